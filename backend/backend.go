@@ -1,12 +1,12 @@
 package backend
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
-	"strings"
 	"sync/atomic"
 	"time"
 
@@ -14,15 +14,19 @@ import (
 )
 
 // Backend represents a single SGLang backend instance.
-// All HTTP traffic is routed through an SSH tunnel — no direct HTTP to instances.
+// HTTP traffic is routed through an SSH tunnel, unless direct HTTP to the
+// instance's public port is enabled with SetDirectHTTP.
 type Backend struct {
 	Instance           *vast.Instance
-	baseURL            string // tunnel URL set by CheckHealth (e.g. "http://127.0.0.1:PORT")
+	baseURL            string // URL set by CheckHealth (e.g. tunnel "http://127.0.0.1:PORT")
 	httpClient         *http.Client
 	tunnel             Tunnel
 	tunnelFactory      TunnelFactory // creates tunnels; nil = use NewSSHTunnel
 	activeReqs         atomic.Int64
+	activeStreams      atomic.Int64 // the streaming subset of activeReqs
 	healthy            atomic.Bool
+	draining           atomic.Bool
+	ejectedUntil       atomic.Int64 // unix ns before which picks skip the backend
 	keyPath            string
 	vastClient         *vast.Client
 	healthInterval     time.Duration // tick interval for StartHealthLoop; 0 = 5s
@@ -30,16 +34,28 @@ type Backend struct {
 	sshBackoffTil      time.Time     // don't retry SSH until this time
 	lastUpgradeAttempt time.Time     // last time we tried to upgrade proxy→direct SSH
 	label              string        // managed label value; empty = labeling disabled
+	engineStats        atomic.Pointer[EngineStats]
+	lastGPUUpdate      atomic.Pointer[GPUUpdate]
+	directHTTP         bool        // try the public HTTP port before the tunnel
+	directHTTPRetryAt  time.Time   // don't probe the public HTTP port until this time
+	httpDirect         atomic.Bool // traffic currently goes to the public HTTP port
+	bootstrap          Bootstrap
+	bootstrapped       bool // bootstrap command has been started
+	bootstrapResult    atomic.Pointer[bootstrapResult]
+	expectedModel      string // health checks fail unless served; "" = any
+	weight             int    // configured round-robin weight; 0 = 1
+	models             atomic.Pointer[[]string]
+	contextLength      atomic.Int64 // max tokens per request; 0 = unknown
+	rtt                atomic.Int64 // latest health check round trip, in ns; 0 = unknown
+	latency            atomic.Int64 // EWMA of proxied request durations, in ns; 0 = none yet
 }
 
 // NewBackend creates a backend for the given instance.
 // label is the vast.ai label to apply when healthy; empty disables labeling.
 func NewBackend(inst *vast.Instance, keyPath string, vastClient *vast.Client, label string) *Backend {
 	return &Backend{
-		Instance: inst,
-		httpClient: &http.Client{
-			Timeout: 5 * time.Minute,
-		},
+		Instance:   inst,
+		httpClient: newHTTPClient(DefaultTimeouts),
 		keyPath:    keyPath,
 		vastClient: vastClient,
 		label:      label,
@@ -66,6 +82,42 @@ func (b *Backend) ActiveRequests() int64 {
 	return b.activeReqs.Load()
 }
 
+// RTT returns the round-trip time of the latest successful health check
+// request, through the tunnel if there is one, or 0 if none succeeded yet.
+func (b *Backend) RTT() time.Duration {
+	return time.Duration(b.rtt.Load())
+}
+
+// SetRTT sets the round-trip time directly (used in tests).
+func (b *Backend) SetRTT(d time.Duration) {
+	b.rtt.Store(int64(d))
+}
+
+// latencyWeight is the weight of each new sample in the latency EWMA; 0.2
+// makes samples older than about ten requests count for little.
+const latencyWeight = 0.2
+
+// ObserveLatency folds the duration of a successfully proxied request into
+// the backend's latency average.
+func (b *Backend) ObserveLatency(d time.Duration) {
+	for {
+		old := b.latency.Load()
+		next := int64(d)
+		if old != 0 {
+			next = old + int64(latencyWeight*float64(int64(d)-old))
+		}
+		if b.latency.CompareAndSwap(old, max(next, 1)) {
+			return
+		}
+	}
+}
+
+// Latency returns the exponentially weighted moving average of proxied
+// request durations, or 0 before any request has completed.
+func (b *Backend) Latency() time.Duration {
+	return time.Duration(b.latency.Load())
+}
+
 // Acquire increments the active request counter.
 func (b *Backend) Acquire() {
 	b.activeReqs.Add(1)
@@ -76,9 +128,65 @@ func (b *Backend) Release() {
 	b.activeReqs.Add(-1)
 }
 
-// IsHealthy returns whether this backend can serve requests.
+// AcquireStream increments the active streaming request counter, which
+// counts a subset of the requests counted by Acquire.
+func (b *Backend) AcquireStream() {
+	b.activeStreams.Add(1)
+}
+
+// TryAcquireStream increments the active streaming request counter unless
+// it has already reached limit (0 means no limit), reporting whether it
+// did. The check and the increment are one atomic step, so concurrent
+// callers can't overshoot the limit.
+func (b *Backend) TryAcquireStream(limit int64) bool {
+	for {
+		n := b.activeStreams.Load()
+		if limit > 0 && n >= limit {
+			return false
+		}
+		if b.activeStreams.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// ReleaseStream decrements the active streaming request counter.
+func (b *Backend) ReleaseStream() {
+	b.activeStreams.Add(-1)
+}
+
+// ActiveStreams returns the number of in-flight streaming requests.
+func (b *Backend) ActiveStreams() int64 {
+	return b.activeStreams.Load()
+}
+
+// IsHealthy returns whether this backend can serve requests. A draining
+// backend is never healthy, so it receives no new requests.
 func (b *Backend) IsHealthy() bool {
-	return b.healthy.Load()
+	return b.healthy.Load() && !b.draining.Load()
+}
+
+// SetDraining marks the backend as draining (e.g. its instance was
+// preempted): in-flight requests continue but no new ones are routed to it.
+func (b *Backend) SetDraining(v bool) {
+	b.draining.Store(v)
+}
+
+// Eject keeps the balancer from picking the backend until the given time,
+// unless no other backend is available. Unlike marking it unhealthy, the
+// health loop doesn't undo it.
+func (b *Backend) Eject(until time.Time) {
+	b.ejectedUntil.Store(until.UnixNano())
+}
+
+// Ejected reports whether the backend is currently ejected.
+func (b *Backend) Ejected() bool {
+	return time.Now().UnixNano() < b.ejectedUntil.Load()
+}
+
+// IsDraining reports whether the backend is draining.
+func (b *Backend) IsDraining() bool {
+	return b.draining.Load()
 }
 
 // SetHealthy sets the healthy state directly (used in tests).
@@ -96,6 +204,12 @@ func (b *Backend) SetTunnel(t Tunnel) {
 	b.tunnel = t
 }
 
+// SetHostKeys verifies the instance's SSH host key against hostKeys,
+// pinning it on first connect. Call before the health loop starts.
+func (b *Backend) SetHostKeys(hostKeys *HostKeys) {
+	b.tunnelFactory = hostKeys.TunnelFactory(b.Instance.ID)
+}
+
 // SetTunnelFactory injects a tunnel factory (used in tests).
 func (b *Backend) SetTunnelFactory(f TunnelFactory) {
 	b.tunnelFactory = f
@@ -109,9 +223,14 @@ func (b *Backend) IsDirect() bool {
 	return b.tunnel.IsDirect()
 }
 
-// CheckHealth verifies connectivity to the backend via the SSH tunnel.
-// All HTTP traffic goes through the tunnel — no direct HTTP to instances.
+// CheckHealth verifies connectivity to the backend via the SSH tunnel, or
+// directly over HTTP if enabled with SetDirectHTTP and reachable.
 func (b *Backend) CheckHealth(ctx context.Context) error {
+	if url, ok := b.checkDirectHTTP(ctx); ok {
+		b.baseURL = url
+		b.healthy.Store(true)
+		return nil
+	}
 	if b.tunnel == nil {
 		b.healthy.Store(false)
 		return fmt.Errorf("no tunnel for instance %d", b.Instance.ID)
@@ -162,6 +281,7 @@ func (b *Backend) EnsureSSH() bool {
 	}
 	b.sshFails = 0
 	b.tunnel = tunnel
+	b.runBootstrap()
 	return true
 }
 
@@ -176,6 +296,7 @@ func (b *Backend) httpHealthCheck(ctx context.Context, baseURL string) error {
 	if b.Instance.JupyterToken != "" {
 		req.Header.Set("Authorization", "Bearer "+b.Instance.JupyterToken)
 	}
+	start := time.Now()
 	resp, err := b.httpClient.Do(req)
 	if err != nil {
 		return err
@@ -185,7 +306,21 @@ func (b *Backend) httpHealthCheck(ctx context.Context, baseURL string) error {
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("health check returned %d", resp.StatusCode)
 	}
-	return nil
+	b.rtt.Store(int64(time.Since(start)))
+	models, contextLength, err := decodeModels(resp.Body)
+	if err != nil {
+		if b.expectedModel != "" {
+			return fmt.Errorf("decode models: %w", err)
+		}
+		return nil
+	}
+	if len(models) > 0 {
+		b.models.Store(&models)
+	}
+	if contextLength > 0 {
+		b.contextLength.Store(contextLength)
+	}
+	return b.checkExpectedModel(models)
 }
 
 // FetchGPUMetrics retrieves GPU metrics via SSH.
@@ -202,7 +337,8 @@ func (b *Backend) FetchGPUMetrics() (*GPUMetrics, error) {
 	return ParseNvidiaSmi(output)
 }
 
-// FetchModel queries the backend's /v1/models endpoint and returns the first model name.
+// FetchModel queries the backend's /v1/models endpoint, records every
+// model served (see Models) and returns the first model name.
 func (b *Backend) FetchModel(ctx context.Context) (string, error) {
 	if b.baseURL == "" {
 		return "", fmt.Errorf("no base URL")
@@ -224,25 +360,20 @@ func (b *Backend) FetchModel(ctx context.Context) (string, error) {
 	}
 	defer resp.Body.Close()
 
-	// Parse just enough to get the model ID.
-	var result struct {
-		Data []struct {
-			ID string `json:"id"`
-		} `json:"data"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	models, _, err := decodeModels(resp.Body)
+	if err != nil {
 		return "", err
 	}
-	if len(result.Data) > 0 {
-		return result.Data[0].ID, nil
+	if len(models) > 0 {
+		b.models.Store(&models)
+		return models[0], nil
 	}
 	return "", fmt.Errorf("no models returned")
 }
 
 // StartHealthLoop periodically checks health and fetches GPU metrics.
 // Call in a goroutine.
-func (b *Backend) StartHealthLoop(ctx context.Context, watcher *vast.Watcher, gpuCh chan<- GPUUpdate) {
+func (b *Backend) StartHealthLoop(ctx context.Context, watcher vast.Discovery, gpuCh chan<- GPUUpdate) {
 	interval := b.healthInterval
 	if interval == 0 {
 		interval = 5 * time.Second
@@ -292,18 +423,26 @@ func (b *Backend) StartHealthLoop(ctx context.Context, watcher *vast.Watcher, gp
 				}
 			}
 
+			// Scrape scheduler load from engines that report it.
+			b.updateEngineStats(ctx)
+
 			// Attempt to upgrade proxy→direct SSH every 30s.
 			b.tryUpgradeToDirect(ctx)
 
 			// Fetch GPU metrics via SSH.
 			if b.tunnel != nil {
 				if metrics, err := b.FetchGPUMetrics(); err == nil {
-					select {
-					case gpuCh <- GPUUpdate{
+					update := GPUUpdate{
 						InstanceID: b.Instance.ID,
 						GPUs:       metrics.GPUs,
 						IsDirect:   b.tunnel.IsDirect(),
-					}:
+						Engine:     b.EngineStats(),
+						Active:     b.ActiveRequests(),
+						RTT:        b.RTT(),
+					}
+					b.lastGPUUpdate.Store(&update)
+					select {
+					case gpuCh <- update:
 					default:
 					}
 				} else {
@@ -367,11 +506,14 @@ func (b *Backend) ApplyLabel(ctx context.Context) {
 	go b.setLabel(ctx, b.label)
 }
 
-// setLabel sets the instance label via the vast.ai API (best-effort, logged).
+// setLabel sets the instance label via the vast.ai API (best-effort,
+// logged), keeping any routing weight the current label carries.
 func (b *Backend) setLabel(ctx context.Context, label string) {
 	if b.label == "" || b.vastClient == nil {
 		return
 	}
+	_, weight := vast.LabelWeight(b.Instance.Label)
+	label = vast.WithLabelWeight(label, weight)
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 	if err := b.vastClient.SetLabel(ctx, b.Instance.ID, label); err != nil {
@@ -388,7 +530,7 @@ func (b *Backend) clearLabelIfOurs(ctx context.Context) {
 	if b.label == "" || b.vastClient == nil {
 		return
 	}
-	if b.Instance.Label != b.label {
+	if b.Instance.BaseLabel() != b.label {
 		return
 	}
 	b.setLabel(ctx, "")
@@ -413,6 +555,12 @@ func (b *Backend) Close() {
 // inference on this backend. Only SGLang supports a server-side abort endpoint;
 // for other engines this is a no-op.
 func (b *Backend) AbortAll(ctx context.Context) error {
+	return b.Abort(ctx, "")
+}
+
+// Abort aborts the in-flight request with the given rid, as AbortAll does
+// for every request.
+func (b *Backend) Abort(ctx context.Context, rid string) error {
 	if !b.Instance.Engine.SupportsAbort() {
 		return nil
 	}
@@ -423,8 +571,8 @@ func (b *Backend) AbortAll(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "POST", b.baseURL+"/abort_request",
-		strings.NewReader(`{"rid":""}`))
+	body, _ := json.Marshal(map[string]string{"rid": rid})
+	req, err := http.NewRequestWithContext(ctx, "POST", b.baseURL+"/abort_request", bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
@@ -446,6 +594,20 @@ func (b *Backend) AbortAll(ctx context.Context) error {
 // GPUUpdate is sent from a backend's health loop to the TUI.
 type GPUUpdate struct {
 	InstanceID int
-	GPUs       []GPUMetric // per-GPU utilization and temperature
-	IsDirect   bool        // true if SSH tunnel is direct (not proxied)
+	GPUs       []GPUMetric   // per-GPU utilization and temperature
+	IsDirect   bool          // true if SSH tunnel is direct (not proxied)
+	Engine     *EngineStats  // scheduler load from the engine; nil if unavailable
+	Active     int64         // requests in flight through the proxy
+	RTT        time.Duration // latest health check round trip; 0 if unknown
+}
+
+// LastGPUUpdate returns the most recent update sent by the health loop, or
+// nil if GPU metrics haven't been fetched yet.
+func (b *Backend) LastGPUUpdate() *GPUUpdate {
+	return b.lastGPUUpdate.Load()
+}
+
+// SetLastGPUUpdate sets the last GPU update directly (used in tests).
+func (b *Backend) SetLastGPUUpdate(u *GPUUpdate) {
+	b.lastGPUUpdate.Store(u)
 }
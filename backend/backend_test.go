@@ -90,6 +90,9 @@ func TestCheckHealthViaTunnel(t *testing.T) {
 	if be.BaseURL() != want {
 		t.Errorf("BaseURL() = %q, want %q", be.BaseURL(), want)
 	}
+	if be.RTT() <= 0 {
+		t.Errorf("RTT() = %v, want the health check's round trip", be.RTT())
+	}
 }
 
 func TestCheckHealthTunnelFailure(t *testing.T) {
@@ -286,6 +289,45 @@ func TestAcquireReleaseConcurrent(t *testing.T) {
 	}
 }
 
+func TestAcquireReleaseStream(t *testing.T) {
+	inst := testInstance(1)
+	be := NewBackend(inst, "", nil, "")
+
+	be.AcquireStream()
+	be.AcquireStream()
+	be.ReleaseStream()
+	if be.ActiveStreams() != 1 {
+		t.Errorf("after 2 acquires and 1 release: %d", be.ActiveStreams())
+	}
+	if be.ActiveRequests() != 0 {
+		t.Errorf("streams counted as active requests: %d", be.ActiveRequests())
+	}
+}
+
+func TestTryAcquireStreamConcurrent(t *testing.T) {
+	be := NewBackend(testInstance(1), "", nil, "")
+
+	var acquired atomic.Int64
+	var wg sync.WaitGroup
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if be.TryAcquireStream(10) {
+				acquired.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if acquired.Load() != 10 || be.ActiveStreams() != 10 {
+		t.Errorf("acquired %d streams (%d active), want 10", acquired.Load(), be.ActiveStreams())
+	}
+	if !be.TryAcquireStream(0) {
+		t.Error("TryAcquireStream(0) should not limit")
+	}
+}
+
 // --- SetHealthy / Close tests ---
 
 func TestSetHealthy(t *testing.T) {
@@ -465,6 +507,9 @@ func TestStartHealthLoopGPUMetrics(t *testing.T) {
 	be.SetTunnel(mock)
 	be.SetTunnelFactory(mockTunnelFactory(mock, nil))
 
+	be.Acquire()
+	be.Acquire()
+
 	gpuCh := make(chan GPUUpdate, 10)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -477,6 +522,9 @@ func TestStartHealthLoopGPUMetrics(t *testing.T) {
 		if update.InstanceID != 1 {
 			t.Errorf("InstanceID = %d, want 1", update.InstanceID)
 		}
+		if update.Active != 2 {
+			t.Errorf("Active = %d, want 2", update.Active)
+		}
 		if len(update.GPUs) != 1 {
 			t.Fatalf("GPUs len = %d, want 1", len(update.GPUs))
 		}
@@ -649,6 +697,27 @@ func TestAbortAll(t *testing.T) {
 	}
 }
 
+func TestAbort(t *testing.T) {
+	var gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+	}))
+	defer srv.Close()
+
+	inst := testInstance(1)
+	inst.Engine = vast.EngineSGLang
+	be := NewBackend(inst, "", nil, "")
+	be.baseURL = srv.URL
+
+	if err := be.Abort(context.Background(), "req-1"); err != nil {
+		t.Fatalf("Abort() error: %v", err)
+	}
+	if gotBody != `{"rid":"req-1"}` {
+		t.Errorf("body = %q, want {\"rid\":\"req-1\"}", gotBody)
+	}
+}
+
 func TestAbortAllHTTPError(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -992,3 +1061,24 @@ func TestSetLabelAPIFailureDoesNotAffectHealth(t *testing.T) {
 		}
 	}
 }
+
+func TestObserveLatency(t *testing.T) {
+	be := NewBackend(testInstance(1), "", nil, "")
+	if be.Latency() != 0 {
+		t.Errorf("Latency() = %v before any request, want 0", be.Latency())
+	}
+	be.ObserveLatency(time.Second)
+	if be.Latency() != time.Second {
+		t.Errorf("Latency() = %v after first sample, want 1s", be.Latency())
+	}
+	be.ObserveLatency(2 * time.Second)
+	if got, want := be.Latency(), 1200*time.Millisecond; got != want {
+		t.Errorf("Latency() = %v, want %v", got, want)
+	}
+	for range 50 {
+		be.ObserveLatency(3 * time.Second)
+	}
+	if got := be.Latency(); got < 2990*time.Millisecond || got > 3*time.Second {
+		t.Errorf("Latency() = %v after a run of 3s samples, want about 3s", got)
+	}
+}
@@ -0,0 +1,85 @@
+package backend
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Bootstrap is a shell command run over SSH on each newly discovered
+// instance once its first tunnel is up, e.g. to pull a LoRA adapter or
+// restart the server with different flags.
+type Bootstrap struct {
+	Command string
+	Timeout time.Duration // 0 = no limit
+}
+
+// bootstrapResult is the outcome of running the bootstrap command.
+type bootstrapResult struct {
+	output string
+	err    error
+	took   time.Duration
+}
+
+// SetBootstrap sets the command to run when the backend's first tunnel is
+// created. Call before the health loop starts.
+func (b *Backend) SetBootstrap(bs Bootstrap) {
+	b.bootstrap = bs
+}
+
+// runBootstrap runs the bootstrap command, once, over the current tunnel.
+func (b *Backend) runBootstrap() {
+	if b.bootstrap.Command == "" || b.bootstrapped {
+		return
+	}
+	b.bootstrapped = true
+	log.Printf("backend %d: running bootstrap command", b.Instance.ID)
+
+	start := time.Now()
+	done := make(chan bootstrapResult, 1)
+	tunnel := b.tunnel
+	go func() {
+		out, err := tunnel.RunCommand(b.bootstrap.Command)
+		done <- bootstrapResult{output: out, err: err}
+	}()
+	var timeout <-chan time.Time
+	if b.bootstrap.Timeout > 0 {
+		timer := time.NewTimer(b.bootstrap.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var res bootstrapResult
+	select {
+	case res = <-done:
+	case <-timeout:
+		res.err = fmt.Errorf("timed out after %s", b.bootstrap.Timeout)
+	}
+	res.took = time.Since(start)
+	if res.err != nil {
+		log.Printf("backend %d: bootstrap failed after %s: %v", b.Instance.ID, res.took.Round(time.Millisecond), res.err)
+	} else {
+		log.Printf("backend %d: bootstrap finished in %s", b.Instance.ID, res.took.Round(time.Millisecond))
+	}
+	b.bootstrapResult.Store(&res)
+}
+
+// BootstrapLog returns the bootstrap command's output and result as log
+// lines for the instance log view, or nil if it hasn't run.
+func (b *Backend) BootstrapLog() []string {
+	res := b.bootstrapResult.Load()
+	if res == nil {
+		return nil
+	}
+	var lines []string
+	if out := strings.TrimRight(res.output, "\n"); out != "" {
+		for _, line := range strings.Split(out, "\n") {
+			lines = append(lines, "[bootstrap] "+line)
+		}
+	}
+	status := fmt.Sprintf("[bootstrap] finished in %s", res.took.Round(time.Millisecond))
+	if res.err != nil {
+		status = fmt.Sprintf("[bootstrap] failed after %s: %v", res.took.Round(time.Millisecond), res.err)
+	}
+	return append(lines, status)
+}
@@ -0,0 +1,88 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingTunnel records how many commands it was asked to run.
+type countingTunnel struct {
+	mockTunnel
+	runs  int
+	block chan struct{}
+}
+
+func (c *countingTunnel) RunCommand(cmd string) (string, error) {
+	c.runs++
+	if c.block != nil {
+		<-c.block
+	}
+	return c.mockTunnel.RunCommand(cmd)
+}
+
+func TestBootstrapRunsOnceOnFirstTunnel(t *testing.T) {
+	be := NewBackend(testInstance(1), "", nil, "")
+	be.SetBootstrap(Bootstrap{Command: "pull-lora.sh"})
+	tunnel := &countingTunnel{mockTunnel: mockTunnel{localAddr: "127.0.0.1:55555", cmdOutput: "pulling\ndone\n"}}
+	be.SetTunnelFactory(mockTunnelFactory(tunnel, nil))
+
+	if be.BootstrapLog() != nil {
+		t.Fatal("BootstrapLog() before the tunnel exists should be nil")
+	}
+	if !be.EnsureSSH() {
+		t.Fatal("EnsureSSH() = false, want true")
+	}
+	logs := be.BootstrapLog()
+	if len(logs) != 3 || logs[0] != "[bootstrap] pulling" || logs[1] != "[bootstrap] done" ||
+		!strings.HasPrefix(logs[2], "[bootstrap] finished in ") {
+		t.Errorf("BootstrapLog() = %q", logs)
+	}
+
+	// A replacement tunnel must not rerun the command.
+	be.tunnel = nil
+	be.EnsureSSH()
+	if tunnel.runs != 1 {
+		t.Errorf("bootstrap ran %d times, want 1", tunnel.runs)
+	}
+}
+
+func TestBootstrapFailure(t *testing.T) {
+	be := NewBackend(testInstance(1), "", nil, "")
+	be.SetBootstrap(Bootstrap{Command: "false"})
+	tunnel := &mockTunnel{localAddr: "127.0.0.1:55555", cmdErr: fmt.Errorf("exit status 1")}
+	be.SetTunnelFactory(mockTunnelFactory(tunnel, nil))
+
+	be.EnsureSSH()
+	logs := be.BootstrapLog()
+	if len(logs) != 1 || !strings.Contains(logs[0], "failed") || !strings.Contains(logs[0], "exit status 1") {
+		t.Errorf("BootstrapLog() = %q", logs)
+	}
+}
+
+func TestBootstrapTimeout(t *testing.T) {
+	be := NewBackend(testInstance(1), "", nil, "")
+	be.SetBootstrap(Bootstrap{Command: "sleep 999", Timeout: 10 * time.Millisecond})
+	block := make(chan struct{})
+	defer close(block)
+	tunnel := &countingTunnel{mockTunnel: mockTunnel{localAddr: "127.0.0.1:55555"}, block: block}
+	be.SetTunnelFactory(mockTunnelFactory(tunnel, nil))
+
+	be.EnsureSSH()
+	logs := be.BootstrapLog()
+	if len(logs) != 1 || !strings.Contains(logs[0], "timed out") {
+		t.Errorf("BootstrapLog() = %q", logs)
+	}
+}
+
+func TestNoBootstrapCommand(t *testing.T) {
+	be := NewBackend(testInstance(1), "", nil, "")
+	tunnel := &countingTunnel{mockTunnel: mockTunnel{localAddr: "127.0.0.1:55555"}}
+	be.SetTunnelFactory(mockTunnelFactory(tunnel, nil))
+
+	be.EnsureSSH()
+	if tunnel.runs != 0 || be.BootstrapLog() != nil {
+		t.Errorf("runs = %d, BootstrapLog() = %q; want nothing run", tunnel.runs, be.BootstrapLog())
+	}
+}
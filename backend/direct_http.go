@@ -0,0 +1,54 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// directHTTPRetry is how long to wait before probing an instance's public
+// HTTP port again after it failed.
+const directHTTPRetry = time.Minute
+
+// SetDirectHTTP enables serving traffic straight to the instance's public
+// HTTP port (the host port mapped to the engine's container port) when it
+// is reachable and accepts the instance token, skipping the SSH hop. The
+// tunnel is used otherwise, and still carries GPU metrics. Traffic on the
+// direct path, including the token, is unencrypted. Call before the health
+// loop starts.
+func (b *Backend) SetDirectHTTP(v bool) {
+	b.directHTTP = v
+}
+
+// ServesDirectHTTP reports whether traffic currently goes to the instance's
+// public HTTP port rather than through the SSH tunnel.
+func (b *Backend) ServesDirectHTTP() bool {
+	return b.httpDirect.Load()
+}
+
+// checkDirectHTTP probes the instance's public HTTP port, if direct mode is
+// on, and returns its URL if the health check passes there.
+func (b *Backend) checkDirectHTTP(ctx context.Context) (string, bool) {
+	if !b.directHTTP || time.Now().Before(b.directHTTPRetryAt) {
+		return "", false
+	}
+	port := b.Instance.ResolveDirectHTTPPort()
+	if b.Instance.PublicIPAddr == "" || port == 0 {
+		return "", false
+	}
+	url := fmt.Sprintf("http://%s:%d", b.Instance.PublicIPAddr, port)
+	if err := b.httpHealthCheck(ctx, url); err != nil {
+		if b.httpDirect.Load() {
+			log.Printf("backend %d: direct HTTP %s failed, falling back to tunnel: %v", b.Instance.ID, url, err)
+		}
+		b.httpDirect.Store(false)
+		b.directHTTPRetryAt = time.Now().Add(directHTTPRetry)
+		return "", false
+	}
+	if !b.httpDirect.Load() {
+		log.Printf("backend %d: serving direct HTTP via %s", b.Instance.ID, url)
+	}
+	b.httpDirect.Store(true)
+	return url, true
+}
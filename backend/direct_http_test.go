@@ -0,0 +1,78 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/vast"
+)
+
+// directInstance returns an instance whose container port 8000 is published
+// at srv's address.
+func directInstance(t *testing.T, srv *httptest.Server) *vast.Instance {
+	t.Helper()
+	u, _ := url.Parse(srv.URL)
+	inst := testInstance(1)
+	inst.PublicIPAddr = u.Hostname()
+	inst.ContainerPort = 8000
+	inst.Ports = map[string][]vast.PortMapping{"8000/tcp": {{HostIP: "0.0.0.0", HostPort: u.Port()}}}
+	return inst
+}
+
+func authServer(token string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+}
+
+func TestCheckHealthDirectHTTP(t *testing.T) {
+	srv := authServer("test-token")
+	defer srv.Close()
+
+	be := NewBackend(directInstance(t, srv), "", nil, "")
+	be.SetDirectHTTP(true)
+	// No tunnel at all: direct HTTP alone makes the backend healthy.
+	if err := be.CheckHealth(context.Background()); err != nil {
+		t.Fatalf("CheckHealth: %v", err)
+	}
+	if be.BaseURL() != srv.URL || !be.IsHealthy() || !be.ServesDirectHTTP() {
+		t.Errorf("BaseURL = %q, healthy = %v, direct = %v", be.BaseURL(), be.IsHealthy(), be.ServesDirectHTTP())
+	}
+}
+
+func TestCheckHealthDirectHTTPFallback(t *testing.T) {
+	// The public port answers, but rejects the instance token.
+	public := authServer("other-token")
+	defer public.Close()
+	tunnelSrv := authServer("test-token")
+	defer tunnelSrv.Close()
+
+	be := NewBackend(directInstance(t, public), "", nil, "")
+	be.SetDirectHTTP(true)
+	be.SetTunnel(&mockTunnel{localAddr: tunnelSrv.Listener.Addr().String()})
+	if err := be.CheckHealth(context.Background()); err != nil {
+		t.Fatalf("CheckHealth: %v", err)
+	}
+	if be.BaseURL() != tunnelSrv.URL || be.ServesDirectHTTP() {
+		t.Errorf("BaseURL = %q, direct = %v, want tunnel", be.BaseURL(), be.ServesDirectHTTP())
+	}
+	if !be.directHTTPRetryAt.After(time.Now()) {
+		t.Error("failed direct probe not backed off")
+	}
+}
+
+func TestCheckHealthDirectHTTPDisabled(t *testing.T) {
+	srv := authServer("test-token")
+	defer srv.Close()
+
+	be := NewBackend(directInstance(t, srv), "", nil, "")
+	if err := be.CheckHealth(context.Background()); err == nil {
+		t.Error("CheckHealth without a tunnel succeeded with direct HTTP off")
+	}
+}
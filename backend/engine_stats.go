@@ -0,0 +1,231 @@
+package backend
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shutej/vastproxy/vast"
+)
+
+// EngineStats is scheduler load reported by the inference engine itself,
+// used for routing and display.
+type EngineStats struct {
+	Running      int       // requests currently being decoded
+	Waiting      int       // requests queued for admission
+	CacheHitRate float64   // prefix cache hit rate, 0–1
+	KVCacheUsage float64   // fraction of KV cache blocks in use, 0–1 (vLLM only)
+	UpdatedAt    time.Time // when the stats were scraped
+}
+
+// EngineStats returns the most recently scraped engine stats, or nil if
+// none have been collected (e.g. the engine doesn't expose them).
+func (b *Backend) EngineStats() *EngineStats {
+	return b.engineStats.Load()
+}
+
+// SetEngineStats sets the engine stats directly (used in tests).
+func (b *Backend) SetEngineStats(s *EngineStats) {
+	b.engineStats.Store(s)
+}
+
+// FetchEngineStats scrapes load stats from the engine through the tunnel
+// and stores them on the backend. SGLang and vLLM are supported; other
+// engines return an error.
+func (b *Backend) FetchEngineStats(ctx context.Context) (*EngineStats, error) {
+	if b.baseURL == "" {
+		return nil, fmt.Errorf("no base URL")
+	}
+	var (
+		stats *EngineStats
+		err   error
+	)
+	switch b.Instance.Engine {
+	case vast.EngineSGLang:
+		stats, err = b.fetchSGLangServerInfo(ctx)
+	case vast.EngineVLLM:
+		stats, err = b.fetchVLLMMetrics(ctx)
+	default:
+		return nil, fmt.Errorf("engine %s does not report stats", b.Instance.Engine)
+	}
+	if err != nil {
+		return nil, err
+	}
+	stats.UpdatedAt = time.Now()
+	b.engineStats.Store(stats)
+	return stats, nil
+}
+
+// updateEngineStats refreshes the engine stats from the health loop. On
+// failure the stale stats are dropped so routing doesn't act on them.
+func (b *Backend) updateEngineStats(ctx context.Context) {
+	if b.Instance.Engine != vast.EngineSGLang && b.Instance.Engine != vast.EngineVLLM {
+		return
+	}
+	if _, err := b.FetchEngineStats(ctx); err != nil {
+		if b.engineStats.Swap(nil) != nil {
+			log.Printf("backend %d: engine stats unavailable: %v", b.Instance.ID, err)
+		}
+	}
+}
+
+// sglangServerInfo is the part of SGLang's /get_server_info response we
+// use. internal_states has one entry per data-parallel rank.
+type sglangServerInfo struct {
+	ContextLength  *int64 `json:"context_length"` // server arg; null unless set
+	InternalStates []struct {
+		NumRunningReqs *int     `json:"num_running_reqs"`
+		NumWaitingReqs *int     `json:"num_waiting_reqs"`
+		NumQueueReqs   *int     `json:"num_queue_reqs"`
+		CacheHitRate   *float64 `json:"cache_hit_rate"`
+	} `json:"internal_states"`
+}
+
+// fetchSGLangServerInfo reads running/waiting request counts and the cache
+// hit rate from SGLang's /get_server_info, summing counts across ranks and
+// averaging the hit rate. A context length set in the server args is
+// recorded too.
+func (b *Backend) fetchSGLangServerInfo(ctx context.Context) (*EngineStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", b.baseURL+"/get_server_info", nil)
+	if err != nil {
+		return nil, err
+	}
+	if b.Instance.JupyterToken != "" {
+		req.Header.Set("Authorization", "Bearer "+b.Instance.JupyterToken)
+	}
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get_server_info returned %d", resp.StatusCode)
+	}
+
+	var info sglangServerInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	if info.ContextLength != nil && *info.ContextLength > 0 {
+		b.contextLength.Store(*info.ContextLength)
+	}
+	stats := &EngineStats{}
+	rates := 0
+	for _, st := range info.InternalStates {
+		if st.NumRunningReqs != nil {
+			stats.Running += *st.NumRunningReqs
+		}
+		if st.NumWaitingReqs != nil {
+			stats.Waiting += *st.NumWaitingReqs
+		} else if st.NumQueueReqs != nil {
+			stats.Waiting += *st.NumQueueReqs
+		}
+		if st.CacheHitRate != nil {
+			stats.CacheHitRate += *st.CacheHitRate
+			rates++
+		}
+	}
+	if rates > 0 {
+		stats.CacheHitRate /= float64(rates)
+	}
+	return stats, nil
+}
+
+// fetchVLLMMetrics reads queue depth, running sequences and cache usage from
+// vLLM's Prometheus /metrics endpoint.
+func (b *Backend) fetchVLLMMetrics(ctx context.Context) (*EngineStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", b.baseURL+"/metrics", nil)
+	if err != nil {
+		return nil, err
+	}
+	if b.Instance.JupyterToken != "" {
+		req.Header.Set("Authorization", "Bearer "+b.Instance.JupyterToken)
+	}
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metrics returned %d", resp.StatusCode)
+	}
+	return ParseVLLMMetrics(resp.Body)
+}
+
+// ParseVLLMMetrics extracts engine stats from vLLM's Prometheus text
+// exposition. Samples of the same metric (e.g. one per served model) are
+// summed; usage and hit-rate gauges are averaged. Both the current
+// (kv_cache_usage_perc, prefix_cache_* counters) and older
+// (gpu_cache_usage_perc, gpu_prefix_cache_hit_rate) metric names are read.
+func ParseVLLMMetrics(r io.Reader) (*EngineStats, error) {
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		name, rest, ok := strings.Cut(line, " ")
+		if i := strings.IndexByte(line, '{'); i >= 0 {
+			// Labels may contain spaces; the value follows the closing brace.
+			j := strings.LastIndexByte(line, '}')
+			if j < i {
+				continue
+			}
+			name, rest, ok = line[:i], line[j+1:], true
+		}
+		if !ok || !strings.HasPrefix(name, "vllm:") {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		sums[name] += v
+		counts[name]++
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(sums) == 0 {
+		return nil, fmt.Errorf("no vllm metrics found")
+	}
+
+	avg := func(names ...string) float64 {
+		for _, n := range names {
+			if c := counts[n]; c > 0 {
+				return sums[n] / float64(c)
+			}
+		}
+		return 0
+	}
+	stats := &EngineStats{
+		Running:      int(sums["vllm:num_requests_running"]),
+		Waiting:      int(sums["vllm:num_requests_waiting"]),
+		KVCacheUsage: avg("vllm:kv_cache_usage_perc", "vllm:gpu_cache_usage_perc"),
+		CacheHitRate: avg("vllm:gpu_prefix_cache_hit_rate"),
+	}
+	if q := sums["vllm:prefix_cache_queries_total"]; q > 0 {
+		stats.CacheHitRate = sums["vllm:prefix_cache_hits_total"] / q
+	}
+	return stats, nil
+}
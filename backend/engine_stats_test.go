@@ -0,0 +1,146 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shutej/vastproxy/vast"
+)
+
+func TestFetchEngineStatsSGLang(t *testing.T) {
+	var gotPath, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"model_path":"m","context_length":65536,"internal_states":[
+			{"num_running_reqs":3,"num_waiting_reqs":1,"cache_hit_rate":0.5},
+			{"num_running_reqs":2,"num_queue_reqs":4,"cache_hit_rate":0.3}]}`))
+	}))
+	defer srv.Close()
+
+	inst := testInstance(1)
+	inst.Engine = vast.EngineSGLang
+	be := NewBackend(inst, "", nil, "")
+	be.baseURL = srv.URL
+
+	stats, err := be.FetchEngineStats(context.Background())
+	if err != nil {
+		t.Fatalf("FetchEngineStats() error: %v", err)
+	}
+	if gotPath != "/get_server_info" || gotAuth != "Bearer test-token" {
+		t.Errorf("request = %s auth=%q", gotPath, gotAuth)
+	}
+	if stats.Running != 5 || stats.Waiting != 5 {
+		t.Errorf("running=%d waiting=%d, want 5 5", stats.Running, stats.Waiting)
+	}
+	if stats.CacheHitRate < 0.399 || stats.CacheHitRate > 0.401 {
+		t.Errorf("cache hit rate = %v, want 0.4", stats.CacheHitRate)
+	}
+	if be.EngineStats() != stats {
+		t.Error("stats should be stored on the backend")
+	}
+	if be.ContextLength() != 65536 {
+		t.Errorf("ContextLength() = %d, want 65536 from server args", be.ContextLength())
+	}
+}
+
+func TestFetchEngineStatsUnsupportedEngine(t *testing.T) {
+	be := NewBackend(testInstance(1), "", nil, "")
+	be.baseURL = "http://127.0.0.1:1"
+	if _, err := be.FetchEngineStats(context.Background()); err == nil {
+		t.Error("expected error for unknown engine")
+	}
+}
+
+func TestUpdateEngineStatsDropsStaleOnError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	inst := testInstance(1)
+	inst.Engine = vast.EngineSGLang
+	be := NewBackend(inst, "", nil, "")
+	be.baseURL = srv.URL
+	be.SetEngineStats(&EngineStats{Running: 1})
+
+	be.updateEngineStats(context.Background())
+	if be.EngineStats() != nil {
+		t.Error("stale stats should be dropped after a failed scrape")
+	}
+}
+
+const vllmMetrics = `# HELP vllm:num_requests_running Number of requests currently running on GPU.
+# TYPE vllm:num_requests_running gauge
+vllm:num_requests_running{engine="0",model_name="llama"} 4.0
+vllm:num_requests_running{engine="1",model_name="llama"} 2.0
+vllm:num_requests_waiting{engine="0",model_name="llama"} 3.0
+vllm:kv_cache_usage_perc{engine="0",model_name="llama"} 0.8
+vllm:kv_cache_usage_perc{engine="1",model_name="llama"} 0.6
+vllm:prefix_cache_queries_total{engine="0",model_name="llama"} 200.0
+vllm:prefix_cache_hits_total{engine="0",model_name="llama"} 50.0
+process_cpu_seconds_total 12.5
+`
+
+func TestParseVLLMMetrics(t *testing.T) {
+	stats, err := ParseVLLMMetrics(strings.NewReader(vllmMetrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Running != 6 || stats.Waiting != 3 {
+		t.Errorf("running=%d waiting=%d, want 6 3", stats.Running, stats.Waiting)
+	}
+	if stats.KVCacheUsage < 0.699 || stats.KVCacheUsage > 0.701 {
+		t.Errorf("KV cache usage = %v, want 0.7", stats.KVCacheUsage)
+	}
+	if stats.CacheHitRate != 0.25 {
+		t.Errorf("cache hit rate = %v, want 0.25", stats.CacheHitRate)
+	}
+}
+
+func TestParseVLLMMetricsLegacyNames(t *testing.T) {
+	stats, err := ParseVLLMMetrics(strings.NewReader(`vllm:num_requests_running{model_name="m"} 1
+vllm:gpu_cache_usage_perc{model_name="m"} 0.5
+vllm:gpu_prefix_cache_hit_rate{model_name="m"} 0.9
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Running != 1 || stats.KVCacheUsage != 0.5 || stats.CacheHitRate != 0.9 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestParseVLLMMetricsNone(t *testing.T) {
+	if _, err := ParseVLLMMetrics(strings.NewReader("process_cpu_seconds_total 1\n")); err == nil {
+		t.Error("expected error when no vllm metrics are present")
+	}
+}
+
+func TestFetchEngineStatsVLLM(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Write([]byte(vllmMetrics))
+	}))
+	defer srv.Close()
+
+	inst := testInstance(1)
+	inst.Engine = vast.EngineVLLM
+	be := NewBackend(inst, "", nil, "")
+	be.baseURL = srv.URL
+
+	stats, err := be.FetchEngineStats(context.Background())
+	if err != nil {
+		t.Fatalf("FetchEngineStats() error: %v", err)
+	}
+	if gotPath != "/metrics" {
+		t.Errorf("path = %q, want /metrics", gotPath)
+	}
+	if stats.Running != 6 || be.EngineStats() != stats {
+		t.Errorf("stats = %+v", stats)
+	}
+}
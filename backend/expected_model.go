@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ExpectedModels configures the model each backend must serve, so an
+// instance launched from a misconfigured template is marked unhealthy
+// instead of silently serving the wrong model.
+type ExpectedModels struct {
+	Default string            // for instances whose label isn't in ByLabel; "" = any
+	ByLabel map[string]string // instance label -> model
+}
+
+// For returns the model expected on an instance with the given label, or
+// "" if any model is acceptable.
+func (e ExpectedModels) For(label string) string {
+	if model, ok := e.ByLabel[label]; ok {
+		return model
+	}
+	return e.Default
+}
+
+// ParseExpectedModels parses per-label expected models such as
+// "chat=meta-llama/Llama-3-8B,code=Qwen/Qwen2.5-Coder-7B".
+func ParseExpectedModels(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		label, model, ok := strings.Cut(entry, "=")
+		label, model = strings.TrimSpace(label), strings.TrimSpace(model)
+		if !ok || label == "" || model == "" {
+			return nil, fmt.Errorf("invalid entry %q, want label=model", entry)
+		}
+		out[label] = model
+	}
+	return out, nil
+}
+
+// SetExpectedModel makes health checks fail unless /v1/models lists model.
+// An empty model accepts any. Call before the health loop starts.
+func (b *Backend) SetExpectedModel(model string) {
+	b.expectedModel = model
+}
+
+// checkExpectedModel returns an error unless served lists the expected
+// model, if one is set.
+func (b *Backend) checkExpectedModel(served []string) error {
+	if b.expectedModel != "" && !slices.Contains(served, b.expectedModel) {
+		return fmt.Errorf("expected model %q not served (serving %q)", b.expectedModel, served)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func modelsServer(t *testing.T, models ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := []map[string]string{}
+		for _, m := range models {
+			data = append(data, map[string]string{"id": m})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCheckHealthExpectedModel(t *testing.T) {
+	srv := modelsServer(t, "meta-llama/Llama-3-8B", "lora-a")
+
+	be := NewBackend(testInstance(1), "", nil, "")
+	be.SetTunnel(&mockTunnel{localAddr: srv.Listener.Addr().String()})
+
+	be.SetExpectedModel("lora-a")
+	if err := be.CheckHealth(context.Background()); err != nil {
+		t.Fatalf("CheckHealth() with served model: %v", err)
+	}
+
+	be.SetExpectedModel("Qwen/Qwen2.5-7B")
+	err := be.CheckHealth(context.Background())
+	if err == nil || !strings.Contains(err.Error(), `expected model "Qwen/Qwen2.5-7B" not served`) {
+		t.Fatalf("CheckHealth() with wrong model: err = %v", err)
+	}
+	if be.IsHealthy() {
+		t.Error("backend serving the wrong model should be unhealthy")
+	}
+}
+
+func TestExpectedModelsFor(t *testing.T) {
+	e := ExpectedModels{Default: "base", ByLabel: map[string]string{"code": "coder"}}
+	if got := e.For("code"); got != "coder" {
+		t.Errorf("For(code) = %q, want coder", got)
+	}
+	if got := e.For("other"); got != "base" {
+		t.Errorf("For(other) = %q, want base", got)
+	}
+}
+
+func TestParseExpectedModels(t *testing.T) {
+	got, err := ParseExpectedModels(" chat=meta-llama/Llama-3-8B , code=Qwen/Qwen2.5-Coder-7B,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["chat"] != "meta-llama/Llama-3-8B" || got["code"] != "Qwen/Qwen2.5-Coder-7B" {
+		t.Errorf("got %v", got)
+	}
+	for _, bad := range []string{"chat", "=model", "chat="} {
+		if _, err := ParseExpectedModels(bad); err == nil {
+			t.Errorf("ParseExpectedModels(%q): expected error", bad)
+		}
+	}
+}
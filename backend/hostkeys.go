@@ -0,0 +1,101 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HostKeys pins each instance's SSH host key on its first successful
+// connect (trust on first use) and refuses later connections presenting a
+// different key. That catches a man in the middle appearing after the
+// first connect, without managing known_hosts for ephemeral instances.
+type HostKeys struct {
+	mu   sync.Mutex
+	path string         // "" = in memory only
+	keys map[int]string // instance ID -> host key, authorized_keys format
+}
+
+// NewHostKeys returns a host key store persisted to path, loading the keys
+// pinned by earlier runs. An empty path keeps keys in memory only.
+func NewHostKeys(path string) (*HostKeys, error) {
+	h := &HostKeys{path: path, keys: make(map[int]string)}
+	if path == "" {
+		return h, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &h.keys); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return h, nil
+}
+
+// check returns an error if key differs from the key pinned for instanceID.
+func (h *HostKeys) check(instanceID int, key ssh.PublicKey) error {
+	h.mu.Lock()
+	pinned, ok := h.keys[instanceID]
+	h.mu.Unlock()
+	if !ok || pinned == marshalHostKey(key) {
+		return nil
+	}
+	want, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pinned))
+	if err != nil {
+		return fmt.Errorf("host key for instance %d changed", instanceID)
+	}
+	return fmt.Errorf("host key for instance %d changed: pinned %s, got %s",
+		instanceID, ssh.FingerprintSHA256(want), ssh.FingerprintSHA256(key))
+}
+
+// pin records key for instanceID if none is pinned yet.
+func (h *HostKeys) pin(instanceID int, key ssh.PublicKey) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.keys[instanceID]; ok {
+		return
+	}
+	h.keys[instanceID] = marshalHostKey(key)
+	log.Printf("ssh: pinned host key %s for instance %d", ssh.FingerprintSHA256(key), instanceID)
+	if h.path == "" {
+		return
+	}
+	data, _ := json.MarshalIndent(h.keys, "", "  ")
+	if err := os.WriteFile(h.path, data, 0600); err != nil {
+		log.Printf("ssh: save host keys: %v", err)
+	}
+}
+
+// TunnelFactory returns a factory for SSH tunnels to instanceID that
+// verify its host key, pinning the key once a tunnel is established.
+func (h *HostKeys) TunnelFactory(instanceID int) TunnelFactory {
+	return func(publicIP string, directSSHPort int, sshHost string, sshPort int, keyPath string, remotePort int) (Tunnel, error) {
+		var seen ssh.PublicKey
+		callback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if err := h.check(instanceID, key); err != nil {
+				return err
+			}
+			seen = key
+			return nil
+		}
+		tunnel, err := newSSHTunnel(callback, publicIP, directSSHPort, sshHost, sshPort, keyPath, remotePort)
+		if err == nil && seen != nil {
+			h.pin(instanceID, seen)
+		}
+		return tunnel, err
+	}
+}
+
+func marshalHostKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
@@ -0,0 +1,93 @@
+package backend
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestHostKeysPinOnFirstConnect(t *testing.T) {
+	keyPath, pubKey := writeTestKey(t)
+	path := filepath.Join(t.TempDir(), "host_keys.json")
+	hostKeys, err := NewHostKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := newTestSSHServer(t, pubKey)
+	defer first.close()
+	first.serve(t)
+	host, port := splitHostPort(t, first.addr)
+	tunnel, err := hostKeys.TunnelFactory(7)("", 0, host, port, keyPath, 8080)
+	if err != nil {
+		t.Fatalf("first connect: %v", err)
+	}
+	tunnel.Close()
+
+	// Same instance ID, different host key: refused.
+	second := newTestSSHServer(t, pubKey)
+	defer second.close()
+	second.serve(t)
+	host, port = splitHostPort(t, second.addr)
+	_, err = hostKeys.TunnelFactory(7)("", 0, host, port, keyPath, 8080)
+	if err == nil || !strings.Contains(err.Error(), "host key for instance 7 changed") {
+		t.Fatalf("connect with changed key: err = %v", err)
+	}
+
+	// Pins survive a restart.
+	reloaded, err := NewHostKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.keys) != 1 || reloaded.keys[7] != hostKeys.keys[7] {
+		t.Errorf("reloaded keys = %v, want %v", reloaded.keys, hostKeys.keys)
+	}
+}
+
+func TestHostKeysCheck(t *testing.T) {
+	hostKeys, _ := NewHostKeys("")
+	a, b := testHostKey(t), testHostKey(t)
+
+	if err := hostKeys.check(1, a); err != nil {
+		t.Errorf("check() before pinning: %v", err)
+	}
+	hostKeys.pin(1, a)
+	hostKeys.pin(1, b) // already pinned: ignored
+	if err := hostKeys.check(1, a); err != nil {
+		t.Errorf("check() with pinned key: %v", err)
+	}
+	if err := hostKeys.check(1, b); err == nil {
+		t.Error("check() with a different key should fail")
+	}
+	if err := hostKeys.check(2, b); err != nil {
+		t.Errorf("check() for another instance: %v", err)
+	}
+}
+
+func TestNewHostKeysInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "host_keys.json")
+	if err := os.WriteFile(path, []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewHostKeys(path); err == nil {
+		t.Error("expected error for invalid file")
+	}
+}
+
+func testHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
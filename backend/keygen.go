@@ -0,0 +1,59 @@
+package backend
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// EnsureKey returns a private key path usable for SSH. If neither keyPath
+// nor any default key in ~/.ssh loads, it falls back to genPath, generating
+// an ed25519 keypair there (and genPath+".pub") if it doesn't exist yet.
+// generated reports whether a new key was written.
+func EnsureKey(keyPath, genPath string) (path string, generated bool, err error) {
+	if _, err := buildAuthMethods(keyPath); err == nil {
+		return keyPath, false, nil
+	}
+	if _, err := os.Stat(genPath); err == nil {
+		return genPath, false, nil
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", false, fmt.Errorf("generate key: %w", err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "vastproxy")
+	if err != nil {
+		return "", false, fmt.Errorf("marshal key: %w", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		return "", false, fmt.Errorf("marshal key: %w", err)
+	}
+	if err := os.WriteFile(genPath, pem.EncodeToMemory(block), 0600); err != nil {
+		return "", false, fmt.Errorf("write key: %w", err)
+	}
+	if err := os.WriteFile(genPath+".pub", ssh.MarshalAuthorizedKey(signer.PublicKey()), 0644); err != nil {
+		return "", false, fmt.Errorf("write public key: %w", err)
+	}
+	return genPath, true, nil
+}
+
+// PublicKey returns the authorized_keys line for the private key at
+// keyPath.
+func PublicKey(keyPath string) (string, error) {
+	pemBytes, err := os.ReadFile(expandHome(keyPath))
+	if err != nil {
+		return "", err
+	}
+	signer, err := ssh.ParsePrivateKey(pemBytes)
+	if err != nil {
+		return "", fmt.Errorf("parse key: %w", err)
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))), nil
+}
@@ -0,0 +1,63 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnsureKeyGenerates(t *testing.T) {
+	t.Setenv("HOME", t.TempDir()) // no default keys
+	genPath := filepath.Join(t.TempDir(), "vastproxy_ed25519")
+
+	path, generated, err := EnsureKey("~/.ssh/id_rsa", genPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != genPath || !generated {
+		t.Fatalf("EnsureKey() = %q, %v; want %q, true", path, generated, genPath)
+	}
+	if _, err := buildAuthMethods(path); err != nil {
+		t.Errorf("generated key unusable: %v", err)
+	}
+	info, err := os.Stat(genPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	pub, err := PublicKey(genPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(pub, "ssh-ed25519 ") {
+		t.Errorf("PublicKey() = %q, want ssh-ed25519", pub)
+	}
+	written, _ := os.ReadFile(genPath + ".pub")
+	if strings.TrimSpace(string(written)) != pub {
+		t.Errorf(".pub = %q, want %q", written, pub)
+	}
+
+	// The next run reuses it.
+	path, generated, err = EnsureKey("~/.ssh/id_rsa", genPath)
+	if err != nil || path != genPath || generated {
+		t.Errorf("second EnsureKey() = %q, %v, %v; want %q, false, nil", path, generated, err, genPath)
+	}
+}
+
+func TestEnsureKeyExisting(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	keyPath, _ := writeTestKey(t)
+	genPath := filepath.Join(t.TempDir(), "vastproxy_ed25519")
+
+	path, generated, err := EnsureKey(keyPath, genPath)
+	if err != nil || path != keyPath || generated {
+		t.Errorf("EnsureKey() = %q, %v, %v; want %q, false, nil", path, generated, err, keyPath)
+	}
+	if _, err := os.Stat(genPath); !os.IsNotExist(err) {
+		t.Error("key generated although one exists")
+	}
+}
@@ -0,0 +1,63 @@
+package backend
+
+import (
+	"encoding/json"
+	"io"
+	"slices"
+)
+
+// decodeModels returns the model IDs in an OpenAI /v1/models response and
+// the largest context length among them (vLLM and SGLang report
+// max_model_len), or 0 if none is given.
+func decodeModels(r io.Reader) ([]string, int64, error) {
+	var result struct {
+		Data []struct {
+			ID          string `json:"id"`
+			MaxModelLen int64  `json:"max_model_len"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
+		return nil, 0, err
+	}
+	ids := make([]string, 0, len(result.Data))
+	var maxLen int64
+	for _, m := range result.Data {
+		ids = append(ids, m.ID)
+		maxLen = max(maxLen, m.MaxModelLen)
+	}
+	return ids, maxLen, nil
+}
+
+// Models returns every model the backend serves (base models and LoRA
+// variants) as of its last health check, or just Instance.ModelName if
+// the list isn't known yet.
+func (b *Backend) Models() []string {
+	if models := b.models.Load(); models != nil {
+		return *models
+	}
+	if b.Instance.ModelName != "" {
+		return []string{b.Instance.ModelName}
+	}
+	return nil
+}
+
+// Serves reports whether the backend serves model.
+func (b *Backend) Serves(model string) bool {
+	return slices.Contains(b.Models(), model)
+}
+
+// SetModels sets the served models (used in tests).
+func (b *Backend) SetModels(models []string) {
+	b.models.Store(&models)
+}
+
+// ContextLength returns the backend's maximum context length in tokens, or
+// 0 if the engine hasn't reported it.
+func (b *Backend) ContextLength() int64 {
+	return b.contextLength.Load()
+}
+
+// SetContextLength sets the maximum context length (used in tests).
+func (b *Backend) SetContextLength(n int64) {
+	b.contextLength.Store(n)
+}
@@ -0,0 +1,46 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckHealthRecordsModels(t *testing.T) {
+	srv := modelsServer(t, "meta-llama/Llama-3-8B", "lora-a", "lora-b")
+
+	be := NewBackend(testInstance(1), "", nil, "")
+	be.SetTunnel(&mockTunnel{localAddr: srv.Listener.Addr().String()})
+	if got := be.Models(); got != nil {
+		t.Errorf("Models() before health check = %q, want nil", got)
+	}
+	if err := be.CheckHealth(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := be.Models(); len(got) != 3 || got[2] != "lora-b" {
+		t.Errorf("Models() = %q, want all three", got)
+	}
+	if !be.Serves("lora-a") || be.Serves("lora-c") {
+		t.Error("Serves() disagrees with Models()")
+	}
+}
+
+func TestCheckHealthRecordsContextLength(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"id":"base","max_model_len":32768},{"id":"lora-a","max_model_len":8192}]}`))
+	}))
+	defer srv.Close()
+
+	be := NewBackend(testInstance(1), "", nil, "")
+	be.SetTunnel(&mockTunnel{localAddr: srv.Listener.Addr().String()})
+	if be.ContextLength() != 0 {
+		t.Errorf("ContextLength() before health check = %d, want 0", be.ContextLength())
+	}
+	if err := be.CheckHealth(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := be.ContextLength(); got != 32768 {
+		t.Errorf("ContextLength() = %d, want 32768", got)
+	}
+}
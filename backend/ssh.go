@@ -8,6 +8,8 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 
 	sshlib "github.com/blacknon/go-sshlib"
@@ -39,9 +41,15 @@ var _ Tunnel = (*SSHTunnel)(nil)
 // NewSSHTunnel creates an SSH connection and establishes a local port forward.
 // It tries direct SSH first (publicIP:directPort) for lower latency, then
 // falls back to proxy SSH (sshHost:sshPort) which is more reliable.
+// Host keys aren't checked; see HostKeys for pinning.
 func NewSSHTunnel(publicIP string, directSSHPort int, sshHost string, sshPort int, keyPath string, remotePort int) (Tunnel, error) {
+	return newSSHTunnel(ssh.InsecureIgnoreHostKey(), publicIP, directSSHPort, sshHost, sshPort, keyPath, remotePort)
+}
+
+// newSSHTunnel is NewSSHTunnel with host keys checked by hostKeyCallback.
+func newSSHTunnel(hostKeyCallback ssh.HostKeyCallback, publicIP string, directSSHPort int, sshHost string, sshPort int, keyPath string, remotePort int) (Tunnel, error) {
 	conn := &sshlib.Connect{}
-	conn.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	conn.HostKeyCallback = hostKeyCallback
 
 	auth, err := buildAuthMethods(keyPath)
 	if err != nil {
@@ -77,18 +85,18 @@ func NewSSHTunnel(publicIP string, directSSHPort int, sshHost string, sshPort in
 		return nil, fmt.Errorf("ssh client is nil after connect")
 	}
 
-	// Find a free local port.
-	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	// Bind the local end of the forward once and keep the listener, so no
+	// other process can take the port in between.
+	ln, err := listenLocal()
 	if err != nil {
 		conn.Client.Close()
-		return nil, fmt.Errorf("find free port: %w", err)
+		return nil, err
 	}
-	localAddr := ln.Addr().String()
-	ln.Close()
 
 	tunnel := &SSHTunnel{
 		conn:      conn,
-		localAddr: localAddr,
+		listener:  ln,
+		localAddr: ln.Addr().String(),
 		isDirect:  isDirect,
 	}
 
@@ -97,16 +105,9 @@ func NewSSHTunnel(publicIP string, directSSHPort int, sshHost string, sshPort in
 	// because the library ignores Dial errors and passes nil to io.Copy,
 	// causing unrecoverable panics in child goroutines.
 	remoteAddr := fmt.Sprintf("127.0.0.1:%d", remotePort)
-	ln2, err := net.Listen("tcp", localAddr)
-	if err != nil {
-		conn.Client.Close()
-		return nil, fmt.Errorf("listen %s: %w", localAddr, err)
-	}
-	tunnel.listener = ln2
-
 	go func() {
 		for {
-			local, err := ln2.Accept()
+			local, err := ln.Accept()
 			if err != nil {
 				return // listener closed
 			}
@@ -123,6 +124,63 @@ func NewSSHTunnel(publicIP string, directSSHPort int, sshHost string, sshPort in
 	return tunnel, nil
 }
 
+// localPorts is the range tunnels bind their local end in; zero means any
+// free port.
+var localPorts struct {
+	mu          sync.Mutex
+	first, last int
+	next        int // where the next search starts, to spread ports out
+}
+
+// SetLocalPortRange restricts tunnels' local ports to first–last
+// (inclusive), e.g. so a firewall can be scoped to them. Zero values mean
+// any free port. Call before creating tunnels.
+func SetLocalPortRange(first, last int) {
+	localPorts.mu.Lock()
+	defer localPorts.mu.Unlock()
+	localPorts.first, localPorts.last, localPorts.next = first, last, first
+}
+
+// ParsePortRange parses a port range such as "20000-20999".
+func ParsePortRange(s string) (first, last int, err error) {
+	lo, hi, ok := strings.Cut(s, "-")
+	if ok {
+		first, err = strconv.Atoi(strings.TrimSpace(lo))
+		if err == nil {
+			last, err = strconv.Atoi(strings.TrimSpace(hi))
+		}
+	}
+	if !ok || err != nil || first < 1 || last > 65535 || first > last {
+		return 0, 0, fmt.Errorf("invalid port range %q (want first-last)", s)
+	}
+	return first, last, nil
+}
+
+// listenLocal binds a loopback listener for a tunnel's local end, within
+// the configured port range if any.
+func listenLocal() (net.Listener, error) {
+	localPorts.mu.Lock()
+	defer localPorts.mu.Unlock()
+	first, last := localPorts.first, localPorts.last
+	if first == 0 {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, fmt.Errorf("listen: %w", err)
+		}
+		return ln, nil
+	}
+	n := last - first + 1
+	for i := range n {
+		port := first + (localPorts.next-first+i)%n
+		ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err == nil {
+			localPorts.next = port + 1
+			return ln, nil
+		}
+	}
+	return nil, fmt.Errorf("no free local port in %d-%d", first, last)
+}
+
 // forward copies data between two connections and closes both when done.
 func forward(a, b net.Conn) {
 	var wg sync.WaitGroup
@@ -181,14 +239,18 @@ func (t *SSHTunnel) Close() {
 	}
 }
 
-func buildAuthMethods(keyPath string) ([]ssh.AuthMethod, error) {
-	// Expand ~ in path.
-	if keyPath != "" && keyPath[0] == '~' {
-		home, err := os.UserHomeDir()
-		if err == nil {
-			keyPath = filepath.Join(home, keyPath[1:])
+// expandHome expands a leading ~ in path to the user's home directory.
+func expandHome(path string) string {
+	if path != "" && path[0] == '~' {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
 		}
 	}
+	return path
+}
+
+func buildAuthMethods(keyPath string) ([]ssh.AuthMethod, error) {
+	keyPath = expandHome(keyPath)
 
 	var methods []ssh.AuthMethod
 
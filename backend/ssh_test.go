@@ -535,3 +535,41 @@ func splitHostPort(t *testing.T, addr string) (string, int) {
 	fmt.Sscanf(portStr, "%d", &port)
 	return host, port
 }
+
+func TestParsePortRange(t *testing.T) {
+	first, last, err := ParsePortRange("20000-20999")
+	if err != nil || first != 20000 || last != 20999 {
+		t.Errorf("ParsePortRange = %d, %d, %v", first, last, err)
+	}
+	for _, bad := range []string{"20000", "a-b", "30000-20000", "0-10", "1-70000"} {
+		if _, _, err := ParsePortRange(bad); err == nil {
+			t.Errorf("ParsePortRange(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestListenLocalPortRange(t *testing.T) {
+	held, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := held.Addr().(*net.TCPAddr).Port
+	SetLocalPortRange(port, port)
+	t.Cleanup(func() { SetLocalPortRange(0, 0) })
+
+	// The only port in range is taken.
+	if ln, err := listenLocal(); err == nil {
+		ln.Close()
+		t.Fatal("listenLocal succeeded with the range exhausted")
+	}
+
+	held.Close()
+	ln, err := listenLocal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if got := ln.Addr().(*net.TCPAddr).Port; got != port {
+		t.Errorf("port = %d, want %d", got, port)
+	}
+}
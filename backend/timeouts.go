@@ -0,0 +1,49 @@
+package backend
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// Timeouts configures the HTTP client used to reach a backend through its
+// tunnel. A zero field means no limit.
+type Timeouts struct {
+	Dial           time.Duration // connecting to the tunnel
+	TLSHandshake   time.Duration // TLS handshake, for HTTPS backends
+	ResponseHeader time.Duration // waiting for response headers once the request is sent
+	Request        time.Duration // whole exchange, for the proxy's own requests (health checks, stats, abort)
+}
+
+// DefaultTimeouts fail fast on a dead tunnel but allow a long non-streaming
+// generation to take minutes before its response headers arrive.
+var DefaultTimeouts = Timeouts{
+	Dial:           10 * time.Second,
+	TLSHandshake:   10 * time.Second,
+	ResponseHeader: 5 * time.Minute,
+	Request:        time.Minute,
+}
+
+// SetTimeouts replaces the backend's HTTP client with one using t.
+// Proxied requests share its transport, and so its dial, TLS and
+// response-header timeouts, but never the overall Request timeout: response
+// bodies, such as long token streams, are not time limited.
+func (b *Backend) SetTimeouts(t Timeouts) {
+	b.httpClient = newHTTPClient(t)
+}
+
+// newHTTPClient returns an HTTP client with its own transport configured
+// for t.
+func newHTTPClient(t Timeouts) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   t.Dial,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = t.TLSHandshake
+	transport.ResponseHeaderTimeout = t.ResponseHeader
+	return &http.Client{
+		Transport: transport,
+		Timeout:   t.Request,
+	}
+}
@@ -0,0 +1,60 @@
+package backend
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/vast"
+)
+
+func TestSetTimeoutsResponseHeader(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	b := NewBackend(&vast.Instance{ID: 1}, "", nil, "")
+	b.SetTimeouts(Timeouts{ResponseHeader: 50 * time.Millisecond})
+	if _, err := b.HTTPClient().Get(srv.URL); err == nil {
+		t.Error("expected response header timeout")
+	}
+}
+
+func TestSetTimeoutsStreamingBody(t *testing.T) {
+	// A slow body outlives the overall Request timeout: it limits the
+	// client's own requests but not proxied ones, which use the transport.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for range 4 {
+			io.WriteString(w, "data: x\n\n")
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	b := NewBackend(&vast.Instance{ID: 1}, "", nil, "")
+	b.SetTimeouts(Timeouts{Dial: time.Second, ResponseHeader: time.Second, Request: 100 * time.Millisecond})
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	resp, err := b.HTTPClient().Transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || len(body) != 4*len("data: x\n\n") {
+		t.Errorf("proxied stream: %d bytes, err %v", len(body), err)
+	}
+
+	resp, err = b.HTTPClient().Get(srv.URL)
+	if err == nil {
+		_, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if err == nil {
+		t.Error("client request outlived the Request timeout")
+	}
+}
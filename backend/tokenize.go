@@ -0,0 +1,76 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Tokenize returns the number of prompt tokens the engine's own tokenizer
+// counts for an OpenAI-style JSON request body, using the /tokenize
+// endpoint served by vLLM and SGLang. Chat requests are tokenized with the
+// model's chat template applied; text completions by their prompt.
+func (b *Backend) Tokenize(ctx context.Context, body []byte) (int64, error) {
+	if b.baseURL == "" {
+		return 0, fmt.Errorf("no base URL")
+	}
+	var in struct {
+		Model    string          `json:"model"`
+		Messages json.RawMessage `json:"messages"`
+		Prompt   json.RawMessage `json:"prompt"`
+		Input    json.RawMessage `json:"input"`
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return 0, err
+	}
+	out := map[string]any{"model": in.Model}
+	switch {
+	case in.Messages != nil:
+		out["messages"] = in.Messages
+	case in.Prompt != nil:
+		out["prompt"] = in.Prompt
+	case bytes.HasPrefix(in.Input, []byte(`"`)):
+		out["prompt"] = in.Input
+	case in.Input != nil:
+		out["messages"] = in.Input
+	default:
+		return 0, fmt.Errorf("request has no prompt")
+	}
+	payload, _ := json.Marshal(out)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", b.baseURL+"/tokenize", bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.Instance.JupyterToken != "" {
+		req.Header.Set("Authorization", "Bearer "+b.Instance.JupyterToken)
+	}
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("tokenize returned HTTP %d", resp.StatusCode)
+	}
+	var result struct {
+		Count  *int64  `json:"count"`
+		Tokens []int64 `json:"tokens"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	switch {
+	case result.Count != nil:
+		return *result.Count, nil
+	case result.Tokens != nil:
+		return int64(len(result.Tokens)), nil
+	}
+	return 0, fmt.Errorf("tokenize returned no count")
+}
@@ -0,0 +1,51 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	var got map[string]json.RawMessage
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tokenize" {
+			http.NotFound(w, r)
+			return
+		}
+		gotAuth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"count":42,"max_model_len":8192,"tokens":[1,2]}`))
+	}))
+	defer srv.Close()
+	be := NewBackend(testInstance(1), "", nil, "")
+	be.baseURL = srv.URL
+
+	n, err := be.Tokenize(context.Background(), []byte(`{"model":"m","messages":[{"role":"user","content":"hi"}],"temperature":0}`))
+	if err != nil || n != 42 {
+		t.Fatalf("Tokenize() = %d, %v; want 42", n, err)
+	}
+	if gotAuth != "Bearer test-token" || string(got["model"]) != `"m"` || got["messages"] == nil || got["temperature"] != nil {
+		t.Errorf("tokenize request = %v auth=%q", got, gotAuth)
+	}
+
+	if _, err := be.Tokenize(context.Background(), []byte(`{"model":"m","prompt":"hi"}`)); err != nil || string(got["prompt"]) != `"hi"` {
+		t.Errorf("prompt: err = %v, request = %v", err, got)
+	}
+	if _, err := be.Tokenize(context.Background(), []byte(`{"model":"m"}`)); err == nil {
+		t.Error("expected an error for a request without a prompt")
+	}
+}
+
+func TestTokenizeUnsupported(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	be := NewBackend(testInstance(1), "", nil, "")
+	be.baseURL = srv.URL
+	if _, err := be.Tokenize(context.Background(), []byte(`{"prompt":"hi"}`)); err == nil {
+		t.Error("expected an error when the engine has no /tokenize")
+	}
+}
@@ -0,0 +1,61 @@
+package backend
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/shutej/vastproxy/vast"
+)
+
+// Weights configures round-robin weights per GPU, so beefier instances
+// receive proportionally more traffic: an instance weighs its GPU's
+// weight times its GPU count. GPUs not listed weigh 1.
+type Weights map[string]int // lowercased GPU name -> weight per GPU
+
+// ParseWeights parses per-GPU weights such as "A100 SXM4=4,RTX 4090=1".
+func ParseWeights(s string) (Weights, error) {
+	out := make(Weights)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		gpu, raw, ok := strings.Cut(entry, "=")
+		gpu = strings.TrimSpace(gpu)
+		w, err := strconv.Atoi(strings.TrimSpace(raw))
+		if !ok || gpu == "" || err != nil || w <= 0 {
+			return nil, fmt.Errorf("invalid entry %q, want gpu=weight", entry)
+		}
+		out[strings.ToLower(gpu)] = w
+	}
+	return out, nil
+}
+
+// For returns the weight of inst, or 0 if no weights are configured.
+func (w Weights) For(inst *vast.Instance) int {
+	if len(w) == 0 {
+		return 0
+	}
+	per, ok := w[strings.ToLower(inst.GPUName)]
+	if !ok {
+		per = 1
+	}
+	return per * max(inst.NumGPUs, 1)
+}
+
+// SetWeight sets the backend's configured round-robin weight; 0 means the
+// default of 1. Call before adding the backend to a balancer.
+func (b *Backend) SetWeight(w int) {
+	b.weight = w
+}
+
+// Weight returns the backend's round-robin weight: a weight in the
+// instance label (see vast.LabelWeight) wins over the configured one, and
+// the default is 1.
+func (b *Backend) Weight() int {
+	if _, w := vast.LabelWeight(b.Instance.Label); w > 0 {
+		return w
+	}
+	return max(b.weight, 1)
+}
@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shutej/vastproxy/vast"
+)
+
+func TestParseWeights(t *testing.T) {
+	w, err := ParseWeights("A100 SXM4=4, RTX 4090=1,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		inst vast.Instance
+		want int
+	}{
+		{vast.Instance{GPUName: "A100 SXM4", NumGPUs: 8}, 32},
+		{vast.Instance{GPUName: "rtx 4090", NumGPUs: 1}, 1},
+		{vast.Instance{GPUName: "H100 SXM", NumGPUs: 2}, 2}, // unlisted: 1 per GPU
+	}
+	for _, tt := range tests {
+		if got := w.For(&tt.inst); got != tt.want {
+			t.Errorf("For(%s x%d) = %d, want %d", tt.inst.GPUName, tt.inst.NumGPUs, got, tt.want)
+		}
+	}
+	if got := Weights(nil).For(&tests[0].inst); got != 0 {
+		t.Errorf("unconfigured For() = %d, want 0", got)
+	}
+	for _, bad := range []string{"A100", "A100=0", "A100=x", "=2"} {
+		if _, err := ParseWeights(bad); err == nil {
+			t.Errorf("ParseWeights(%q): expected error", bad)
+		}
+	}
+}
+
+func TestBackendWeight(t *testing.T) {
+	inst := testInstance(1)
+	be := NewBackend(inst, "", nil, "")
+	if be.Weight() != 1 {
+		t.Errorf("default Weight() = %d, want 1", be.Weight())
+	}
+	be.SetWeight(4)
+	if be.Weight() != 4 {
+		t.Errorf("configured Weight() = %d, want 4", be.Weight())
+	}
+	inst.Label = "proxied:w=2"
+	if be.Weight() != 2 {
+		t.Errorf("labeled Weight() = %d, want 2", be.Weight())
+	}
+}
+
+func TestSetLabelKeepsWeight(t *testing.T) {
+	lt := newLabelTracker()
+	defer lt.close()
+
+	inst := testInstance(1)
+	inst.Label = "w=3"
+	be := NewBackend(inst, "", lt.client(), "proxied")
+	be.setLabel(context.Background(), "proxied")
+	if inst.Label != "proxied:w=3" {
+		t.Errorf("Instance.Label = %q, want proxied:w=3", inst.Label)
+	}
+
+	be.Close()
+	labels := lt.labels()
+	if len(labels) != 2 || labels[1] != "w=3" {
+		t.Errorf("labels = %q, want the weight kept when clearing", labels)
+	}
+}
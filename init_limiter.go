@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// initLimiter bounds how many backends are initialized (SSH tunnel, first
+// health check, model discovery) concurrently.
+type initLimiter struct {
+	slots  chan struct{}
+	jitter time.Duration
+}
+
+func newInitLimiter(concurrency int, jitter time.Duration) *initLimiter {
+	return &initLimiter{slots: make(chan struct{}, max(concurrency, 1)), jitter: jitter}
+}
+
+// acquire waits a random jitter delay, then for a free slot. It returns
+// false if ctx is done first.
+func (l *initLimiter) acquire(ctx context.Context) bool {
+	if l.jitter > 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(rand.N(l.jitter)):
+		}
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case l.slots <- struct{}{}:
+		return true
+	}
+}
+
+func (l *initLimiter) release() {
+	<-l.slots
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFDsStart is the first inherited file descriptor under the systemd
+// socket activation protocol (LISTEN_FDS / LISTEN_PID).
+const listenFDsStart = 3
+
+// listen returns the listener for the proxy's HTTP server.
+//
+// If the process was started with an inherited socket (LISTEN_FDS set and
+// LISTEN_PID matching this process, as done by systemd socket activation or
+// a supervisor performing a hand-off), that socket is used as-is. Otherwise
+// a new socket is bound to addr; when reusePort is set it gets SO_REUSEPORT
+// so a replacement vastproxy can bind the same address while this one drains.
+func listen(addr string, reusePort bool) (net.Listener, error) {
+	if ln, err := inheritedListener(); ln != nil || err != nil {
+		return ln, err
+	}
+
+	lc := net.ListenConfig{}
+	if reusePort {
+		lc.Control = setReusePort
+	}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// inheritedListener returns the first socket passed via LISTEN_FDS, or nil
+// if none was passed to this process.
+func inheritedListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+
+	// Don't pass the sockets on to any child processes.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(uintptr(listenFDsStart), "listener")
+	if f == nil {
+		return nil, fmt.Errorf("inherited fd %d is invalid", listenFDsStart)
+	}
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("inherited fd %d: %w", listenFDsStart, err)
+	}
+	return ln, nil
+}
@@ -2,23 +2,35 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/joho/godotenv"
 	"github.com/shutej/vastproxy/backend"
 	"github.com/shutej/vastproxy/proxy"
+	"github.com/shutej/vastproxy/sim"
 	"github.com/shutej/vastproxy/tui"
 	"github.com/shutej/vastproxy/vast"
 )
 
 func main() {
+	// --dry-run swaps vast.ai for an in-process simulated fleet with canned
+	// completions and synthetic GPU metrics, for demos and development.
+	dryRun := flag.Bool("dry-run", false, "simulate a fleet in-process instead of using vast.ai")
+	flag.Parse()
+
 	// Load .env (ignore error if missing).
 	_ = godotenv.Load()
 
@@ -29,9 +41,17 @@ func main() {
 		defer logFile.Close()
 	}
 
+	build := buildInfo()
+	log.Printf("vastproxy %s", build)
+
 	apiKey := os.Getenv("VAST_API_KEY")
-	if apiKey == "" {
-		fmt.Fprintln(os.Stderr, "VAST_API_KEY not set. Set it in .env or environment.")
+	discoveryFile := os.Getenv("DISCOVERY_FILE")
+	if *dryRun {
+		// Never touch the real account, even if a key is configured.
+		apiKey, discoveryFile = "", ""
+	}
+	if apiKey == "" && discoveryFile == "" && !*dryRun {
+		fmt.Fprintln(os.Stderr, "VAST_API_KEY not set. Set it (or DISCOVERY_FILE) in .env or environment.")
 		os.Exit(1)
 	}
 
@@ -40,11 +60,61 @@ func main() {
 		keyPath = "~/.ssh/id_rsa"
 	}
 
+	// Without a usable key, generate vastproxy_ed25519 next to .env so
+	// first-time setup works. ATTACH_SSH_KEY=true authorizes the key on
+	// each discovered instance via the API.
+	var generated bool
+	if !*dryRun {
+		keyPath, generated, err = backend.EnsureKey(keyPath, "vastproxy_ed25519")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "SSH key: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	attach, _ := strconv.ParseBool(os.Getenv("ATTACH_SSH_KEY"))
+	attach = attach && !*dryRun
+	if generated {
+		log.Printf("no SSH key found; generated %s", keyPath)
+		if !attach {
+			fmt.Fprintf(os.Stderr, "No SSH key found; generated %s.\nAdd %s.pub to your vast.ai account, or set ATTACH_SSH_KEY=true to attach it to instances.\n", keyPath, keyPath)
+		}
+	}
+	var attachKey string
+	if attach {
+		if apiKey == "" {
+			fmt.Fprintln(os.Stderr, "ATTACH_SSH_KEY requires VAST_API_KEY")
+			os.Exit(1)
+		}
+		if attachKey, err = backend.PublicKey(keyPath); err != nil {
+			fmt.Fprintf(os.Stderr, "ATTACH_SSH_KEY: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// PIN_HOST_KEYS=true pins each instance's SSH host key on first
+	// connect and refuses connections if it later changes. Pins are kept
+	// in HOST_KEYS_FILE (default vastproxy_host_keys.json).
+	var hostKeys *backend.HostKeys
+	if pin, _ := strconv.ParseBool(os.Getenv("PIN_HOST_KEYS")); pin {
+		path := os.Getenv("HOST_KEYS_FILE")
+		if path == "" {
+			path = "vastproxy_host_keys.json"
+		}
+		if hostKeys, err = backend.NewHostKeys(path); err != nil {
+			fmt.Fprintf(os.Stderr, "HOST_KEYS_FILE: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	listenAddr := os.Getenv("LISTEN_ADDR")
 	if listenAddr == "" {
 		listenAddr = ":8080"
 	}
 
+	// LISTEN_REUSEPORT lets a replacement process bind the same address
+	// while this one drains, for upgrades without dropping streams.
+	reusePort, _ := strconv.ParseBool(os.Getenv("LISTEN_REUSEPORT"))
+
 	proxyLabel := os.Getenv("VASTPROXY_LABEL")
 	if proxyLabel == "" {
 		proxyLabel = "proxied"
@@ -53,24 +123,469 @@ func main() {
 		proxyLabel = ""
 	}
 
-	// Create vast.ai watcher.
-	vastClient := vast.NewClient(apiKey)
-	watcher := vast.NewWatcher(vastClient, 10*time.Second)
+	// TUI_THEME forces a dark or light palette (default: follow the
+	// terminal); TUI_COLORS overrides colors, e.g. "healthy=#00af00,dim=245".
+	// NO_COLOR turns colors off.
+	if err := tui.SetTheme(os.Getenv("TUI_THEME"), os.Getenv("TUI_COLORS")); err != nil {
+		fmt.Fprintf(os.Stderr, "TUI_THEME/TUI_COLORS: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Create the instance watcher. By default instances are discovered via
+	// the vast.ai API; DISCOVERY_FILE switches to a local JSON file instead.
+	var vastClient *vast.Client
+	if apiKey != "" {
+		vastClient = vast.NewClient(apiKey)
+	}
+	var provider vast.Provider = vastClient
+	if discoveryFile != "" {
+		log.Printf("discovery: reading instances from %s", discoveryFile)
+		provider = vast.NewFileProvider(discoveryFile)
+	}
+	// In a dry run DRY_RUN_INSTANCES (default 5) simulated instances serve
+	// canned completions; DRY_RUN_CHAOS, e.g. 3m, takes a random one down
+	// for 45s that often.
+	var fleet *sim.Fleet
+	if *dryRun {
+		n := envInt("DRY_RUN_INSTANCES", 5)
+		if fleet, err = sim.NewFleet(n); err != nil {
+			fmt.Fprintf(os.Stderr, "dry run: %v\n", err)
+			os.Exit(1)
+		}
+		defer fleet.Close()
+		log.Printf("dry run: simulating %d instances", n)
+		provider = fleet
+	}
+	watcher := vast.NewWatcher(provider, 10*time.Second)
 
-	// Create load balancer.
+	// Create load balancer. POOL_BY groups backends into independently
+	// balanced pools by served model or instance label.
 	balancer := proxy.NewBalancer()
+	poolMode, err := proxy.ParsePoolMode(os.Getenv("POOL_BY"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "POOL_BY: %v\n", err)
+		os.Exit(1)
+	}
+	balancer.SetPoolMode(poolMode)
+
+	// BALANCE selects round-robin (default), queue-depth, p2c (the less
+	// busy of two random backends) or latency (weighted inversely to each
+	// backend's moving average request latency) routing.
+	strategy, err := proxy.ParseStrategy(os.Getenv("BALANCE"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "BALANCE: %v\n", err)
+		os.Exit(1)
+	}
+	balancer.SetStrategy(strategy)
+
+	// Keep long prompts (LONG_PROMPT_TOKENS, estimated) off backends whose
+	// KV cache usage is above KV_CACHE_LIMIT, e.g. 0.9.
+	kvCacheLimit := envFloat("KV_CACHE_LIMIT", 0)
+	balancer.SetKVCacheLimit(kvCacheLimit)
+
+	// Skip busy backends while others aren't: those at BUSY_GPU_UTIL
+	// percent average GPU utilization, or BUSY_QUEUE_DEPTH requests queued
+	// or running.
+	balancer.SetBusyLimits(envFloat("BUSY_GPU_UTIL", 0), int64(envInt("BUSY_QUEUE_DEPTH", 0)))
+
+	// At most MAX_STREAMS_PER_BACKEND streaming requests per backend; once
+	// all are full, further streams get 503. Non-streaming calls don't count.
+	balancer.SetMaxStreams(int64(envInt("MAX_STREAMS_PER_BACKEND", 0)))
+
+	// With SIZE_ROUTING=true, long prompts go to the instances with the most
+	// VRAM and shorter ones to the rest, in a fleet of mixed sizes.
+	sizeRouting, _ := strconv.ParseBool(os.Getenv("SIZE_ROUTING"))
+	balancer.SetSizeRouting(sizeRouting)
+
+	// Instances labeled AUDIO_LABEL serve /v1/audio/* and nothing else.
+	audioLabel := os.Getenv("AUDIO_LABEL")
+	balancer.SetAudioLabel(audioLabel)
+
+	// Instances labeled SHADOW_LABEL serve no clients; they only receive
+	// the copies sent by MIRROR_PERCENT below.
+	balancer.SetShadowLabel(os.Getenv("SHADOW_LABEL"))
+
+	// TRAFFIC_SPLIT divides traffic between instance labels by percent,
+	// e.g. "stable=90,canary=10"; adjustable at runtime via the admin API.
+	if s := os.Getenv("TRAFFIC_SPLIT"); s != "" {
+		split, err := proxy.ParseTrafficSplit(s)
+		if err == nil {
+			err = balancer.SetTrafficSplit(split)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "TRAFFIC_SPLIT: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Optional watchdog that rents replacement instances from PROVISION_SPEC
+	// whenever fewer than MIN_HEALTHY backends are healthy, and (with
+	// RECREATE_DESTROYED) replaces instances destroyed for being unhealthy.
+	var watchdog *vast.Watchdog
+	specPath := os.Getenv("PROVISION_SPEC")
+	recreate, _ := strconv.ParseBool(os.Getenv("RECREATE_DESTROYED"))
+	if specPath != "" || recreate {
+		if vastClient == nil {
+			fmt.Fprintln(os.Stderr, "PROVISION_SPEC and RECREATE_DESTROYED require VAST_API_KEY")
+			os.Exit(1)
+		}
+		var spec vast.ProvisionSpec
+		minHealthy := 0
+		if specPath != "" {
+			spec, err = vast.LoadProvisionSpec(specPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "PROVISION_SPEC: %v\n", err)
+				os.Exit(1)
+			}
+			minHealthy = envInt("MIN_HEALTHY", 1)
+		}
+		watchdog = vast.NewWatchdog(vastClient, spec, minHealthy, balancer)
+		watchdog.BootTimeout = envDuration("PROVISION_BOOT_TIMEOUT", watchdog.BootTimeout)
+		watchdog.MaxInstances = envInt("MAX_INSTANCES", 0)
+	}
+
+	// Optionally raise bids of interruptible instances before they are
+	// outbid, up to BID_MAX $/hour.
+	if raw := os.Getenv("BID_MAX"); raw != "" {
+		maxBid, err := strconv.ParseFloat(raw, 64)
+		if err != nil || maxBid <= 0 || vastClient == nil {
+			fmt.Fprintln(os.Stderr, "BID_MAX must be a positive $/hour price and requires VAST_API_KEY")
+			os.Exit(1)
+		}
+		margin := 0.05
+		if raw := os.Getenv("BID_MARGIN"); raw != "" {
+			if margin, err = strconv.ParseFloat(raw, 64); err != nil {
+				fmt.Fprintf(os.Stderr, "BID_MARGIN: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		watcher.OnPoll(vast.NewBidPolicy(vastClient, maxBid, margin).Check)
+	}
 
 	// Create sticky stats tracker (5-minute sliding window).
 	stickyStats := proxy.NewStickyStats(5 * time.Minute)
 
+	// Responses carry the proxy version alongside the other metadata
+	// headers (backend model, tunnel type, timing).
+	proxyOpts := []proxy.Option{proxy.WithVersion(build.Version)}
+
+	// Optional access log, separate from the debug log above.
+	if path := os.Getenv("ACCESS_LOG"); path != "" {
+		format, err := proxy.ParseAccessLogFormat(os.Getenv("ACCESS_LOG_FORMAT"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ACCESS_LOG_FORMAT: %v\n", err)
+			os.Exit(1)
+		}
+		accessFile, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "open access log: %v\n", err)
+			os.Exit(1)
+		}
+		defer accessFile.Close()
+		proxyOpts = append(proxyOpts, proxy.WithAccessLog(proxy.NewAccessLog(accessFile, format)))
+	}
+
+	// Optional body capture for debugging, retrievable via the admin API.
+	var captures *proxy.BodyCapture
+	if n := envInt("CAPTURE_BODIES", 0); n > 0 {
+		captures = proxy.NewBodyCapture(n, envInt("CAPTURE_MAX_BYTES", 4096),
+			envList("CAPTURE_REDACT", "messages,prompt,input"))
+		proxyOpts = append(proxyOpts, proxy.WithBodyCapture(captures))
+	}
+
+	// The TUI's recent-requests pane shows the last RECENT_REQUESTS
+	// requests (default 200; 0 disables it).
+	var recent *proxy.RecentRequests
+	if n := envInt("RECENT_REQUESTS", 200); n > 0 {
+		recent = proxy.NewRecentRequests(n)
+		proxyOpts = append(proxyOpts, proxy.WithRecentRequests(recent))
+	}
+
+	// Optional hedging of small non-streaming requests to cut tail latency.
+	if delay := envDuration("HEDGE_DELAY", 0); delay > 0 {
+		proxyOpts = append(proxyOpts, proxy.WithHedging(delay, int64(envInt("HEDGE_MAX_BODY", 16384))))
+	}
+
+	// Optional per-route upstream timeouts (none by default).
+	if routes, err := proxy.ParseRouteTimeouts(os.Getenv("ROUTE_TIMEOUTS")); err != nil {
+		fmt.Fprintf(os.Stderr, "ROUTE_TIMEOUTS: %v\n", err)
+		os.Exit(1)
+	} else if def := envDuration("DEFAULT_TIMEOUT", 0); def > 0 || len(routes) > 0 {
+		proxyOpts = append(proxyOpts, proxy.WithRouteTimeouts(proxy.RouteTimeouts{Default: def, Routes: routes}))
+	}
+
+	// Abort SSE streams whose backend goes silent.
+	if d := envDuration("STREAM_IDLE_TIMEOUT", 0); d > 0 {
+		proxyOpts = append(proxyOpts, proxy.WithStreamIdleTimeout(d))
+	}
+
+	// Send an SSE comment to clients whose stream has been quiet for
+	// SSE_KEEPALIVE (e.g. during a long prefill), so idle timeouts along
+	// the way don't drop it.
+	if d := envDuration("SSE_KEEPALIVE", 0); d > 0 {
+		proxyOpts = append(proxyOpts, proxy.WithSSEKeepAlive(d))
+	}
+
+	// Hard ceiling on any request's lifetime, streams included.
+	if d := envDuration("MAX_REQUEST_DURATION", 0); d > 0 {
+		proxyOpts = append(proxyOpts, proxy.WithMaxRequestDuration(d))
+	}
+
+	// With ABORT_ON_IDLE=true, abort all backend work once no request has
+	// been in flight for ABORT_IDLE_DELAY. Only safe for a single client.
+	if on, _ := strconv.ParseBool(os.Getenv("ABORT_ON_IDLE")); on {
+		proxyOpts = append(proxyOpts, proxy.WithAbortOnIdle(envDuration("ABORT_IDLE_DELAY", 5*time.Second)))
+	}
+
+	// Eject a backend for OUTLIER_EJECT_FOR once its error rate over
+	// OUTLIER_WINDOW reaches OUTLIER_ERROR_RATE (e.g. 0.5) and is well above
+	// the rest of the fleet's.
+	if rate := envFloat("OUTLIER_ERROR_RATE", 0); rate > 0 {
+		outliers := proxy.NewOutlierDetector(envDuration("OUTLIER_WINDOW", time.Minute), rate, envDuration("OUTLIER_EJECT_FOR", 30*time.Second))
+		proxyOpts = append(proxyOpts, proxy.WithOutlierDetection(outliers))
+	}
+
+	// Copy MIRROR_PERCENT of inference requests with bodies up to
+	// MIRROR_MAX_BODY bytes to a SHADOW_LABEL instance, discarding its
+	// responses.
+	if pct := envFloat("MIRROR_PERCENT", 0); pct > 0 {
+		proxyOpts = append(proxyOpts, proxy.WithMirroring(pct, int64(envInt("MIRROR_MAX_BODY", 1<<20))))
+	}
+
+	// With COALESCE_REQUESTS=true, identical in-flight temperature-0
+	// requests (bodies up to COALESCE_MAX_BODY bytes) from the same key
+	// share one upstream call.
+	if on, _ := strconv.ParseBool(os.Getenv("COALESCE_REQUESTS")); on {
+		proxyOpts = append(proxyOpts, proxy.WithCoalescing(int64(envInt("COALESCE_MAX_BODY", 1<<20))))
+	}
+
+	// Response sent when no backend is healthy; while the watchdog is
+	// provisioning it also carries the estimated time to capacity.
+	if header, err := proxy.ParseHeaders(os.Getenv("NO_BACKENDS_HEADERS")); err != nil {
+		fmt.Fprintf(os.Stderr, "NO_BACKENDS_HEADERS: %v\n", err)
+		os.Exit(1)
+	} else {
+		proxyOpts = append(proxyOpts, proxy.WithNoBackendsResponse(proxy.NoBackendsResponse{
+			Status: envInt("NO_BACKENDS_STATUS", 0),
+			Body:   os.Getenv("NO_BACKENDS_BODY"),
+			Header: header,
+		}))
+	}
+	if watchdog != nil {
+		proxyOpts = append(proxyOpts, proxy.WithCapacityETA(watchdog.TimeToCapacity))
+	}
+
+	// Maintenance mode answers inference routes with 503 while the fleet is
+	// rotated; toggled with MAINTENANCE at startup or via the admin API.
+	maintenance := proxy.NewMaintenance(envDuration("MAINTENANCE_RETRY_AFTER", time.Minute), os.Getenv("MAINTENANCE_MESSAGE"))
+	if on, _ := strconv.ParseBool(os.Getenv("MAINTENANCE")); on {
+		maintenance.SetEnabled(true)
+	}
+	proxyOpts = append(proxyOpts, proxy.WithMaintenance(maintenance))
+
+	// Per-API-key concurrency limits, keyed by fingerprint as in /usage.
+	// Keys aren't validated, so the limits are advisory.
+	if overrides, err := proxy.ParseKeyLimits(os.Getenv("KEY_MAX_CONCURRENCY_OVERRIDES")); err != nil {
+		fmt.Fprintf(os.Stderr, "KEY_MAX_CONCURRENCY_OVERRIDES: %v\n", err)
+		os.Exit(1)
+	} else if limit := envInt("KEY_MAX_CONCURRENCY", 0); limit > 0 || len(overrides) > 0 {
+		proxyOpts = append(proxyOpts, proxy.WithKeyLimits(proxy.NewKeyLimiter(limit, overrides)))
+	}
+
+	// Forward at most MAX_CONCURRENCY inference requests at once; the rest
+	// queue, admitted round-robin across API keys, for up to QUEUE_TIMEOUT.
+	if limit := envInt("MAX_CONCURRENCY", 0); limit > 0 {
+		proxyOpts = append(proxyOpts, proxy.WithAdmission(proxy.NewAdmission(limit, envDuration("QUEUE_TIMEOUT", 30*time.Second))))
+	}
+
+	// Fallback models for pooled routing when a model has no healthy backend.
+	if fallbacks, err := proxy.ParseModelFallbacks(os.Getenv("MODEL_FALLBACKS")); err != nil {
+		fmt.Fprintf(os.Stderr, "MODEL_FALLBACKS: %v\n", err)
+		os.Exit(1)
+	} else if len(fallbacks) > 0 {
+		proxyOpts = append(proxyOpts, proxy.WithModelFallbacks(fallbacks))
+	}
+
+	// Load balancers in front of the proxy whose X-Forwarded-For, X-Real-IP
+	// and Forwarded headers identify the real client.
+	if trusted, err := proxy.ParsePrefixes(os.Getenv("TRUSTED_PROXIES")); err != nil {
+		fmt.Fprintf(os.Stderr, "TRUSTED_PROXIES: %v\n", err)
+		os.Exit(1)
+	} else if len(trusted) > 0 {
+		proxyOpts = append(proxyOpts, proxy.WithTrustedProxies(trusted))
+	}
+
+	// Only accept requests from these client networks (403 otherwise).
+	if allowed, err := proxy.ParsePrefixes(os.Getenv("ALLOWED_CLIENTS")); err != nil {
+		fmt.Fprintf(os.Stderr, "ALLOWED_CLIENTS: %v\n", err)
+		os.Exit(1)
+	} else if len(allowed) > 0 {
+		proxyOpts = append(proxyOpts, proxy.WithAllowedClients(allowed))
+	}
+
+	// Client header rules: FORWARD_HEADERS restricts the X- headers sent to
+	// backends to these correlation headers (W3C trace headers are always
+	// forwarded), DROP_HEADERS never forwards these (e.g. "X-Internal-*"),
+	// and SET_HEADERS adds or overrides Name=value headers.
+	if set, err := proxy.ParseHeaders(os.Getenv("SET_HEADERS")); err != nil {
+		fmt.Fprintf(os.Stderr, "SET_HEADERS: %v\n", err)
+		os.Exit(1)
+	} else {
+		proxyOpts = append(proxyOpts, proxy.WithHeaderRules(proxy.HeaderRules{
+			Forward: envList("FORWARD_HEADERS", ""),
+			Drop:    envList("DROP_HEADERS", ""),
+			Set:     set,
+		}))
+	}
+
+	// Serve the OpenAI Responses API on backends that only speak chat completions.
+	if ok, _ := strconv.ParseBool(os.Getenv("RESPONSES_TRANSLATE")); ok {
+		proxyOpts = append(proxyOpts, proxy.WithResponsesTranslation())
+	}
+
+	// Replace placeholder model names in requests with the backend's model.
+	if ok, _ := strconv.ParseBool(os.Getenv("REWRITE_MODEL")); ok {
+		proxyOpts = append(proxyOpts, proxy.WithModelRewrite())
+	}
+
+	// Token usage per client API key and per backend, for GET /usage, with
+	// optional daily/monthly quotas per key (advisory, like key limits).
+	usage := proxy.NewUsageTracker()
+	if quotas, err := proxy.ParseQuotas(os.Getenv("KEY_QUOTAS")); err != nil {
+		fmt.Fprintf(os.Stderr, "KEY_QUOTAS: %v\n", err)
+		os.Exit(1)
+	} else {
+		usage.SetQuotas(quotas)
+	}
+	proxyOpts = append(proxyOpts, proxy.WithUsage(usage))
+
+	// Request latency percentiles per route, model and backend, for GET
+	// /latency and /metrics.
+	latency := proxy.NewLatencyTracker()
+	proxyOpts = append(proxyOpts, proxy.WithLatency(latency))
+
+	// Time to first token of streaming responses per backend, for GET /ttft.
+	ttft := proxy.NewTTFTTracker()
+	proxyOpts = append(proxyOpts, proxy.WithTTFT(ttft))
+
+	// Optionally persist pinnable instance IDs so sticky sessions survive
+	// a restart: pinned requests wait up to STICKY_WAIT for their instance.
+	var stickyStore *proxy.StickyStore
+	if path := os.Getenv("STICKY_STORE"); path != "" {
+		stickyStore, err = proxy.NewStickyStore(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "STICKY_STORE: %v\n", err)
+			os.Exit(1)
+		}
+		proxyOpts = append(proxyOpts, proxy.WithStickyStore(stickyStore, envDuration("STICKY_WAIT", 30*time.Second)))
+	}
+
+	// With CONTEXT_ROUTING=true, prompts are estimated on ingress so long
+	// ones go to backends whose context window fits them; those that don't
+	// fit any, counted by the engine's tokenizer, are rejected.
+	if on, _ := strconv.ParseBool(os.Getenv("CONTEXT_ROUTING")); on {
+		proxyOpts = append(proxyOpts, proxy.WithContextRouting())
+	}
+
+	if kvCacheLimit > 0 || sizeRouting {
+		proxyOpts = append(proxyOpts, proxy.WithLongPromptTokens(int64(envInt("LONG_PROMPT_TOKENS", 4096))))
+	}
+
 	// Create reverse proxy handler.
-	httpHandler := proxy.NewReverseProxy(balancer, stickyStats)
+	httpHandler := proxy.NewReverseProxy(balancer, stickyStats, proxyOpts...)
 
-	// Create HTTP server.
+	// Create HTTP server. The listener is bound (or inherited) up front so
+	// that bind errors are reported before the TUI takes over the terminal.
 	httpServer := &http.Server{
 		Addr:    listenAddr,
 		Handler: httpHandler,
 	}
+	shutdownTimeout := envDuration("SHUTDOWN_TIMEOUT", 5*time.Second)
+	ln, err := listen(listenAddr, reusePort)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "listen %s: %v\n", listenAddr, err)
+		os.Exit(1)
+	}
+
+	// Serve HTTPS with TLS_CERT/TLS_KEY; TLS_CLIENT_CA additionally
+	// requires client certificates signed by that CA (mutual TLS).
+	tlsConfig, err := serverTLSConfig(os.Getenv("TLS_CERT"), os.Getenv("TLS_KEY"), os.Getenv("TLS_CLIENT_CA"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "TLS: %v\n", err)
+		os.Exit(1)
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	// DIRECT_HTTP serves traffic straight to instances' public HTTP ports
+	// when reachable, skipping the SSH hop (unencrypted).
+	directHTTP, _ := strconv.ParseBool(os.Getenv("DIRECT_HTTP"))
+
+	// At most INIT_CONCURRENCY new instances are connected and health
+	// checked at once, each after a random delay of up to INIT_JITTER, so
+	// a fleet launch doesn't open dozens of SSH sessions simultaneously.
+	initLimit := newInitLimiter(envInt("INIT_CONCURRENCY", 8), envDuration("INIT_JITTER", 2*time.Second))
+
+	// Removed instances' backends keep draining for REMOVE_GRACE before
+	// their tunnels close, so a transient gap in the instance list doesn't
+	// kill in-flight generations.
+	removeGrace := envDuration("REMOVE_GRACE", 30*time.Second)
+
+	// Health checks fail unless /v1/models lists EXPECTED_MODEL, or for
+	// instances labeled in EXPECTED_MODELS (label=model,...) that model.
+	expectedModels := backend.ExpectedModels{Default: os.Getenv("EXPECTED_MODEL")}
+	if raw := os.Getenv("EXPECTED_MODELS"); raw != "" {
+		if expectedModels.ByLabel, err = backend.ParseExpectedModels(raw); err != nil {
+			fmt.Fprintf(os.Stderr, "EXPECTED_MODELS: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// BACKEND_WEIGHTS (gpu=weight,..., per GPU) gives instances more
+	// round-robin traffic in proportion to their GPUs; a label such as
+	// "proxied:w=3" sets an instance's weight directly.
+	weights, err := backend.ParseWeights(os.Getenv("BACKEND_WEIGHTS"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "BACKEND_WEIGHTS: %v\n", err)
+		os.Exit(1)
+	}
+
+	// BOOTSTRAP_CMD, or the script in BOOTSTRAP_SCRIPT, runs over SSH on
+	// each new instance once its tunnel is up (e.g. to pull a LoRA or
+	// restart the server); its output shows in the instance log view.
+	bootstrap := backend.Bootstrap{
+		Command: os.Getenv("BOOTSTRAP_CMD"),
+		Timeout: envDuration("BOOTSTRAP_TIMEOUT", 10*time.Minute),
+	}
+	if path := os.Getenv("BOOTSTRAP_SCRIPT"); path != "" {
+		script, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "BOOTSTRAP_SCRIPT: %v\n", err)
+			os.Exit(1)
+		}
+		bootstrap.Command = string(script)
+	}
+
+	// Bind tunnels' local ends within TUNNEL_PORT_RANGE (e.g. 20000-20999)
+	// so a firewall can be scoped to them.
+	if raw := os.Getenv("TUNNEL_PORT_RANGE"); raw != "" {
+		first, last, err := backend.ParsePortRange(raw)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "TUNNEL_PORT_RANGE: %v\n", err)
+			os.Exit(1)
+		}
+		backend.SetLocalPortRange(first, last)
+	}
+
+	// Timeouts for reaching backends through their tunnels. Streamed
+	// response bodies are never time limited.
+	backendTimeouts := backend.Timeouts{
+		Dial:           envDuration("BACKEND_DIAL_TIMEOUT", backend.DefaultTimeouts.Dial),
+		TLSHandshake:   envDuration("BACKEND_TLS_TIMEOUT", backend.DefaultTimeouts.TLSHandshake),
+		ResponseHeader: envDuration("BACKEND_HEADER_TIMEOUT", backend.DefaultTimeouts.ResponseHeader),
+		Request:        envDuration("BACKEND_REQUEST_TIMEOUT", backend.DefaultTimeouts.Request),
+	}
 
 	// Channels for TUI communication.
 	gpuCh := make(chan backend.GPUUpdate, 64)
@@ -85,20 +600,110 @@ func main() {
 
 	// Handle OS signals.
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	// The outage alarm is raised once no backend has been healthy for
+	// OUTAGE_ALERT_AFTER (default 2m; 0 disables it), after at least one
+	// was. It shows a banner in the TUI and posts to the webhook.
+	var outage *vast.OutageAlarm
+	if d := envDuration("OUTAGE_ALERT_AFTER", 2*time.Minute); d > 0 {
+		outage = vast.NewOutageAlarm(balancer, d)
+	}
+
+	// WEBHOOK_URL receives a POST whenever an instance is added or removed,
+	// its backend turns unhealthy or recovers, or an outage begins or ends.
+	// WEBHOOK_FORMAT is json (default) or slack for a Slack-compatible
+	// {"text": ...} message.
+	if url := os.Getenv("WEBHOOK_URL"); url != "" {
+		format, err := vast.ParseWebhookFormat(os.Getenv("WEBHOOK_FORMAT"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WEBHOOK_FORMAT: %v\n", err)
+			os.Exit(1)
+		}
+		webhook := vast.NewWebhook(url, format)
+		watcher.OnStateChange(webhook.StateChanged)
+		if outage != nil {
+			outage.OnRaise(webhook.Outage)
+			outage.OnClear(webhook.Recovered)
+		}
+		go webhook.Run(ctx, watcher.Subscribe())
+	}
+
+	// EVENT_LOG appends every instance event, state transition and scaling
+	// action to a JSONL file, rotated past EVENT_LOG_MAX_BYTES (default
+	// 10 MB) keeping EVENT_LOG_KEEP old files (default 5).
+	if path := os.Getenv("EVENT_LOG"); path != "" {
+		eventLog, err := vast.OpenEventLog(path, int64(envInt("EVENT_LOG_MAX_BYTES", 10<<20)), envInt("EVENT_LOG_KEEP", 5))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "open event log: %v\n", err)
+			os.Exit(1)
+		}
+		defer eventLog.Close()
+		watcher.OnStateChange(eventLog.StateChanged)
+		watcher.OnAction(eventLog.Action)
+		if watchdog != nil {
+			watchdog.OnAction(eventLog.Action)
+		}
+		go eventLog.Run(ctx, watcher.Subscribe())
+	}
 
 	// Start backend manager (reads from mgrEventCh).
 	// Started before watcher so it's ready to receive events.
-	go manageBackends(ctx, watcher, vastClient, mgrEventCh, balancer, gpuCh, keyPath, proxyLabel)
+	var tunnels backend.TunnelFactory
+	if fleet != nil {
+		tunnels = fleet.Tunnel
+		if every := envDuration("DRY_RUN_CHAOS", 0); every > 0 {
+			go fleet.Chaos(ctx, every, 45*time.Second)
+		}
+	}
+	go manageBackends(ctx, watcher, vastClient, mgrEventCh, balancer, stickyStore, gpuCh, backendTimeouts, directHTTP, bootstrap, keyPath, attachKey, hostKeys, initLimit, removeGrace, expectedModels, weights, proxyLabel, audioLabel, tunnels)
+
+	if watchdog != nil {
+		go watchdog.Run(ctx, time.Minute)
+	}
+
+	// Periodic usage accounting export for cost chargeback (CSV if the
+	// path ends in .csv, JSON otherwise).
+	usageExport := os.Getenv("USAGE_EXPORT")
+	if usageExport != "" {
+		go usage.RunExport(ctx, usageExport, envDuration("USAGE_EXPORT_INTERVAL", 5*time.Minute))
+	}
+
+	// Optionally destroy instances that stay unhealthy, e.g. dead-on-arrival
+	// rentals, so they stop billing unattended.
+	if d := envDuration("DESTROY_UNHEALTHY_AFTER", 0); d > 0 {
+		var onDestroy func(vast.Instance)
+		if recreate {
+			onDestroy = func(inst vast.Instance) {
+				go watchdog.Replace(ctx, inst)
+			}
+		}
+		go watcher.ReapUnhealthy(ctx, d, time.Minute, onDestroy)
+	}
 
 	// Start HTTP server.
 	go func() {
-		log.Printf("HTTP server listening on %s", listenAddr)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("HTTP server listening on %s", ln.Addr())
+		if err := httpServer.Serve(ln); err != nil && err != http.ErrServerClosed {
 			log.Printf("HTTP server error: %v", err)
 		}
 	}()
 
+	// Start the admin API on its own listener, if configured.
+	var adminServer *http.Server
+	if adminAddr := os.Getenv("ADMIN_ADDR"); adminAddr != "" {
+		admin := &proxy.Admin{Balancer: balancer, Captures: captures, Usage: usage, Latency: latency, TTFT: ttft, Maintenance: maintenance, Watcher: watcher, Sticky: stickyStats, Build: &build}
+		// ADMIN_PPROF adds pprof and runtime stats for diagnosing leaks.
+		admin.Debug, _ = strconv.ParseBool(os.Getenv("ADMIN_PPROF"))
+		adminServer = &http.Server{Addr: adminAddr, Handler: admin.Handler()}
+		go func() {
+			log.Printf("admin server listening on %s", adminAddr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("admin server error: %v", err)
+			}
+		}()
+	}
+
 	// Create TUI model. Pass a start function that kicks off the watcher
 	// once Init() runs, ensuring the TUI is ready to receive events.
 	startWatcher := func() {
@@ -107,15 +712,93 @@ func main() {
 	abortFn := func() {
 		balancer.AbortAll(context.Background())
 	}
+	abortOneFn := func(id int) {
+		if err := balancer.AbortBackend(context.Background(), id); err != nil {
+			log.Printf("abort on instance %d failed: %v", id, err)
+		}
+	}
 	destroyFn := func() {
 		watcher.DestroyAll(context.Background())
 	}
-	tuiModel := tui.NewModel(tuiEventCh, gpuCh, listenAddr, startWatcher, abortFn, destroyFn, stickyStats, balancer)
-	p := tea.NewProgram(tuiModel, tea.WithAltScreen())
+	cleanupFn := func() {
+		watcher.DestroyUnhealthy(context.Background())
+	}
+	destroyOneFn := func(id int) {
+		if err := watcher.Destroy(context.Background(), id); err != nil {
+			log.Printf("destroy instance %d failed: %v", id, err)
+		}
+	}
+	// The instance detail view shows the bootstrap command's output, then
+	// container logs, which need the vast.ai API.
+	var logsFn tui.LogsFunc
+	if vastClient != nil || bootstrap.Command != "" {
+		logsFn = func(id int) ([]string, error) {
+			var lines []string
+			if be := balancer.Backend(id); be != nil {
+				lines = be.BootstrapLog()
+			}
+			if vastClient == nil {
+				return lines, nil
+			}
+			ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			defer cancel()
+			logs, err := vastClient.InstanceLogs(ctx, id, 50)
+			if err != nil {
+				return lines, err
+			}
+			return append(lines, strings.Split(strings.TrimRight(logs, "\n"), "\n")...), nil
+		}
+	}
+	if fleet != nil {
+		logsFn = fleet.Logs
+	}
+	version := build.String()
+	if fleet != nil {
+		version += " (dry run)"
+	}
+	tuiModel := tui.NewModel(tuiEventCh, gpuCh, listenAddr, version, startWatcher, abortFn, abortOneFn, destroyFn, destroyOneFn, cleanupFn, stickyStats, balancer, balancer, logsFn)
+	tuiModel.SetConfig([]tui.ConfigItem{
+		{Name: "label", Value: proxyLabel},
+		{Name: "strategy", Value: strategy.String()},
+		{Name: "pools", Value: poolMode.String()},
+		{Name: "admin", Value: os.Getenv("ADMIN_ADDR")},
+	})
+	tuiModel.SetProxyURL(tui.ProxyURL(listenAddr, tlsConfig != nil))
+	if recent != nil {
+		tuiModel.SetRequests(func() []tui.RequestView {
+			var views []tui.RequestView
+			for _, rr := range recent.Recent() {
+				views = append(views, tui.RequestView(rr))
+			}
+			return views
+		})
+	}
+	if outage != nil {
+		tuiModel.SetOutage(outage)
+	}
+	// The wheel scrolls and a click selects a card; TUI_MOUSE=false leaves
+	// the mouse to the terminal, e.g. for selecting text without shift.
+	teaOpts := []tea.ProgramOption{tea.WithAltScreen()}
+	if mouse, err := strconv.ParseBool(os.Getenv("TUI_MOUSE")); mouse || err != nil {
+		teaOpts = append(teaOpts, tea.WithMouseCellMotion())
+	}
+	p := tea.NewProgram(tuiModel, teaOpts...)
+
+	// OUTAGE_EXIT=true quits with exit status 3 when the outage alarm is
+	// raised, so a supervisor can page someone or restart the proxy.
+	var outageExit atomic.Bool
+	if outage != nil {
+		if exit, _ := strconv.ParseBool(os.Getenv("OUTAGE_EXIT")); exit {
+			outage.OnRaise(func(time.Time) {
+				outageExit.Store(true)
+				p.Send(tea.Quit())
+			})
+		}
+		go outage.Run(ctx, 5*time.Second)
+	}
 
 	go func() {
 		<-sigCh
-		cancel()
 		p.Send(tea.Quit())
 	}()
 
@@ -124,17 +807,90 @@ func main() {
 		fmt.Fprintf(os.Stderr, "TUI error: %v\n", err)
 	}
 
-	// Graceful shutdown.
+	// Graceful shutdown. Stop accepting requests and let in-flight ones
+	// (typically long generations) finish for up to STREAM_DRAIN_TIMEOUT
+	// before cancelling, which closes the tunnels they run over.
+	drainTimeout := envDuration("STREAM_DRAIN_TIMEOUT", shutdownTimeout)
+	if n := balancer.ActiveRequests(); n > 0 {
+		fmt.Fprintf(os.Stderr, "Waiting up to %s for %d in-flight requests...\n", drainTimeout, n)
+	}
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer drainCancel()
+	if err := httpServer.Shutdown(drainCtx); err != nil {
+		log.Printf("shutdown: abandoning %d in-flight requests: %v", balancer.ActiveRequests(), err)
+		_ = httpServer.Close()
+	}
 	cancel()
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if usageExport != "" {
+		if err := usage.Export(usageExport); err != nil {
+			log.Printf("usage export: %v", err)
+		}
+	}
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer shutdownCancel()
-	_ = httpServer.Shutdown(shutdownCtx)
+	if adminServer != nil {
+		_ = adminServer.Shutdown(shutdownCtx)
+	}
+	if outageExit.Load() {
+		fmt.Fprintln(os.Stderr, "Exiting: no healthy backends (OUTAGE_EXIT)")
+		os.Exit(3)
+	}
+}
+
+// envInt returns the integer value of an environment variable, or def if it
+// is unset or invalid.
+func envInt(name string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// envFloat returns the float value of an environment variable, or def if
+// it is unset or invalid.
+func envFloat(name string, def float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// envDuration returns the time.Duration value of an environment variable
+// (e.g. "2s"), or def if it is unset or invalid.
+func envDuration(name string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// envList returns a comma-separated environment variable as a slice,
+// falling back to def when unset. "none" yields an empty list.
+func envList(name, def string) []string {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		v = def
+	}
+	if v == "none" || v == "" {
+		return nil
+	}
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
 }
 
-// manageBackends bridges watcher events to backend creation/removal.
-func manageBackends(ctx context.Context, watcher *vast.Watcher, vastClient *vast.Client, eventCh <-chan vast.InstanceEvent, bal *proxy.Balancer, gpuCh chan<- backend.GPUUpdate, keyPath string, proxyLabel string) {
+// manageBackends bridges discovery events to backend creation/removal.
+func manageBackends(ctx context.Context, watcher vast.Discovery, vastClient *vast.Client, eventCh <-chan vast.InstanceEvent, bal *proxy.Balancer, stickyStore *proxy.StickyStore, gpuCh chan<- backend.GPUUpdate, timeouts backend.Timeouts, directHTTP bool, bootstrap backend.Bootstrap, keyPath string, attachKey string, hostKeys *backend.HostKeys, initLimit *initLimiter, removeGrace time.Duration, expectedModels backend.ExpectedModels, weights backend.Weights, proxyLabel string, audioLabel string, tunnels backend.TunnelFactory) {
 	backends := make(map[int]*backend.Backend)
 	cancels := make(map[int]context.CancelFunc)
+	removals := make(map[int]*time.Timer) // backends in their removal grace period
 	var mu sync.Mutex
 
 	updateBalancer := func() {
@@ -147,29 +903,84 @@ func manageBackends(ctx context.Context, watcher *vast.Watcher, vastClient *vast
 		bal.SetBackends(list)
 	}
 
+	// teardown closes the backend for id. Must be called with mu held.
+	teardown := func(id int) {
+		if t, ok := removals[id]; ok {
+			t.Stop()
+			delete(removals, id)
+		}
+		if be, ok := backends[id]; ok {
+			be.Close()
+			delete(backends, id)
+		}
+		if cancelFn, ok := cancels[id]; ok {
+			cancelFn()
+			delete(cancels, id)
+		}
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			mu.Lock()
-			for id, be := range backends {
-				be.Close()
-				if cancelFn, ok := cancels[id]; ok {
-					cancelFn()
-				}
+			for id := range backends {
+				teardown(id)
 			}
 			mu.Unlock()
 			return
 
 		case evt, ok := <-eventCh:
 			if !ok {
-				return
+				// Discovery stopped; keep the backends until shutdown.
+				eventCh = nil
+				continue
 			}
 
 			switch evt.Type {
-			case "added":
+			case "added", "moved", "restarted":
 				inst := evt.Instance
+				mu.Lock()
+				if evt.Type != "added" {
+					log.Printf("backend manager: instance %d %s, rebuilding its backend", inst.ID, evt.Type)
+					teardown(inst.ID)
+				} else if t, ok := removals[inst.ID]; ok {
+					// Back within the grace period: keep the backend if
+					// it is still healthy and reached the same way. (Its
+					// health loop stops once a check fails while the
+					// instance is gone.)
+					be := backends[inst.ID]
+					be.SetDraining(false)
+					if be.IsHealthy() && be.Instance.SameEndpoints(inst) {
+						t.Stop()
+						delete(removals, inst.ID)
+						mu.Unlock()
+						log.Printf("backend manager: instance %d is back, keeping its backend", inst.ID)
+						watcher.SetInstanceState(inst.ID, vast.StateHealthy)
+						updateBalancer()
+						continue
+					}
+					teardown(inst.ID)
+				}
+				mu.Unlock()
 				log.Printf("backend manager: adding instance %d (%s)", inst.ID, inst.DisplayName())
-				be := backend.NewBackend(inst, keyPath, vastClient, proxyLabel)
+				// Audio instances are identified by their label, so
+				// don't replace it with the managed one.
+				label := proxyLabel
+				if audioLabel != "" && inst.BaseLabel() == audioLabel {
+					label = ""
+				}
+				be := backend.NewBackend(inst, keyPath, vastClient, label)
+				be.SetTimeouts(timeouts)
+				be.SetDirectHTTP(directHTTP)
+				be.SetBootstrap(bootstrap)
+				be.SetExpectedModel(expectedModels.For(inst.BaseLabel()))
+				be.SetWeight(weights.For(inst))
+				if hostKeys != nil {
+					be.SetHostKeys(hostKeys)
+				}
+				if tunnels != nil {
+					be.SetTunnelFactory(tunnels)
+				}
 				beCtx, beCancel := context.WithCancel(ctx)
 
 				mu.Lock()
@@ -187,8 +998,18 @@ func manageBackends(ctx context.Context, watcher *vast.Watcher, vastClient *vast
 							watcher.SetInstanceState(inst.ID, vast.StateUnhealthy)
 						}
 					}()
+					if !initLimit.acquire(beCtx) {
+						return // removed while waiting
+					}
+					release := sync.OnceFunc(initLimit.release)
+					defer release()
 					watcher.SetInstanceState(inst.ID, vast.StateConnecting)
 
+					if attachKey != "" {
+						if err := vastClient.AttachSSHKey(beCtx, inst.ID, attachKey); err != nil {
+							log.Printf("backend %d: attach ssh key: %v", inst.ID, err)
+						}
+					}
 					be.EnsureSSH()
 					if err := be.CheckHealth(beCtx); err != nil {
 						log.Printf("backend %d: initial health check failed: %v", inst.ID, err)
@@ -207,25 +1028,62 @@ func manageBackends(ctx context.Context, watcher *vast.Watcher, vastClient *vast
 						}
 					}
 
+					release()
+
 					// Continue with periodic health + GPU loop.
 					be.StartHealthLoop(beCtx, watcher, gpuCh)
 				}()
 
-			case "removed":
+			case "draining":
 				id := evt.Instance.ID
-				log.Printf("backend manager: removing instance %d", id)
+				log.Printf("backend manager: draining instance %d", id)
 				mu.Lock()
 				if be, ok := backends[id]; ok {
-					be.Close()
-					delete(backends, id)
-				}
-				if cancelFn, ok := cancels[id]; ok {
-					cancelFn()
-					delete(cancels, id)
+					be.SetDraining(true)
 				}
 				mu.Unlock()
 
-				updateBalancer()
+			case "removed":
+				id := evt.Instance.ID
+				remove := func() {
+					if stickyStore != nil {
+						stickyStore.Forget(id)
+					}
+					updateBalancer()
+				}
+				mu.Lock()
+				be, ok := backends[id]
+				_, pending := removals[id]
+				switch {
+				case pending:
+					mu.Unlock()
+				case ok && removeGrace > 0 && !be.IsDraining():
+					// Stop new requests now; close after the grace period
+					// unless the instance comes back. Draining (preempted)
+					// backends have already had their grace period.
+					log.Printf("backend manager: removing instance %d in %v", id, removeGrace)
+					be.SetDraining(true)
+					var t *time.Timer
+					t = time.AfterFunc(removeGrace, func() {
+						mu.Lock()
+						if removals[id] != t {
+							mu.Unlock()
+							return // came back, or replaced
+						}
+						log.Printf("backend manager: removing instance %d", id)
+						teardown(id)
+						mu.Unlock()
+						remove()
+					})
+					removals[id] = t
+					mu.Unlock()
+					updateBalancer()
+				default:
+					log.Printf("backend manager: removing instance %d", id)
+					teardown(id)
+					mu.Unlock()
+					remove()
+				}
 			}
 		}
 	}
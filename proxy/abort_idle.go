@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// WithAbortOnIdle aborts all in-flight inference on every backend once no
+// request has been in flight for delay, freeing GPUs from generations
+// nobody is waiting on. It suits a single user: with several clients the
+// in-flight count can drop to zero just as another request starts, and
+// the abort cancels it. SGLang requests are also aborted one by one when
+// their client disconnects, which is safe for any number of clients.
+func WithAbortOnIdle(delay time.Duration) Option {
+	return func(h *handler) {
+		h.abortOnIdle = true
+		h.abortIdleDelay = delay
+	}
+}
+
+// abortIfIdle aborts all backend work if the proxy is still idle after the
+// configured delay.
+func (h *handler) abortIfIdle() {
+	time.AfterFunc(h.abortIdleDelay, func() {
+		if h.balancer.ActiveRequests() != 0 {
+			return
+		}
+		log.Printf("proxy: idle for %v, aborting all backend work", h.abortIdleDelay)
+		h.balancer.AbortAll(context.Background())
+	})
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vastproxytest"
+)
+
+// abortCountingBackend returns a healthy SGLang backend on a fake server
+// that counts abort requests.
+func abortCountingBackend(t *testing.T) (*backend.Backend, *vastproxytest.SGLang) {
+	t.Helper()
+	srv := vastproxytest.NewSGLang(t, "test-model")
+	return vastproxytest.NewBackend(1, srv), srv
+}
+
+func TestAbortOnIdleDefaultOff(t *testing.T) {
+	be, srv := abortCountingBackend(t)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`)))
+	time.Sleep(50 * time.Millisecond)
+	if n := srv.Aborts(); n != 0 {
+		t.Errorf("abort called %d times, want 0 by default", n)
+	}
+}
+
+func TestAbortOnIdle(t *testing.T) {
+	be, srv := abortCountingBackend(t)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithAbortOnIdle(20*time.Millisecond))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`)))
+	if n := srv.Aborts(); n != 0 {
+		t.Errorf("abort called %d times before the idle delay", n)
+	}
+	deadline := time.Now().Add(time.Second)
+	for srv.Aborts() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := srv.Aborts(); n != 1 {
+		t.Errorf("abort called %d times after the idle delay, want 1", n)
+	}
+}
+
+func TestAbortOnIdleSkippedWhenBusy(t *testing.T) {
+	be, srv := abortCountingBackend(t)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithAbortOnIdle(20*time.Millisecond))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`)))
+	bal.Acquire() // another request starts within the delay
+	defer bal.Release()
+	time.Sleep(60 * time.Millisecond)
+	if n := srv.Aborts(); n != 0 {
+		t.Errorf("abort called %d times with a request in flight, want 0", n)
+	}
+}
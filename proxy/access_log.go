@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat selects how access log lines are written.
+type AccessLogFormat int
+
+const (
+	// AccessLogCombined writes Apache/nginx Combined Log Format lines,
+	// followed by backend, upstream status and duration fields.
+	AccessLogCombined AccessLogFormat = iota
+	// AccessLogJSON writes one JSON object per line.
+	AccessLogJSON
+)
+
+// ParseAccessLogFormat parses "combined" or "json" (case-insensitive).
+func ParseAccessLogFormat(s string) (AccessLogFormat, error) {
+	switch strings.ToLower(s) {
+	case "", "combined":
+		return AccessLogCombined, nil
+	case "json":
+		return AccessLogJSON, nil
+	default:
+		return 0, fmt.Errorf("unknown access log format %q", s)
+	}
+}
+
+// AccessLogEntry describes a single proxied request.
+type AccessLogEntry struct {
+	Time           time.Time
+	RequestID      string
+	ClientAddr     string
+	Method         string
+	URI            string
+	Proto          string
+	Status         int
+	Bytes          int64
+	BackendID      int // 0 if no backend was picked
+	UpstreamStatus int // 0 if the backend never responded
+	Duration       time.Duration
+	Referer        string
+	UserAgent      string
+}
+
+// AccessLog writes one line per request to w. It is independent of the
+// debug log so standard log tooling can consume it. Safe for concurrent use.
+type AccessLog struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format AccessLogFormat
+}
+
+// NewAccessLog creates an access logger writing lines in format to w.
+func NewAccessLog(w io.Writer, format AccessLogFormat) *AccessLog {
+	return &AccessLog{w: w, format: format}
+}
+
+// WithAccessLog enables per-request access logging.
+func WithAccessLog(a *AccessLog) Option {
+	return func(h *handler) {
+		h.accessLog = a
+	}
+}
+
+// Log writes an entry. Write errors are ignored.
+func (a *AccessLog) Log(e AccessLogEntry) {
+	var line []byte
+	switch a.format {
+	case AccessLogJSON:
+		line = e.jsonLine()
+	default:
+		line = e.combinedLine()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.w.Write(line)
+}
+
+// combinedLine renders e in Combined Log Format with trailing extras:
+//
+//	host - - [02/Jan/2006:15:04:05 -0700] "GET /v1/models HTTP/1.1" 200 123 "-" "curl/8.0" backend=1 upstream=200 duration_ms=12 request_id=abc
+func (e AccessLogEntry) combinedLine() []byte {
+	return fmt.Appendf(nil, "%s - - [%s] \"%s %s %s\" %d %d %q %q backend=%d upstream=%d duration_ms=%d request_id=%s\n",
+		clientHost(e.ClientAddr),
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method, e.URI, e.Proto,
+		e.Status, e.Bytes,
+		orDash(e.Referer), orDash(e.UserAgent),
+		e.BackendID, e.UpstreamStatus, e.Duration.Milliseconds(), orDash(e.RequestID))
+}
+
+func (e AccessLogEntry) jsonLine() []byte {
+	line, _ := json.Marshal(struct {
+		Time           string  `json:"time"`
+		RequestID      string  `json:"request_id,omitempty"`
+		ClientAddr     string  `json:"client_addr"`
+		Method         string  `json:"method"`
+		URI            string  `json:"uri"`
+		Proto          string  `json:"proto"`
+		Status         int     `json:"status"`
+		Bytes          int64   `json:"bytes"`
+		BackendID      int     `json:"backend_id"`
+		UpstreamStatus int     `json:"upstream_status"`
+		DurationMS     float64 `json:"duration_ms"`
+		Referer        string  `json:"referer,omitempty"`
+		UserAgent      string  `json:"user_agent,omitempty"`
+	}{
+		Time:           e.Time.Format(time.RFC3339Nano),
+		RequestID:      e.RequestID,
+		ClientAddr:     clientHost(e.ClientAddr),
+		Method:         e.Method,
+		URI:            e.URI,
+		Proto:          e.Proto,
+		Status:         e.Status,
+		Bytes:          e.Bytes,
+		BackendID:      e.BackendID,
+		UpstreamStatus: e.UpstreamStatus,
+		DurationMS:     float64(e.Duration.Microseconds()) / 1000,
+		Referer:        e.Referer,
+		UserAgent:      e.UserAgent,
+	})
+	return append(line, '\n')
+}
+
+// clientHost strips the port from a RemoteAddr.
+func clientHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	if addr == "" {
+		return "-"
+	}
+	return addr
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+func TestParseAccessLogFormat(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    AccessLogFormat
+		wantErr bool
+	}{
+		{"", AccessLogCombined, false},
+		{"combined", AccessLogCombined, false},
+		{"JSON", AccessLogJSON, false},
+		{"xml", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAccessLogFormat(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAccessLogFormat(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseAccessLogFormat(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	var buf bytes.Buffer
+	al := NewAccessLog(&buf, AccessLogCombined)
+	al.Log(AccessLogEntry{
+		Time:           time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		ClientAddr:     "10.0.0.1:5555",
+		Method:         "POST",
+		URI:            "/v1/chat/completions",
+		Proto:          "HTTP/1.1",
+		Status:         200,
+		Bytes:          42,
+		BackendID:      7,
+		UpstreamStatus: 200,
+		Duration:       1500 * time.Millisecond,
+		UserAgent:      "curl/8.0",
+	})
+
+	want := `10.0.0.1 - - [01/Mar/2024:12:00:00 +0000] "POST /v1/chat/completions HTTP/1.1" 200 42 "-" "curl/8.0" backend=7 upstream=200 duration_ms=1500 request_id=-` + "\n"
+	if buf.String() != want {
+		t.Errorf("line =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	var buf bytes.Buffer
+	al := NewAccessLog(&buf, AccessLogJSON)
+	al.Log(AccessLogEntry{
+		Time:       time.Now(),
+		ClientAddr: "10.0.0.1:5555",
+		Method:     "GET",
+		URI:        "/v1/models",
+		Status:     503,
+	})
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if got["client_addr"] != "10.0.0.1" || got["method"] != "GET" || got["status"] != float64(503) {
+		t.Errorf("entry = %v", got)
+	}
+}
+
+func TestReverseProxyAccessLog(t *testing.T) {
+	backendSrv := fakeBackendServer(t)
+	defer backendSrv.Close()
+
+	inst := &vast.Instance{ID: 3}
+	be := backend.NewBackend(inst, "", nil, "")
+	be.SetBaseURL(backendSrv.URL)
+	be.SetHealthy(true)
+
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+
+	var buf bytes.Buffer
+	handler := NewReverseProxy(bal, nil, WithAccessLog(NewAccessLog(&buf, AccessLogJSON)))
+
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if got["backend_id"] != float64(3) || got["upstream_status"] != float64(200) || got["status"] != float64(200) {
+		t.Errorf("entry = %v", got)
+	}
+	if got["bytes"].(float64) <= 0 {
+		t.Errorf("bytes = %v, want > 0", got["bytes"])
+	}
+}
+
+func TestReverseProxyAccessLogNoBackends(t *testing.T) {
+	var buf bytes.Buffer
+	handler := NewReverseProxy(NewBalancer(), nil, WithAccessLog(NewAccessLog(&buf, AccessLogCombined)))
+
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := buf.String()
+	if !strings.Contains(line, `"GET /v1/models HTTP/1.1" 503`) || !strings.Contains(line, "backend=0 upstream=0") {
+		t.Errorf("line = %q", line)
+	}
+}
@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/shutej/vastproxy/vast"
+)
+
+// Admin serves the proxy's admin API, intended for a separate listener that
+// isn't exposed to API clients. Endpoints whose feature isn't configured
+// (nil field) respond 404.
+type Admin struct {
+	Balancer    *Balancer
+	Captures    *BodyCapture
+	Usage       *UsageTracker
+	Latency     *LatencyTracker
+	TTFT        *TTFTTracker
+	Maintenance *Maintenance
+	Watcher     *vast.Watcher
+	Sticky      *StickyStats
+	Build       *BuildInfo
+
+	// Debug serves net/http/pprof and runtime stats. Profiles expose
+	// internals (and cost CPU), so it is off unless explicitly enabled.
+	Debug bool
+}
+
+// Handler returns the admin API http.Handler.
+//
+//	GET /captures — recent captured request/response bodies, newest first
+//	GET /debug/pprof/ — net/http/pprof profiles (goroutine, heap, ...), if Debug
+//	GET /debug/runtime — goroutine count and memory stats, if Debug
+//	POST /instances/{id}/abort — abort all in-flight inference on one
+//	                backend, e.g. when it is wedged mid-generation
+//	GET /latency  — request duration percentiles per route, model and backend
+//	GET /maintenance — whether maintenance mode is on
+//	POST /maintenance?enabled=true|false — turn maintenance mode on or off
+//	GET /metrics  — latency and TTFT summaries in Prometheus text format
+//	GET /pools    — per-pool backend counts and in-flight requests
+//	POST /pause   — stop accepting new requests (clients get 503)
+//	POST /resume  — accept new requests again
+//	GET /split    — the traffic split between instance labels
+//	POST /split   — replace the traffic split with a JSON object of label
+//	                to percent, e.g. {"stable":90,"canary":10}; {} removes it
+//	GET /status   — instances, states, models, GPU metrics and load, as
+//	                shown in the TUI
+//	GET /ttft     — average time to first token per backend
+//	GET /usage    — token usage per API key fingerprint and per backend, and
+//	                quota consumption
+//	GET /usage/export — usage per API key, backend and model as JSON, or
+//	                CSV with ?format=csv
+//	GET /version  — version, commit and build date of this binary
+func (a *Admin) Handler() http.Handler {
+	mux := http.NewServeMux()
+	if a.Debug {
+		registerDebug(mux)
+	}
+	mux.HandleFunc("GET /pools", func(w http.ResponseWriter, r *http.Request) {
+		if a.Balancer == nil {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, a.Balancer.Pools())
+	})
+	setPaused := func(paused bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if a.Balancer == nil {
+				http.NotFound(w, r)
+				return
+			}
+			a.Balancer.SetPaused(paused)
+			writeJSON(w, http.StatusOK, map[string]bool{"paused": paused})
+		}
+	}
+	mux.HandleFunc("POST /pause", setPaused(true))
+	mux.HandleFunc("POST /resume", setPaused(false))
+	mux.HandleFunc("POST /instances/{id}/abort", func(w http.ResponseWriter, r *http.Request) {
+		if a.Balancer == nil {
+			http.NotFound(w, r)
+			return
+		}
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "invalid instance id", http.StatusBadRequest)
+			return
+		}
+		switch err := a.Balancer.AbortBackend(r.Context(), id); {
+		case errors.Is(err, ErrUnknownBackend):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrNoAbort):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		default:
+			writeJSON(w, http.StatusOK, map[string]int{"aborted": id})
+		}
+	})
+	mux.HandleFunc("GET /split", func(w http.ResponseWriter, r *http.Request) {
+		if a.Balancer == nil {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, a.Balancer.TrafficSplit())
+	})
+	mux.HandleFunc("POST /split", func(w http.ResponseWriter, r *http.Request) {
+		if a.Balancer == nil {
+			http.NotFound(w, r)
+			return
+		}
+		var split TrafficSplit
+		if err := json.NewDecoder(r.Body).Decode(&split); err != nil {
+			http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := a.Balancer.SetTrafficSplit(split); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, a.Balancer.TrafficSplit())
+	})
+	mux.HandleFunc("GET /maintenance", func(w http.ResponseWriter, r *http.Request) {
+		if a.Maintenance == nil {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"enabled": a.Maintenance.Enabled()})
+	})
+	mux.HandleFunc("POST /maintenance", func(w http.ResponseWriter, r *http.Request) {
+		if a.Maintenance == nil {
+			http.NotFound(w, r)
+			return
+		}
+		enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+		if err != nil {
+			http.Error(w, "enabled must be true or false", http.StatusBadRequest)
+			return
+		}
+		a.Maintenance.SetEnabled(enabled)
+		writeJSON(w, http.StatusOK, map[string]bool{"enabled": enabled})
+	})
+	mux.HandleFunc("GET /captures", func(w http.ResponseWriter, r *http.Request) {
+		if a.Captures == nil {
+			http.Error(w, "body capture disabled", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, a.Captures.Recent())
+	})
+	mux.HandleFunc("GET /usage", func(w http.ResponseWriter, r *http.Request) {
+		if a.Usage == nil {
+			http.Error(w, "usage tracking disabled", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"by_key":     a.Usage.ByKey(),
+			"by_backend": a.Usage.ByBackend(),
+			"quotas":     a.Usage.Quotas(),
+		})
+	})
+	mux.HandleFunc("GET /usage/export", func(w http.ResponseWriter, r *http.Request) {
+		if a.Usage == nil {
+			http.Error(w, "usage tracking disabled", http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			a.Usage.WriteCSV(w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		a.Usage.WriteJSON(w)
+	})
+	mux.HandleFunc("GET /latency", func(w http.ResponseWriter, r *http.Request) {
+		if a.Latency == nil {
+			http.Error(w, "latency tracking disabled", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, a.Latency.Summaries())
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if a.Latency != nil {
+			a.Latency.WritePrometheus(w)
+		}
+		if a.TTFT != nil {
+			a.TTFT.WritePrometheus(w)
+		}
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		if a.Watcher == nil || a.Balancer == nil {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, FleetStatus(a.Watcher.List(), a.Balancer, a.Sticky))
+	})
+	mux.HandleFunc("GET /version", func(w http.ResponseWriter, r *http.Request) {
+		if a.Build == nil {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, a.Build)
+	})
+	mux.HandleFunc("GET /ttft", func(w http.ResponseWriter, r *http.Request) {
+		if a.TTFT == nil {
+			http.Error(w, "TTFT tracking disabled", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, a.TTFT.ByBackend())
+	})
+	return mux
+}
+
+// writeJSON writes v as an indented JSON response.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrQueueTimeout is returned by Admission.Acquire when a request waited
+// in the queue longer than the configured maximum.
+var ErrQueueTimeout = errors.New("timed out waiting in the admission queue")
+
+// Admission caps the number of requests forwarded at once and queues the
+// rest. Queued requests are admitted round-robin across API keys rather
+// than first in, first out, so one client flooding the queue can't starve
+// interactive users. Safe for concurrent use.
+type Admission struct {
+	mu      sync.Mutex
+	limit   int
+	maxWait time.Duration // 0 = wait as long as the request does
+	active  int
+	queues  map[string][]chan struct{} // waiting requests per key, oldest first
+	order   []string                   // keys with waiting requests, next to admit first
+}
+
+// NewAdmission creates an admission queue forwarding up to limit requests
+// at once. Requests queued longer than maxWait (if non-zero) give up.
+func NewAdmission(limit int, maxWait time.Duration) *Admission {
+	return &Admission{
+		limit:   limit,
+		maxWait: maxWait,
+		queues:  make(map[string][]chan struct{}),
+	}
+}
+
+// WithAdmission queues inference requests once the admission limit is
+// reached, answering 503 to those that time out in the queue.
+func WithAdmission(a *Admission) Option {
+	return func(h *handler) {
+		h.admission = a
+	}
+}
+
+// Acquire waits for a request slot for key. It fails with ErrQueueTimeout
+// or ctx's error if no slot frees up in time. Each successful Acquire must
+// be paired with Release.
+func (a *Admission) Acquire(ctx context.Context, key string) error {
+	a.mu.Lock()
+	if a.active < a.limit && len(a.order) == 0 {
+		a.active++
+		a.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{}, 1)
+	if len(a.queues[key]) == 0 {
+		a.order = append(a.order, key)
+	}
+	a.queues[key] = append(a.queues[key], ready)
+	a.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if a.maxWait > 0 {
+		t := time.NewTimer(a.maxWait)
+		defer t.Stop()
+		timeout = t.C
+	}
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = ErrQueueTimeout
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.dequeue(key, ready) {
+		// Admitted while giving up: pass the slot on.
+		a.releaseLocked()
+	}
+	return err
+}
+
+// dequeue removes ready from key's queue, reporting false if it was
+// already admitted. Must be called with mu held.
+func (a *Admission) dequeue(key string, ready chan struct{}) bool {
+	q := a.queues[key]
+	i := slices.Index(q, ready)
+	if i < 0 {
+		return false
+	}
+	if q = slices.Delete(q, i, i+1); len(q) > 0 {
+		a.queues[key] = q
+	} else {
+		delete(a.queues, key)
+		a.order = slices.DeleteFunc(a.order, func(k string) bool { return k == key })
+	}
+	return true
+}
+
+// Release frees a slot reserved by Acquire, handing it to the oldest
+// request of the next key in turn.
+func (a *Admission) Release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.releaseLocked()
+}
+
+func (a *Admission) releaseLocked() {
+	if len(a.order) == 0 {
+		a.active--
+		return
+	}
+	key := a.order[0]
+	a.order = a.order[1:]
+	q := a.queues[key]
+	ready := q[0]
+	if q = q[1:]; len(q) > 0 {
+		a.queues[key] = q
+		a.order = append(a.order, key)
+	} else {
+		delete(a.queues, key)
+	}
+	ready <- struct{}{}
+}
+
+// Queued returns the number of requests waiting per key.
+func (a *Admission) Queued() map[string]int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	queued := make(map[string]int, len(a.queues))
+	for key, q := range a.queues {
+		queued[key] = len(q)
+	}
+	return queued
+}
+
+// writeQueueTimeout writes the 503 response sent when a request waited
+// too long for an admission slot.
+func writeQueueTimeout(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "1")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(`{"error":{"message":"the fleet is at capacity; timed out waiting in the queue","type":"server_error","code":"queue_timeout"}}`))
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// waitQueued waits until n requests are queued on a.
+func waitQueued(t *testing.T, a *Admission, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		total := 0
+		for _, q := range a.Queued() {
+			total += q
+		}
+		if total == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Queued() = %v, want %d waiting", a.Queued(), n)
+}
+
+func TestAdmissionRoundRobinAcrossKeys(t *testing.T) {
+	a := NewAdmission(1, 0)
+	if err := a.Acquire(context.Background(), "key-flood"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The flooding key queues three requests before the interactive one.
+	admitted := make(chan string, 4)
+	enqueue := func(key string) {
+		go func() {
+			if err := a.Acquire(context.Background(), key); err == nil {
+				admitted <- key
+			}
+		}()
+	}
+	for i := range 3 {
+		enqueue("key-flood")
+		waitQueued(t, a, i+1)
+	}
+	enqueue("key-chat")
+	waitQueued(t, a, 4)
+
+	var got []string
+	for range 4 {
+		a.Release()
+		got = append(got, <-admitted)
+	}
+	want := []string{"key-flood", "key-chat", "key-flood", "key-flood"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("admission order = %v, want %v", got, want)
+	}
+}
+
+func TestAdmissionTimeout(t *testing.T) {
+	a := NewAdmission(1, 20*time.Millisecond)
+	a.Acquire(context.Background(), "key-a")
+	if err := a.Acquire(context.Background(), "key-b"); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("Acquire() = %v, want ErrQueueTimeout", err)
+	}
+	if q := a.Queued(); len(q) != 0 {
+		t.Errorf("Queued() = %v after timeout, want empty", q)
+	}
+
+	// The slot still frees up normally.
+	a.Release()
+	if err := a.Acquire(context.Background(), "key-b"); err != nil {
+		t.Errorf("Acquire() after Release = %v", err)
+	}
+}
+
+func TestAdmissionCanceled(t *testing.T) {
+	a := NewAdmission(1, 0)
+	a.Acquire(context.Background(), "key-a")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := a.Acquire(ctx, "key-b"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Acquire() = %v, want context.Canceled", err)
+	}
+	a.Release()
+	if err := a.Acquire(context.Background(), "key-c"); err != nil {
+		t.Errorf("Acquire() = %v, want the freed slot", err)
+	}
+}
+
+func TestReverseProxyAdmission(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithAdmission(NewAdmission(1, 20*time.Millisecond)))
+
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`)))
+		done <- rec.Code
+	}()
+	for be.ActiveRequests() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "queue_timeout") {
+		t.Errorf("queued request: status = %d body = %s, want 503 queue_timeout", rec.Code, rec.Body.String())
+	}
+
+	close(release)
+	if code := <-done; code != 200 {
+		t.Errorf("first request: status = %d, want 200", code)
+	}
+}
@@ -0,0 +1,24 @@
+package proxy
+
+import (
+	"net/http"
+	"net/netip"
+)
+
+// WithAllowedClients rejects requests from clients outside prefixes with
+// 403, a lightweight alternative to API keys when the proxy listens on a
+// LAN or VPN interface. Behind trusted proxies (WithTrustedProxies) the
+// forwarded client address is checked rather than the load balancer's.
+func WithAllowedClients(prefixes []netip.Prefix) Option {
+	return func(h *handler) {
+		h.allowedClients = prefixes
+	}
+}
+
+// writeForbidden writes the 403 response sent to clients outside the
+// allowlist.
+func writeForbidden(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	w.Write([]byte(`{"error":{"message":"client address not allowed","type":"permission_error","code":"ip_not_allowed"}}`))
+}
@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestAllowedClients(t *testing.T) {
+	srv := fakeBackendServer(t)
+	defer srv.Close()
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+
+	allowed, _ := ParsePrefixes("192.168.0.0/16,100.64.0.0/10")
+	trusted, _ := ParsePrefixes("10.0.0.1")
+	handler := NewReverseProxy(bal, nil, WithAllowedClients(allowed), WithTrustedProxies(trusted))
+
+	tests := []struct {
+		remote, xff string
+		want        int
+	}{
+		{"192.168.1.20:5000", "", http.StatusOK},
+		{"100.100.1.2:5000", "", http.StatusOK},
+		{"[::ffff:192.168.1.20]:5000", "", http.StatusOK},
+		{"203.0.113.9:5000", "", http.StatusForbidden},
+		// Spoofed forwarding headers from an untrusted peer are ignored.
+		{"203.0.113.9:5000", "192.168.1.20", http.StatusForbidden},
+		// Behind a trusted load balancer the forwarded client is checked.
+		{"10.0.0.1:5000", "192.168.1.20", http.StatusOK},
+		{"10.0.0.1:5000", "203.0.113.9", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/v1/models", nil)
+		req.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			req.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s (X-Forwarded-For %q): status = %d, want %d", tt.remote, tt.xff, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// anonymousKey identifies clients that send no bearer token.
+const anonymousKey = "anonymous"
+
+// clientKeyID returns a stable identifier for the API key a client presented
+// in its Authorization header. The raw key is never stored: the ID is a
+// short SHA-256 fingerprint. Clients without a key share anonymousKey.
+// The key isn't validated (the backends check their own tokens, not the
+// client's), so anything keyed on it is advisory.
+func clientKeyID(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok || strings.TrimSpace(token) == "" {
+		return anonymousKey
+	}
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return "key-" + hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"strings"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// isAudioPath reports whether path is an OpenAI audio endpoint, e.g.
+// /v1/audio/transcriptions or /v1/audio/speech.
+func isAudioPath(path string) bool {
+	return strings.HasPrefix(path, "/v1/audio/")
+}
+
+// SetAudioLabel marks instances carrying label as audio-capable (e.g.
+// Whisper or TTS servers). Audio requests are routed only to them and all
+// other requests only to the rest. An empty label disables the split.
+func (b *Balancer) SetAudioLabel(label string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.audioLabel = label
+}
+
+// PickAudio selects the next healthy audio-capable backend. Without an
+// audio label every backend is a candidate.
+func (b *Balancer) PickAudio() (*backend.Backend, error) {
+	return b.pick(func(be *backend.Backend) bool {
+		return b.shadowMatch(be) && b.audioMatch(be, true)
+	})
+}
+
+// accepts reports whether be may serve an audio (or non-audio) request.
+func (b *Balancer) accepts(be *backend.Backend, audio bool) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.shadowMatch(be) && b.audioMatch(be, audio)
+}
+
+// isAudio must be called with mu held.
+func (b *Balancer) isAudio(be *backend.Backend) bool {
+	return b.audioLabel != "" && be.Instance.BaseLabel() == b.audioLabel
+}
+
+// audioMatch must be called with mu held.
+func (b *Balancer) audioMatch(be *backend.Backend, audio bool) bool {
+	return b.audioLabel == "" || b.isAudio(be) == audio
+}
@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+func makeLabeledBackend(t *testing.T, id int, label string, h http.HandlerFunc) *backend.Backend {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	be := backend.NewBackend(&vast.Instance{ID: id, Label: label}, "", nil, "")
+	be.SetBaseURL(srv.URL)
+	be.SetHealthy(true)
+	return be
+}
+
+func TestPickAudio(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	b := NewBalancer()
+	b.SetAudioLabel("audio")
+	b.SetBackends([]*backend.Backend{
+		makeLabeledBackend(t, 1, "", ok),
+		makeLabeledBackend(t, 2, "audio", ok),
+	})
+
+	for range 3 {
+		if be, err := b.PickAudio(); err != nil || be.Instance.ID != 2 {
+			t.Fatalf("PickAudio() = %v, %v; want instance 2", be, err)
+		}
+		if be, err := b.Pick(); err != nil || be.Instance.ID != 1 {
+			t.Fatalf("Pick() = %v, %v; want instance 1", be, err)
+		}
+	}
+	if _, err := b.PickExcluding(2); err != ErrNoBackends {
+		t.Errorf("PickExcluding(2) err = %v, want ErrNoBackends", err)
+	}
+
+	// Without an audio label every backend serves everything.
+	b.SetAudioLabel("")
+	seen := map[int]bool{}
+	for range 2 {
+		be, _ := b.PickAudio()
+		seen[be.Instance.ID] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("PickAudio() without label picked %v, want both", seen)
+	}
+}
+
+func TestReverseProxyAudioTranscription(t *testing.T) {
+	var gotType string
+	var gotFile []byte
+	audioBe := makeLabeledBackend(t, 2, "audio", func(w http.ResponseWriter, r *http.Request) {
+		gotType = r.Header.Get("Content-Type")
+		f, _, err := r.FormFile("file")
+		if err == nil {
+			gotFile, _ = io.ReadAll(f)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"text":"hello"}`))
+	})
+	chatBe := makeLabeledBackend(t, 1, "", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("audio request routed to chat backend")
+	})
+	bal := NewBalancer()
+	bal.SetAudioLabel("audio")
+	bal.SetBackends([]*backend.Backend{chatBe, audioBe})
+	handler := NewReverseProxy(bal, nil)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("model", "whisper-1")
+	fw, _ := mw.CreateFormFile("file", "a.wav")
+	fw.Write([]byte("RIFF\x00\x01binary"))
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/v1/audio/transcriptions", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	// Sticky pins to a non-audio backend are ignored.
+	req.Header.Set(StickyHeader, "1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get(StickyHeader) != "2" {
+		t.Fatalf("status = %d, backend = %s", rec.Code, rec.Header().Get(StickyHeader))
+	}
+	if gotType != mw.FormDataContentType() {
+		t.Errorf("Content-Type = %q, want %q", gotType, mw.FormDataContentType())
+	}
+	if string(gotFile) != "RIFF\x00\x01binary" {
+		t.Errorf("file = %q", gotFile)
+	}
+}
+
+func TestReverseProxyAudioSpeech(t *testing.T) {
+	audioBe := makeLabeledBackend(t, 2, "audio", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write([]byte{0xff, 0xfb, 0x90, 0x00})
+	})
+	bal := NewBalancer()
+	bal.SetAudioLabel("audio")
+	bal.SetBackends([]*backend.Backend{audioBe})
+	handler := NewReverseProxy(bal, nil, WithUsage(NewUsageTracker()))
+
+	req := httptest.NewRequest("POST", "/v1/audio/speech", bytes.NewReader([]byte(`{"model":"tts-1","input":"hi"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "audio/mpeg" {
+		t.Errorf("Content-Type = %q, want audio/mpeg", ct)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), []byte{0xff, 0xfb, 0x90, 0x00}) {
+		t.Errorf("body = %x", rec.Body.Bytes())
+	}
+
+	// Chat requests never reach the audio-only backend.
+	req = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(`{}`)))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("chat status = %d, want 503", rec.Code)
+	}
+}
@@ -11,12 +11,27 @@ import (
 	"github.com/shutej/vastproxy/backend"
 )
 
-// Balancer implements round-robin load balancing across healthy backends.
+// Balancer load-balances across healthy backends, round-robin by default.
 type Balancer struct {
 	backends   []*backend.Backend
 	counter    atomic.Uint64 // monotonically increasing request counter
 	activeReqs atomic.Int64  // total in-flight requests across all backends
+	paused     atomic.Bool   // when set, picks fail with ErrPaused
 	mu         sync.RWMutex
+
+	poolMode     PoolMode
+	strategy     Strategy
+	kvCacheLimit float64  // KV cache usage above which long prompts avoid a backend; 0 = off
+	sizeRouting  bool     // long prompts go to the backends with the most VRAM
+	poolCounters sync.Map // pool name → *atomic.Uint64 round-robin counter
+	audioLabel   string   // instances with this label serve /v1/audio only
+	busyGPUUtil  float64  // average GPU utilization (%) at which a backend is busy; 0 = off
+	busyQueue    int64    // queue depth at which a backend is busy; 0 = off
+	shadowLabel  string   // instances with this label get mirrored requests only
+	split        TrafficSplit
+	maxStreams   int64 // streaming requests per backend; 0 = unlimited
+
+	shadowCounter atomic.Uint64 // round-robin counter among shadows
 }
 
 // NewBalancer creates a new load balancer.
@@ -38,9 +53,69 @@ func (b *Balancer) SetBackends(backends []*backend.Backend) {
 // ErrNoBackends is returned when no healthy backends are available.
 var ErrNoBackends = fmt.Errorf("no healthy backends available")
 
-// Pick selects the next healthy backend using round-robin.
-// The atomic counter ensures even distribution regardless of timing.
-func (b *Balancer) Pick() (*backend.Backend, error) {
+// Pick selects the next healthy backend using the balancer's strategy
+// (round-robin by default). The atomic counter ensures even distribution
+// regardless of timing.
+func (b *Balancer) Pick(opts ...PickOption) (*backend.Backend, error) {
+	return b.pick(func(be *backend.Backend) bool {
+		return b.shadowMatch(be) && b.audioMatch(be, false)
+	}, opts...)
+}
+
+// PickExcluding selects the next healthy backend other than the one with
+// the given instance ID, from every pool that one is in (so it serves the
+// same models), e.g. for a hedged duplicate of a request.
+func (b *Balancer) PickExcluding(id int) (*backend.Backend, error) {
+	return b.pick(b.alternatesTo(id))
+}
+
+// hasAlternate reports whether PickExcluding(id) has a healthy backend to
+// choose from.
+func (b *Balancer) hasAlternate(id int) bool {
+	allow := b.alternatesTo(id)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, be := range b.backends {
+		if be.IsHealthy() && allow(be) {
+			return true
+		}
+	}
+	return false
+}
+
+// alternatesTo returns a filter, to be called with mu held, accepting the
+// backends PickExcluding(id) may choose.
+func (b *Balancer) alternatesTo(id int) func(*backend.Backend) bool {
+	var pools []string
+	audio := false
+	b.mu.RLock()
+	for _, be := range b.backends {
+		if be.Instance.ID == id {
+			pools = b.poolsOf(be)
+			audio = b.isAudio(be)
+		}
+	}
+	b.mu.RUnlock()
+
+	return func(be *backend.Backend) bool {
+		if be.Instance.ID == id || !b.shadowMatch(be) || !b.audioMatch(be, audio) {
+			return false
+		}
+		for _, pool := range pools {
+			if !b.inPool(be, pool) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// pick selects among healthy backends accepted by allow
+// (nil allows all).
+func (b *Balancer) pick(allow func(*backend.Backend) bool, opts ...PickOption) (*backend.Backend, error) {
+	if b.paused.Load() {
+		return nil, ErrPaused
+	}
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
@@ -52,7 +127,7 @@ func (b *Balancer) Pick() (*backend.Backend, error) {
 	// Collect healthy backends.
 	healthy := make([]*backend.Backend, 0, n)
 	for _, be := range b.backends {
-		if be.IsHealthy() {
+		if be.IsHealthy() && (allow == nil || allow(be)) {
 			healthy = append(healthy, be)
 		}
 	}
@@ -60,10 +135,11 @@ func (b *Balancer) Pick() (*backend.Backend, error) {
 	if len(healthy) == 0 {
 		return nil, ErrNoBackends
 	}
-
 	// Atomically increment and pick based on counter mod healthy count.
-	idx := b.counter.Add(1) - 1
-	pick := healthy[idx%uint64(len(healthy))]
+	pick, idx, err := b.chooseWithStream(healthy, &b.counter, opts)
+	if err != nil {
+		return nil, err
+	}
 
 	log.Printf("balancer: picked instance %d (counter=%d, healthy=%d/%d)",
 		pick.Instance.ID, idx, len(healthy), n)
@@ -73,14 +149,51 @@ func (b *Balancer) Pick() (*backend.Backend, error) {
 // PickByID selects a specific backend by instance ID.
 // Returns ErrNoBackends if the instance doesn't exist or isn't healthy.
 func (b *Balancer) PickByID(id int) (*backend.Backend, error) {
+	if b.paused.Load() {
+		return nil, ErrPaused
+	}
+	if be := b.healthyByID(id); be != nil {
+		return be, nil
+	}
+	return nil, ErrNoBackends
+}
+
+// healthyByID returns the backend with the given instance ID if it exists
+// and is healthy, or nil.
+func (b *Balancer) healthyByID(id int) *backend.Backend {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	for _, be := range b.backends {
 		if be.Instance.ID == id && be.IsHealthy() {
-			return be, nil
+			return be
 		}
 	}
-	return nil, ErrNoBackends
+	return nil
+}
+
+// Backend returns the backend with the given instance ID, healthy or
+// not, or nil.
+func (b *Balancer) Backend(id int) *backend.Backend {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, be := range b.backends {
+		if be.Instance.ID == id {
+			return be
+		}
+	}
+	return nil
+}
+
+// IsHealthy reports whether the backend with the given instance ID exists
+// and is healthy.
+func (b *Balancer) IsHealthy(id int) bool {
+	return b.healthyByID(id) != nil
+}
+
+// HasBackend reports whether a backend with the given instance ID exists,
+// healthy or not.
+func (b *Balancer) HasBackend(id int) bool {
+	return b.Backend(id) != nil
 }
 
 // HealthyCount returns the number of healthy backends.
@@ -130,6 +243,31 @@ func (b *Balancer) HasAbortSupport() bool {
 	return false
 }
 
+// ErrUnknownBackend is returned by AbortBackend for an instance the
+// balancer has no backend for.
+var ErrUnknownBackend = fmt.Errorf("no such backend")
+
+// ErrNoAbort is returned by AbortBackend when the instance's engine has no
+// server-side abort endpoint.
+var ErrNoAbort = fmt.Errorf("engine does not support abort")
+
+// AbortBackend aborts all in-flight inference on instance id's backend,
+// healthy or not, leaving the rest of the fleet alone.
+func (b *Balancer) AbortBackend(ctx context.Context, id int) error {
+	be := b.Backend(id)
+	if be == nil {
+		return ErrUnknownBackend
+	}
+	if !be.Instance.Engine.SupportsAbort() {
+		return ErrNoAbort
+	}
+	if err := be.AbortAll(ctx); err != nil {
+		return err
+	}
+	log.Printf("balancer: aborted all requests on backend %d", id)
+	return nil
+}
+
 // AbortAll sends abort requests to all healthy backends that support it.
 func (b *Balancer) AbortAll(ctx context.Context) {
 	b.mu.RLock()
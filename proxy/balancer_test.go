@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"sync"
@@ -299,6 +300,55 @@ func TestBalancerAbortAll(t *testing.T) {
 	}
 }
 
+func TestBalancerAbortBackend(t *testing.T) {
+	wedged, fake := abortCountingBackend(t)
+	wedged.SetHealthy(false) // wedged boxes are often failing health checks
+	vllm := makeBackend(2, true)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{wedged, vllm})
+
+	if err := bal.AbortBackend(context.Background(), 1); err != nil || fake.Aborts() != 1 {
+		t.Errorf("AbortBackend(1) = %v with %d aborts, want nil and 1", err, fake.Aborts())
+	}
+	if err := bal.AbortBackend(context.Background(), 2); !errors.Is(err, ErrNoAbort) {
+		t.Errorf("AbortBackend(2) = %v, want ErrNoAbort", err)
+	}
+	if err := bal.AbortBackend(context.Background(), 99); !errors.Is(err, ErrUnknownBackend) {
+		t.Errorf("AbortBackend(99) = %v, want ErrUnknownBackend", err)
+	}
+}
+
+func TestAdminAbortInstance(t *testing.T) {
+	wedged, fake := abortCountingBackend(t)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{wedged, makeBackend(2, true)})
+	srv := httptest.NewServer((&Admin{Balancer: bal}).Handler())
+	defer srv.Close()
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/instances/1/abort", http.StatusOK},
+		{"/instances/2/abort", http.StatusConflict},
+		{"/instances/99/abort", http.StatusNotFound},
+		{"/instances/abc/abort", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp, err := http.Post(srv.URL+tt.path, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("POST %s = %d, want %d", tt.path, resp.StatusCode, tt.want)
+		}
+	}
+	if n := fake.Aborts(); n != 1 {
+		t.Errorf("abort called %d times, want 1", n)
+	}
+}
+
 func TestPickByIDHealthy(t *testing.T) {
 	bal := NewBalancer()
 	bal.SetBackends([]*backend.Backend{
@@ -437,3 +487,23 @@ func TestHasAbortSupport(t *testing.T) {
 		t.Error("HasAbortSupport() = true with only unknown engine, want false")
 	}
 }
+
+func TestPickExcluding(t *testing.T) {
+	b := NewBalancer()
+	b.SetBackends([]*backend.Backend{makeBackend(1, true), makeBackend(2, true), makeBackend(3, false)})
+
+	for range 5 {
+		be, err := b.PickExcluding(1)
+		if err != nil {
+			t.Fatalf("PickExcluding() error: %v", err)
+		}
+		if be.Instance.ID != 2 {
+			t.Errorf("picked %d, want 2", be.Instance.ID)
+		}
+	}
+
+	b.SetBackends([]*backend.Backend{makeBackend(1, true)})
+	if _, err := b.PickExcluding(1); err != ErrNoBackends {
+		t.Errorf("err = %v, want ErrNoBackends", err)
+	}
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import "github.com/shutej/vastproxy/backend"
+
+// SetBusyLimits makes picks skip busy backends while others aren't: those
+// whose average GPU utilization is at least gpuUtil percent, or whose
+// queue depth (engine-reported or in flight through the proxy, whichever
+// is larger) is at least queue. 0 disables either check.
+func (b *Balancer) SetBusyLimits(gpuUtil float64, queue int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.busyGPUUtil = gpuUtil
+	b.busyQueue = queue
+}
+
+// isBusy reports whether be is over the busy limits. Must be called with
+// mu held.
+func (b *Balancer) isBusy(be *backend.Backend) bool {
+	if b.busyQueue > 0 && queueDepth(be) >= b.busyQueue {
+		return true
+	}
+	if b.busyGPUUtil > 0 {
+		if u := be.LastGPUUpdate(); u != nil && len(u.GPUs) > 0 {
+			var sum float64
+			for _, g := range u.GPUs {
+				sum += g.Utilization
+			}
+			return sum/float64(len(u.GPUs)) >= b.busyGPUUtil
+		}
+	}
+	return false
+}
+
+// notBusy returns the backends that aren't busy. If every backend is busy,
+// all are returned: a saturated machine is better than no backend. Must be
+// called with mu held.
+func (b *Balancer) notBusy(backends []*backend.Backend) []*backend.Backend {
+	if b.busyGPUUtil <= 0 && b.busyQueue <= 0 {
+		return backends
+	}
+	var out []*backend.Backend
+	for _, be := range backends {
+		if !b.isBusy(be) {
+			out = append(out, be)
+		}
+	}
+	if len(out) == 0 {
+		return backends
+	}
+	return out
+}
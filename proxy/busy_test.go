@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestPickSkipsBusyBackends(t *testing.T) {
+	hot := makeBackend(1, true)
+	hot.SetLastGPUUpdate(&backend.GPUUpdate{GPUs: []backend.GPUMetric{{Utilization: 99}, {Utilization: 95}}})
+	queued := makeBackend(2, true)
+	queued.SetEngineStats(&backend.EngineStats{Running: 6, Waiting: 4})
+	idle := makeBackend(3, true)
+	idle.SetLastGPUUpdate(&backend.GPUUpdate{GPUs: []backend.GPUMetric{{Utilization: 20}}})
+	unknown := makeBackend(4, true)
+
+	bal := NewBalancer()
+	bal.SetBusyLimits(90, 8)
+	bal.SetBackends([]*backend.Backend{hot, queued, idle, unknown})
+
+	seen := map[int]int{}
+	for range 8 {
+		be, err := bal.Pick()
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[be.Instance.ID]++
+	}
+	if seen[1] != 0 || seen[2] != 0 || seen[3] != 4 || seen[4] != 4 {
+		t.Errorf("picks = %v, want only 3 and 4", seen)
+	}
+}
+
+func TestPickUsesBusyBackendsWhenAllBusy(t *testing.T) {
+	b1 := makeBackend(1, true)
+	b1.Acquire()
+	b1.Acquire()
+	b2 := makeBackend(2, true)
+	b2.Acquire()
+	b2.Acquire()
+
+	bal := NewBalancer()
+	bal.SetBusyLimits(0, 2)
+	bal.SetBackends([]*backend.Backend{b1, b2})
+	if _, err := bal.Pick(); err != nil {
+		t.Errorf("Pick() = %v, want a busy backend rather than none", err)
+	}
+
+	// Off by default.
+	bal.SetBusyLimits(0, 0)
+	b3 := makeBackend(3, true)
+	b3.SetLastGPUUpdate(&backend.GPUUpdate{GPUs: []backend.GPUMetric{{Utilization: 100}}})
+	bal.SetBackends([]*backend.Backend{b3})
+	if be, _ := bal.Pick(); be != b3 {
+		t.Error("busy backend skipped with limits disabled")
+	}
+}
@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// captureHardLimit bounds how much of a body is buffered before redaction.
+// Bodies are redacted first and truncated afterwards so that truncation
+// doesn't leave unparseable JSON that would leak redacted fields.
+const captureHardLimit = 1 << 20
+
+// redactedValue replaces the value of every redacted field.
+const redactedValue = "[REDACTED]"
+
+// CapturedExchange is a recorded request/response pair.
+type CapturedExchange struct {
+	RequestID         string    `json:"request_id"`
+	Time              time.Time `json:"time"`
+	Method            string    `json:"method"`
+	Path              string    `json:"path"`
+	BackendID         int       `json:"backend_id"`
+	Status            int       `json:"status"`
+	RequestBody       string    `json:"request_body"`
+	RequestTruncated  bool      `json:"request_truncated,omitempty"`
+	ResponseBody      string    `json:"response_body"`
+	ResponseTruncated bool      `json:"response_truncated,omitempty"`
+}
+
+// BodyCapture keeps the request and response bodies of the last N proxied
+// requests for debugging. Bodies are truncated to maxBytes and the values of
+// the configured JSON fields (e.g. "messages", "prompt") are redacted,
+// including inside SSE data lines. Safe for concurrent use.
+type BodyCapture struct {
+	maxBytes int
+	redact   map[string]bool
+
+	mu      sync.Mutex
+	entries []CapturedExchange // ring buffer
+	next    int                // index of the next slot to write
+	full    bool               // true once the ring has wrapped
+}
+
+// NewBodyCapture creates a capture buffer holding the last n exchanges.
+func NewBodyCapture(n, maxBytes int, redactFields []string) *BodyCapture {
+	redact := make(map[string]bool, len(redactFields))
+	for _, f := range redactFields {
+		if f != "" {
+			redact[f] = true
+		}
+	}
+	return &BodyCapture{
+		maxBytes: maxBytes,
+		redact:   redact,
+		entries:  make([]CapturedExchange, max(n, 1)),
+	}
+}
+
+// WithBodyCapture records request/response bodies into c.
+func WithBodyCapture(c *BodyCapture) Option {
+	return func(h *handler) {
+		h.capture = c
+	}
+}
+
+// Add redacts, truncates and stores an exchange, evicting the oldest.
+func (c *BodyCapture) Add(ex CapturedExchange, reqBody, respBody []byte) {
+	ex.RequestBody, ex.RequestTruncated = c.prepare(reqBody)
+	ex.ResponseBody, ex.ResponseTruncated = c.prepare(respBody)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[c.next] = ex
+	c.next = (c.next + 1) % len(c.entries)
+	if c.next == 0 {
+		c.full = true
+	}
+}
+
+// Recent returns the captured exchanges, newest first.
+func (c *BodyCapture) Recent() []CapturedExchange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.next
+	if c.full {
+		n = len(c.entries)
+	}
+	out := make([]CapturedExchange, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, c.entries[(c.next-i+len(c.entries))%len(c.entries)])
+	}
+	return out
+}
+
+func (c *BodyCapture) prepare(body []byte) (string, bool) {
+	body = redactBody(body, c.redact)
+	if c.maxBytes > 0 && len(body) > c.maxBytes {
+		return string(body[:c.maxBytes]), true
+	}
+	return string(body), false
+}
+
+// redactBody redacts fields in a JSON document or in each "data:" line of an
+// SSE stream. Content that can't be parsed is replaced entirely when any
+// fields are configured, since it may contain what we're meant to hide.
+func redactBody(body []byte, fields map[string]bool) []byte {
+	if len(fields) == 0 || len(bytes.TrimSpace(body)) == 0 {
+		return body
+	}
+	if out, ok := redactJSON(body, fields); ok {
+		return out
+	}
+	if !bytes.Contains(body, []byte("data:")) {
+		return []byte("[unparseable body redacted]")
+	}
+
+	lines := bytes.Split(body, []byte("\n"))
+	for i, line := range lines {
+		payload, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			continue
+		}
+		payload = bytes.TrimSpace(payload)
+		if len(payload) == 0 || string(payload) == "[DONE]" {
+			continue
+		}
+		if out, ok := redactJSON(payload, fields); ok {
+			lines[i] = append([]byte("data: "), out...)
+		} else {
+			lines[i] = []byte("data: [unparseable, redacted]")
+		}
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+func redactJSON(body []byte, fields map[string]bool) ([]byte, bool) {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, false
+	}
+	out, err := json.Marshal(redactValue(v, fields))
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+func redactValue(v any, fields map[string]bool) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if fields[k] {
+				t[k] = redactedValue
+			} else {
+				t[k] = redactValue(child, fields)
+			}
+		}
+	case []any:
+		for i, child := range t {
+			t[i] = redactValue(child, fields)
+		}
+	}
+	return v
+}
+
+// captureBuffer is an io.Writer that keeps at most limit bytes.
+type captureBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// teeReadCloser tees reads from an io.ReadCloser into w.
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func newTeeReadCloser(rc io.ReadCloser, w io.Writer) io.ReadCloser {
+	return teeReadCloser{Reader: io.TeeReader(rc, w), Closer: rc}
+}
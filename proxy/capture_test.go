@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+func TestBodyCaptureRingBuffer(t *testing.T) {
+	c := NewBodyCapture(2, 0, nil)
+	for _, p := range []string{"/a", "/b", "/c"} {
+		c.Add(CapturedExchange{Path: p}, nil, nil)
+	}
+	got := c.Recent()
+	if len(got) != 2 {
+		t.Fatalf("len = %d, want 2", len(got))
+	}
+	if got[0].Path != "/c" || got[1].Path != "/b" {
+		t.Errorf("paths = %s, %s; want /c, /b", got[0].Path, got[1].Path)
+	}
+}
+
+func TestBodyCaptureTruncates(t *testing.T) {
+	c := NewBodyCapture(1, 5, nil)
+	c.Add(CapturedExchange{}, []byte("hello world"), []byte("hi"))
+	ex := c.Recent()[0]
+	if ex.RequestBody != "hello" || !ex.RequestTruncated {
+		t.Errorf("request = %q truncated=%v", ex.RequestBody, ex.RequestTruncated)
+	}
+	if ex.ResponseBody != "hi" || ex.ResponseTruncated {
+		t.Errorf("response = %q truncated=%v", ex.ResponseBody, ex.ResponseTruncated)
+	}
+}
+
+func TestRedactBodyJSON(t *testing.T) {
+	fields := map[string]bool{"messages": true, "content": true}
+	out := redactBody([]byte(`{"model":"m","messages":[{"role":"user","content":"secret"}]}`), fields)
+	if strings.Contains(string(out), "secret") {
+		t.Errorf("secret leaked: %s", out)
+	}
+	if !strings.Contains(string(out), `"model":"m"`) || !strings.Contains(string(out), redactedValue) {
+		t.Errorf("out = %s", out)
+	}
+}
+
+func TestRedactBodySSE(t *testing.T) {
+	fields := map[string]bool{"content": true}
+	in := "data: {\"choices\":[{\"delta\":{\"content\":\"secret\"}}]}\n\ndata: {\"choices\":[{\"delta\":{\"cont\n\ndata: [DONE]\n\n"
+	out := string(redactBody([]byte(in), fields))
+	if strings.Contains(out, "secret") || strings.Contains(out, "cont\n") {
+		t.Errorf("content leaked: %q", out)
+	}
+	if !strings.Contains(out, "data: [DONE]") {
+		t.Errorf("[DONE] should be kept: %q", out)
+	}
+}
+
+func TestRedactBodyUnparseable(t *testing.T) {
+	out := redactBody([]byte(`{"prompt":"sec`), map[string]bool{"prompt": true})
+	if strings.Contains(string(out), "sec") {
+		t.Errorf("unparseable body leaked: %s", out)
+	}
+	// Without redaction fields the body is kept verbatim.
+	if got := string(redactBody([]byte("plain"), nil)); got != "plain" {
+		t.Errorf("got %q, want plain", got)
+	}
+}
+
+func TestReverseProxyBodyCapture(t *testing.T) {
+	backendSrv := fakeBackendServer(t)
+	defer backendSrv.Close()
+
+	inst := &vast.Instance{ID: 4}
+	be := backend.NewBackend(inst, "", nil, "")
+	be.SetBaseURL(backendSrv.URL)
+	be.SetHealthy(true)
+
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	capture := NewBodyCapture(10, 1024, []string{"prompt"})
+	handler := NewReverseProxy(bal, nil, WithBodyCapture(capture))
+
+	req := httptest.NewRequest("POST", "/v1/completions", strings.NewReader(`{"model":"m","prompt":"secret"}`))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := capture.Recent()
+	if len(got) != 1 {
+		t.Fatalf("captured %d exchanges, want 1", len(got))
+	}
+	ex := got[0]
+	if ex.BackendID != 4 || ex.Status != http.StatusOK || ex.Path != "/v1/completions" {
+		t.Errorf("exchange = %+v", ex)
+	}
+	if strings.Contains(ex.RequestBody, "secret") || !strings.Contains(ex.RequestBody, `"model":"m"`) {
+		t.Errorf("request body = %s", ex.RequestBody)
+	}
+	if !strings.Contains(ex.ResponseBody, "/v1/completions") {
+		t.Errorf("response body = %s", ex.ResponseBody)
+	}
+}
+
+func TestAdminCaptures(t *testing.T) {
+	capture := NewBodyCapture(10, 0, nil)
+	capture.Add(CapturedExchange{Time: time.Now(), Path: "/v1/models"}, nil, []byte("ok"))
+
+	srv := httptest.NewServer((&Admin{Captures: capture}).Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/captures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got []CapturedExchange
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ResponseBody != "ok" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestAdminCapturesDisabled(t *testing.T) {
+	srv := httptest.NewServer((&Admin{}).Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/captures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", resp.StatusCode)
+	}
+}
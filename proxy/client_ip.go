@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// ParsePrefixes parses a comma-separated list of CIDRs and bare IP
+// addresses, e.g. "10.0.0.0/8,192.168.1.5".
+func ParsePrefixes(s string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			p, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %v", entry, err)
+			}
+			out = append(out, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %v", entry, err)
+		}
+		out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return out, nil
+}
+
+// WithTrustedProxies trusts the client IP headers set by load balancers in
+// prefixes. Requests from anywhere else have those headers replaced, so
+// clients can't spoof their address.
+func WithTrustedProxies(prefixes []netip.Prefix) Option {
+	return func(h *handler) {
+		h.trustedProxies = prefixes
+	}
+}
+
+// trusted reports whether ip belongs to a trusted proxy.
+func (h *handler) trusted(ip string) bool {
+	return containsIP(h.trustedProxies, ip)
+}
+
+// containsIP reports whether ip is in any of prefixes.
+func containsIP(prefixes []netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerIP returns the IP address of the connection r arrived on.
+func peerIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// forwardedChain returns the client addresses claimed by r's headers,
+// nearest proxy last: the Forwarded "for" parameters if present, otherwise
+// X-Forwarded-For, otherwise X-Real-IP.
+func forwardedChain(r *http.Request) []string {
+	var chain []string
+	for _, v := range r.Header.Values("Forwarded") {
+		for _, elem := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					chain = append(chain, forwardedNode(val))
+				}
+			}
+		}
+	}
+	if len(chain) > 0 {
+		return chain
+	}
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, ip := range strings.Split(v, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				chain = append(chain, ip)
+			}
+		}
+	}
+	if len(chain) == 0 {
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			chain = append(chain, ip)
+		}
+	}
+	return chain
+}
+
+// forwardedNode returns the IP of a Forwarded "for" value such as
+// "192.0.2.60" or "\"[2001:db8::17]:4711\"".
+func forwardedNode(v string) string {
+	v = strings.Trim(v, `"`)
+	if host, _, err := net.SplitHostPort(v); err == nil {
+		return host
+	}
+	return strings.Trim(v, "[]")
+}
+
+// clientIP returns the address of the client that made r. Behind trusted
+// proxies it is the nearest address in the forwarding chain that isn't a
+// trusted proxy itself.
+func (h *handler) clientIP(r *http.Request) string {
+	peer := peerIP(r)
+	if !h.trusted(peer) {
+		return peer
+	}
+	chain := forwardedChain(r)
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !h.trusted(chain[i]) || i == 0 {
+			return chain[i]
+		}
+	}
+	return peer
+}
+
+// setForwardedHeaders sets X-Forwarded-For, X-Real-IP, Forwarded and
+// X-Forwarded-Proto/Host/Port on an outbound request, so backends see the
+// client's address and the URL it used. Incoming values are kept only if
+// they came from a trusted proxy; the connection's peer address is
+// appended to the incoming chain.
+func (h *handler) setForwardedHeaders(req, orig *http.Request) {
+	peer := peerIP(orig)
+	proto, host, port := requestOrigin(orig)
+	var xff, fwd []string
+	if h.trusted(peer) {
+		xff = slices.Clone(orig.Header.Values("X-Forwarded-For"))
+		fwd = slices.Clone(orig.Header.Values("Forwarded"))
+		if v := orig.Header.Get("X-Forwarded-Proto"); v != "" {
+			proto = v
+		}
+		if v := orig.Header.Get("X-Forwarded-Host"); v != "" {
+			host = v
+		}
+		if v := orig.Header.Get("X-Forwarded-Port"); v != "" {
+			port = v
+		}
+	}
+	xff = append(xff, peer)
+	node := peer
+	if strings.Contains(node, ":") {
+		node = `"[` + node + `]"`
+	}
+	fwd = append(fwd, fmt.Sprintf("for=%s;host=%q;proto=%s", node, orig.Host, proto))
+
+	req.Header.Set("X-Forwarded-For", strings.Join(xff, ", "))
+	req.Header.Set("Forwarded", strings.Join(fwd, ", "))
+	req.Header.Set("X-Real-IP", h.clientIP(orig))
+	req.Header.Set("X-Forwarded-Proto", proto)
+	req.Header.Set("X-Forwarded-Host", host)
+	req.Header.Set("X-Forwarded-Port", port)
+}
+
+// requestOrigin returns the scheme, host (without port) and port the client
+// used to reach the proxy.
+func requestOrigin(r *http.Request) (proto, host, port string) {
+	proto, port = "http", "80"
+	if r.TLS != nil {
+		proto, port = "https", "443"
+	}
+	host = r.Host
+	if h, p, err := net.SplitHostPort(r.Host); err == nil {
+		host, port = h, p
+	}
+	return proto, host, port
+}
@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	got, err := ParsePrefixes("10.1.2.3/8, 192.168.1.5,::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.1.5/32"),
+		netip.MustParsePrefix("::1/128"),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("prefix %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if _, err := ParsePrefixes("10.0.0.0/33"); err == nil {
+		t.Error("expected error for bad CIDR")
+	}
+	if _, err := ParsePrefixes("lb.internal"); err == nil {
+		t.Error("expected error for hostname")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, _ := ParsePrefixes("10.0.0.0/8")
+	h := &handler{trustedProxies: trusted}
+	tests := []struct {
+		name   string
+		remote string
+		header http.Header
+		want   string
+	}{
+		{"direct", "203.0.113.9:1234", nil, "203.0.113.9"},
+		{"untrusted peer can't spoof", "203.0.113.9:1234",
+			http.Header{"X-Forwarded-For": {"1.2.3.4"}}, "203.0.113.9"},
+		{"trusted LB", "10.0.0.2:1234",
+			http.Header{"X-Forwarded-For": {"198.51.100.7"}}, "198.51.100.7"},
+		{"skips trusted hops", "10.0.0.2:1234",
+			http.Header{"X-Forwarded-For": {"6.6.6.6, 198.51.100.7, 10.0.0.3"}}, "198.51.100.7"},
+		{"real IP", "10.0.0.2:1234",
+			http.Header{"X-Real-Ip": {"198.51.100.8"}}, "198.51.100.8"},
+		{"forwarded", "10.0.0.2:1234",
+			http.Header{"Forwarded": {`for="[2001:db8::17]:4711";proto=https`}}, "2001:db8::17"},
+		{"trusted LB without headers", "10.0.0.2:1234", nil, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		for k, v := range tt.header {
+			r.Header[k] = v
+		}
+		if got := h.clientIP(r); got != tt.want {
+			t.Errorf("%s: clientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReverseProxyForwardedHeaders(t *testing.T) {
+	trusted, _ := ParsePrefixes("10.0.0.0/8")
+	for _, tt := range []struct {
+		remote, wantXFF, wantReal, wantFwd string
+	}{
+		{"10.0.0.2:1234", "198.51.100.7, 10.0.0.2", "198.51.100.7", `for=198.51.100.7, for=10.0.0.2;host="example.com";proto=http`},
+		{"203.0.113.9:1234", "203.0.113.9", "203.0.113.9", `for=203.0.113.9;host="example.com";proto=http`},
+	} {
+		be, got := headerBackend(t)
+		bal := NewBalancer()
+		bal.SetBackends([]*backend.Backend{be})
+		var buf bytes.Buffer
+		handler := NewReverseProxy(bal, nil, WithTrustedProxies(trusted),
+			WithAccessLog(NewAccessLog(&buf, AccessLogJSON)))
+
+		req := httptest.NewRequest("GET", "/v1/models", nil)
+		req.RemoteAddr = tt.remote
+		req.Header.Set("X-Forwarded-For", "198.51.100.7")
+		req.Header.Set("Forwarded", "for=198.51.100.7")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		h := *got
+		if h.Get("X-Forwarded-For") != tt.wantXFF || h.Get("X-Real-IP") != tt.wantReal || h.Get("Forwarded") != tt.wantFwd {
+			t.Errorf("from %s: X-Forwarded-For=%q X-Real-IP=%q Forwarded=%q, want %q %q %q", tt.remote,
+				h.Get("X-Forwarded-For"), h.Get("X-Real-IP"), h.Get("Forwarded"), tt.wantXFF, tt.wantReal, tt.wantFwd)
+		}
+		var entry map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+		}
+		if entry["client_addr"] != tt.wantReal {
+			t.Errorf("from %s: access log client = %v, want %s", tt.remote, entry["client_addr"], tt.wantReal)
+		}
+	}
+}
+
+func TestReverseProxyForwardedOrigin(t *testing.T) {
+	trusted, _ := ParsePrefixes("10.0.0.0/8")
+	for _, tt := range []struct {
+		remote, url                   string
+		header                        http.Header
+		wantProto, wantHost, wantPort string
+	}{
+		{"203.0.113.9:1234", "http://api.example.com/v1/models", nil, "http", "api.example.com", "80"},
+		{"203.0.113.9:1234", "https://api.example.com:8443/v1/models", nil, "https", "api.example.com", "8443"},
+		// A trusted load balancer terminating TLS reports the original origin.
+		{"10.0.0.2:1234", "http://10.0.0.5:8080/v1/models",
+			http.Header{"X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"api.example.com"}, "X-Forwarded-Port": {"443"}},
+			"https", "api.example.com", "443"},
+		// Untrusted clients can't claim another origin.
+		{"203.0.113.9:1234", "http://10.0.0.5:8080/v1/models",
+			http.Header{"X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"evil.example"}},
+			"http", "10.0.0.5", "8080"},
+	} {
+		be, got := headerBackend(t)
+		bal := NewBalancer()
+		bal.SetBackends([]*backend.Backend{be})
+		handler := NewReverseProxy(bal, nil, WithTrustedProxies(trusted))
+
+		req := httptest.NewRequest("GET", tt.url, nil)
+		req.RemoteAddr = tt.remote
+		for k, v := range tt.header {
+			req.Header[k] = v
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		h := *got
+		if h.Get("X-Forwarded-Proto") != tt.wantProto || h.Get("X-Forwarded-Host") != tt.wantHost || h.Get("X-Forwarded-Port") != tt.wantPort {
+			t.Errorf("%s from %s: proto=%q host=%q port=%q, want %q %q %q", tt.url, tt.remote,
+				h.Get("X-Forwarded-Proto"), h.Get("X-Forwarded-Host"), h.Get("X-Forwarded-Port"),
+				tt.wantProto, tt.wantHost, tt.wantPort)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RequestTimeoutHeader lets a client bound how long the proxy waits on the
+// backend, in seconds (e.g. "30" or "2.5") or as a Go duration ("90s").
+// The OpenAI SDKs' X-Stainless-Timeout header is ignored: the SDKs send it
+// on every request (600 by default) as a per-read timeout, not a bound on
+// the whole request, so long streams would be cut off.
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+// errClientTimeout is the context cause when a request outlives the
+// timeout its client asked for.
+var errClientTimeout = errors.New("client request timeout exceeded")
+
+// clientTimeout returns the timeout requested by r's RequestTimeoutHeader,
+// if any.
+func clientTimeout(r *http.Request) (time.Duration, bool) {
+	return parseRequestTimeout(r.Header.Get(RequestTimeoutHeader))
+}
+
+// parseRequestTimeout parses a timeout in seconds or as a Go duration.
+func parseRequestTimeout(s string) (time.Duration, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		secs, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, false
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	if d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
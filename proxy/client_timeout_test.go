@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestParseRequestTimeout(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"30", 30 * time.Second, true},
+		{"2.5", 2500 * time.Millisecond, true},
+		{"90s", 90 * time.Second, true},
+		{"", 0, false},
+		{"0", 0, false},
+		{"-5", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := parseRequestTimeout(tt.in); got != tt.want || ok != tt.ok {
+			t.Errorf("parseRequestTimeout(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestReverseProxyClientTimeout(t *testing.T) {
+	var hits atomic.Int32
+	be, srv := delayedBackend(t, 1, 500*time.Millisecond, &hits)
+	defer srv.Close()
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{}"))
+	req.Header.Set(RequestTimeoutHeader, "0.02")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusGatewayTimeout || !strings.Contains(rec.Body.String(), "client_timeout") {
+		t.Errorf("status = %d body = %s, want 504 client_timeout", rec.Code, rec.Body.String())
+	}
+	if !be.IsHealthy() {
+		t.Error("a client timeout should not mark the backend unhealthy")
+	}
+
+	// A generous timeout lets the request finish.
+	req = httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{}"))
+	req.Header.Set(RequestTimeoutHeader, "10s")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+
+	// The OpenAI SDKs' per-read timeout isn't a deadline for the request.
+	req = httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{}"))
+	req.Header.Set("X-Stainless-Timeout", "0.02")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("X-Stainless-Timeout: status = %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// coalesceMaxResponse bounds the response body kept for followers; larger
+// responses aren't shared and each follower makes its own call.
+const coalesceMaxResponse = 16 << 20
+
+// WithCoalescing serves identical in-flight requests with one upstream
+// call: while a deterministic (temperature 0), non-streaming inference
+// request is in flight, another from the same API key with the same path
+// and body of at most maxBody bytes waits for it and gets a copy of its
+// response. This saves backend time during evaluation runs with duplicated
+// prompts. Each waiting request still passes the proxy's own checks
+// (allowlist, limits, quotas, admission) and is logged and counted on its
+// own; only the backend round trip is shared. If the first request fails
+// or its client goes away, each waiting request is served on its own.
+func WithCoalescing(maxBody int64) Option {
+	return func(h *handler) {
+		h.coalesce = &coalescer{maxBody: maxBody, calls: make(map[[sha256.Size]byte]*coalescedCall)}
+	}
+}
+
+// coalescer tracks the coalescable requests in flight.
+type coalescer struct {
+	maxBody int64
+
+	mu    sync.Mutex
+	calls map[[sha256.Size]byte]*coalescedCall
+}
+
+// coalescedCall is one in-flight request and, once done is closed, its
+// response.
+type coalescedCall struct {
+	reqID string
+	done  chan struct{}
+	rec   *coalesceRecorder
+
+	ok               bool // the response may be shared
+	status           int
+	header           http.Header
+	body             []byte
+	backendID        int
+	upstreamStatus   int32
+	model            string
+	promptTokens     int64
+	completionTokens int64
+}
+
+// key returns the coalescing key of r, whose body is rb, or false if r
+// can't be coalesced.
+func (c *coalescer) key(r *http.Request, rb *requestBody) ([sha256.Size]byte, bool) {
+	if r.Method != http.MethodPost || !isInferencePath(r.URL.Path) || isAudioPath(r.URL.Path) {
+		return [sha256.Size]byte{}, false
+	}
+	if r.Header.Get(StickyHeader) != "" || r.ContentLength < 0 || r.ContentLength > c.maxBody {
+		return [sha256.Size]byte{}, false
+	}
+	if !rb.deterministic() {
+		return [sha256.Size]byte{}, false
+	}
+	hash := sha256.New()
+	for _, part := range []string{clientKeyID(r), r.URL.RequestURI(), r.Header.Get(PoolHeader)} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	hash.Write(rb.bytes())
+	var key [sha256.Size]byte
+	hash.Sum(key[:0])
+	return key, true
+}
+
+// join returns the call in flight for key, or registers a new one made by
+// the request reqID, in which case leader is true and the caller must
+// finish it.
+func (c *coalescer) join(key [sha256.Size]byte, reqID string) (call *coalescedCall, leader bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if call, ok := c.calls[key]; ok {
+		return call, false
+	}
+	call = &coalescedCall{reqID: reqID, done: make(chan struct{})}
+	c.calls[key] = call
+	return call, true
+}
+
+// finish publishes the leader's response to the requests waiting on call.
+// shareable is false if the response must not be copied: the client went
+// away, the request timed out, or the body wasn't copied to the end. Only
+// 2xx responses are shared in any case.
+func (c *coalescer) finish(key [sha256.Size]byte, call *coalescedCall, shareable bool) {
+	c.mu.Lock()
+	delete(c.calls, key)
+	c.mu.Unlock()
+	rec := call.rec
+	call.ok = shareable && rec != nil && !rec.overflow && rec.status >= 200 && rec.status < 300
+	if rec != nil {
+		call.status, call.header, call.body = rec.status, rec.header, rec.body.Bytes()
+	}
+	close(call.done)
+}
+
+// wait blocks until call is finished, reporting whether its response may
+// be copied. It returns false if ctx is done first.
+func (call *coalescedCall) wait(ctx context.Context) bool {
+	select {
+	case <-call.done:
+		return call.ok
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// writeTo copies the call's response to w as the response to reqID.
+func (call *coalescedCall) writeTo(w http.ResponseWriter, reqID string) {
+	for k, vv := range call.header {
+		w.Header()[k] = append([]string(nil), vv...)
+	}
+	w.Header().Set(RequestIDHeader, reqID)
+	w.WriteHeader(call.status)
+	w.Write(call.body)
+}
+
+// eofBody calls onEOF once its reader is read to the end, telling a
+// completely copied response body from one cut short by an error.
+type eofBody struct {
+	io.ReadCloser
+	onEOF func()
+}
+
+func (b *eofBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.onEOF()
+	}
+	return n, err
+}
+
+// coalesceRecorder passes a response through to the client, keeping a
+// copy for coalesced followers.
+type coalesceRecorder struct {
+	http.ResponseWriter
+	status   int
+	header   http.Header // snapshot taken when the header was written
+	body     bytes.Buffer
+	overflow bool // body exceeded coalesceMaxResponse
+}
+
+func (cr *coalesceRecorder) WriteHeader(code int) {
+	if cr.header == nil {
+		cr.status = code
+		cr.header = cr.Header().Clone()
+	}
+	cr.ResponseWriter.WriteHeader(code)
+}
+
+func (cr *coalesceRecorder) Write(b []byte) (int, error) {
+	if cr.header == nil {
+		cr.WriteHeader(http.StatusOK)
+	}
+	n, err := cr.ResponseWriter.Write(b)
+	if !cr.overflow {
+		if cr.body.Len()+n > coalesceMaxResponse {
+			cr.overflow = true
+			cr.body = bytes.Buffer{}
+		} else {
+			cr.body.Write(b[:n])
+		}
+	}
+	return n, err
+}
+
+// Flush implements http.Flusher for streaming (SSE) support.
+func (cr *coalesceRecorder) Flush() {
+	if f, ok := cr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
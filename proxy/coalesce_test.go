@@ -0,0 +1,199 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// coalesceBackend returns a backend whose server waits for release before
+// answering with status and counts the requests it receives.
+func coalesceBackend(t *testing.T, status int, hits *atomic.Int32, release <-chan struct{}) (*backend.Backend, *httptest.Server) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"call":%d}`, n)
+	}))
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	return be, srv
+}
+
+// serveConcurrently sends n copies of body to handler at once, releasing
+// the backend once they have all arrived at the proxy.
+func serveConcurrently(handler http.Handler, n int, body string, release chan struct{}) []*httptest.ResponseRecorder {
+	recs := make([]*httptest.ResponseRecorder, n)
+	var wg sync.WaitGroup
+	for i := range recs {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.ServeHTTP(recs[i], httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	return recs
+}
+
+func TestHandlerCoalescesIdenticalRequests(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+	be, srv := coalesceBackend(t, http.StatusOK, &hits, release)
+	defer srv.Close()
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithCoalescing(1<<20))
+
+	recs := serveConcurrently(handler, 5, `{"temperature":0,"messages":[]}`, release)
+	if hits.Load() != 1 {
+		t.Errorf("backend got %d requests, want 1", hits.Load())
+	}
+	ids := map[string]bool{}
+	for _, rec := range recs {
+		if rec.Code != http.StatusOK || rec.Body.String() != `{"call":1}` {
+			t.Errorf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+		ids[rec.Header().Get(RequestIDHeader)] = true
+	}
+	if len(ids) != len(recs) {
+		t.Errorf("request IDs = %v, want one per request", ids)
+	}
+}
+
+func TestHandlerCoalescingSkipsNondeterministic(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+	be, srv := coalesceBackend(t, http.StatusOK, &hits, release)
+	defer srv.Close()
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithCoalescing(1<<20))
+
+	serveConcurrently(handler, 3, `{"temperature":1,"messages":[]}`, release)
+	if hits.Load() != 3 {
+		t.Errorf("backend got %d requests, want 3", hits.Load())
+	}
+}
+
+func TestHandlerCoalescingRetriesAfterFailure(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+	be, srv := coalesceBackend(t, http.StatusInternalServerError, &hits, release)
+	defer srv.Close()
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithCoalescing(1<<20))
+
+	serveConcurrently(handler, 3, `{"temperature":0,"messages":[]}`, release)
+	if hits.Load() != 3 {
+		t.Errorf("backend got %d requests, want each follower to retry after the 500", hits.Load())
+	}
+}
+
+func TestHandlerCoalescingSkipsTruncatedResponse(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		if n == 1 {
+			// A 200 whose body is cut off mid-way.
+			w.Header().Set("Content-Length", "100")
+			fmt.Fprint(w, `{"call":`)
+			return
+		}
+		fmt.Fprintf(w, `{"call":%d}`, n)
+	}))
+	defer srv.Close()
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithCoalescing(1<<20))
+
+	recs := serveConcurrently(handler, 3, `{"temperature":0,"messages":[]}`, release)
+	if hits.Load() != 3 {
+		t.Errorf("backend got %d requests, want each follower to retry after the truncated response", hits.Load())
+	}
+	complete := 0
+	for _, rec := range recs {
+		if rec.Body.String() != `{"call":` {
+			complete++
+		}
+	}
+	if complete != 2 {
+		t.Errorf("%d complete responses, want 2 (only the leader's is truncated)", complete)
+	}
+}
+
+func TestHandlerCoalescedFollowersAreCounted(t *testing.T) {
+	release := make(chan struct{})
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":20}}`)
+	}))
+	defer srv.Close()
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	usage := NewUsageTracker()
+	recent := NewRecentRequests(10)
+	handler := NewReverseProxy(bal, nil, WithCoalescing(1<<20), WithUsage(usage), WithRecentRequests(recent))
+
+	serveConcurrently(handler, 4, `{"model":"m","temperature":0,"messages":[]}`, release)
+	if hits.Load() != 1 {
+		t.Errorf("backend got %d requests, want 1", hits.Load())
+	}
+	want := Usage{Requests: 4, PromptTokens: 40, CompletionTokens: 80}
+	if got := usage.ByBackend()[1]; got != want {
+		t.Errorf("ByBackend()[1] = %+v, want %+v", got, want)
+	}
+	entries := recent.Recent()
+	if len(entries) != 4 {
+		t.Fatalf("recent requests = %d, want 4", len(entries))
+	}
+	for _, e := range entries {
+		if e.BackendID != 1 || e.Status != http.StatusOK || e.Model != "m" {
+			t.Errorf("recent entry = %+v", e)
+		}
+	}
+}
+
+func TestHandlerCoalescedFollowersPassKeyLimits(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+	be, srv := coalesceBackend(t, http.StatusOK, &hits, release)
+	defer srv.Close()
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithCoalescing(1<<20), WithKeyLimits(NewKeyLimiter(1, nil)))
+
+	recs := serveConcurrently(handler, 3, `{"temperature":0,"messages":[]}`, release)
+	limited := 0
+	for _, rec := range recs {
+		if rec.Code == http.StatusTooManyRequests {
+			limited++
+		}
+	}
+	if limited != 2 {
+		t.Errorf("%d requests rejected by the key limit, want 2", limited)
+	}
+}
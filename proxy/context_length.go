@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// PromptTokens passes the request's estimated prompt size, so it goes to a
+// backend whose context window fits it.
+func PromptTokens(n int64) PickOption {
+	return func(h *pickHints) {
+		h.promptTokens = n
+	}
+}
+
+// WithContextRouting estimates each request's prompt size so that long
+// prompts go to backends whose context window fits them, and prompts that
+// fit no backend are rejected with 400 before reaching one.
+func WithContextRouting() Option {
+	return func(h *handler) {
+		h.contextRouting = true
+	}
+}
+
+// routesOnPromptSize reports whether any enabled feature needs the
+// request's estimated prompt size.
+func (h *handler) routesOnPromptSize() bool {
+	return h.contextRouting || h.longPromptTokens > 0
+}
+
+// withContextFor returns the backends whose context length fits n tokens
+// (or is unknown). If none does, all are returned and the engine decides.
+func withContextFor(backends []*backend.Backend, n int64) []*backend.Backend {
+	var out []*backend.Backend
+	for _, be := range backends {
+		if l := be.ContextLength(); l == 0 || l >= n {
+			out = append(out, be)
+		}
+	}
+	if len(out) == 0 {
+		return backends
+	}
+	return out
+}
+
+// MaxContextLength returns the largest context length among the healthy
+// backends in pool ("" for all backends). ok is false if any of them
+// hasn't reported one, or none is healthy.
+func (b *Balancer) MaxContextLength(pool string) (n int64, ok bool) {
+	_, n, ok = b.largestContext(pool)
+	return n, ok
+}
+
+// largestContext is MaxContextLength, also returning a backend with that
+// context length.
+func (b *Balancer) largestContext(pool string) (largest *backend.Backend, n int64, ok bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, be := range b.backends {
+		if !be.IsHealthy() || pool != "" && !b.inPool(be, pool) || b.isAudio(be) || b.isShadow(be) {
+			continue
+		}
+		l := be.ContextLength()
+		if l == 0 {
+			return nil, 0, false
+		}
+		if l > n {
+			largest, n = be, l
+		}
+	}
+	return largest, n, n > 0
+}
+
+// exceedsContext reports whether body's prompt is longer than every
+// backend's context window, returning its token count and the largest
+// window. The length-based estimate only flags candidates: a prompt is
+// rejected only once the engine's own tokenizer has counted it, since the
+// estimate can be far off (images, non-English text).
+func (h *handler) exceedsContext(ctx context.Context, pool string, estimate int64, body []byte) (tokens, maxTokens int64, exceeds bool) {
+	be, maxTokens, ok := h.balancer.largestContext(pool)
+	if !ok || estimate <= maxTokens {
+		return 0, 0, false
+	}
+	tokens, err := be.Tokenize(ctx, body)
+	if err != nil {
+		log.Printf("proxy: [%s] can't count prompt tokens on backend %d: %v", RequestIDFromContext(ctx), be.Instance.ID, err)
+		return 0, 0, false
+	}
+	return tokens, maxTokens, tokens > maxTokens
+}
+
+// writeContextLengthExceeded writes the 400 OpenAI clients get when a
+// prompt is too long for the model.
+func writeContextLengthExceeded(w http.ResponseWriter, promptTokens, maxTokens int64) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	fmt.Fprintf(w, `{"error":{"message":%q,"type":"invalid_request_error","code":"context_length_exceeded"}}`,
+		fmt.Sprintf("This request's prompt is %d tokens, more than the largest context length served (%d tokens).",
+			promptTokens, maxTokens))
+}
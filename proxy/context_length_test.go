@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+// longPrompt returns a chat request whose prompt is estimated at n tokens.
+func longPrompt(n int) string {
+	return `{"messages":[{"role":"user","content":"` + strings.Repeat("x", 4*n) + `"}]}`
+}
+
+func contextBackend(t *testing.T, id int, contextLength int64) *backend.Backend {
+	t.Helper()
+	return tokenizingBackend(t, id, contextLength, 1)
+}
+
+// tokenizingBackend returns a backend with the given context length whose
+// tokenizer counts tokensPer4Chars tokens for every 4 bytes it is sent.
+func tokenizingBackend(t *testing.T, id int, contextLength int64, tokensPer4Chars int) *backend.Backend {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/tokenize" {
+			body, _ := io.ReadAll(r.Body)
+			fmt.Fprintf(w, `{"count":%d}`, len(body)/4*tokensPer4Chars)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"path":%q}`, r.URL.Path)
+	}))
+	t.Cleanup(srv.Close)
+	be := backend.NewBackend(&vast.Instance{ID: id}, "", nil, "")
+	be.SetBaseURL(srv.URL)
+	be.SetHealthy(true)
+	be.SetContextLength(contextLength)
+	return be
+}
+
+func TestContextLengthExceeded(t *testing.T) {
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{contextBackend(t, 1, 4096), contextBackend(t, 2, 8192)})
+	handler := NewReverseProxy(bal, nil, WithContextRouting())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(longPrompt(10000))))
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), "context_length_exceeded") {
+		t.Fatalf("status = %d body = %s, want 400 context_length_exceeded", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(longPrompt(100))))
+	if rec.Code != 200 {
+		t.Errorf("short prompt: status = %d, want 200", rec.Code)
+	}
+}
+
+func TestContextLengthRejectsOnlyOnTokenizerCount(t *testing.T) {
+	// The engine counts far fewer tokens than the length-based estimate.
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{tokenizingBackend(t, 1, 4096, 0)})
+	handler := NewReverseProxy(bal, nil, WithContextRouting())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(longPrompt(10000))))
+	if rec.Code != 200 {
+		t.Errorf("status = %d body = %s, want 200: the tokenizer says the prompt fits", rec.Code, rec.Body.String())
+	}
+}
+
+func TestContextLengthNotRejectedWithoutTokenizer(t *testing.T) {
+	srv := fakeBackendServer(t)
+	defer srv.Close()
+	be := backend.NewBackend(&vast.Instance{ID: 1}, "", nil, "")
+	be.SetBaseURL(srv.URL)
+	be.SetHealthy(true)
+	be.SetContextLength(4096)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithContextRouting())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(longPrompt(10000))))
+	if rec.Code != 200 {
+		t.Errorf("status = %d, want 200 when the prompt can't be counted", rec.Code)
+	}
+}
+
+func TestContextLengthUnknownNotRejected(t *testing.T) {
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{contextBackend(t, 1, 4096), contextBackend(t, 2, 0)})
+	handler := NewReverseProxy(bal, nil, WithContextRouting())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(longPrompt(10000))))
+	if rec.Code != 200 || rec.Header().Get(StickyHeader) != "2" {
+		t.Errorf("status = %d backend = %s, want 200 from backend 2 (unknown context)", rec.Code, rec.Header().Get(StickyHeader))
+	}
+}
+
+func TestLongPromptPrefersLargerContext(t *testing.T) {
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{contextBackend(t, 1, 4096), contextBackend(t, 2, 32768)})
+	handler := NewReverseProxy(bal, nil, WithContextRouting())
+
+	for range 4 {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(longPrompt(8000))))
+		if got := rec.Header().Get(StickyHeader); got != "2" {
+			t.Fatalf("long prompt went to backend %s, want 2", got)
+		}
+	}
+}
+
+func TestMaxContextLength(t *testing.T) {
+	bal := NewBalancer()
+	if _, ok := bal.MaxContextLength(""); ok {
+		t.Error("MaxContextLength with no backends should not be ok")
+	}
+	down := contextBackend(t, 3, 1<<20)
+	down.SetHealthy(false)
+	bal.SetBackends([]*backend.Backend{contextBackend(t, 1, 4096), contextBackend(t, 2, 8192), down})
+	if n, ok := bal.MaxContextLength(""); !ok || n != 8192 {
+		t.Errorf("MaxContextLength() = %d, %v; want 8192, true", n, ok)
+	}
+}
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminDebug(t *testing.T) {
+	handler := (&Admin{Debug: true}).Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/goroutine?debug=1", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "goroutine profile") {
+		t.Errorf("goroutine profile: %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/runtime", nil))
+	var stats RuntimeStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("bad JSON %q: %v", rec.Body.String(), err)
+	}
+	if stats.Goroutines == 0 || stats.HeapAlloc == 0 {
+		t.Errorf("runtime stats = %+v", stats)
+	}
+}
+
+func TestAdminDebugDisabled(t *testing.T) {
+	handler := (&Admin{}).Handler()
+	for _, path := range []string{"/debug/pprof/", "/debug/runtime"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// tagAbortID sets the "rid" field of the JSON request body raw, which
+// SGLang uses as the request's ID, so the request can be aborted on its own
+// if the client goes away. An rid the client sent is kept. It returns the
+// request's rid, or "" if raw isn't a JSON object, and the body to send
+// instead of raw, or nil if raw is unchanged. The field is spliced in, so
+// the rest of the body is sent byte-for-byte.
+func tagAbortID(raw []byte, rid string) (string, []byte) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(raw, &fields) != nil || fields == nil {
+		return "", nil
+	}
+	if existing, ok := fields["rid"]; ok {
+		var s string
+		if json.Unmarshal(existing, &s) != nil {
+			return "", nil
+		}
+		return s, nil
+	}
+	obj := bytes.TrimLeft(raw, " \t\r\n")
+	field, _ := json.Marshal(rid)
+	out := append([]byte(`{"rid":`), field...)
+	if len(fields) > 0 {
+		out = append(out, ',')
+	}
+	return rid, append(out, obj[1:]...)
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+func TestTagAbortID(t *testing.T) {
+	tests := []struct {
+		body, want, sent string
+	}{
+		{`{"model":"m","seed":12345678901234567890}`, "req-1", `{"rid":"req-1","model":"m","seed":12345678901234567890}`},
+		{` {}`, "req-1", `{"rid":"req-1"}`},
+		{`{"model":"m","rid":"mine"}`, "mine", ""},
+		{`not json`, "", ""},
+		{`[1,2]`, "", ""},
+	}
+	for _, tt := range tests {
+		got, sent := tagAbortID([]byte(tt.body), "req-1")
+		if got != tt.want || string(sent) != tt.sent {
+			t.Errorf("tagAbortID(%s) = %q, %s, want %q, %s", tt.body, got, sent, tt.want, tt.sent)
+		}
+	}
+}
+
+func TestReverseProxyAbortsOnClientDisconnect(t *testing.T) {
+	started := make(chan string, 1)
+	aborted := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			RID string `json:"rid"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path == "/abort_request" {
+			aborted <- req.RID
+			return
+		}
+		started <- req.RID
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	be := backend.NewBackend(&vast.Instance{ID: 1, Engine: vast.EngineSGLang}, "", nil, "")
+	be.SetBaseURL(srv.URL)
+	be.SetHealthy(true)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"stream":true}`)).WithContext(ctx)
+	req.Header.Set(RequestIDHeader, "req-abc")
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+	if rid := <-started; rid != "req-abc" {
+		t.Errorf("backend got rid %q, want req-abc", rid)
+	}
+	cancel()
+	<-done
+
+	select {
+	case rid := <-aborted:
+		if rid != "req-abc" {
+			t.Errorf("aborted rid %q, want req-abc", rid)
+		}
+	case <-time.After(time.Second):
+		t.Error("no abort sent after the client disconnected")
+	}
+}
+
+func TestReverseProxyTagsOnlyInferenceRequests(t *testing.T) {
+	sent := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sent <- string(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	be := backend.NewBackend(&vast.Instance{ID: 1, Engine: vast.EngineSGLang}, "", nil, "")
+	be.SetBaseURL(srv.URL)
+	be.SetHealthy(true)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	capture := NewBodyCapture(4, 0, nil)
+	handler := NewReverseProxy(bal, nil, WithBodyCapture(capture))
+
+	for _, tt := range []struct{ path, want string }{
+		{"/v1/chat/completions", `{"rid":"req-abc","model":"m"}`},
+		{"/tokenize", `{"model":"m"}`},
+	} {
+		req := httptest.NewRequest("POST", tt.path, strings.NewReader(`{"model":"m"}`))
+		req.Header.Set(RequestIDHeader, "req-abc")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if got := <-sent; got != tt.want {
+			t.Errorf("%s: backend got %s, want %s", tt.path, got, tt.want)
+		}
+	}
+	// Captures show the body the client sent.
+	for _, ex := range capture.Recent() {
+		if ex.RequestBody != `{"model":"m"}` {
+			t.Errorf("%s: captured request body %s", ex.Path, ex.RequestBody)
+		}
+	}
+}
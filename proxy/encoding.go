@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// decodableEncodings are the content codings the proxy can decompress.
+var decodableEncodings = map[string]bool{"gzip": true, "x-gzip": true, "deflate": true, "identity": true}
+
+// inspectsBodies reports whether any enabled feature reads response bodies
+// (usage accounting, body capture, TTFT, Responses translation), in which
+// case compressed responses are decoded before they reach the client.
+func (h *handler) inspectsBodies(translated bool) bool {
+	return h.usage != nil || h.capture != nil || h.ttft != nil || translated
+}
+
+// restrictAcceptEncoding drops content codings the proxy can't decode from
+// a request's Accept-Encoding, so the backend only compresses with
+// something decodeBody understands.
+func restrictAcceptEncoding(header http.Header) {
+	accept := header.Get("Accept-Encoding")
+	if accept == "" {
+		return
+	}
+	var kept []string
+	for _, part := range strings.Split(accept, ",") {
+		coding, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if decodableEncodings[strings.ToLower(strings.TrimSpace(coding))] {
+			kept = append(kept, strings.TrimSpace(part))
+		}
+	}
+	if len(kept) == 0 {
+		header.Del("Accept-Encoding")
+		return
+	}
+	header.Set("Accept-Encoding", strings.Join(kept, ", "))
+}
+
+// decodeBody replaces a gzip- or deflate-encoded response body with its
+// decompressed stream and removes the encoding headers, so body-inspecting
+// features see plain JSON or SSE. Other codings are left alone.
+func decodeBody(resp *http.Response) error {
+	var (
+		rc  io.ReadCloser
+		err error
+	)
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		rc, err = gzip.NewReader(resp.Body)
+	case "deflate":
+		rc, err = zlib.NewReader(resp.Body)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body = &decodedBody{ReadCloser: rc, raw: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	return nil
+}
+
+// decodedBody is a decompressing reader that also closes the underlying
+// response body.
+type decodedBody struct {
+	io.ReadCloser
+	raw io.ReadCloser
+}
+
+func (b *decodedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.raw.Close()
+}
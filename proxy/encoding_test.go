@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestRestrictAcceptEncoding(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"gzip, deflate, br, zstd", "gzip, deflate"},
+		{"br;q=1.0, gzip;q=0.5", "gzip;q=0.5"},
+		{"br", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.in != "" {
+			h.Set("Accept-Encoding", tt.in)
+		}
+		restrictAcceptEncoding(h)
+		if got := h.Get("Accept-Encoding"); got != tt.want {
+			t.Errorf("restrictAcceptEncoding(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// gzipBackend serves body gzip-compressed, flushing after each chunk so
+// SSE events arrive as they are written.
+func gzipBackend(t *testing.T, contentType string, chunks ...string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			t.Errorf("Accept-Encoding = %q, want gzip offered", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		for _, c := range chunks {
+			io.WriteString(zw, c)
+			zw.Flush()
+			w.(http.Flusher).Flush()
+		}
+		zw.Close()
+	}))
+}
+
+func TestReverseProxyUsageGzipJSON(t *testing.T) {
+	srv := gzipBackend(t, "application/json",
+		`{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":20}}`)
+	defer srv.Close()
+
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	usage := NewUsageTracker()
+	handler := NewReverseProxy(bal, nil, WithUsage(usage))
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"messages":[]}`))
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Content-Encoding = %q, want decoded response", rec.Header().Get("Content-Encoding"))
+	}
+	if !strings.Contains(rec.Body.String(), `"prompt_tokens":10`) {
+		t.Errorf("body = %q, want plain JSON", rec.Body.String())
+	}
+	if got := usage.ByBackend()[1]; got.PromptTokens != 10 || got.CompletionTokens != 20 {
+		t.Errorf("usage = %+v, want 10 prompt, 20 completion tokens", got)
+	}
+}
+
+func TestReverseProxyUsageGzipSSE(t *testing.T) {
+	srv := gzipBackend(t, "text/event-stream",
+		`data: {"choices":[{"delta":{"content":"he"}}]}`+"\n\n",
+		`data: {"choices":[{"delta":{"content":"llo"}}]}`+"\n\n",
+		"data: [DONE]\n\n")
+	defer srv.Close()
+
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	usage := NewUsageTracker()
+	tr := NewTTFTTracker()
+	handler := NewReverseProxy(bal, nil, WithUsage(usage), WithTTFT(tr))
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"stream":true}`))
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if !strings.Contains(rec.Body.String(), "data: [DONE]") {
+		t.Errorf("body = %q, want decoded SSE", rec.Body.String())
+	}
+	if got := usage.ByBackend()[1]; got.CompletionTokens != 2 {
+		t.Errorf("completion tokens = %d, want 2 streamed chunks", got.CompletionTokens)
+	}
+	if got := tr.ByBackend()[1]; got.Count != 1 {
+		t.Errorf("TTFT count = %d, want 1", got.Count)
+	}
+}
+
+func TestReverseProxyGzipPassthrough(t *testing.T) {
+	srv := gzipBackend(t, "application/json", `{"ok":true}`)
+	defer srv.Close()
+
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil)
+
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	// Nothing inspects the body, so the client gets it compressed.
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip passed through", rec.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(rec.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, _ := io.ReadAll(zr)
+	if string(plain) != `{"ok":true}` {
+		t.Errorf("decompressed body = %q", plain)
+	}
+}
+
+func TestDecodeBodyIdentity(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}, Body: io.NopCloser(strings.NewReader("plain"))}
+	if err := decodeBody(resp); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "plain" {
+		t.Errorf("body = %q", body)
+	}
+	resp = &http.Response{Header: http.Header{"Content-Encoding": {"gzip"}}, Body: io.NopCloser(strings.NewReader("not gzip"))}
+	if err := decodeBody(resp); err == nil {
+		t.Error("expected error for corrupt gzip body")
+	}
+}
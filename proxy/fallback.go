@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// WithModelFallbacks configures fallback models for pooled routing: when
+// every backend for a requested model is unhealthy (or gone), the request
+// is sent to the fallback model's pool instead, with its model field
+// rewritten. Fallbacks chain (a→b→c) until a healthy pool is found.
+func WithModelFallbacks(fallbacks map[string]string) Option {
+	return func(h *handler) {
+		h.fallbacks = fallbacks
+	}
+}
+
+// ParseModelFallbacks parses a comma-separated list of model=fallback
+// pairs, e.g. "llama-70b=llama-8b,qwen-72b=qwen-7b".
+func ParseModelFallbacks(s string) (map[string]string, error) {
+	fallbacks := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		model, fallback, ok := strings.Cut(pair, "=")
+		if !ok || model == "" || fallback == "" {
+			return nil, fmt.Errorf("invalid model fallback %q (want model=fallback)", pair)
+		}
+		fallbacks[model] = fallback
+	}
+	return fallbacks, nil
+}
+
+// pickFallback walks the fallback chain for pool and returns a backend from
+// the first pool with a healthy member, rewriting r's model field to match.
+func (h *handler) pickFallback(r *http.Request, rb *requestBody, pool string, opts ...PickOption) (*backend.Backend, bool) {
+	seen := map[string]bool{pool: true}
+	for next, ok := h.fallbacks[pool]; ok && !seen[next]; next, ok = h.fallbacks[next] {
+		seen[next] = true
+		be, err := h.balancer.PickPool(next, opts...)
+		if err != nil {
+			continue
+		}
+		if err := setRequestModel(rb, next); err != nil {
+			if streamingPick(opts) {
+				be.ReleaseStream()
+			}
+			log.Printf("proxy: [%s] rewrite model for fallback: %v", RequestIDFromContext(r.Context()), err)
+			return nil, false
+		}
+		log.Printf("proxy: [%s] model %q unavailable, falling back to %q",
+			RequestIDFromContext(r.Context()), pool, next)
+		return be, true
+	}
+	return nil, false
+}
+
+// setRequestModel replaces the "model" field of the request's JSON body,
+// if present. Other fields keep their values, but the object is
+// re-encoded: keys come out sorted and insignificant whitespace is dropped.
+func setRequestModel(rb *requestBody, model string) error {
+	raw := rb.bytes()
+	if rb.err != nil {
+		return rb.err
+	}
+	if raw != nil {
+		rb.replace(setModelField(raw, model))
+	}
+	return nil
+}
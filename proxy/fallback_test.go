@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+func TestParseModelFallbacks(t *testing.T) {
+	got, err := ParseModelFallbacks("a=b, b=c")
+	if err != nil {
+		t.Fatalf("ParseModelFallbacks() error: %v", err)
+	}
+	if got["a"] != "b" || got["b"] != "c" {
+		t.Errorf("got %v", got)
+	}
+	for _, bad := range []string{"a", "=b", "a="} {
+		if _, err := ParseModelFallbacks(bad); err == nil {
+			t.Errorf("ParseModelFallbacks(%q) expected error", bad)
+		}
+	}
+}
+
+func TestSetRequestModel(t *testing.T) {
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"a","stream":true}`))
+	rb := newRequestBody(httptest.NewRecorder(), req)
+	if err := setRequestModel(rb, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if rb.model() != "b" || !rb.streams() {
+		t.Errorf("parsed body: model = %q, stream = %v", rb.model(), rb.streams())
+	}
+	body, _ := io.ReadAll(req.Body)
+	if !strings.Contains(string(body), `"model":"b"`) || !strings.Contains(string(body), `"stream":true`) {
+		t.Errorf("body = %s", body)
+	}
+	if req.ContentLength != int64(len(body)) {
+		t.Errorf("ContentLength = %d, want %d", req.ContentLength, len(body))
+	}
+
+	// Bodies without a model field are left alone.
+	req = httptest.NewRequest("POST", "/v1/x", strings.NewReader(`{"input":"x"}`))
+	setRequestModel(newRequestBody(httptest.NewRecorder(), req), "b")
+	body, _ = io.ReadAll(req.Body)
+	if string(body) != `{"input":"x"}` {
+		t.Errorf("body = %s", body)
+	}
+}
+
+func TestReverseProxyModelFallback(t *testing.T) {
+	var gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	big := backend.NewBackend(&vast.Instance{ID: 1, ModelName: "big"}, "", nil, "")
+	big.SetBaseURL(srv.URL)
+	small := backend.NewBackend(&vast.Instance{ID: 2, ModelName: "small"}, "", nil, "")
+	small.SetBaseURL(srv.URL)
+	small.SetHealthy(true)
+
+	bal := NewBalancer()
+	bal.SetPoolMode(PoolByModel)
+	bal.SetBackends([]*backend.Backend{big, small})
+	usage := NewUsageTracker()
+	handler := NewReverseProxy(bal, nil, WithModelFallbacks(map[string]string{"big": "small"}), WithUsage(usage))
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"big"}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get(StickyHeader); got != "2" {
+		t.Errorf("routed to %s, want 2", got)
+	}
+	if gotBody != `{"model":"small"}` {
+		t.Errorf("backend body = %s, want model rewritten to small", gotBody)
+	}
+	if rows := usage.Rows(); len(rows) != 1 || rows[0].Model != "small" {
+		t.Errorf("usage rows = %+v, want one for model small", rows)
+	}
+}
+
+// Tagging an SGLang request with its rid keeps the fallback's model.
+func TestReverseProxyModelFallbackSGLang(t *testing.T) {
+	var gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	big := backend.NewBackend(&vast.Instance{ID: 1, ModelName: "big"}, "", nil, "")
+	big.SetBaseURL(srv.URL)
+	small := backend.NewBackend(&vast.Instance{ID: 2, ModelName: "small", Engine: vast.EngineSGLang}, "", nil, "")
+	small.SetBaseURL(srv.URL)
+	small.SetHealthy(true)
+
+	bal := NewBalancer()
+	bal.SetPoolMode(PoolByModel)
+	bal.SetBackends([]*backend.Backend{big, small})
+	handler := NewReverseProxy(bal, nil, WithModelFallbacks(map[string]string{"big": "small"}))
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"big"}`))
+	req.Header.Set(RequestIDHeader, "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if gotBody != `{"rid":"req-1","model":"small"}` {
+		t.Errorf("backend body = %s, want rid added and model rewritten to small", gotBody)
+	}
+}
+
+func TestReverseProxyModelFallbackCycle(t *testing.T) {
+	a := makeModelBackend(t, 1, "a")
+	a.SetHealthy(false)
+	b := makeModelBackend(t, 2, "b")
+	b.SetHealthy(false)
+
+	bal := NewBalancer()
+	bal.SetPoolMode(PoolByModel)
+	bal.SetBackends([]*backend.Backend{a, b})
+	handler := NewReverseProxy(bal, nil, WithModelFallbacks(map[string]string{"a": "b", "b": "a"}))
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"a"}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// authHeaders carry client credentials, which never reach a backend; the
+// backend is sent its own bearer token instead.
+var authHeaders = []string{"Authorization", "Proxy-Authorization", "Api-Key", "X-Api-Key", "Cookie"}
+
+// proxyHeaders are X- headers the proxy sets itself, exempt from
+// HeaderRules.Forward.
+var proxyHeaders = map[string]bool{
+	RequestIDHeader:     true,
+	"X-Forwarded-For":   true,
+	"X-Forwarded-Host":  true,
+	"X-Forwarded-Port":  true,
+	"X-Forwarded-Proto": true,
+	"X-Real-Ip":         true,
+}
+
+// internalHeaderPrefix marks proxy-internal headers (sticky pin, pool, ...),
+// in canonical form.
+const internalHeaderPrefix = "X-Vastproxy-"
+
+// HeaderRules control which client request headers reach backends, on top
+// of the built-in handling: client credentials and proxy-internal headers
+// are always stripped, and the request ID and backend token always set.
+//
+// Header name patterns are case-insensitive; a trailing "*" matches any
+// suffix, e.g. "X-Internal-*".
+type HeaderRules struct {
+	// Forward, if set, lists the only extension ("X-") headers forwarded,
+	// e.g. X-Correlation-ID; other X- headers are dropped. Standard
+	// headers, including the W3C traceparent, tracestate and baggage, are
+	// always forwarded so distributed traces survive the hop.
+	Forward []string
+
+	// Drop lists headers never forwarded, standard or not.
+	Drop []string
+
+	// Set adds headers, replacing any the client sent.
+	Set http.Header
+}
+
+// WithHeaderRules applies rules to the headers forwarded to backends.
+func WithHeaderRules(rules HeaderRules) Option {
+	return func(h *handler) {
+		h.headerRules = rules
+	}
+}
+
+// matchHeader reports whether the canonical header name matches any of
+// patterns.
+func matchHeader(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+				return true
+			}
+		} else if strings.EqualFold(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterHeaders removes client credentials and proxy-internal headers from
+// an outbound request, then applies the configured HeaderRules.
+func (h *handler) filterHeaders(header http.Header) {
+	for _, name := range authHeaders {
+		header.Del(name)
+	}
+	rules := h.headerRules
+	for name := range header {
+		switch {
+		case strings.HasPrefix(name, internalHeaderPrefix),
+			matchHeader(rules.Drop, name),
+			rules.Forward != nil && strings.HasPrefix(name, "X-") &&
+				!proxyHeaders[name] && !matchHeader(rules.Forward, name):
+			delete(header, name)
+		}
+	}
+	for name, values := range rules.Set {
+		header[http.CanonicalHeaderKey(name)] = values
+	}
+}
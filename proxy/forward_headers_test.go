@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// headerBackend returns a backend that records the headers it receives.
+func headerBackend(t *testing.T) (*backend.Backend, *http.Header) {
+	t.Helper()
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	t.Cleanup(srv.Close)
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	return be, &got
+}
+
+func clientRequest() *http.Request {
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer client-secret")
+	req.Header.Set("X-Api-Key", "client-secret")
+	req.Header.Set("Cookie", "session=abc")
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("Tracestate", "vendor=value")
+	req.Header.Set("X-Correlation-ID", "corr-1")
+	req.Header.Set("X-Debug-Token", "internal")
+	req.Header.Set(PoolHeader, "llama")
+	req.Header.Set("Accept", "application/json")
+	return req
+}
+
+func TestForwardHeadersDefault(t *testing.T) {
+	be, got := headerBackend(t)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	NewReverseProxy(bal, nil).ServeHTTP(httptest.NewRecorder(), clientRequest())
+
+	h := *got
+	if h.Get("Authorization") != "Bearer tok" {
+		t.Errorf("Authorization = %q, want backend token", h.Get("Authorization"))
+	}
+	for _, name := range []string{"X-Api-Key", "Cookie", PoolHeader} {
+		if v := h.Get(name); v != "" {
+			t.Errorf("%s = %q, want stripped", name, v)
+		}
+	}
+	for _, name := range []string{"Traceparent", "Tracestate", "X-Correlation-ID", "X-Debug-Token", "Accept", RequestIDHeader} {
+		if h.Get(name) == "" {
+			t.Errorf("%s not forwarded", name)
+		}
+	}
+}
+
+func TestForwardHeadersRestricted(t *testing.T) {
+	be, got := headerBackend(t)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithHeaderRules(HeaderRules{Forward: []string{"x-correlation-id"}}))
+	handler.ServeHTTP(httptest.NewRecorder(), clientRequest())
+
+	h := *got
+	if h.Get("X-Debug-Token") != "" {
+		t.Error("unlisted X-Debug-Token forwarded")
+	}
+	for _, name := range []string{"Traceparent", "Tracestate", "X-Correlation-ID", "Accept", RequestIDHeader} {
+		if h.Get(name) == "" {
+			t.Errorf("%s not forwarded", name)
+		}
+	}
+}
+
+func TestHeaderRulesDropAndSet(t *testing.T) {
+	be, got := headerBackend(t)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithHeaderRules(HeaderRules{
+		Drop: []string{"x-debug-*", "Accept"},
+		Set:  http.Header{"X-Source": {"vastproxy"}, "x-correlation-id": {"fixed"}},
+	}))
+	req := clientRequest()
+	req.Header.Set("X-Debug", "kept")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	h := *got
+	for _, name := range []string{"X-Debug-Token", "Accept"} {
+		if v := h.Get(name); v != "" {
+			t.Errorf("%s = %q, want dropped", name, v)
+		}
+	}
+	if h.Get("X-Debug") != "kept" {
+		t.Error("X-Debug dropped; pattern X-Debug-* should not match it")
+	}
+	if h.Get("X-Source") != "vastproxy" || h.Get("X-Correlation-ID") != "fixed" {
+		t.Errorf("set headers = %q, %q", h.Get("X-Source"), h.Get("X-Correlation-ID"))
+	}
+	if h.Get("Authorization") != "Bearer tok" {
+		t.Errorf("Authorization = %q, want backend token", h.Get("Authorization"))
+	}
+}
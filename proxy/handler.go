@@ -1,10 +1,15 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httputil"
+	"net/netip"
 	"net/url"
 	"strconv"
 	"sync/atomic"
@@ -18,12 +23,19 @@ import (
 // to route to the same instance (best-effort — falls back to round-robin).
 const StickyHeader = "X-VastProxy-Instance"
 
+// RepinHeader is set on responses to sticky requests that could not be
+// served by the pinned instance (e.g. it is draining after preemption or
+// gone). Its value is the old instance ID; clients should re-pin to the
+// instance in StickyHeader.
+const RepinHeader = "X-VastProxy-Repin"
+
 // statusRecorder wraps http.ResponseWriter to capture the status code and
 // count bytes written, for request logging.
 type statusRecorder struct {
 	http.ResponseWriter
 	status       int
 	bytesWritten int64
+	capture      io.Writer // optional copy of the response body
 }
 
 func (sr *statusRecorder) WriteHeader(code int) {
@@ -34,6 +46,9 @@ func (sr *statusRecorder) WriteHeader(code int) {
 func (sr *statusRecorder) Write(b []byte) (int, error) {
 	n, err := sr.ResponseWriter.Write(b)
 	sr.bytesWritten += int64(n)
+	if sr.capture != nil {
+		sr.capture.Write(b[:n])
+	}
 	return n, err
 }
 
@@ -44,105 +59,617 @@ func (sr *statusRecorder) Flush() {
 	}
 }
 
+// Option configures optional behavior of the reverse proxy handler.
+type Option func(*handler)
+
+// handler is the http.Handler returned by NewReverseProxy.
+type handler struct {
+	balancer    *Balancer
+	stickyStats *StickyStats
+	accessLog   *AccessLog
+	capture     *BodyCapture
+	hedge       *hedgeConfig
+	timeouts    *RouteTimeouts
+	fallbacks   map[string]string
+	keyLimits   *KeyLimiter
+	admission   *Admission
+	maintenance *Maintenance
+	noBackends  NoBackendsResponse
+	capacityETA func() (time.Duration, bool)
+	usage       *UsageTracker
+	latency     *LatencyTracker
+	ttft        *TTFTTracker
+	recent      *RecentRequests
+	stickyStore *StickyStore
+	stickyWait  time.Duration
+
+	headerRules    HeaderRules
+	trustedProxies []netip.Prefix
+	allowedClients []netip.Prefix // nil = allow all
+
+	translateResponses bool
+	rewriteModel       bool
+	streamIdleTimeout  time.Duration
+	maxRequestDuration time.Duration
+	longPromptTokens   int64 // prompts this long get the LongPrompt hint; 0 = off
+	contextRouting     bool
+	abortOnIdle        bool
+	outliers           *OutlierDetector
+	mirror             *mirrorConfig
+	version            string
+	sseKeepAlive       time.Duration
+	coalesce           *coalescer
+	abortIdleDelay     time.Duration
+}
+
 // NewReverseProxy creates an http.Handler that load-balances all incoming
 // requests across healthy backends using the balancer's round-robin selection.
 //
 // Incoming path is forwarded as-is to the backend. For example,
 // a request to /v1/chat/completions is proxied to <backend>/v1/chat/completions.
-func NewReverseProxy(balancer *Balancer, stickyStats *StickyStats) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-
-		// Sticky routing: if the client sends X-VastProxy-Instance, try
-		// to route to that specific backend for KV cache locality.
-		var be *backend.Backend
-		hasSticky := r.Header.Get(StickyHeader) != ""
-		if stickyStats != nil {
-			stickyStats.Record(hasSticky)
-		}
-		if raw := r.Header.Get(StickyHeader); raw != "" {
-			if id, err := strconv.Atoi(raw); err == nil {
-				be, _ = balancer.PickByID(id)
-				if be != nil {
-					log.Printf("proxy: sticky route to instance %d", id)
+func NewReverseProxy(balancer *Balancer, stickyStats *StickyStats, opts ...Option) http.Handler {
+	h := &handler{
+		balancer:    balancer,
+		stickyStats: stickyStats,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	balancer := h.balancer
+
+	reqID := requestID(r)
+	clientCtx := r.Context() // done when the client disconnects
+	ctx := context.WithValue(clientCtx, requestIDKey{}, reqID)
+	if h.timeouts != nil {
+		if d := h.timeouts.For(r.URL.Path); d > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d)
+			defer cancel()
+		}
+	}
+	if h.maxRequestDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, h.maxRequestDuration, errMaxDuration)
+		defer cancel()
+	}
+	if d, ok := clientTimeout(r); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, d, errClientTimeout)
+		defer cancel()
+	}
+	// cancelUpstream aborts the backend request (e.g. on stream idle timeout).
+	ctx, cancelUpstream := context.WithCancel(ctx)
+	defer cancelUpstream()
+	r = r.WithContext(ctx)
+	w.Header().Set(RequestIDHeader, reqID)
+	body := newRequestBody(w, r)
+
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	backendID := 0
+	model := ""
+	var ttft time.Duration // time to first SSE data chunk; 0 if not streamed
+	// Capture the upstream status code from the backend response.
+	var upstreamStatus atomic.Int32
+	if h.accessLog != nil {
+		defer func() {
+			h.accessLog.Log(AccessLogEntry{
+				Time:           start,
+				RequestID:      reqID,
+				ClientAddr:     h.clientIP(r),
+				Method:         r.Method,
+				URI:            r.RequestURI,
+				Proto:          r.Proto,
+				Status:         rec.status,
+				Bytes:          rec.bytesWritten,
+				BackendID:      backendID,
+				UpstreamStatus: int(upstreamStatus.Load()),
+				Duration:       time.Since(start),
+				Referer:        r.Referer(),
+				UserAgent:      r.UserAgent(),
+			})
+		}()
+	}
+	if h.recent != nil {
+		defer func() {
+			h.recent.Add(RecentRequest{
+				Time:           start,
+				RequestID:      reqID,
+				ClientAddr:     h.clientIP(r),
+				Method:         r.Method,
+				Path:           r.URL.Path,
+				Model:          model,
+				BackendID:      backendID,
+				Status:         rec.status,
+				UpstreamStatus: int(upstreamStatus.Load()),
+				Bytes:          rec.bytesWritten,
+				Duration:       time.Since(start),
+				TTFT:           ttft,
+			})
+		}()
+	}
+
+	if ip := h.clientIP(r); h.allowedClients != nil && !containsIP(h.allowedClients, ip) {
+		log.Printf("proxy: [%s] client %s not in allowlist, rejecting", reqID, ip)
+		writeForbidden(rec)
+		return
+	}
+	if h.maintenance != nil && h.maintenance.Enabled() && isInferencePath(r.URL.Path) {
+		h.maintenance.write(rec)
+		return
+	}
+	if h.keyLimits != nil {
+		key := clientKeyID(r)
+		if !h.keyLimits.Acquire(key) {
+			log.Printf("proxy: [%s] %s at its concurrency limit, rejecting", reqID, key)
+			writeKeyLimited(rec)
+			return
+		}
+		defer h.keyLimits.Release(key)
+	}
+	if h.usage != nil {
+		var qe *QuotaError
+		if err := h.usage.CheckQuota(clientKeyID(r)); errors.As(err, &qe) {
+			log.Printf("proxy: [%s] %s: %v", reqID, clientKeyID(r), err)
+			writeQuotaExceeded(rec, qe)
+			return
+		}
+	}
+	if h.admission != nil && isInferencePath(r.URL.Path) {
+		key := clientKeyID(r)
+		if err := h.admission.Acquire(ctx, key); err != nil {
+			log.Printf("proxy: [%s] %s not admitted: %v", reqID, key, err)
+			writeQueueTimeout(rec)
+			return
+		}
+		defer h.admission.Release()
+	}
+
+	// With pooling enabled, the pool comes from X-VastProxy-Pool or the
+	// request's model field; the proxy answers /v1/models itself.
+	// Audio requests (multipart uploads, binary responses) go to the
+	// audio-capable backends and bypass model pools.
+	audio := isAudioPath(r.URL.Path)
+	pool := ""
+	if balancer.Pooled() && !audio {
+		if r.Method == http.MethodGet && r.URL.Path == "/v1/models" {
+			balancer.serveModels(rec)
+			return
+		}
+		pool = r.Header.Get(PoolHeader)
+		if pool == "" {
+			pool = body.model()
+		}
+	}
+
+	if (h.latency != nil || h.usage != nil || h.recent != nil) && !audio {
+		model = body.model()
+	}
+
+	// Reject prompts no backend's context window can hold. The prompt is
+	// only estimated for the features that route on its size.
+	promptTokens := int64(0)
+	streaming := false
+	if r.Method == http.MethodPost && !audio {
+		if h.routesOnPromptSize() {
+			promptTokens = body.promptTokens()
+		}
+		if balancer.limitsStreams() {
+			streaming = body.streams()
+		}
+	}
+	if body.tooLarge() {
+		log.Printf("proxy: [%s] request body over %d bytes, rejecting", reqID, maxInspectedBody)
+		writeRequestTooLarge(rec)
+		return
+	}
+	if h.contextRouting && promptTokens > 0 {
+		if tokens, maxTokens, exceeds := h.exceedsContext(ctx, pool, promptTokens, body.bytes()); exceeds {
+			log.Printf("proxy: [%s] prompt of %d tokens exceeds max context length %d", reqID, tokens, maxTokens)
+			writeContextLengthExceeded(rec, tokens, maxTokens)
+			return
+		}
+	}
+
+	// Identical deterministic requests share one backend round trip.
+	// Followers copy the leader's response but are logged and counted
+	// like any other request.
+	var prompt, completion int64 // token usage, once counted
+	bodyCopied := false          // the upstream body was copied to the end
+	if h.coalesce != nil {
+		if key, ok := h.coalesce.key(r, body); ok {
+			call, leader := h.coalesce.join(key, reqID)
+			if leader {
+				call.rec = &coalesceRecorder{ResponseWriter: rec.ResponseWriter}
+				rec.ResponseWriter = call.rec
+				defer func() {
+					call.backendID, call.upstreamStatus, call.model = backendID, upstreamStatus.Load(), model
+					call.promptTokens, call.completionTokens = prompt, completion
+					h.coalesce.finish(key, call, bodyCopied && ctx.Err() == nil && clientCtx.Err() == nil)
+				}()
+			} else if call.wait(ctx) {
+				backendID = call.backendID
+				upstreamStatus.Store(call.upstreamStatus)
+				if model == "" {
+					model = call.model
 				}
+				call.writeTo(rec, reqID)
+				if h.usage != nil {
+					h.usage.Record(clientKeyID(r), backendID, model, call.promptTokens, call.completionTokens, time.Since(start))
+				}
+				log.Printf("proxy: [%s] %s %s coalesced with [%s] status=%d bytes=%d duration=%s",
+					reqID, r.Method, r.URL.Path, call.reqID, rec.status, rec.bytesWritten, time.Since(start).Round(time.Millisecond))
+				return
+			} else if clientCtx.Err() != nil {
+				return
 			}
 		}
-		if be == nil {
-			var err error
-			be, err = balancer.Pick()
-			if err != nil {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusServiceUnavailable)
-				w.Write([]byte(`{"error":{"message":"no backends available","type":"server_error"}}`))
-				return
+	}
+
+	// Sticky routing: if the client sends X-VastProxy-Instance, try
+	// to route to that specific backend for KV cache locality.
+	var be *backend.Backend
+	pinned := 0
+	if raw := r.Header.Get(StickyHeader); raw != "" {
+		if id, err := strconv.Atoi(raw); err == nil {
+			pinned = id
+			be, _ = balancer.PickByID(id)
+			if be == nil && h.stickyStore != nil && h.stickyStore.Known(id) && !balancer.Paused() {
+				log.Printf("proxy: [%s] pinned instance %d not ready, waiting up to %v", reqID, id, h.stickyWait)
+				be = h.waitForPin(ctx, id)
+			}
+			if be != nil && pool != "" && !balancer.InPool(be, pool) {
+				be = nil // pinned backend serves a different pool
+			}
+			if be != nil && !balancer.accepts(be, audio) {
+				be = nil
+			}
+			if be != nil && streaming && !balancer.TryAcquireStream(be) {
+				be = nil // pinned backend has too many streams
+			}
+			if be != nil {
+				log.Printf("proxy: [%s] sticky route to instance %d", reqID, id)
 			}
 		}
-		be.Acquire()
-		balancer.Acquire()
-		defer func() {
-			be.Release()
-			if remaining := balancer.Release(); remaining == 0 {
-				// Last client disconnected — abort all in-flight inference
-				// on backends to free GPU resources.
-				log.Printf("proxy: last request finished, aborting all backend work")
-				go balancer.AbortAll(context.Background())
+	}
+	if h.stickyStats != nil {
+		if r.Header.Get(StickyHeader) != "" {
+			h.stickyStats.RecordPin(pinned, be != nil)
+		} else {
+			h.stickyStats.Record(false)
+		}
+	}
+	if be == nil {
+		var err error
+		pickOpts := h.pickOptions(promptTokens, streaming)
+		if pool != "" {
+			be, err = balancer.PickPool(pool, pickOpts...)
+			if err != nil {
+				if fb, ok := h.pickFallback(r, body, pool, pickOpts...); ok {
+					be, err = fb, nil
+					model = body.model() // charge the model actually served
+				}
 			}
-		}()
-
-		target, err := url.Parse(be.BaseURL())
+		} else if audio {
+			be, err = balancer.PickAudio()
+		} else {
+			be, err = balancer.Pick(pickOpts...)
+		}
+		if errors.Is(err, ErrPaused) {
+			writePaused(rec)
+			return
+		}
+		if errors.Is(err, ErrStreamsFull) {
+			log.Printf("proxy: [%s] every backend at its stream limit, rejecting", reqID)
+			writeStreamsFull(rec)
+			return
+		}
+		if errors.Is(err, ErrUnknownPool) {
+			rec.Header().Set("Content-Type", "application/json")
+			rec.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(rec, `{"error":{"message":%q,"type":"invalid_request_error","code":"model_not_found"}}`,
+				fmt.Sprintf("model %q is not served by any backend", pool))
+			return
+		}
 		if err != nil {
-			log.Printf("proxy: bad backend URL %q: %v", be.BaseURL(), err)
-			http.Error(w, `{"error":{"message":"internal error"}}`, http.StatusInternalServerError)
+			h.writeNoBackends(rec)
 			return
 		}
+	}
+	if pinned != 0 && pinned != be.Instance.ID {
+		rec.Header().Set(RepinHeader, strconv.Itoa(pinned))
+	}
+	backendID = be.Instance.ID
+	if h.stickyStore != nil {
+		h.stickyStore.Remember(backendID)
+	}
+	be.Acquire()
+	balancer.Acquire()
+	if streaming {
+		defer be.ReleaseStream() // reserved by the pick
+	}
+	defer func() {
+		be.Release()
+		if remaining := balancer.Release(); remaining == 0 && h.abortOnIdle {
+			h.abortIfIdle()
+		}
+	}()
+	if h.mirror != nil && !audio {
+		h.mirrorRequest(r, reqID)
+	}
 
-		// Capture the upstream status code from the backend response.
-		var upstreamStatus atomic.Int32
+	target, err := url.Parse(be.BaseURL())
+	if err != nil {
+		log.Printf("proxy: [%s] bad backend URL %q: %v", reqID, be.BaseURL(), err)
+		http.Error(rec, `{"error":{"message":"internal error"}}`, http.StatusInternalServerError)
+		return
+	}
 
-		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	var reqBody, respBody *captureBuffer
+	if h.capture != nil {
+		reqBody = &captureBuffer{limit: captureHardLimit}
+		respBody = &captureBuffer{limit: captureHardLimit}
+		if r.Body != nil {
+			r.Body = newTeeReadCloser(r.Body, reqBody)
+		}
+		rec.capture = respBody
+	}
 
+	var usage *usageCounter
+	if h.usage != nil {
+		usage = &usageCounter{header: rec.Header()}
+		if rec.capture != nil {
+			rec.capture = io.MultiWriter(rec.capture, usage)
+		} else {
+			rec.capture = usage
+		}
+	}
+
+	translated := false
+	if h.translateResponses && r.Method == http.MethodPost && r.URL.Path == responsesPath && r.Body != nil {
+		if err := translateResponsesRequest(r); err != nil {
+			rec.Header().Set("Content-Type", "application/json")
+			rec.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rec, `{"error":{"message":%q,"type":"invalid_request_error"}}`, err.Error())
+			return
+		}
+		translated = true
+	}
+
+	clientModel := "" // the request's model, if rewritten
+	if h.rewriteModel && r.Method == http.MethodPost && !audio {
+		if clientModel, err = rewriteRequestModel(r, be); err != nil {
+			rec.Header().Set("Content-Type", "application/json")
+			rec.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rec, `{"error":{"message":%q,"type":"invalid_request_error"}}`, err.Error())
+			return
+		}
+	}
+
+	// SGLang inference requests carry an rid, so a generation whose client
+	// went away can be aborted without touching anyone else's. The body
+	// read on ingress is reused unless it was rewritten above.
+	abortID := ""
+	if be.Instance.Engine.SupportsAbort() && r.Method == http.MethodPost && !audio && isInferencePath(r.URL.Path) {
+		raw := body.bytes()
+		if body.tooLarge() {
+			writeRequestTooLarge(rec)
+			return
+		}
+		if translated || clientModel != "" {
+			raw, _ = io.ReadAll(r.Body)
+			r.Body = io.NopCloser(bytes.NewReader(raw))
+		}
+		var tagged []byte
+		if abortID, tagged = tagAbortID(raw, reqID); tagged != nil {
+			if reqBody != nil && reqBody.buf.Len() == 0 {
+				reqBody.Write(raw) // the new body bypasses the capture tee
+			}
+			r.Body = io.NopCloser(bytes.NewReader(tagged))
+			r.ContentLength = int64(len(tagged))
+			r.Header.Set("Content-Length", strconv.Itoa(len(tagged)))
+		}
+	}
+
+	var upstreamStart time.Time
+	inspect := h.inspectsBodies(translated) || clientModel != ""
+	var out http.ResponseWriter = rec
+	var keepAlive *keepAliveWriter
+	if h.sseKeepAlive > 0 && !audio {
+		keepAlive = newKeepAliveWriter(rec, h.sseKeepAlive)
+		out = keepAlive
+	}
+	// Hedged duplicates may go to backends serving other models, so
+	// requests whose model was rewritten aren't hedged.
+	if sent, ok := h.hedgeable(r, body, be); ok && !translated && clientModel == "" {
+		backendID, bodyCopied = h.serveHedged(out, r, be, sent, start, &upstreamStatus)
+	} else {
 		proxy := &httputil.ReverseProxy{
 			Director: func(req *http.Request) {
-				req.URL.Scheme = target.Scheme
-				req.URL.Host = target.Host
-				req.URL.Path = r.URL.Path
-				req.URL.RawQuery = r.URL.RawQuery
-				req.Host = target.Host
-
-				// Replace any client auth with the backend's bearer token.
-				req.Header.Del("Authorization")
-				if tok := be.Token(); tok != "" {
-					req.Header.Set("Authorization", "Bearer "+tok)
+				h.rewriteRequest(req, r, target, be, reqID)
+				if inspect {
+					restrictAcceptEncoding(req.Header)
 				}
-
-				// Strip the sticky header — it's proxy-internal.
-				req.Header.Del(StickyHeader)
+				upstreamStart = time.Now()
 			},
 			ModifyResponse: func(resp *http.Response) error {
 				upstreamStatus.Store(int32(resp.StatusCode))
+				if inspect {
+					if err := decodeBody(resp); err != nil {
+						return err
+					}
+				}
+				// Wrapped innermost, so upstream errors that the
+				// wrappers below turn into a clean end don't count.
+				resp.Body = &eofBody{ReadCloser: resp.Body, onEOF: func() { bodyCopied = true }}
 				resp.Header.Set(StickyHeader, strconv.Itoa(be.Instance.ID))
+				resp.Header.Set(RequestIDHeader, reqID)
+				h.setMetadata(resp.Header, be, start, upstreamStart)
+				if isEventStream(resp) {
+					resp.Body = &firstDataBody{ReadCloser: resp.Body, onFirst: func() {
+						ttft = time.Since(upstreamStart)
+						if h.ttft != nil {
+							h.ttft.Record(be.Instance.ID, ttft)
+						}
+					}}
+				}
+				if h.streamIdleTimeout > 0 && isEventStream(resp) {
+					resp.Body = newIdleTimeoutBody(resp.Body, h.streamIdleTimeout, func() {
+						log.Printf("proxy: [%s] backend %d stream idle for %v, aborting",
+							reqID, be.Instance.ID, h.streamIdleTimeout)
+						cancelUpstream()
+					})
+				}
+				if clientModel != "" && resp.StatusCode == http.StatusOK {
+					if err := restoreResponseModel(resp, clientModel); err != nil {
+						return err
+					}
+				}
+				if isEventStream(resp) && !translated {
+					resp.Body = newStreamErrorBody(resp.Body, func(err error) {
+						if clientCtx.Err() == nil {
+							log.Printf("proxy: [%s] backend %d stream failed mid-response: %v", reqID, be.Instance.ID, err)
+						}
+					})
+				}
+				if translated {
+					return translateResponsesResponse(resp)
+				}
 				return nil
 			},
 			Transport: be.HTTPClient().Transport,
 			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
-				log.Printf("proxy: backend %d error, marking unhealthy: %v", be.Instance.ID, err)
+				if isTimeout(err) {
+					log.Printf("proxy: [%s] backend %d timed out: %v", reqID, be.Instance.ID, err)
+					writeGatewayTimeout(w, r.Context())
+					return
+				}
+				log.Printf("proxy: [%s] backend %d error, marking unhealthy: %v", reqID, be.Instance.ID, err)
 				be.SetHealthy(false)
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusBadGateway)
-				w.Write([]byte(`{"error":{"message":"backend error","type":"server_error"}}`))
+				writeBackendError(w)
 			},
 			// Streaming (SSE) works automatically — ReverseProxy flushes
 			// the response when the backend sends data, because Go's
 			// default FlushInterval is -1 for responses without Content-Length.
 			FlushInterval: -1,
 		}
+		// rewriteRequest sets the whole X-Forwarded-For chain; without a
+		// peer address ReverseProxy doesn't append it a second time.
+		in := *r
+		in.RemoteAddr = ""
+		proxy.ServeHTTP(out, &in)
+	}
+	if keepAlive != nil {
+		keepAlive.stop()
+	}
+
+	if h.capture != nil {
+		h.capture.Add(CapturedExchange{
+			RequestID: reqID,
+			Time:      start,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			BackendID: backendID,
+			Status:    rec.status,
+		}, reqBody.buf.Bytes(), respBody.buf.Bytes())
+	}
+
+	if abortID != "" && clientCtx.Err() != nil {
+		if served := balancer.Backend(backendID); served != nil {
+			log.Printf("proxy: [%s] client disconnected, aborting rid %s on backend %d", reqID, abortID, backendID)
+			go served.Abort(context.Background(), abortID)
+		}
+	}
+
+	if errors.Is(context.Cause(ctx), errMaxDuration) {
+		log.Printf("proxy: [%s] backend %d request exceeded max duration %v, aborted",
+			reqID, backendID, h.maxRequestDuration)
+	}
 
-		proxy.ServeHTTP(rec, r)
+	elapsed := time.Since(start)
+	us := upstreamStatus.Load()
+	if model == "" {
+		model = be.Instance.ModelName
+	}
+	if h.usage != nil && us != 0 {
+		served := be
+		if b := balancer.Backend(backendID); b != nil {
+			served = b
+		}
+		var ok bool
+		prompt, completion, ok = usage.result()
+		if !ok {
+			prompt = estimatePromptTokens(body.bytes())
+		}
+		h.usage.Record(clientKeyID(r), backendID, model, prompt, completion, elapsed)
+		if !ok {
+			// The estimate is recorded now and corrected with the
+			// tokenizer's count in the background, so neither the
+			// client nor the request's slots wait for /tokenize.
+			// Coalesced followers are charged the estimate.
+			go h.usage.correctPromptTokens(served, body.bytes(), clientKeyID(r), backendID, model, prompt)
+		}
+	}
+	if h.latency != nil && us != 0 {
+		h.latency.Record(r.URL.Path, model, backendID, elapsed)
+	}
+	if us >= 200 && us < 300 && backendID == be.Instance.ID {
+		be.ObserveLatency(elapsed)
+	}
+	// Connection failures leave no upstream status; client disconnects
+	// (499) and timeouts (504) aren't the backend's errors.
+	if h.outliers != nil && backendID == be.Instance.ID && r.Context().Err() == nil {
+		h.outliers.Record(be, us >= 500 || (us == 0 && rec.status == http.StatusBadGateway), time.Now())
+	}
+	ttftLog := ""
+	if ttft > 0 {
+		ttftLog = " ttft=" + ttft.Round(time.Millisecond).String()
+	}
+	log.Printf("proxy: [%s] %s %s → backend %d upstream=%d status=%d bytes=%d duration=%s%s",
+		reqID, r.Method, r.URL.Path, backendID, us, rec.status, rec.bytesWritten, elapsed.Round(time.Millisecond), ttftLog)
+}
+
+// rewriteRequest points an outbound request at the backend and rewrites its
+// headers (see filterHeaders). orig is the incoming client request.
+func (h *handler) rewriteRequest(req, orig *http.Request, target *url.URL, be *backend.Backend, reqID string) {
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	req.URL.Path = orig.URL.Path
+	req.URL.RawQuery = orig.URL.RawQuery
+	req.Host = target.Host
+
+	// Record the client address, then replace any client auth with the
+	// backend's bearer token and strip proxy-internal headers such as the
+	// sticky pin and pool.
+	h.setForwardedHeaders(req, orig)
+	h.filterHeaders(req.Header)
+	if tok := be.Token(); tok != "" {
+		req.Header.Set("Authorization", "Bearer "+tok)
+	}
+
+	req.Header.Set(RequestIDHeader, reqID)
+}
+
+// writeGatewayTimeout writes the 504 response sent when the upstream
+// deadline for a request expires, distinguishing the client's own timeout
+// (see RequestTimeoutHeader).
+func writeGatewayTimeout(w http.ResponseWriter, ctx context.Context) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusGatewayTimeout)
+	if errors.Is(context.Cause(ctx), errClientTimeout) {
+		w.Write([]byte(`{"error":{"message":"request exceeded the client's timeout","type":"timeout","code":"client_timeout"}}`))
+		return
+	}
+	w.Write([]byte(`{"error":{"message":"upstream request timed out","type":"timeout"}}`))
+}
 
-		elapsed := time.Since(start)
-		us := upstreamStatus.Load()
-		log.Printf("proxy: %s %s → backend %d upstream=%d status=%d bytes=%d duration=%s",
-			r.Method, r.URL.Path, be.Instance.ID, us, rec.status, rec.bytesWritten, elapsed.Round(time.Millisecond))
-	})
+// writeBackendError writes the 502 response sent when a backend fails.
+func writeBackendError(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadGateway)
+	w.Write([]byte(`{"error":{"message":"backend error","type":"server_error"}}`))
 }
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/shutej/vastproxy/backend"
 	"github.com/shutej/vastproxy/vast"
@@ -154,6 +155,34 @@ func TestReverseProxySSEStreaming(t *testing.T) {
 	}
 }
 
+// The legacy text-completions endpoint streams exactly like chat.
+func TestReverseProxySSEStreamingCompletions(t *testing.T) {
+	backendSrv := sseBackendServer(t)
+	defer backendSrv.Close()
+
+	inst := &vast.Instance{ID: 1, JupyterToken: "tok"}
+	be := backend.NewBackend(inst, "", nil, "")
+	be.SetBaseURL(backendSrv.URL)
+	be.SetHealthy(true)
+
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil)
+
+	req := httptest.NewRequest("POST", "/v1/completions", strings.NewReader(`{"stream":true}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	if !strings.Contains(body, "chunk 0") || !strings.Contains(body, "[DONE]") {
+		t.Errorf("SSE body missing expected chunks: %s", body)
+	}
+}
+
 func TestReverseProxyAcquireRelease(t *testing.T) {
 	backendSrv := fakeBackendServer(t)
 	defer backendSrv.Close()
@@ -453,6 +482,83 @@ func TestReverseProxyStickyFallback(t *testing.T) {
 	}
 }
 
+func TestReverseProxyStickyDrainingRepins(t *testing.T) {
+	backendSrv := fakeBackendServer(t)
+	defer backendSrv.Close()
+
+	draining := makeBackend(1, true)
+	draining.SetBaseURL(backendSrv.URL)
+	draining.SetDraining(true)
+	other := makeBackend(2, true)
+	other.SetBaseURL(backendSrv.URL)
+
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{draining, other})
+	handler := NewReverseProxy(bal, nil)
+
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	req.Header.Set(StickyHeader, "1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(StickyHeader); got != "2" {
+		t.Errorf("response %s = %q, want 2", StickyHeader, got)
+	}
+	if got := rec.Header().Get(RepinHeader); got != "1" {
+		t.Errorf("response %s = %q, want 1", RepinHeader, got)
+	}
+
+	// Requests served by their pinned instance carry no repin signal.
+	req = httptest.NewRequest("GET", "/v1/models", nil)
+	req.Header.Set(StickyHeader, "2")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get(RepinHeader); got != "" {
+		t.Errorf("response %s = %q, want empty", RepinHeader, got)
+	}
+
+	// Nor do requests whose sticky header isn't an instance ID.
+	req = httptest.NewRequest("GET", "/v1/models", nil)
+	req.Header.Set(StickyHeader, "not-an-id")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get(RepinHeader); got != "" {
+		t.Errorf("unparsable pin: response %s = %q, want empty", RepinHeader, got)
+	}
+}
+
+func TestReverseProxyRecordsStickyBreakdown(t *testing.T) {
+	backendSrv := fakeBackendServer(t)
+	defer backendSrv.Close()
+
+	up := makeBackend(1, true)
+	up.SetBaseURL(backendSrv.URL)
+	down := makeBackend(2, false)
+	down.SetBaseURL(backendSrv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{up, down})
+	stats := NewStickyStats(time.Minute)
+	handler := NewReverseProxy(bal, stats)
+
+	for _, pin := range []string{"1", "2", ""} {
+		req := httptest.NewRequest("GET", "/v1/models", nil)
+		if pin != "" {
+			req.Header.Set(StickyHeader, pin)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if hits, misses := stats.ForInstance(1); hits != 1 || misses != 0 {
+		t.Errorf("instance 1: hits=%d misses=%d, want 1, 0", hits, misses)
+	}
+	if hits, misses := stats.ForInstance(2); hits != 0 || misses != 1 {
+		t.Errorf("instance 2: hits=%d misses=%d, want 0, 1", hits, misses)
+	}
+	if got := stats.Misses(); got != 1 {
+		t.Errorf("Misses() = %d, want 1", got)
+	}
+}
+
 func TestReverseProxyStickyHeaderNotForwarded(t *testing.T) {
 	// Verify that X-VastProxy-Instance is stripped before reaching the backend.
 	var gotHeader string
@@ -0,0 +1,221 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// hedgeConfig controls hedged requests (see WithHedging).
+type hedgeConfig struct {
+	delay   time.Duration // send the duplicate after this long without a response
+	maxBody int64         // only hedge requests with bodies up to this size
+}
+
+// WithHedging enables hedged requests. A non-streaming, non-sticky request
+// with a body of at most maxBody bytes is duplicated to a second backend if
+// the first hasn't responded within delay (or fails first). Whichever
+// response arrives first is returned and the other attempt is canceled.
+func WithHedging(delay time.Duration, maxBody int64) Option {
+	return func(h *handler) {
+		h.hedge = &hedgeConfig{delay: delay, maxBody: maxBody}
+	}
+}
+
+// hopHeaders are connection-specific headers that aren't forwarded.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// hedgeable reports whether r, routed to primary, may be hedged. If so, it
+// returns the fully read request body; otherwise r.Body is left readable.
+func (h *handler) hedgeable(r *http.Request, rb *requestBody, primary *backend.Backend) ([]byte, bool) {
+	if h.hedge == nil || r.Header.Get(StickyHeader) != "" {
+		return nil, false
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		return nil, false
+	}
+	// Unknown length (chunked) or too large: don't buffer.
+	if r.ContentLength < 0 || r.ContentLength > h.hedge.maxBody {
+		return nil, false
+	}
+	if !h.balancer.hasAlternate(primary.Instance.ID) {
+		return nil, false // nothing to hedge to
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil || rb.streams() {
+		return nil, false
+	}
+	return body, true
+}
+
+// hedgeResult is the outcome of one attempt of a hedged request.
+type hedgeResult struct {
+	be   *backend.Backend
+	resp *http.Response
+	err  error
+	sent time.Time // when the request was sent upstream
+}
+
+// serveHedged sends r to primary and, after the hedge delay, to a second
+// backend, then writes whichever response arrives first. It returns the
+// instance ID of the backend whose response was used and whether its body
+// was copied to the end.
+func (h *handler) serveHedged(w http.ResponseWriter, r *http.Request, primary *backend.Backend, body []byte, start time.Time, upstreamStatus *atomic.Int32) (int, bool) {
+	reqID := RequestIDFromContext(r.Context())
+	results := make(chan hedgeResult, 2)
+	cancels := make(map[*backend.Backend]context.CancelFunc, 2)
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+
+	launch := func(be *backend.Backend) bool {
+		target, err := url.Parse(be.BaseURL())
+		if err != nil {
+			return false
+		}
+		ctx, cancel := context.WithCancel(r.Context())
+		cancels[be] = cancel
+
+		out := r.Clone(ctx)
+		out.RequestURI = ""
+		out.Body = io.NopCloser(bytes.NewReader(body))
+		out.ContentLength = int64(len(body))
+		for _, hdr := range hopHeaders {
+			out.Header.Del(hdr)
+		}
+		h.rewriteRequest(out, r, target, be, reqID)
+		if h.inspectsBodies(false) {
+			restrictAcceptEncoding(out.Header)
+		}
+
+		transport := be.HTTPClient().Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		go func() {
+			sent := time.Now()
+			resp, err := transport.RoundTrip(out)
+			results <- hedgeResult{be: be, resp: resp, err: err, sent: sent}
+		}()
+		return true
+	}
+
+	launch(primary)
+	pending := 1
+	var hedged *backend.Backend
+	hedge := func() {
+		if hedged != nil || r.Context().Err() != nil {
+			return
+		}
+		be, err := h.balancer.PickExcluding(primary.Instance.ID)
+		if err != nil {
+			return
+		}
+		hedged = be
+		be.Acquire()
+		if launch(be) {
+			pending++
+			log.Printf("proxy: [%s] hedging to backend %d", reqID, be.Instance.ID)
+		}
+	}
+	defer func() {
+		if hedged != nil {
+			hedged.Release()
+		}
+	}()
+
+	timer := time.NewTimer(h.hedge.delay)
+	defer timer.Stop()
+
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			hedge()
+		case res := <-results:
+			pending--
+			if res.err != nil {
+				if !errors.Is(res.err, context.Canceled) && !isTimeout(res.err) {
+					log.Printf("proxy: [%s] backend %d error, marking unhealthy: %v", reqID, res.be.Instance.ID, res.err)
+					res.be.SetHealthy(false)
+				}
+				// Fail over immediately rather than waiting for the delay.
+				hedge()
+				continue
+			}
+
+			// Winner: cancel the other attempt and discard its response.
+			for be, cancel := range cancels {
+				if be != res.be {
+					cancel()
+				}
+			}
+			if pending > 0 {
+				go func(n int) {
+					for range n {
+						if loser := <-results; loser.resp != nil {
+							loser.resp.Body.Close()
+						}
+					}
+				}(pending)
+			}
+			if hedged != nil {
+				log.Printf("proxy: [%s] hedge won by backend %d", reqID, res.be.Instance.ID)
+			}
+			if h.inspectsBodies(false) {
+				if err := decodeBody(res.resp); err != nil {
+					log.Printf("proxy: [%s] backend %d: decode response: %v", reqID, res.be.Instance.ID, err)
+					res.resp.Body.Close()
+					writeBackendError(w)
+					return res.be.Instance.ID, false
+				}
+			}
+			h.setMetadata(res.resp.Header, res.be, start, res.sent)
+			copied := writeHedgedResponse(w, res, reqID, upstreamStatus)
+			return res.be.Instance.ID, copied
+		}
+	}
+
+	if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		writeGatewayTimeout(w, r.Context())
+	} else {
+		writeBackendError(w)
+	}
+	return primary.Instance.ID, false
+}
+
+// writeHedgedResponse copies the winning response to the client,
+// reporting whether the whole body was copied.
+func writeHedgedResponse(w http.ResponseWriter, res hedgeResult, reqID string, upstreamStatus *atomic.Int32) bool {
+	defer res.resp.Body.Close()
+	upstreamStatus.Store(int32(res.resp.StatusCode))
+
+	for k, vv := range res.resp.Header {
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+	for _, hdr := range hopHeaders {
+		w.Header().Del(hdr)
+	}
+	w.Header().Set(StickyHeader, strconv.Itoa(res.be.Instance.ID))
+	w.Header().Set(RequestIDHeader, reqID)
+	w.WriteHeader(res.resp.StatusCode)
+	_, err := io.Copy(w, res.resp.Body)
+	return err == nil
+}
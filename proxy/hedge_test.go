@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+// delayedBackend returns a backend whose server sleeps before responding
+// and counts the requests it receives.
+func delayedBackend(t *testing.T, id int, delay time.Duration, hits *atomic.Int32) (*backend.Backend, *httptest.Server) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		fmt.Fprintf(w, `{"backend":%d}`, id)
+	}))
+	be := backend.NewBackend(&vast.Instance{ID: id}, "", nil, "")
+	be.SetBaseURL(srv.URL)
+	be.SetHealthy(true)
+	return be, srv
+}
+
+func TestHedgingFastSecondWins(t *testing.T) {
+	var slowHits, fastHits atomic.Int32
+	slow, slowSrv := delayedBackend(t, 1, time.Second, &slowHits)
+	defer slowSrv.Close()
+	fast, fastSrv := delayedBackend(t, 2, 0, &fastHits)
+	defer fastSrv.Close()
+
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{slow, fast})
+	handler := NewReverseProxy(bal, nil, WithHedging(20*time.Millisecond, 1024))
+
+	// First round-robin pick is backend 1 (the slow one).
+	req := httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{"input":"x"}`))
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(rec, req)
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("hedged request took %v, want well under the slow backend's delay", elapsed)
+	}
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"backend":2`) {
+		t.Errorf("status = %d, body = %s; want 200 from backend 2", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get(StickyHeader); got != "2" {
+		t.Errorf("%s = %q, want 2", StickyHeader, got)
+	}
+	if slowHits.Load() != 1 || fastHits.Load() != 1 {
+		t.Errorf("hits = %d/%d, want 1/1", slowHits.Load(), fastHits.Load())
+	}
+	if slow.ActiveRequests() != 0 || fast.ActiveRequests() != 0 {
+		t.Errorf("active = %d/%d, want 0/0", slow.ActiveRequests(), fast.ActiveRequests())
+	}
+}
+
+func TestHedgingFastPrimaryNoDuplicate(t *testing.T) {
+	var hits1, hits2 atomic.Int32
+	be1, srv1 := delayedBackend(t, 1, 0, &hits1)
+	defer srv1.Close()
+	be2, srv2 := delayedBackend(t, 2, 0, &hits2)
+	defer srv2.Close()
+
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be1, be2})
+	handler := NewReverseProxy(bal, nil, WithHedging(time.Second, 1024))
+
+	req := httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if total := hits1.Load() + hits2.Load(); total != 1 {
+		t.Errorf("backends received %d requests, want 1", total)
+	}
+}
+
+func TestHedgingSkipsStreamingAndSticky(t *testing.T) {
+	var hits1, hits2 atomic.Int32
+	be1, srv1 := delayedBackend(t, 1, 100*time.Millisecond, &hits1)
+	defer srv1.Close()
+	be2, srv2 := delayedBackend(t, 2, 100*time.Millisecond, &hits2)
+	defer srv2.Close()
+
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be1, be2})
+	handler := NewReverseProxy(bal, nil, WithHedging(time.Millisecond, 1024))
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"stream":true}`))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`))
+	req.Header.Set(StickyHeader, "1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if total := hits1.Load() + hits2.Load(); total != 2 {
+		t.Errorf("backends received %d requests, want 2 (no duplicates)", total)
+	}
+}
+
+func TestHedgingNeedsAnAlternate(t *testing.T) {
+	be := makeBackend(1, true)
+	shadow := makeBackend(2, true)
+	shadow.Instance.Label = "shadow"
+	audio := makeBackend(3, true)
+	audio.Instance.Label = "audio"
+	bal := NewBalancer()
+	bal.SetShadowLabel("shadow")
+	bal.SetAudioLabel("audio")
+	bal.SetBackends([]*backend.Backend{be, shadow, audio})
+	h := NewReverseProxy(bal, nil, WithHedging(time.Millisecond, 1024)).(*handler)
+
+	// Neither the shadow nor the audio backend can take a hedge, so the
+	// body isn't buffered for one.
+	req := httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{"input":"x"}`))
+	if _, ok := h.hedgeable(req, newRequestBody(httptest.NewRecorder(), req), be); ok {
+		t.Error("hedgeable with no alternate backend")
+	}
+
+	other := makeBackend(4, true)
+	bal.SetBackends([]*backend.Backend{be, shadow, audio, other})
+	if _, ok := h.hedgeable(req, newRequestBody(httptest.NewRecorder(), req), be); !ok {
+		t.Error("not hedgeable with an alternate backend")
+	}
+}
+
+func TestHedgingSkipsLargeBodies(t *testing.T) {
+	var hits1, hits2 atomic.Int32
+	be1, srv1 := delayedBackend(t, 1, 100*time.Millisecond, &hits1)
+	defer srv1.Close()
+	be2, srv2 := delayedBackend(t, 2, 100*time.Millisecond, &hits2)
+	defer srv2.Close()
+
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be1, be2})
+	handler := NewReverseProxy(bal, nil, WithHedging(time.Millisecond, 4))
+
+	req := httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{"input":"long"}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if total := hits1.Load() + hits2.Load(); total != 1 {
+		t.Errorf("backends received %d requests, want 1", total)
+	}
+}
+
+func TestHedgingFailsOverOnError(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hj, _ := w.(http.Hijacker)
+		conn, _, _ := hj.Hijack()
+		conn.Close()
+	}))
+	defer broken.Close()
+	bad := backend.NewBackend(&vast.Instance{ID: 1}, "", nil, "")
+	bad.SetBaseURL(broken.URL)
+	bad.SetHealthy(true)
+
+	var hits atomic.Int32
+	good, goodSrv := delayedBackend(t, 2, 0, &hits)
+	defer goodSrv.Close()
+
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{bad, good})
+	handler := NewReverseProxy(bal, nil, WithHedging(time.Hour, 1024))
+
+	req := httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"backend":2`) {
+		t.Errorf("status = %d, body = %s; want 200 from backend 2", rec.Code, rec.Body.String())
+	}
+	if bad.IsHealthy() {
+		t.Error("failed backend should be marked unhealthy")
+	}
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// KeyLimiter caps the number of concurrent requests per client API key so
+// one heavy consumer can't starve everyone else sharing the fleet. Keys are
+// identified by their fingerprint (see clientKeyID), the same IDs reported
+// by /usage. The proxy doesn't validate keys, so the limit is advisory: it
+// holds well-behaved clients to their share, but a client can evade it by
+// sending a different bearer token. Safe for concurrent use.
+type KeyLimiter struct {
+	mu        sync.Mutex
+	limit     int            // default per-key limit; 0 = unlimited
+	overrides map[string]int // per-key limits by fingerprint
+	active    map[string]int
+}
+
+// NewKeyLimiter creates a limiter allowing limit concurrent requests per
+// key (0 for no default limit), with per-key overrides.
+func NewKeyLimiter(limit int, overrides map[string]int) *KeyLimiter {
+	return &KeyLimiter{
+		limit:     limit,
+		overrides: overrides,
+		active:    make(map[string]int),
+	}
+}
+
+// WithKeyLimits rejects requests with 429 once their API key has the
+// maximum number of requests in flight.
+func WithKeyLimits(l *KeyLimiter) Option {
+	return func(h *handler) {
+		h.keyLimits = l
+	}
+}
+
+// ParseKeyLimits parses a comma-separated list of key=limit pairs, e.g.
+// "key-1a2b3c4d=16,anonymous=2".
+func ParseKeyLimits(s string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, raw, ok := strings.Cut(pair, "=")
+		n, err := strconv.Atoi(raw)
+		if !ok || key == "" || err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid key limit %q (want key=limit)", pair)
+		}
+		limits[key] = n
+	}
+	return limits, nil
+}
+
+// Acquire reserves a request slot for key, reporting false if the key is
+// already at its limit. Each successful Acquire must be paired with Release.
+func (l *KeyLimiter) Acquire(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit, ok := l.overrides[key]
+	if !ok {
+		limit = l.limit
+	}
+	if limit > 0 && l.active[key] >= limit {
+		return false
+	}
+	l.active[key]++
+	return true
+}
+
+// Release frees a slot reserved by Acquire.
+func (l *KeyLimiter) Release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[key]--; l.active[key] <= 0 {
+		delete(l.active, key)
+	}
+}
+
+// Active returns the number of in-flight requests per key.
+func (l *KeyLimiter) Active() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return maps.Clone(l.active)
+}
+
+// writeKeyLimited writes the 429 response sent when a key has too many
+// requests in flight.
+func writeKeyLimited(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "1")
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write([]byte(`{"error":{"message":"too many concurrent requests for this API key","type":"rate_limit_error"}}`))
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestParseKeyLimits(t *testing.T) {
+	limits, err := ParseKeyLimits("key-1a2b3c4d=16, anonymous=2")
+	if err != nil {
+		t.Fatalf("ParseKeyLimits() error: %v", err)
+	}
+	if limits["key-1a2b3c4d"] != 16 || limits["anonymous"] != 2 {
+		t.Errorf("limits = %v", limits)
+	}
+	for _, bad := range []string{"key-1", "=3", "key-1=many", "key-1=-1"} {
+		if _, err := ParseKeyLimits(bad); err == nil {
+			t.Errorf("ParseKeyLimits(%q) expected error", bad)
+		}
+	}
+}
+
+func TestKeyLimiter(t *testing.T) {
+	l := NewKeyLimiter(1, map[string]int{"key-big": 2, "key-free": 0})
+	if !l.Acquire("key-a") || l.Acquire("key-a") {
+		t.Error("default limit of 1 not enforced")
+	}
+	if !l.Acquire("key-b") {
+		t.Error("a busy key should not limit other keys")
+	}
+	if !l.Acquire("key-big") || !l.Acquire("key-big") || l.Acquire("key-big") {
+		t.Error("override of 2 not enforced")
+	}
+	for range 10 {
+		if !l.Acquire("key-free") {
+			t.Fatal("an override of 0 should be unlimited")
+		}
+	}
+	l.Release("key-a")
+	if !l.Acquire("key-a") {
+		t.Error("released slot should be reusable")
+	}
+	if got := l.Active(); got["key-a"] != 1 || got["key-big"] != 2 || got["key-free"] != 10 {
+		t.Errorf("Active() = %v", got)
+	}
+}
+
+func TestReverseProxyKeyLimits(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	limiter := NewKeyLimiter(1, nil)
+	handler := NewReverseProxy(bal, nil, WithKeyLimits(limiter))
+
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{}"))
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	done := make(chan struct{})
+	go func() {
+		send("heavy")
+		close(done)
+	}()
+	for len(limiter.Active()) == 0 {
+		time.Sleep(time.Millisecond) // wait for the first request to take its slot
+	}
+
+	if rec := send("heavy"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second request for the same key: status = %d, want 429", rec.Code)
+	}
+	close(release)
+	if rec := send("light"); rec.Code != http.StatusOK {
+		t.Errorf("other key: status = %d, want 200", rec.Code)
+	}
+	<-done
+	if got := limiter.Active(); len(got) != 0 {
+		t.Errorf("Active() = %v after all requests finished, want empty", got)
+	}
+}
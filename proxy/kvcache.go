@@ -0,0 +1,70 @@
+package proxy
+
+import "github.com/shutej/vastproxy/backend"
+
+// PickOption passes per-request hints to the balancer.
+type PickOption func(*pickHints)
+
+type pickHints struct {
+	longPrompt   bool
+	promptTokens int64
+	streaming    bool
+}
+
+// LongPrompt marks the request as long-context, so it avoids backends
+// whose KV cache is nearly full (see Balancer.SetKVCacheLimit) and prefers
+// the largest ones (see Balancer.SetSizeRouting).
+func LongPrompt() PickOption {
+	return func(h *pickHints) {
+		h.longPrompt = true
+	}
+}
+
+// SetKVCacheLimit sets the KV cache usage fraction (0–1) above which a
+// backend is skipped for long prompts, since admitting them would force
+// the engine to evict or preempt. 0 disables the check.
+func (b *Balancer) SetKVCacheLimit(limit float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.kvCacheLimit = limit
+}
+
+// withKVHeadroom returns the backends whose KV cache usage is below limit
+// (or unknown). If every backend is over the limit, all are returned: a
+// full cache is better than no backend.
+func withKVHeadroom(backends []*backend.Backend, limit float64) []*backend.Backend {
+	var out []*backend.Backend
+	for _, be := range backends {
+		if s := be.EngineStats(); s == nil || s.KVCacheUsage < limit {
+			out = append(out, be)
+		}
+	}
+	if len(out) == 0 {
+		return backends
+	}
+	return out
+}
+
+// WithLongPromptTokens treats requests whose estimated prompt is at least
+// n tokens as long-context when picking a backend.
+func WithLongPromptTokens(n int64) Option {
+	return func(h *handler) {
+		h.longPromptTokens = n
+	}
+}
+
+// pickOptions returns the balancer hints for a request whose prompt is
+// estimated at promptTokens.
+func (h *handler) pickOptions(promptTokens int64, streaming bool) []PickOption {
+	var opts []PickOption
+	if streaming {
+		opts = append(opts, Streaming())
+	}
+	if promptTokens > 0 {
+		opts = append(opts, PromptTokens(promptTokens))
+	}
+	if h.longPromptTokens > 0 && promptTokens >= h.longPromptTokens {
+		opts = append(opts, LongPrompt())
+	}
+	return opts
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestPickLongPromptAvoidsFullKVCache(t *testing.T) {
+	full := makeBackend(1, true)
+	full.SetEngineStats(&backend.EngineStats{KVCacheUsage: 0.95})
+	roomy := makeBackend(2, true)
+	roomy.SetEngineStats(&backend.EngineStats{KVCacheUsage: 0.4})
+	unknown := makeBackend(3, true)
+
+	bal := NewBalancer()
+	bal.SetKVCacheLimit(0.9)
+	bal.SetBackends([]*backend.Backend{full, roomy, unknown})
+
+	for range 6 {
+		be, err := bal.Pick(LongPrompt())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if be.Instance.ID == 1 {
+			t.Error("long prompt routed to backend with a full KV cache")
+		}
+	}
+
+	// Short prompts still use every backend.
+	seen := map[int]bool{}
+	for range 3 {
+		be, _ := bal.Pick()
+		seen[be.Instance.ID] = true
+	}
+	if !seen[1] {
+		t.Error("short prompts should still reach backend 1")
+	}
+}
+
+func TestPickLongPromptAllFull(t *testing.T) {
+	b1 := makeBackend(1, true)
+	b1.SetEngineStats(&backend.EngineStats{KVCacheUsage: 0.99})
+	bal := NewBalancer()
+	bal.SetKVCacheLimit(0.9)
+	bal.SetBackends([]*backend.Backend{b1})
+
+	if be, err := bal.Pick(LongPrompt()); err != nil || be.Instance.ID != 1 {
+		t.Errorf("Pick() = %v, %v, want fallback to backend 1", be, err)
+	}
+}
+
+func TestPickLongPromptLimitDisabled(t *testing.T) {
+	full := makeBackend(1, true)
+	full.SetEngineStats(&backend.EngineStats{KVCacheUsage: 0.99})
+	other := makeBackend(2, true)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{full, other})
+
+	seen := map[int]bool{}
+	for range 2 {
+		be, _ := bal.Pick(LongPrompt())
+		seen[be.Instance.ID] = true
+	}
+	if !seen[1] || !seen[2] {
+		t.Errorf("picks = %v, want both backends with no limit set", seen)
+	}
+}
+
+func TestReverseProxyLongPromptRouting(t *testing.T) {
+	backendSrv := fakeBackendServer(t)
+	defer backendSrv.Close()
+
+	full := makeBackend(1, true)
+	full.SetBaseURL(backendSrv.URL)
+	full.SetEngineStats(&backend.EngineStats{KVCacheUsage: 0.95})
+	roomy := makeBackend(2, true)
+	roomy.SetBaseURL(backendSrv.URL)
+
+	bal := NewBalancer()
+	bal.SetKVCacheLimit(0.9)
+	bal.SetBackends([]*backend.Backend{full, roomy})
+	handler := NewReverseProxy(bal, nil, WithLongPromptTokens(100))
+
+	long := `{"messages":[{"role":"user","content":"` + strings.Repeat("x", 1000) + `"}]}`
+	for range 4 {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(long))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if got := rec.Header().Get(StickyHeader); got != "2" {
+			t.Errorf("long prompt served by %s, want 2", got)
+		}
+		if !strings.Contains(rec.Body.String(), "/v1/chat/completions") {
+			t.Errorf("body = %s, want request forwarded intact", rec.Body.String())
+		}
+	}
+}
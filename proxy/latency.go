@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyWindow is the number of most recent durations kept per key for
+// computing percentiles.
+const latencyWindow = 1024
+
+// maxLatencyKeys bounds the number of (route, model, backend) keys tracked,
+// since routes and models come from clients.
+const maxLatencyKeys = 1000
+
+// LatencySummary summarizes request durations for one (route, model,
+// backend) combination. Percentiles cover the most recent latencyWindow
+// requests; Count and Sum cover all of them.
+type LatencySummary struct {
+	Route     string  `json:"route"`
+	Model     string  `json:"model"`
+	BackendID int     `json:"backend_id"`
+	Count     int64   `json:"count"`
+	Sum       float64 `json:"sum_seconds"`
+	P50       float64 `json:"p50_seconds"`
+	P95       float64 `json:"p95_seconds"`
+	P99       float64 `json:"p99_seconds"`
+}
+
+type latencyKey struct {
+	route     string
+	model     string
+	backendID int
+}
+
+// latencySamples is a ring of recent durations plus running totals.
+type latencySamples struct {
+	count int64
+	sum   time.Duration
+	ring  []time.Duration
+	next  int
+}
+
+// LatencyTracker aggregates request durations keyed by route, model and
+// backend, so slow models can be told apart from slow machines. Safe for
+// concurrent use.
+type LatencyTracker struct {
+	mu   sync.Mutex
+	keys map[latencyKey]*latencySamples
+}
+
+// NewLatencyTracker creates an empty latency tracker.
+func NewLatencyTracker() *LatencyTracker {
+	return &LatencyTracker{keys: make(map[latencyKey]*latencySamples)}
+}
+
+// WithLatency records the duration of every proxied request into t.
+func WithLatency(t *LatencyTracker) Option {
+	return func(h *handler) {
+		h.latency = t
+	}
+}
+
+// Record adds one request's duration.
+func (t *LatencyTracker) Record(route, model string, backendID int, d time.Duration) {
+	k := latencyKey{route: route, model: model, backendID: backendID}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.keys[k]
+	if s == nil {
+		if len(t.keys) >= maxLatencyKeys {
+			return
+		}
+		s = &latencySamples{}
+		t.keys[k] = s
+	}
+	s.count++
+	s.sum += d
+	if len(s.ring) < latencyWindow {
+		s.ring = append(s.ring, d)
+	} else {
+		s.ring[s.next] = d
+		s.next = (s.next + 1) % latencyWindow
+	}
+}
+
+// Summaries returns a snapshot of every key's summary, ordered by route,
+// model and backend.
+func (t *LatencyTracker) Summaries() []LatencySummary {
+	t.mu.Lock()
+	out := make([]LatencySummary, 0, len(t.keys))
+	for k, s := range t.keys {
+		sorted := slices.Clone(s.ring)
+		slices.Sort(sorted)
+		out = append(out, LatencySummary{
+			Route:     k.route,
+			Model:     k.model,
+			BackendID: k.backendID,
+			Count:     s.count,
+			Sum:       s.sum.Seconds(),
+			P50:       percentile(sorted, 0.50).Seconds(),
+			P95:       percentile(sorted, 0.95).Seconds(),
+			P99:       percentile(sorted, 0.99).Seconds(),
+		})
+	}
+	t.mu.Unlock()
+
+	slices.SortFunc(out, func(a, b LatencySummary) int {
+		return cmp.Or(
+			cmp.Compare(a.Route, b.Route),
+			cmp.Compare(a.Model, b.Model),
+			cmp.Compare(a.BackendID, b.BackendID),
+		)
+	})
+	return out
+}
+
+// WritePrometheus writes the summaries in the Prometheus text exposition
+// format as the vastproxy_request_duration_seconds summary.
+func (t *LatencyTracker) WritePrometheus(w io.Writer) {
+	const name = "vastproxy_request_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Proxied request duration by route, model and backend.\n", name)
+	fmt.Fprintf(w, "# TYPE %s summary\n", name)
+	for _, s := range t.Summaries() {
+		labels := fmt.Sprintf(`route="%s",model="%s",backend="%d"`,
+			promLabelEscaper.Replace(s.Route), promLabelEscaper.Replace(s.Model), s.BackendID)
+		fmt.Fprintf(w, "%s{%s,quantile=\"0.5\"} %g\n", name, labels, s.P50)
+		fmt.Fprintf(w, "%s{%s,quantile=\"0.95\"} %g\n", name, labels, s.P95)
+		fmt.Fprintf(w, "%s{%s,quantile=\"0.99\"} %g\n", name, labels, s.P99)
+		fmt.Fprintf(w, "%s_sum{%s} %g\n", name, labels, s.Sum)
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, s.Count)
+	}
+}
+
+// promLabelEscaper escapes a Prometheus label value.
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// percentile returns the p-th quantile (0–1) of sorted using the
+// nearest-rank method, or 0 for an empty slice.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
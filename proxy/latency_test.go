@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestLatencyTrackerPercentiles(t *testing.T) {
+	lt := NewLatencyTracker()
+	for i := 1; i <= 100; i++ {
+		lt.Record("/v1/chat/completions", "llama", 1, time.Duration(i)*time.Millisecond)
+	}
+	lt.Record("/v1/chat/completions", "llama", 2, time.Second)
+
+	got := lt.Summaries()
+	if len(got) != 2 {
+		t.Fatalf("got %d summaries, want 2", len(got))
+	}
+	s := got[0]
+	if s.BackendID != 1 || s.Count != 100 {
+		t.Errorf("summary = %+v, want backend 1 with 100 requests", s)
+	}
+	if s.P50 != 0.05 || s.P95 != 0.095 || s.P99 != 0.099 {
+		t.Errorf("p50/p95/p99 = %v/%v/%v, want 0.05/0.095/0.099", s.P50, s.P95, s.P99)
+	}
+	if got[1].BackendID != 2 || got[1].P99 != 1 {
+		t.Errorf("summary = %+v, want backend 2 with p99 1s", got[1])
+	}
+}
+
+func TestLatencyTrackerWindow(t *testing.T) {
+	lt := NewLatencyTracker()
+	for range latencyWindow {
+		lt.Record("/r", "m", 1, time.Second)
+	}
+	for range latencyWindow {
+		lt.Record("/r", "m", 1, time.Millisecond)
+	}
+	s := lt.Summaries()[0]
+	if s.Count != 2*latencyWindow {
+		t.Errorf("Count = %d, want %d", s.Count, 2*latencyWindow)
+	}
+	if s.P99 != 0.001 {
+		t.Errorf("P99 = %v, want only recent samples (0.001)", s.P99)
+	}
+}
+
+func TestLatencyTrackerKeyLimit(t *testing.T) {
+	lt := NewLatencyTracker()
+	for i := range maxLatencyKeys + 10 {
+		lt.Record("/r", "m", i, time.Millisecond)
+	}
+	if got := len(lt.Summaries()); got != maxLatencyKeys {
+		t.Errorf("tracked %d keys, want %d", got, maxLatencyKeys)
+	}
+}
+
+func TestLatencyTrackerPrometheus(t *testing.T) {
+	lt := NewLatencyTracker()
+	lt.Record("/v1/completions", `we"ird`, 3, 2*time.Second)
+
+	var b strings.Builder
+	lt.WritePrometheus(&b)
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE vastproxy_request_duration_seconds summary",
+		`vastproxy_request_duration_seconds{route="/v1/completions",model="we\"ird",backend="3",quantile="0.99"} 2`,
+		`vastproxy_request_duration_seconds_count{route="/v1/completions",model="we\"ird",backend="3"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestReverseProxyRecordsLatency(t *testing.T) {
+	backendSrv := fakeBackendServer(t)
+	defer backendSrv.Close()
+
+	be := makeBackend(1, true)
+	be.SetBaseURL(backendSrv.URL)
+	be.Instance.ModelName = "served-model"
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	lt := NewLatencyTracker()
+	handler := NewReverseProxy(bal, nil, WithLatency(lt))
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"llama"}`))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/models", nil))
+
+	got := lt.Summaries()
+	if len(got) != 2 {
+		t.Fatalf("got %+v, want 2 summaries", got)
+	}
+	if got[0].Route != "/v1/chat/completions" || got[0].Model != "llama" || got[0].BackendID != 1 {
+		t.Errorf("summary = %+v, want chat completions for llama on backend 1", got[0])
+	}
+	if got[1].Route != "/v1/models" || got[1].Model != "served-model" {
+		t.Errorf("summary = %+v, want /v1/models with the backend's model", got[1])
+	}
+}
+
+func TestAdminLatency(t *testing.T) {
+	lt := NewLatencyTracker()
+	lt.Record("/v1/completions", "m", 1, time.Second)
+	srv := httptest.NewServer((&Admin{Latency: lt}).Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/latency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got []LatencySummary
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].P50 != 1 {
+		t.Errorf("got %+v", got)
+	}
+
+	resp, err = http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "vastproxy_request_duration_seconds_count") {
+		t.Errorf("metrics = %s", body)
+	}
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maintenance is a switchable maintenance mode, e.g. for rotating the whole
+// fleet. While enabled, inference routes are answered with 503 and a
+// Retry-After header; other paths (health checks, /v1/models, engine status
+// endpoints) are still proxied. Safe for concurrent use.
+type Maintenance struct {
+	mu         sync.RWMutex
+	enabled    bool
+	retryAfter time.Duration
+	message    string
+}
+
+// NewMaintenance creates a maintenance switch, initially disabled, that
+// tells clients to retry after retryAfter with message.
+func NewMaintenance(retryAfter time.Duration, message string) *Maintenance {
+	if message == "" {
+		message = "service under maintenance, retry later"
+	}
+	return &Maintenance{retryAfter: retryAfter, message: message}
+}
+
+// WithMaintenance rejects inference requests while m is enabled.
+func WithMaintenance(m *Maintenance) Option {
+	return func(h *handler) {
+		h.maintenance = m
+	}
+}
+
+// SetEnabled turns maintenance mode on or off.
+func (m *Maintenance) SetEnabled(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.enabled != enabled {
+		log.Printf("proxy: maintenance mode=%v", enabled)
+	}
+	m.enabled = enabled
+}
+
+// Enabled reports whether maintenance mode is on.
+func (m *Maintenance) Enabled() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.enabled
+}
+
+// isInferencePath reports whether path runs inference on a backend, i.e.
+// is affected by maintenance mode.
+func isInferencePath(path string) bool {
+	if path == "/v1/models" || strings.HasPrefix(path, "/v1/models/") {
+		return false
+	}
+	return strings.HasPrefix(path, "/v1/") || path == "/generate"
+}
+
+// write writes the 503 maintenance response.
+func (m *Maintenance) write(w http.ResponseWriter) {
+	m.mu.RLock()
+	retryAfter, message := m.retryAfter, m.message
+	m.mu.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprintf(w, `{"error":{"message":%q,"type":"server_error","code":"maintenance"}}`, message)
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestIsInferencePath(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/v1/chat/completions":   true,
+		"/v1/responses":          true,
+		"/v1/audio/translations": true,
+		"/generate":              true,
+		"/v1/models":             false,
+		"/v1/models/llama":       false,
+		"/health":                false,
+		"/get_server_info":       false,
+	} {
+		if got := isInferencePath(path); got != want {
+			t.Errorf("isInferencePath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestReverseProxyMaintenance(t *testing.T) {
+	backendSrv := fakeBackendServer(t)
+	defer backendSrv.Close()
+
+	be := makeBackend(1, true)
+	be.SetBaseURL(backendSrv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	m := NewMaintenance(2*time.Minute, "rotating the fleet")
+	m.SetEnabled(true)
+	handler := NewReverseProxy(bal, nil, WithMaintenance(m))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{}")))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "120" {
+		t.Errorf("status = %d, Retry-After = %q, want 503 120", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error.Message != "rotating the fleet" || body.Error.Code != "maintenance" {
+		t.Errorf("error = %+v", body.Error)
+	}
+
+	// Non-inference paths are still proxied.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/models", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("/v1/models status = %d, want 200", rec.Code)
+	}
+
+	m.SetEnabled(false)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{}")))
+	if rec.Code != http.StatusOK {
+		t.Errorf("after disabling: status = %d, want 200", rec.Code)
+	}
+}
+
+func TestAdminMaintenance(t *testing.T) {
+	m := NewMaintenance(time.Minute, "")
+	srv := httptest.NewServer((&Admin{Maintenance: m}).Handler())
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/maintenance?enabled=true", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !m.Enabled() {
+		t.Error("POST /maintenance?enabled=true did not enable maintenance")
+	}
+
+	resp, err = http.Post(srv.URL+"/maintenance?enabled=maybe", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid value: status = %d, want 400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,30 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// errMaxDuration is the context cause when a request outlives the
+// configured maximum duration.
+var errMaxDuration = errors.New("maximum request duration exceeded")
+
+// WithMaxRequestDuration caps the lifetime of every proxied request,
+// streams included, regardless of any longer per-route timeout. When the
+// ceiling is reached the upstream connection is closed, which makes the
+// engine abort the generation and free the GPU; a request that hasn't
+// received response headers yet is answered with 504.
+func WithMaxRequestDuration(d time.Duration) Option {
+	return func(h *handler) {
+		h.maxRequestDuration = d
+	}
+}
+
+// isTimeout reports whether err comes from a request deadline: a route
+// timeout, the client's timeout or the maximum request duration. Such
+// errors say nothing about the backend's health.
+func isTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errMaxDuration) ||
+		errors.Is(err, errClientTimeout)
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+func TestReverseProxyMaxRequestDurationStream(t *testing.T) {
+	aborted := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		// A runaway generation: keep streaming until the client goes away.
+		for i := 0; ; i++ {
+			select {
+			case <-r.Context().Done():
+				close(aborted)
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			fmt.Fprintf(w, "data: chunk %d\n\n", i)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer srv.Close()
+
+	be := backend.NewBackend(&vast.Instance{ID: 1}, "", nil, "")
+	be.SetBaseURL(srv.URL)
+	be.SetHealthy(true)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	// The per-route timeout is longer; the ceiling still applies.
+	handler := NewReverseProxy(bal, nil,
+		WithRouteTimeouts(RouteTimeouts{Default: time.Hour}),
+		WithMaxRequestDuration(100*time.Millisecond))
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"stream":true}`))
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(rec, req)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream was not stopped at the maximum duration")
+	}
+	select {
+	case <-aborted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("backend generation was not aborted")
+	}
+	if !strings.Contains(rec.Body.String(), "chunk 0") {
+		t.Errorf("body = %q, want chunks relayed before the ceiling", rec.Body.String())
+	}
+	if !be.IsHealthy() {
+		t.Error("hitting the ceiling should not mark the backend unhealthy")
+	}
+}
+
+func TestReverseProxyMaxRequestDurationBeforeHeaders(t *testing.T) {
+	var hits atomic.Int32
+	be, srv := delayedBackend(t, 1, time.Second, &hits)
+	defer srv.Close()
+
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithMaxRequestDuration(20*time.Millisecond))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{}")))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want 504", rec.Code)
+	}
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// Response metadata headers, set alongside StickyHeader on every proxied
+// response so client-side telemetry can attribute latency without parsing
+// the proxy's logs.
+const (
+	// ModelHeader is the model the serving backend has loaded.
+	ModelHeader = "X-VastProxy-Model"
+	// TunnelHeader is how the proxy reached the backend: "direct" or
+	// "proxy" SSH, or "http" to the instance's public port.
+	TunnelHeader = "X-VastProxy-Tunnel"
+	// VersionHeader is the proxy's version (see WithVersion).
+	VersionHeader = "X-VastProxy-Version"
+	// TimingHeader is the standard Server-Timing header: "queue" is the
+	// time the request spent in the proxy before being sent upstream
+	// (admission, picking a backend), "upstream" the time until the
+	// backend's response headers arrived, both in milliseconds.
+	TimingHeader = "Server-Timing"
+)
+
+// WithVersion reports version in VersionHeader on proxied responses.
+func WithVersion(version string) Option {
+	return func(h *handler) {
+		h.version = version
+	}
+}
+
+// setMetadata sets the response metadata headers for a response from be
+// to a request received at start, sent upstream at sent.
+func (h *handler) setMetadata(header http.Header, be *backend.Backend, start, sent time.Time) {
+	if model := be.Instance.ModelName; model != "" {
+		header.Set(ModelHeader, model)
+	}
+	header.Set(TunnelHeader, tunnelType(be))
+	if h.version != "" {
+		header.Set(VersionHeader, h.version)
+	}
+	now := time.Now()
+	if sent.IsZero() {
+		sent = now
+	}
+	header.Set(TimingHeader, fmt.Sprintf("queue;dur=%.1f, upstream;dur=%.1f", ms(sent.Sub(start)), ms(now.Sub(sent))))
+}
+
+// tunnelType returns the TunnelHeader value for be.
+func tunnelType(be *backend.Backend) string {
+	switch {
+	case be.ServesDirectHTTP():
+		return "http"
+	case be.IsDirect():
+		return "direct"
+	default:
+		return "proxy"
+	}
+}
+
+// ms converts d to fractional milliseconds.
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+var timingRE = regexp.MustCompile(`^queue;dur=\d+\.\d, upstream;dur=\d+\.\d$`)
+
+func TestResponseMetadataHeaders(t *testing.T) {
+	srv := fakeBackendServer(t)
+	defer srv.Close()
+	be := makeBackend(1, true)
+	be.Instance.ModelName = "test-model"
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithVersion("v1.2.3"))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`)))
+	for header, want := range map[string]string{
+		StickyHeader:  "1",
+		ModelHeader:   "test-model",
+		TunnelHeader:  "proxy",
+		VersionHeader: "v1.2.3",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if got := rec.Header().Get(TimingHeader); !timingRE.MatchString(got) {
+		t.Errorf("%s = %q", TimingHeader, got)
+	}
+}
+
+func TestResponseMetadataHeadersHedged(t *testing.T) {
+	var hits atomic.Int32
+	be, srv := delayedBackend(t, 1, 50*time.Millisecond, &hits)
+	defer srv.Close()
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithHedging(time.Second, 1024))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{"input":"x"}`)))
+	if got := rec.Header().Get(TunnelHeader); got != "proxy" {
+		t.Errorf("%s = %q, want proxy", TunnelHeader, got)
+	}
+	if got := rec.Header().Get(VersionHeader); got != "" {
+		t.Errorf("%s = %q without WithVersion", VersionHeader, got)
+	}
+	got := rec.Header().Get(TimingHeader)
+	if !timingRE.MatchString(got) || strings.Contains(got, "upstream;dur=0.") {
+		t.Errorf("%s = %q, want upstream time of the 50ms backend", TimingHeader, got)
+	}
+}
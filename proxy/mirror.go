@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// mirrorTimeout bounds a mirrored request, which nobody waits on.
+const mirrorTimeout = 10 * time.Minute
+
+// maxMirrors bounds the mirrored requests in flight; beyond it copies are
+// skipped, so a slow shadow never costs the proxy more than this.
+const maxMirrors = 16
+
+// mirrorConfig controls traffic mirroring (see WithMirroring).
+type mirrorConfig struct {
+	fraction float64       // share of requests copied, 0–1
+	maxBody  int64         // only mirror requests with bodies up to this size
+	slots    chan struct{} // one per mirrored request in flight
+}
+
+// SetShadowLabel marks instances carrying label as shadows: they serve no
+// client requests, only the copies sent by WithMirroring, so a new
+// template or engine version can be tried on real traffic. An empty label
+// disables shadows.
+func (b *Balancer) SetShadowLabel(label string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.shadowLabel = label
+}
+
+// isShadow must be called with mu held.
+func (b *Balancer) isShadow(be *backend.Backend) bool {
+	return b.shadowLabel != "" && be.Instance.BaseLabel() == b.shadowLabel
+}
+
+// shadowMatch reports whether be may serve client requests, i.e. isn't a
+// shadow. Must be called with mu held.
+func (b *Balancer) shadowMatch(be *backend.Backend) bool {
+	return !b.isShadow(be)
+}
+
+// PickShadow selects the next healthy shadow backend.
+func (b *Balancer) PickShadow() (*backend.Backend, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var shadows []*backend.Backend
+	for _, be := range b.backends {
+		if b.isShadow(be) && be.IsHealthy() {
+			shadows = append(shadows, be)
+		}
+	}
+	if len(shadows) == 0 {
+		return nil, ErrNoBackends
+	}
+	return shadows[(b.shadowCounter.Add(1)-1)%uint64(len(shadows))], nil
+}
+
+// WithMirroring sends an asynchronous copy of percent (0–100) of inference
+// requests with bodies of at most maxBody bytes to a shadow backend (see
+// Balancer.SetShadowLabel). The copy's response is discarded; only its
+// status is logged.
+func WithMirroring(percent float64, maxBody int64) Option {
+	return func(h *handler) {
+		h.mirror = &mirrorConfig{
+			fraction: percent / 100,
+			maxBody:  maxBody,
+			slots:    make(chan struct{}, maxMirrors),
+		}
+	}
+}
+
+// mirrorRequest copies r to a shadow backend if it is sampled, leaving
+// r.Body readable.
+func (h *handler) mirrorRequest(r *http.Request, reqID string) {
+	m := h.mirror
+	if !isInferencePath(r.URL.Path) || rand.Float64() >= m.fraction {
+		return
+	}
+	if r.ContentLength < 0 || r.ContentLength > m.maxBody {
+		return
+	}
+	be, err := h.balancer.PickShadow()
+	if err != nil {
+		return
+	}
+	target, err := url.Parse(be.BaseURL())
+	if err != nil {
+		return
+	}
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		log.Printf("proxy: [%s] %d mirrored requests in flight, skipping copy", reqID, maxMirrors)
+		return
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body, err = io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			<-m.slots
+			return
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), mirrorTimeout)
+	out := r.Clone(ctx)
+	out.RequestURI = ""
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.ContentLength = int64(len(body))
+	for _, hdr := range hopHeaders {
+		out.Header.Del(hdr)
+	}
+	h.rewriteRequest(out, r, target, be, reqID)
+
+	be.Acquire()
+	go func() {
+		defer func() {
+			be.Release()
+			cancel()
+			<-m.slots
+		}()
+		transport := be.HTTPClient().Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		start := time.Now()
+		resp, err := transport.RoundTrip(out)
+		if err != nil {
+			log.Printf("proxy: [%s] mirror to shadow %d failed: %v", reqID, be.Instance.ID, err)
+			return
+		}
+		n, _ := io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		log.Printf("proxy: [%s] mirrored to shadow %d: status=%d bytes=%d duration=%s",
+			reqID, be.Instance.ID, resp.StatusCode, n, time.Since(start).Round(time.Millisecond))
+	}()
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestPickSkipsShadow(t *testing.T) {
+	be := makeBackend(1, true)
+	shadow := makeBackend(2, true)
+	shadow.Instance.Label = "shadow"
+	bal := NewBalancer()
+	bal.SetShadowLabel("shadow")
+	bal.SetBackends([]*backend.Backend{be, shadow})
+
+	for range 4 {
+		got, err := bal.Pick()
+		if err != nil || got != be {
+			t.Fatalf("Pick() = %v, %v, want backend 1", got, err)
+		}
+	}
+	if got, err := bal.PickShadow(); err != nil || got != shadow {
+		t.Errorf("PickShadow() = %v, %v, want backend 2", got, err)
+	}
+	if got, err := bal.PickExcluding(1); err == nil {
+		t.Errorf("PickExcluding(1) = %v, want an error", got)
+	}
+	if got, err := bal.PickAudio(); err != nil || got != be {
+		t.Errorf("PickAudio() = %v, %v, want backend 1", got, err)
+	}
+
+	bal.SetBackends([]*backend.Backend{shadow})
+	if _, err := bal.Pick(); err != ErrNoBackends {
+		t.Errorf("Pick() with only a shadow = %v, want ErrNoBackends", err)
+	}
+}
+
+func TestHandlerMirrorsToShadow(t *testing.T) {
+	bodies := make(chan string, 1)
+	shadowSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies <- r.URL.Path + " " + string(b)
+		http.Error(w, "shadow failure", http.StatusInternalServerError)
+	}))
+	defer shadowSrv.Close()
+	primary := fakeBackendServer(t)
+	defer primary.Close()
+
+	be := makeBackend(1, true)
+	be.SetBaseURL(primary.URL)
+	shadow := makeBackend(2, true)
+	shadow.Instance.Label = "shadow"
+	shadow.SetBaseURL(shadowSrv.URL)
+	bal := NewBalancer()
+	bal.SetShadowLabel("shadow")
+	bal.SetBackends([]*backend.Backend{be, shadow})
+	handler := NewReverseProxy(bal, nil, WithMirroring(100, 1<<20))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"messages":[]}`)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want the primary's 200", rec.Code)
+	}
+	select {
+	case got := <-bodies:
+		if got != `/v1/chat/completions {"messages":[]}` {
+			t.Errorf("shadow got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shadow received no copy")
+	}
+}
+
+func TestHandlerMirrorSkipsLargeBodies(t *testing.T) {
+	shadowSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("shadow received an oversized request")
+	}))
+	defer shadowSrv.Close()
+	primary := fakeBackendServer(t)
+	defer primary.Close()
+
+	be := makeBackend(1, true)
+	be.SetBaseURL(primary.URL)
+	shadow := makeBackend(2, true)
+	shadow.Instance.Label = "shadow"
+	shadow.SetBaseURL(shadowSrv.URL)
+	bal := NewBalancer()
+	bal.SetShadowLabel("shadow")
+	bal.SetBackends([]*backend.Backend{be, shadow})
+	handler := NewReverseProxy(bal, nil, WithMirroring(100, 4))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"messages":[]}`)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d", rec.Code)
+	}
+	if shadow.ActiveRequests() != 0 {
+		t.Error("shadow acquired for a skipped copy")
+	}
+}
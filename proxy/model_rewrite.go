@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// WithModelRewrite replaces the "model" field of JSON request bodies with a
+// model the chosen backend actually serves, for clients that send
+// placeholder names. Responses report the client's model name back.
+func WithModelRewrite() Option {
+	return func(h *handler) {
+		h.rewriteModel = true
+	}
+}
+
+// rewriteRequestModel sets the "model" field of r's JSON body to the
+// backend's model, unless the backend serves the requested one. It returns
+// the client's model name if the body was changed, or "".
+func rewriteRequestModel(r *http.Request, be *backend.Backend) (string, error) {
+	models := be.Models()
+	if r.Body == nil || r.Body == http.NoBody || len(models) == 0 {
+		return "", nil
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		if mt, _, _ := mime.ParseMediaType(ct); !strings.Contains(mt, "json") {
+			return "", nil
+		}
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	var fields map[string]json.RawMessage
+	var orig string
+	if json.Unmarshal(body, &fields) != nil || json.Unmarshal(fields["model"], &orig) != nil ||
+		be.Serves(orig) {
+		return "", nil
+	}
+	fields["model"], _ = json.Marshal(models[0])
+	if body, err = json.Marshal(fields); err != nil {
+		return "", err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return orig, nil
+}
+
+// restoreResponseModel sets the "model" field of a JSON response, or of
+// each event in a stream, back to the client's model name.
+func restoreResponseModel(resp *http.Response, model string) error {
+	if isEventStream(resp) {
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		pr, pw := io.Pipe()
+		go restoreStreamModel(resp.Body, pw, model)
+		resp.Body = pr
+		return nil
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); !strings.Contains(mt, "json") {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	body = setModelField(body, model)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+// restoreStreamModel copies SSE lines from src to dst, setting the model
+// field of each data payload.
+func restoreStreamModel(src io.ReadCloser, dst *io.PipeWriter, model string) {
+	defer src.Close()
+	sc := bufio.NewScanner(src)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		if payload, ok := strings.CutPrefix(line, "data:"); ok {
+			payload = strings.TrimSpace(payload)
+			if payload != "[DONE]" {
+				line = "data: " + string(setModelField([]byte(payload), model))
+			}
+		}
+		if _, err := fmt.Fprintln(dst, line); err != nil {
+			return
+		}
+	}
+	dst.CloseWithError(sc.Err())
+}
+
+// setModelField returns a JSON object with its top-level "model" field set
+// to model. Other bodies, and objects without the field, are returned
+// unchanged.
+func setModelField(body []byte, model string) []byte {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return body
+	}
+	if _, ok := fields["model"]; !ok {
+		return body
+	}
+	fields["model"], _ = json.Marshal(model)
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+// modelRewriteProxy returns a model-rewriting proxy in front of a backend
+// serving models, and a pointer to the model field the backend last saw.
+func modelRewriteProxy(t *testing.T, stream bool, models ...string) (http.Handler, *string) {
+	t.Helper()
+	var gotModel string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		gotModel = req.Model
+		if stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "data: {\"id\":\"1\",\"model\":%q}\n\n", req.Model)
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"1","model":%q,"usage":{"prompt_tokens":3}}`, req.Model)
+	}))
+	t.Cleanup(srv.Close)
+	be := backend.NewBackend(&vast.Instance{ID: 1}, "", nil, "")
+	be.SetBaseURL(srv.URL)
+	be.SetHealthy(true)
+	be.SetModels(models)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	return NewReverseProxy(bal, nil, WithModelRewrite()), &gotModel
+}
+
+func TestModelRewrite(t *testing.T) {
+	handler, gotModel := modelRewriteProxy(t, false, "meta-llama/Llama-3-8B")
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[]}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if *gotModel != "meta-llama/Llama-3-8B" {
+		t.Errorf("backend saw model %q, want meta-llama/Llama-3-8B", *gotModel)
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad JSON %q: %v", rec.Body.String(), err)
+	}
+	if resp["model"] != "gpt-4" || resp["id"] != "1" || resp["usage"] == nil {
+		t.Errorf("response = %v, want model gpt-4 and other fields kept", resp)
+	}
+}
+
+func TestModelRewriteStream(t *testing.T) {
+	handler, gotModel := modelRewriteProxy(t, true, "meta-llama/Llama-3-8B")
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","stream":true}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if *gotModel != "meta-llama/Llama-3-8B" {
+		t.Errorf("backend saw model %q", *gotModel)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	if !strings.Contains(string(body), `"model":"gpt-4"`) || !strings.Contains(string(body), "data: [DONE]") {
+		t.Errorf("stream = %q, want model gpt-4 and [DONE]", body)
+	}
+}
+
+func TestModelRewriteKeepsServedModel(t *testing.T) {
+	handler, gotModel := modelRewriteProxy(t, false, "base", "lora-a")
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"lora-a"}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if *gotModel != "lora-a" {
+		t.Errorf("backend saw model %q, want lora-a unchanged", *gotModel)
+	}
+	if !strings.Contains(rec.Body.String(), `"model":"lora-a"`) {
+		t.Errorf("response = %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CapacityETAHeader is set on no-backends responses while new capacity is
+// being provisioned, to the estimated seconds until it is healthy.
+const CapacityETAHeader = "X-VastProxy-Capacity-ETA"
+
+// NoBackendsResponse customizes the response sent when no healthy backend
+// can serve a request, so client SDK retry logic can be tuned. Zero fields
+// keep the defaults: 503 and an OpenAI-style JSON error.
+type NoBackendsResponse struct {
+	Status int
+	Body   string
+	Header http.Header // extra headers, e.g. Retry-After
+}
+
+// WithNoBackendsResponse replaces the default no-backends response.
+func WithNoBackendsResponse(resp NoBackendsResponse) Option {
+	return func(h *handler) {
+		h.noBackends = resp
+	}
+}
+
+// WithCapacityETA reports estimated time to capacity in no-backends
+// responses while eta returns true, e.g. while the provisioning watchdog
+// has instances booting.
+func WithCapacityETA(eta func() (time.Duration, bool)) Option {
+	return func(h *handler) {
+		h.capacityETA = eta
+	}
+}
+
+// ParseHeaders parses a comma-separated list of Name=value pairs, e.g.
+// "Retry-After=30,X-Reason=capacity".
+func ParseHeaders(s string) (http.Header, error) {
+	header := make(http.Header)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid header %q (want Name=value)", pair)
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return header, nil
+}
+
+// writeNoBackends writes the response sent when no healthy backend is
+// available.
+func (h *handler) writeNoBackends(w http.ResponseWriter) {
+	eta, provisioning := time.Duration(0), false
+	if h.capacityETA != nil {
+		eta, provisioning = h.capacityETA()
+	}
+	etaSeconds := int(math.Ceil(eta.Seconds()))
+
+	for name, values := range h.noBackends.Header {
+		w.Header()[name] = values
+	}
+	if provisioning {
+		w.Header().Set(CapacityETAHeader, strconv.Itoa(etaSeconds))
+		if w.Header().Get("Retry-After") == "" {
+			w.Header().Set("Retry-After", strconv.Itoa(max(etaSeconds, 1)))
+		}
+	}
+
+	status := h.noBackends.Status
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	body := h.noBackends.Body
+	if body == "" {
+		body = `{"error":{"message":"no backends available","type":"server_error"}}`
+		if provisioning {
+			body = fmt.Sprintf(`{"error":{"message":"no backends available","type":"server_error","estimated_seconds_to_capacity":%d}}`, etaSeconds)
+		}
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHeaders(t *testing.T) {
+	h, err := ParseHeaders("Retry-After=30, X-Reason=capacity")
+	if err != nil {
+		t.Fatalf("ParseHeaders() error: %v", err)
+	}
+	if h.Get("Retry-After") != "30" || h.Get("X-Reason") != "capacity" {
+		t.Errorf("header = %v", h)
+	}
+	if _, err := ParseHeaders("Retry-After"); err == nil {
+		t.Error("expected error for a pair without =")
+	}
+}
+
+func TestReverseProxyCustomNoBackends(t *testing.T) {
+	handler := NewReverseProxy(NewBalancer(), nil, WithNoBackendsResponse(NoBackendsResponse{
+		Status: http.StatusTooManyRequests,
+		Body:   `{"error":"busy"}`,
+		Header: http.Header{"Retry-After": {"30"}},
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{}")))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", rec.Code)
+	}
+	if rec.Body.String() != `{"error":"busy"}` || rec.Header().Get("Retry-After") != "30" {
+		t.Errorf("body = %s, headers = %v", rec.Body.String(), rec.Header())
+	}
+}
+
+func TestReverseProxyNoBackendsCapacityETA(t *testing.T) {
+	handler := NewReverseProxy(NewBalancer(), nil, WithCapacityETA(func() (time.Duration, bool) {
+		return 90 * time.Second, true
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{}")))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+	if rec.Header().Get(CapacityETAHeader) != "90" || rec.Header().Get("Retry-After") != "90" {
+		t.Errorf("headers = %v", rec.Header())
+	}
+	if !strings.Contains(rec.Body.String(), `"estimated_seconds_to_capacity":90`) {
+		t.Errorf("body = %s", rec.Body.String())
+	}
+
+	// Nothing provisioning: the default response is unchanged.
+	handler = NewReverseProxy(NewBalancer(), nil, WithCapacityETA(func() (time.Duration, bool) {
+		return 0, false
+	}))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{}")))
+	if rec.Header().Get("Retry-After") != "" || strings.Contains(rec.Body.String(), "estimated") {
+		t.Errorf("headers = %v, body = %s", rec.Header(), rec.Body.String())
+	}
+}
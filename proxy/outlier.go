@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// outlierBuckets is the number of buckets the sliding window is split into.
+const outlierBuckets = 10
+
+// outlierMinRequests is the number of requests a backend must have served
+// within the window before its error rate is judged.
+const outlierMinRequests = 10
+
+// outlierFactor is how many times the rest of the fleet's error rate a
+// backend's must reach to be ejected.
+const outlierFactor = 2
+
+// OutlierDetector tracks each backend's upstream error rate (5xx responses
+// and failed connections) over a sliding window and ejects a backend whose
+// rate is at least minRate and well above the rest of the fleet's. This
+// catches engines that answer health checks but fail completions, which
+// the health loop keeps marking healthy. An ejected backend gets no new
+// requests for ejectFor, then is judged afresh; at most half the backends
+// are ejected at once. Safe for concurrent use.
+type OutlierDetector struct {
+	window   time.Duration
+	minRate  float64
+	ejectFor time.Duration
+
+	mu       sync.Mutex
+	backends map[int]*outlierStats
+}
+
+// outlierStats is one backend's request and error counts per bucket.
+type outlierStats struct {
+	be     *backend.Backend
+	epochs [outlierBuckets]int64 // bucket index (time / bucket width) each slot holds
+	total  [outlierBuckets]int
+	errors [outlierBuckets]int
+}
+
+// NewOutlierDetector creates a detector judging error rates over window
+// (at least a second).
+func NewOutlierDetector(window time.Duration, minRate float64, ejectFor time.Duration) *OutlierDetector {
+	return &OutlierDetector{
+		window:   max(window, time.Second),
+		minRate:  minRate,
+		ejectFor: ejectFor,
+		backends: make(map[int]*outlierStats),
+	}
+}
+
+// WithOutlierDetection records the outcome of every proxied request into
+// d, which ejects backends with outlying error rates.
+func WithOutlierDetection(d *OutlierDetector) Option {
+	return func(h *handler) {
+		h.outliers = d
+	}
+}
+
+// Record adds the outcome of one request served by be at now, ejecting be
+// if its error rate has become an outlier.
+func (d *OutlierDetector) Record(be *backend.Backend, failed bool, now time.Time) {
+	epoch := now.UnixNano() / int64(d.window/outlierBuckets)
+	slot := int(epoch % outlierBuckets)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.backends[be.Instance.ID]
+	if s == nil || s.be != be {
+		s = &outlierStats{be: be}
+		d.backends[be.Instance.ID] = s
+	}
+	if s.epochs[slot] != epoch {
+		s.epochs[slot], s.total[slot], s.errors[slot] = epoch, 0, 0
+	}
+	s.total[slot]++
+	if failed {
+		s.errors[slot]++
+		d.judge(s, epoch, now)
+	}
+}
+
+// judge ejects s's backend if its error rate is an outlier. Must be called
+// with mu held.
+func (d *OutlierDetector) judge(s *outlierStats, epoch int64, now time.Time) {
+	total, errors := s.counts(epoch)
+	if total < outlierMinRequests || s.be.Ejected() {
+		return
+	}
+	rate := float64(errors) / float64(total)
+	if rate < d.minRate {
+		return
+	}
+
+	active, ejected := 1, 0
+	var othersTotal, othersErrors int
+	for id, o := range d.backends {
+		if o == s {
+			continue
+		}
+		t, e := o.counts(epoch)
+		switch {
+		case o.be.Ejected():
+			active++
+			ejected++
+		case t == 0:
+			delete(d.backends, id) // idle or removed
+		default:
+			active++
+			othersTotal += t
+			othersErrors += e
+		}
+	}
+	if othersTotal == 0 {
+		return // nothing to compare with
+	}
+	if rate < outlierFactor*float64(othersErrors)/float64(othersTotal) {
+		return // the whole fleet is failing, not this backend
+	}
+	if ejected+1 > max(1, active/2) {
+		return
+	}
+
+	log.Printf("proxy: backend %d error rate %.0f%% (%d/%d) is an outlier, ejecting for %v",
+		s.be.Instance.ID, 100*rate, errors, total, d.ejectFor)
+	s.be.Eject(now.Add(d.ejectFor))
+	s.epochs = [outlierBuckets]int64{} // judged afresh once back
+}
+
+// counts sums the requests and errors in the window ending at epoch.
+func (s *outlierStats) counts(epoch int64) (total, errors int) {
+	for i, e := range s.epochs {
+		if e > epoch-outlierBuckets {
+			total += s.total[i]
+			errors += s.errors[i]
+		}
+	}
+	return total, errors
+}
+
+// notEjected returns the backends that aren't ejected, or all of them if
+// every one is.
+func notEjected(backends []*backend.Backend) []*backend.Backend {
+	var out []*backend.Backend
+	for _, be := range backends {
+		if !be.Ejected() {
+			out = append(out, be)
+		}
+	}
+	if len(out) == 0 {
+		return backends
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// record adds n requests to d for be at now, the first errors of them
+// failed.
+func record(d *OutlierDetector, be *backend.Backend, n, errors int, now time.Time) {
+	for i := range n {
+		d.Record(be, i < errors, now)
+	}
+}
+
+func TestOutlierEjectsFailingBackend(t *testing.T) {
+	bad, good1, good2 := makeBackend(1, true), makeBackend(2, true), makeBackend(3, true)
+	d := NewOutlierDetector(time.Minute, 0.5, time.Hour)
+	now := time.Now()
+	record(d, good1, 20, 1, now)
+	record(d, good2, 20, 0, now)
+	record(d, bad, 9, 9, now)
+	if bad.Ejected() {
+		t.Fatal("ejected before outlierMinRequests")
+	}
+	record(d, bad, 1, 1, now)
+	if !bad.Ejected() || good1.Ejected() || good2.Ejected() {
+		t.Fatalf("ejected = %v %v %v, want only backend 1", bad.Ejected(), good1.Ejected(), good2.Ejected())
+	}
+
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{bad, good1, good2})
+	for range 4 {
+		if be, _ := bal.Pick(); be == bad {
+			t.Error("picked an ejected backend")
+		}
+	}
+	bal.SetBackends([]*backend.Backend{bad})
+	if be, _ := bal.Pick(); be != bad {
+		t.Error("ejected backend not used when it is the only one")
+	}
+}
+
+func TestOutlierSparesFleetWideFailures(t *testing.T) {
+	b1, b2 := makeBackend(1, true), makeBackend(2, true)
+	d := NewOutlierDetector(time.Minute, 0.5, time.Hour)
+	now := time.Now()
+	record(d, b2, 20, 15, now)
+	record(d, b1, 20, 16, now)
+	if b1.Ejected() || b2.Ejected() {
+		t.Error("ejected a backend while the whole fleet is failing")
+	}
+}
+
+func TestOutlierEjectsAtMostHalf(t *testing.T) {
+	good, b1, b2 := makeBackend(1, true), makeBackend(2, true), makeBackend(3, true)
+	d := NewOutlierDetector(time.Minute, 0.5, time.Hour)
+	now := time.Now()
+	record(d, good, 20, 0, now)
+	record(d, b1, 20, 20, now)
+	record(d, b2, 20, 20, now)
+	if !b1.Ejected() || b2.Ejected() {
+		t.Errorf("ejected = %v %v, want only the first failing backend of three", b1.Ejected(), b2.Ejected())
+	}
+}
+
+func TestOutlierWindowSlides(t *testing.T) {
+	bad, good := makeBackend(1, true), makeBackend(2, true)
+	d := NewOutlierDetector(time.Minute, 0.5, time.Hour)
+	start := time.Now()
+	record(d, good, 20, 0, start)
+	record(d, bad, 9, 9, start)
+	// The old errors have left the window by now.
+	later := start.Add(2 * time.Minute)
+	record(d, good, 20, 0, later)
+	record(d, bad, 9, 1, later)
+	record(d, bad, 1, 1, later)
+	if bad.Ejected() {
+		t.Error("ejected for errors outside the window")
+	}
+}
+
+func TestHandlerRecordsOutliers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	good := fakeBackendServer(t)
+	defer good.Close()
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	other := makeBackend(2, true)
+	other.SetBaseURL(good.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be, other})
+	handler := NewReverseProxy(bal, nil, WithOutlierDetection(NewOutlierDetector(time.Minute, 0.5, time.Hour)))
+
+	for range 2 * outlierMinRequests {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`)))
+	}
+	if !be.Ejected() || other.Ejected() {
+		t.Error("backend returning 500s not ejected")
+	}
+}
@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// ErrPaused is returned by the pick methods while the balancer is paused.
+var ErrPaused = fmt.Errorf("proxy paused")
+
+// pausedRetryAfter is the Retry-After (in seconds) sent to clients while
+// the proxy is paused.
+const pausedRetryAfter = 10
+
+// SetPaused pauses or resumes accepting new requests. While paused every
+// pick returns ErrPaused; backends, tunnels and in-flight requests are left
+// alone.
+func (b *Balancer) SetPaused(paused bool) {
+	if b.paused.Swap(paused) != paused {
+		log.Printf("balancer: paused=%v", paused)
+	}
+}
+
+// Paused reports whether the balancer is paused.
+func (b *Balancer) Paused() bool {
+	return b.paused.Load()
+}
+
+// writePaused writes the 503 response sent while the proxy is paused.
+func writePaused(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(pausedRetryAfter))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(`{"error":{"message":"proxy is paused, retry later","type":"server_error","code":"paused"}}`))
+}
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestBalancerPaused(t *testing.T) {
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{makeBackend(1, true)})
+	bal.SetPaused(true)
+
+	if _, err := bal.Pick(); !errors.Is(err, ErrPaused) {
+		t.Errorf("Pick() error = %v, want ErrPaused", err)
+	}
+	if _, err := bal.PickByID(1); !errors.Is(err, ErrPaused) {
+		t.Errorf("PickByID() error = %v, want ErrPaused", err)
+	}
+	if !bal.IsHealthy(1) {
+		t.Error("pausing should not make backends unhealthy")
+	}
+
+	bal.SetPaused(false)
+	if _, err := bal.Pick(); err != nil {
+		t.Errorf("Pick() after resume error = %v", err)
+	}
+}
+
+func TestReverseProxyPaused(t *testing.T) {
+	backendSrv := fakeBackendServer(t)
+	defer backendSrv.Close()
+
+	be := makeBackend(1, true)
+	be.SetBaseURL(backendSrv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	bal.SetPaused(true)
+	handler := NewReverseProxy(bal, nil)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{}")))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" || !strings.Contains(rec.Body.String(), `"paused"`) {
+		t.Errorf("headers = %v, body = %s", rec.Header(), rec.Body.String())
+	}
+}
+
+func TestAdminPauseResume(t *testing.T) {
+	bal := NewBalancer()
+	srv := httptest.NewServer((&Admin{Balancer: bal}).Handler())
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/pause", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !bal.Paused() {
+		t.Error("POST /pause did not pause the balancer")
+	}
+	resp, err = http.Post(srv.URL+"/resume", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if bal.Paused() {
+		t.Error("POST /resume did not resume the balancer")
+	}
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// PoolHeader selects a backend pool explicitly, overriding the request's
+// model field. It is proxy-internal and not forwarded.
+const PoolHeader = "X-VastProxy-Pool"
+
+// PoolMode selects how backends are grouped into pools.
+type PoolMode int
+
+const (
+	PoolNone    PoolMode = iota // all backends form one pool (default)
+	PoolByModel                 // pool name is the backend's served model
+	PoolByLabel                 // pool name is the instance's vast.ai label
+)
+
+// ParsePoolMode parses "none", "model" or "label".
+func ParsePoolMode(s string) (PoolMode, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return PoolNone, nil
+	case "model":
+		return PoolByModel, nil
+	case "label":
+		return PoolByLabel, nil
+	default:
+		return 0, fmt.Errorf("unknown pool mode %q", s)
+	}
+}
+
+func (m PoolMode) String() string {
+	switch m {
+	case PoolByModel:
+		return "model"
+	case PoolByLabel:
+		return "label"
+	default:
+		return "none"
+	}
+}
+
+// ErrUnknownPool is returned when no backend at all belongs to a pool.
+var ErrUnknownPool = fmt.Errorf("unknown backend pool")
+
+// PoolStats summarizes one pool.
+type PoolStats struct {
+	Name           string `json:"name"`
+	Healthy        int    `json:"healthy"`
+	Total          int    `json:"total"`
+	ActiveRequests int64  `json:"active_requests"`
+}
+
+// SetPoolMode sets how backends are grouped into pools.
+func (b *Balancer) SetPoolMode(m PoolMode) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.poolMode = m
+}
+
+// Pooled reports whether backends are grouped into pools.
+func (b *Balancer) Pooled() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.poolMode != PoolNone
+}
+
+// InPool reports whether be belongs to the named pool under the current
+// pool mode.
+func (b *Balancer) InPool(be *backend.Backend, pool string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.inPool(be, pool)
+}
+
+// poolsOf returns the pools be belongs to: in model mode one per model it
+// serves, since an engine can host several models or LoRA variants. Must
+// be called with mu held.
+func (b *Balancer) poolsOf(be *backend.Backend) []string {
+	switch b.poolMode {
+	case PoolByModel:
+		if models := be.Models(); len(models) > 0 {
+			return models
+		}
+	case PoolByLabel:
+		return []string{be.Instance.BaseLabel()}
+	}
+	return []string{""}
+}
+
+// inPool must be called with mu held.
+func (b *Balancer) inPool(be *backend.Backend, pool string) bool {
+	return slices.Contains(b.poolsOf(be), pool)
+}
+
+// PickPool selects the next healthy backend in the named pool using that
+// pool's own round-robin counter and the balancer's strategy. It returns ErrUnknownPool if no backend
+// belongs to the pool and ErrNoBackends if none of them is healthy.
+func (b *Balancer) PickPool(pool string, opts ...PickOption) (*backend.Backend, error) {
+	if b.paused.Load() {
+		return nil, ErrPaused
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var members, healthy []*backend.Backend
+	for _, be := range b.backends {
+		if !b.inPool(be, pool) || !b.shadowMatch(be) || !b.audioMatch(be, false) {
+			continue
+		}
+		members = append(members, be)
+		if be.IsHealthy() {
+			healthy = append(healthy, be)
+		}
+	}
+	if len(members) == 0 {
+		return nil, ErrUnknownPool
+	}
+	if len(healthy) == 0 {
+		return nil, ErrNoBackends
+	}
+	c, _ := b.poolCounters.LoadOrStore(pool, new(atomic.Uint64))
+	pick, idx, err := b.chooseWithStream(healthy, c.(*atomic.Uint64), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("balancer: picked instance %d in pool %q (counter=%d, healthy=%d/%d)",
+		pick.Instance.ID, pool, idx, len(healthy), len(members))
+	return pick, nil
+}
+
+// Pools returns per-pool statistics sorted by name.
+func (b *Balancer) Pools() []PoolStats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	byName := make(map[string]*PoolStats)
+	for _, be := range b.backends {
+		for _, name := range b.poolsOf(be) {
+			ps, ok := byName[name]
+			if !ok {
+				ps = &PoolStats{Name: name}
+				byName[name] = ps
+			}
+			ps.Total++
+			if be.IsHealthy() {
+				ps.Healthy++
+			}
+			ps.ActiveRequests += be.ActiveRequests()
+		}
+	}
+
+	out := make([]PoolStats, 0, len(byName))
+	for _, ps := range byName {
+		out = append(out, *ps)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// serveModels answers GET /v1/models with the union of pools that have at
+// least one healthy backend, so clients can discover every model served.
+func (b *Balancer) serveModels(w http.ResponseWriter) {
+	type model struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		OwnedBy string `json:"owned_by"`
+	}
+	data := []model{}
+	for _, ps := range b.Pools() {
+		if ps.Name != "" && ps.Healthy > 0 {
+			data = append(data, model{ID: ps.Name, Object: "model", OwnedBy: "vastproxy"})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"object": "list", "data": data})
+}
@@ -0,0 +1,252 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+func makeModelBackend(t *testing.T, id int, model string) *backend.Backend {
+	t.Helper()
+	srv := fakeBackendServer(t)
+	t.Cleanup(srv.Close)
+	be := backend.NewBackend(&vast.Instance{ID: id, ModelName: model}, "", nil, "")
+	be.SetBaseURL(srv.URL)
+	be.SetHealthy(true)
+	return be
+}
+
+func TestParsePoolMode(t *testing.T) {
+	for in, want := range map[string]PoolMode{"": PoolNone, "none": PoolNone, "model": PoolByModel, "Label": PoolByLabel} {
+		got, err := ParsePoolMode(in)
+		if err != nil || got != want {
+			t.Errorf("ParsePoolMode(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParsePoolMode("gpu"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+	for _, m := range []PoolMode{PoolNone, PoolByModel, PoolByLabel} {
+		if got, _ := ParsePoolMode(m.String()); got != m {
+			t.Errorf("ParsePoolMode(%q) = %v, want %v", m.String(), got, m)
+		}
+	}
+}
+
+func TestPickPool(t *testing.T) {
+	b := NewBalancer()
+	b.SetPoolMode(PoolByModel)
+	b.SetBackends([]*backend.Backend{
+		makeModelBackend(t, 1, "llama"),
+		makeModelBackend(t, 2, "qwen"),
+		makeModelBackend(t, 3, "llama"),
+	})
+
+	counts := map[int]int{}
+	for range 4 {
+		be, err := b.PickPool("llama")
+		if err != nil {
+			t.Fatalf("PickPool() error: %v", err)
+		}
+		counts[be.Instance.ID]++
+	}
+	if counts[1] != 2 || counts[3] != 2 || counts[2] != 0 {
+		t.Errorf("distribution = %v, want 1 and 3 twice each", counts)
+	}
+
+	if _, err := b.PickPool("mistral"); err != ErrUnknownPool {
+		t.Errorf("err = %v, want ErrUnknownPool", err)
+	}
+}
+
+func TestPickPoolAllUnhealthy(t *testing.T) {
+	b := NewBalancer()
+	b.SetPoolMode(PoolByModel)
+	be := makeModelBackend(t, 1, "llama")
+	be.SetHealthy(false)
+	b.SetBackends([]*backend.Backend{be})
+
+	if _, err := b.PickPool("llama"); err != ErrNoBackends {
+		t.Errorf("err = %v, want ErrNoBackends", err)
+	}
+}
+
+func TestPickExcludingStaysInPool(t *testing.T) {
+	b := NewBalancer()
+	b.SetPoolMode(PoolByModel)
+	b.SetBackends([]*backend.Backend{
+		makeModelBackend(t, 1, "llama"),
+		makeModelBackend(t, 2, "qwen"),
+	})
+	if _, err := b.PickExcluding(1); err != ErrNoBackends {
+		t.Errorf("err = %v, want ErrNoBackends (no other llama backend)", err)
+	}
+}
+
+func TestPoolsStats(t *testing.T) {
+	b := NewBalancer()
+	b.SetPoolMode(PoolByLabel)
+	be1 := makeBackend(1, true)
+	be1.Instance.Label = "a"
+	be2 := makeBackend(2, false)
+	be2.Instance.Label = "a"
+	be3 := makeBackend(3, true)
+	be3.Instance.Label = "b"
+	be3.Acquire()
+	b.SetBackends([]*backend.Backend{be1, be2, be3})
+
+	got := b.Pools()
+	want := []PoolStats{
+		{Name: "a", Healthy: 1, Total: 2},
+		{Name: "b", Healthy: 1, Total: 1, ActiveRequests: 1},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Pools() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReverseProxyRoutesByModel(t *testing.T) {
+	bal := NewBalancer()
+	bal.SetPoolMode(PoolByModel)
+	bal.SetBackends([]*backend.Backend{
+		makeModelBackend(t, 1, "llama"),
+		makeModelBackend(t, 2, "qwen"),
+	})
+	handler := NewReverseProxy(bal, nil)
+
+	for range 3 {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"qwen"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if got := rec.Header().Get(StickyHeader); got != "2" {
+			t.Errorf("routed to %s, want 2", got)
+		}
+	}
+
+	// Explicit pool header wins over the body.
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"qwen"}`))
+	req.Header.Set(PoolHeader, "llama")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get(StickyHeader); got != "1" {
+		t.Errorf("routed to %s, want 1", got)
+	}
+
+	// Sticky pin to a backend in another pool is ignored.
+	req = httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"qwen"}`))
+	req.Header.Set(StickyHeader, "1")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get(StickyHeader); got != "2" {
+		t.Errorf("routed to %s, want 2", got)
+	}
+}
+
+func TestReverseProxyUnknownModel(t *testing.T) {
+	bal := NewBalancer()
+	bal.SetPoolMode(PoolByModel)
+	bal.SetBackends([]*backend.Backend{makeModelBackend(t, 1, "llama")})
+	handler := NewReverseProxy(bal, nil)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4"}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "model_not_found") {
+		t.Errorf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestReverseProxyAggregatedModels(t *testing.T) {
+	bal := NewBalancer()
+	bal.SetPoolMode(PoolByModel)
+	down := makeModelBackend(t, 3, "mistral")
+	down.SetHealthy(false)
+	bal.SetBackends([]*backend.Backend{
+		makeModelBackend(t, 1, "llama"),
+		makeModelBackend(t, 2, "qwen"),
+		down,
+	})
+	handler := NewReverseProxy(bal, nil)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/models", nil))
+
+	var resp struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad JSON %q: %v", rec.Body.String(), err)
+	}
+	if len(resp.Data) != 2 || resp.Data[0].ID != "llama" || resp.Data[1].ID != "qwen" {
+		t.Errorf("models = %+v, want llama and qwen", resp.Data)
+	}
+}
+
+func TestAdminPools(t *testing.T) {
+	bal := NewBalancer()
+	bal.SetPoolMode(PoolByModel)
+	bal.SetBackends([]*backend.Backend{makeModelBackend(t, 1, "llama")})
+
+	srv := httptest.NewServer((&Admin{Balancer: bal}).Handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/pools")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got []PoolStats
+	json.NewDecoder(resp.Body).Decode(&got)
+	if len(got) != 1 || got[0].Name != "llama" || got[0].Healthy != 1 {
+		t.Errorf("pools = %+v", got)
+	}
+}
+
+func TestMultiModelBackendPools(t *testing.T) {
+	bal := NewBalancer()
+	bal.SetPoolMode(PoolByModel)
+	multi := makeModelBackend(t, 1, "llama")
+	multi.SetModels([]string{"llama", "llama-lora-sql"})
+	bal.SetBackends([]*backend.Backend{multi, makeModelBackend(t, 2, "llama")})
+
+	be, err := bal.PickPool("llama-lora-sql")
+	if err != nil || be.Instance.ID != 1 {
+		t.Fatalf("PickPool(llama-lora-sql) = %v, %v; want backend 1", be, err)
+	}
+	if !bal.InPool(multi, "llama") || !bal.InPool(multi, "llama-lora-sql") {
+		t.Error("backend 1 should be in both pools")
+	}
+
+	// A hedge for the multi-model backend must serve all its models.
+	if _, err := bal.PickExcluding(1); err != ErrNoBackends {
+		t.Errorf("PickExcluding(1) err = %v, want ErrNoBackends", err)
+	}
+	if be, err := bal.PickExcluding(2); err != nil || be.Instance.ID != 1 {
+		t.Errorf("PickExcluding(2) = %v, %v; want backend 1", be, err)
+	}
+
+	rec := httptest.NewRecorder()
+	NewReverseProxy(bal, nil).ServeHTTP(rec, httptest.NewRequest("GET", "/v1/models", nil))
+	var resp struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if len(resp.Data) != 2 || resp.Data[0].ID != "llama" || resp.Data[1].ID != "llama-lora-sql" {
+		t.Errorf("models = %+v, want llama and llama-lora-sql", resp.Data)
+	}
+
+	want := []PoolStats{{Name: "llama", Healthy: 2, Total: 2}, {Name: "llama-lora-sql", Healthy: 1, Total: 1}}
+	if got := bal.Pools(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Pools() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,221 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QuotaPeriod is the calendar window a quota applies to. Windows are
+// aligned to UTC days and months.
+type QuotaPeriod int
+
+const (
+	QuotaDaily QuotaPeriod = iota
+	QuotaMonthly
+)
+
+func (p QuotaPeriod) String() string {
+	if p == QuotaMonthly {
+		return "monthly"
+	}
+	return "daily"
+}
+
+// start returns the beginning of the window containing t.
+func (p QuotaPeriod) start(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	if p == QuotaMonthly {
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// end returns the end of the window beginning at start.
+func (p QuotaPeriod) end(start time.Time) time.Time {
+	if p == QuotaMonthly {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// Quota limits the requests and/or tokens (prompt plus completion) an API
+// key may use per period. A zero limit is unlimited.
+type Quota struct {
+	Period   QuotaPeriod
+	Requests int64
+	Tokens   int64
+}
+
+// defaultQuotaKey is the ParseQuotas key for quotas applied to every API
+// key without its own.
+const defaultQuotaKey = "*"
+
+// ParseQuotas parses a comma-separated list of key=limit/period entries,
+// where limit is a count followed by "req" or "tok" and period is "day" or
+// "month", e.g. "*=1000req/day,key-1a2b3c4d=5000000tok/month". Key "*"
+// applies to every key without quotas of its own. A key may have several
+// entries.
+func ParseQuotas(s string) (map[string][]Quota, error) {
+	quotas := make(map[string][]Quota)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, spec, ok := strings.Cut(entry, "=")
+		limit, period, ok2 := strings.Cut(spec, "/")
+		if !ok || !ok2 || key == "" {
+			return nil, fmt.Errorf("invalid quota %q (want key=limit/period)", entry)
+		}
+		var q Quota
+		switch period {
+		case "day":
+			q.Period = QuotaDaily
+		case "month":
+			q.Period = QuotaMonthly
+		default:
+			return nil, fmt.Errorf("quota %q: period must be day or month", entry)
+		}
+		num, unit := limit, ""
+		if i := strings.IndexFunc(limit, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+			num, unit = limit[:i], limit[i:]
+		}
+		n, err := strconv.ParseInt(num, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("quota %q: invalid limit", entry)
+		}
+		switch unit {
+		case "req":
+			q.Requests = n
+		case "tok":
+			q.Tokens = n
+		default:
+			return nil, fmt.Errorf("quota %q: limit unit must be req or tok", entry)
+		}
+		quotas[key] = append(quotas[key], q)
+	}
+	return quotas, nil
+}
+
+// QuotaError reports an exhausted quota.
+type QuotaError struct {
+	Quota    Quota
+	ResetsAt time.Time
+}
+
+func (e *QuotaError) Error() string {
+	limit := fmt.Sprintf("%d requests", e.Quota.Requests)
+	if e.Quota.Requests == 0 {
+		limit = fmt.Sprintf("%d tokens", e.Quota.Tokens)
+	}
+	return fmt.Sprintf("%s quota of %s exhausted for this API key; resets at %s",
+		e.Quota.Period, limit, e.ResetsAt.Format(time.RFC3339))
+}
+
+// periodUsage is a key's usage within the current window of one period.
+type periodUsage struct {
+	start time.Time
+	Usage
+}
+
+// QuotaStatus is a key's usage against one of its quotas.
+type QuotaStatus struct {
+	Period   string    `json:"period"`
+	Requests int64     `json:"requests"`
+	Tokens   int64     `json:"tokens"`
+	MaxReqs  int64     `json:"max_requests,omitempty"`
+	MaxToks  int64     `json:"max_tokens,omitempty"`
+	ResetsAt time.Time `json:"resets_at"`
+}
+
+// SetQuotas sets per-key quotas, keyed by API key fingerprint (see
+// clientKeyID) or "*" for the default. Keys aren't validated, so quotas
+// are advisory: a client sending a new bearer token starts afresh under
+// the default.
+func (t *UsageTracker) SetQuotas(quotas map[string][]Quota) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.quotas = quotas
+}
+
+// quotasFor returns the quotas applying to key. Must be called with mu held.
+func (t *UsageTracker) quotasFor(key string) []Quota {
+	if q, ok := t.quotas[key]; ok {
+		return q
+	}
+	return t.quotas[defaultQuotaKey]
+}
+
+// CheckQuota returns a *QuotaError if key has exhausted any of its quotas.
+func (t *UsageTracker) CheckQuota(key string) error {
+	return t.checkQuotaAt(key, time.Now())
+}
+
+func (t *UsageTracker) checkQuotaAt(key string, now time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, q := range t.quotasFor(key) {
+		u := t.periodUsageAt(key, q.Period, now)
+		if (q.Requests > 0 && u.Requests >= q.Requests) ||
+			(q.Tokens > 0 && u.PromptTokens+u.CompletionTokens >= q.Tokens) {
+			return &QuotaError{Quota: q, ResetsAt: q.Period.end(u.start)}
+		}
+	}
+	return nil
+}
+
+// Quotas returns usage against quota for every key that has quotas and has
+// used any of them in the current window.
+func (t *UsageTracker) Quotas() map[string][]QuotaStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	out := make(map[string][]QuotaStatus)
+	for key := range t.byPeriod {
+		for _, q := range t.quotasFor(key) {
+			u := t.periodUsageAt(key, q.Period, now)
+			if u.Requests == 0 {
+				continue
+			}
+			out[key] = append(out[key], QuotaStatus{
+				Period:   q.Period.String(),
+				Requests: u.Requests,
+				Tokens:   u.PromptTokens + u.CompletionTokens,
+				MaxReqs:  q.Requests,
+				MaxToks:  q.Tokens,
+				ResetsAt: q.Period.end(u.start),
+			})
+		}
+	}
+	return out
+}
+
+// periodUsageAt returns key's usage in the window of period containing now,
+// starting a new window if the previous one has ended. Must be called with
+// mu held.
+func (t *UsageTracker) periodUsageAt(key string, period QuotaPeriod, now time.Time) *periodUsage {
+	periods := t.byPeriod[key]
+	if periods == nil {
+		periods = make(map[QuotaPeriod]*periodUsage)
+		t.byPeriod[key] = periods
+	}
+	start := period.start(now)
+	u := periods[period]
+	if u == nil || !u.start.Equal(start) {
+		u = &periodUsage{start: start}
+		periods[period] = u
+	}
+	return u
+}
+
+// writeQuotaExceeded writes the 429 response sent when a key's quota is
+// exhausted.
+func writeQuotaExceeded(w http.ResponseWriter, qe *QuotaError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(qe.ResetsAt).Seconds())+1))
+	w.WriteHeader(http.StatusTooManyRequests)
+	fmt.Fprintf(w, `{"error":{"message":%q,"type":"insufficient_quota","code":"quota_exceeded"}}`, qe.Error())
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestParseQuotas(t *testing.T) {
+	quotas, err := ParseQuotas("*=1000req/day, key-1a2b3c4d=5000000tok/month, key-1a2b3c4d=50req/day")
+	if err != nil {
+		t.Fatalf("ParseQuotas() error: %v", err)
+	}
+	if got := quotas["*"]; len(got) != 1 || got[0] != (Quota{Period: QuotaDaily, Requests: 1000}) {
+		t.Errorf("default = %+v", got)
+	}
+	want := []Quota{{Period: QuotaMonthly, Tokens: 5000000}, {Period: QuotaDaily, Requests: 50}}
+	if got := quotas["key-1a2b3c4d"]; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("key quotas = %+v, want %+v", got, want)
+	}
+	for _, bad := range []string{"*=1000req", "*=1000req/week", "*=req/day", "*=10bytes/day", "=1req/day", "*=0req/day"} {
+		if _, err := ParseQuotas(bad); err == nil {
+			t.Errorf("ParseQuotas(%q) expected error", bad)
+		}
+	}
+}
+
+func TestUsageTrackerQuotas(t *testing.T) {
+	u := NewUsageTracker()
+	u.SetQuotas(map[string][]Quota{
+		"*":     {{Period: QuotaDaily, Requests: 2}},
+		"key-t": {{Period: QuotaMonthly, Tokens: 100}},
+	})
+	day1 := time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC)
+
+	u.recordAt("key-a", 1, "m", 10, 10, time.Second, day1)
+	if err := u.checkQuotaAt("key-a", day1); err != nil {
+		t.Fatalf("one of two requests used: %v", err)
+	}
+	u.recordAt("key-a", 1, "m", 10, 10, time.Second, day1)
+	var qe *QuotaError
+	if err := u.checkQuotaAt("key-a", day1); !errors.As(err, &qe) {
+		t.Fatalf("err = %v, want *QuotaError", err)
+	}
+	if want := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC); !qe.ResetsAt.Equal(want) {
+		t.Errorf("ResetsAt = %v, want %v", qe.ResetsAt, want)
+	}
+	if !strings.Contains(qe.Error(), "daily quota of 2 requests") {
+		t.Errorf("Error() = %q", qe.Error())
+	}
+	if err := u.checkQuotaAt("key-b", day1); err != nil {
+		t.Errorf("other key: %v", err)
+	}
+	// The daily window rolls over at midnight UTC.
+	if err := u.checkQuotaAt("key-a", day1.Add(2*time.Hour)); err != nil {
+		t.Errorf("next day: %v", err)
+	}
+
+	// Token quotas count prompt and completion tokens.
+	u.recordAt("key-t", 1, "m", 60, 30, time.Second, day1)
+	if err := u.checkQuotaAt("key-t", day1); err != nil {
+		t.Errorf("90 of 100 tokens used: %v", err)
+	}
+	u.recordAt("key-t", 1, "m", 5, 5, time.Second, day1)
+	if err := u.checkQuotaAt("key-t", day1); err == nil {
+		t.Error("100 of 100 tokens used: expected quota error")
+	}
+	if err := u.checkQuotaAt("key-t", day1.Add(2*time.Hour)); err != nil {
+		t.Errorf("next month: %v", err)
+	}
+}
+
+func TestReverseProxyQuotaExceeded(t *testing.T) {
+	backendSrv := fakeBackendServer(t)
+	defer backendSrv.Close()
+
+	be := makeBackend(1, true)
+	be.SetBaseURL(backendSrv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	usage := NewUsageTracker()
+	usage.SetQuotas(map[string][]Quota{"*": {{Period: QuotaDaily, Requests: 1}}})
+	handler := NewReverseProxy(bal, nil, WithUsage(usage))
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{}"))
+		req.Header.Set("Authorization", "Bearer sk-team")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := send(); rec.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d, want 200", rec.Code)
+	}
+	rec := send()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status = %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error.Code != "quota_exceeded" || !strings.Contains(body.Error.Message, "resets at") {
+		t.Errorf("error = %+v", body.Error)
+	}
+	if got := usage.Quotas(); len(got) != 1 {
+		t.Errorf("Quotas() = %+v, want one key", got)
+	}
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// RecentRequest summarizes one proxied request.
+type RecentRequest struct {
+	Time           time.Time
+	RequestID      string
+	ClientAddr     string
+	Method         string
+	Path           string
+	Model          string // empty if the request named none
+	BackendID      int    // 0 if no backend was picked
+	Status         int
+	UpstreamStatus int // 0 if the backend never responded
+	Bytes          int64
+	Duration       time.Duration
+	TTFT           time.Duration // time to first SSE data chunk; 0 if not streamed
+}
+
+// RecentRequests keeps a summary of the last N proxied requests, for
+// browsing in the TUI instead of grepping the log. Safe for concurrent use.
+type RecentRequests struct {
+	mu      sync.Mutex
+	entries []RecentRequest // ring buffer
+	next    int             // index of the next slot to write
+	full    bool            // true once the ring has wrapped
+}
+
+// NewRecentRequests creates a buffer holding the last n requests.
+func NewRecentRequests(n int) *RecentRequests {
+	return &RecentRequests{entries: make([]RecentRequest, max(n, 1))}
+}
+
+// WithRecentRequests records a summary of every request into rr.
+func WithRecentRequests(rr *RecentRequests) Option {
+	return func(h *handler) {
+		h.recent = rr
+	}
+}
+
+// Add stores a request, evicting the oldest.
+func (rr *RecentRequests) Add(e RecentRequest) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.entries[rr.next] = e
+	rr.next = (rr.next + 1) % len(rr.entries)
+	if rr.next == 0 {
+		rr.full = true
+	}
+}
+
+// Recent returns the stored requests, newest first.
+func (rr *RecentRequests) Recent() []RecentRequest {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	n := rr.next
+	if rr.full {
+		n = len(rr.entries)
+	}
+	out := make([]RecentRequest, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, rr.entries[(rr.next-i+len(rr.entries))%len(rr.entries)])
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+func TestRecentRequestsRingBuffer(t *testing.T) {
+	rr := NewRecentRequests(2)
+	if got := rr.Recent(); len(got) != 0 {
+		t.Fatalf("Recent() = %v, want empty", got)
+	}
+	for _, p := range []string{"/a", "/b", "/c"} {
+		rr.Add(RecentRequest{Path: p})
+	}
+	got := rr.Recent()
+	if len(got) != 2 || got[0].Path != "/c" || got[1].Path != "/b" {
+		t.Errorf("Recent() = %+v, want /c then /b", got)
+	}
+}
+
+func TestReverseProxyRecordsRecentRequests(t *testing.T) {
+	srv := sseBackendServer(t)
+	defer srv.Close()
+	be := backend.NewBackend(&vast.Instance{ID: 7, ModelName: "llama"}, "", nil, "")
+	be.SetBaseURL(srv.URL)
+	be.SetHealthy(true)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	rr := NewRecentRequests(10)
+	handler := NewReverseProxy(bal, nil, WithRecentRequests(rr))
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"qwen","stream":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := rr.Recent()
+	if len(got) != 1 {
+		t.Fatalf("recorded %d requests, want 1", len(got))
+	}
+	e := got[0]
+	if e.Path != "/v1/chat/completions" || e.Model != "qwen" || e.BackendID != 7 ||
+		e.Status != http.StatusOK || e.UpstreamStatus != http.StatusOK || e.RequestID == "" {
+		t.Errorf("entry = %+v", e)
+	}
+	if e.TTFT <= 0 || e.Duration < e.TTFT {
+		t.Errorf("ttft = %v, duration = %v", e.TTFT, e.Duration)
+	}
+
+	// Requests rejected before reaching a backend are recorded too.
+	bal.SetPaused(true)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/models", nil))
+	if e := rr.Recent()[0]; e.BackendID != 0 || e.Status != http.StatusServiceUnavailable {
+		t.Errorf("paused entry = %+v", e)
+	}
+}
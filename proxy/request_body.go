@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxInspectedBody bounds the request bodies the proxy buffers to read
+// their JSON fields. Larger requests are rejected with 413.
+const maxInspectedBody = 64 << 20
+
+// requestBody is an inference request's JSON body. It is read and parsed
+// at most once per request, on first use, and only if a feature that
+// looks at the body is enabled. r.Body stays readable for the backend.
+type requestBody struct {
+	w http.ResponseWriter
+	r *http.Request
+
+	loaded bool
+	raw    []byte
+	err    error // reading failed
+	fields struct {
+		Model       string          `json:"model"`
+		Stream      bool            `json:"stream"`
+		Temperature *float64        `json:"temperature"`
+		Messages    json.RawMessage `json:"messages"`
+		Prompt      json.RawMessage `json:"prompt"`
+		Input       json.RawMessage `json:"input"`
+	}
+	parsed bool // fields were decoded from a JSON object
+}
+
+func newRequestBody(w http.ResponseWriter, r *http.Request) *requestBody {
+	return &requestBody{w: w, r: r}
+}
+
+// load reads and parses the body the first time it is called.
+func (b *requestBody) load() {
+	if b.loaded {
+		return
+	}
+	b.loaded = true
+	r := b.r
+	if r.Body == nil || r.Body == http.NoBody {
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		if mt, _, _ := mime.ParseMediaType(ct); !strings.Contains(mt, "json") {
+			return
+		}
+	}
+	b.raw, b.err = io.ReadAll(http.MaxBytesReader(b.w, r.Body, maxInspectedBody))
+	r.Body = io.NopCloser(bytes.NewReader(b.raw))
+	if b.err == nil {
+		b.parsed = json.Unmarshal(b.raw, &b.fields) == nil
+	}
+}
+
+// replace makes raw the request's body, e.g. once a field was rewritten.
+func (b *requestBody) replace(raw []byte) {
+	*b = requestBody{w: b.w, r: b.r, loaded: true, raw: raw}
+	b.parsed = json.Unmarshal(raw, &b.fields) == nil
+	b.r.Body = io.NopCloser(bytes.NewReader(raw))
+	b.r.ContentLength = int64(len(raw))
+	b.r.Header.Set("Content-Length", strconv.Itoa(len(raw)))
+}
+
+// bytes returns the raw body, or nil if it isn't JSON or couldn't be read.
+func (b *requestBody) bytes() []byte {
+	b.load()
+	if b.err != nil {
+		return nil
+	}
+	return b.raw
+}
+
+// model returns the request's "model" field.
+func (b *requestBody) model() string {
+	b.load()
+	return b.fields.Model
+}
+
+// streams reports whether the request asks for a streamed response.
+func (b *requestBody) streams() bool {
+	b.load()
+	return b.parsed && b.fields.Stream
+}
+
+// deterministic reports whether the request asks for a non-streamed
+// response at temperature 0.
+func (b *requestBody) deterministic() bool {
+	b.load()
+	t := b.fields.Temperature
+	return b.parsed && !b.fields.Stream && t != nil && *t == 0
+}
+
+// promptTokens estimates the prompt size from the text under "messages",
+// "prompt" and "input". It returns 0 for requests without a JSON body.
+func (b *requestBody) promptTokens() int64 {
+	b.load()
+	if !b.parsed {
+		return 0
+	}
+	chars := 0
+	for _, raw := range []json.RawMessage{b.fields.Messages, b.fields.Prompt, b.fields.Input} {
+		var v any
+		if raw != nil && json.Unmarshal(raw, &v) == nil {
+			chars += textLen(v)
+		}
+	}
+	return estimateTokens(chars)
+}
+
+// tooLarge reports whether the body was read and exceeded
+// maxInspectedBody.
+func (b *requestBody) tooLarge() bool {
+	var mbe *http.MaxBytesError
+	return errors.As(b.err, &mbe)
+}
+
+// writeRequestTooLarge writes the 413 sent for bodies over
+// maxInspectedBody.
+func writeRequestTooLarge(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	w.Write([]byte(`{"error":{"message":"request body too large","type":"invalid_request_error"}}`))
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestRequestBody(t *testing.T) {
+	for _, tt := range []struct {
+		body          string
+		model         string
+		streams       bool
+		deterministic bool
+	}{
+		{`{"model":"m","stream":true}`, "m", true, false},
+		{`{"temperature":0}`, "", false, true},
+		{`{"temperature":0.0,"stream":false}`, "", false, true},
+		{`{"temperature":0,"stream":true}`, "", true, false},
+		{`{"temperature":0.7}`, "", false, false},
+		{`{}`, "", false, false},
+		{`not json`, "", false, false},
+	} {
+		r := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.body))
+		rb := newRequestBody(httptest.NewRecorder(), r)
+		if got := rb.model(); got != tt.model {
+			t.Errorf("%s: model() = %q, want %q", tt.body, got, tt.model)
+		}
+		if got := rb.streams(); got != tt.streams {
+			t.Errorf("%s: streams() = %v, want %v", tt.body, got, tt.streams)
+		}
+		if got := rb.deterministic(); got != tt.deterministic {
+			t.Errorf("%s: deterministic() = %v, want %v", tt.body, got, tt.deterministic)
+		}
+		if rest, _ := io.ReadAll(r.Body); string(rest) != tt.body {
+			t.Errorf("body not restored: %q", rest)
+		}
+	}
+}
+
+func TestRequestBodySkipsNonJSON(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+	r.Header.Set("Content-Type", "text/plain")
+	if got := newRequestBody(httptest.NewRecorder(), r).model(); got != "" {
+		t.Errorf("model() = %q for a text/plain body, want none", got)
+	}
+}
+
+func TestRequestBodyPromptTokens(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"m","messages":[{"role":"user","content":"12345678"}]}`))
+	if got := newRequestBody(httptest.NewRecorder(), r).promptTokens(); got != 2 {
+		t.Errorf("promptTokens() = %d, want 2", got)
+	}
+}
+
+func TestHandlerRejectsOversizedBody(t *testing.T) {
+	srv := fakeBackendServer(t)
+	defer srv.Close()
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithContextRouting())
+
+	body := `{"prompt":"` + strings.Repeat("x", maxInspectedBody) + `"}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/completions", strings.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", rec.Code)
+	}
+}
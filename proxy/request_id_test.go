@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"abc-123", true},
+		{"", false},
+		{"has space", false},
+		{"new\nline", false},
+		{strings.Repeat("x", maxRequestIDLen+1), false},
+	}
+	for _, tt := range tests {
+		if got := validRequestID(tt.id); got != tt.want {
+			t.Errorf("validRequestID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestNewRequestIDUnique(t *testing.T) {
+	a, b := newRequestID(), newRequestID()
+	if a == b || len(a) != 32 {
+		t.Errorf("ids = %q, %q", a, b)
+	}
+}
+
+func TestReverseProxyRequestIDPropagation(t *testing.T) {
+	var gotID string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID = r.Header.Get(RequestIDHeader)
+		w.Header().Set(RequestIDHeader, "backend-own-id")
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	inst := &vast.Instance{ID: 1}
+	be := backend.NewBackend(inst, "", nil, "")
+	be.SetBaseURL(srv.URL)
+	be.SetHealthy(true)
+
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil)
+
+	// Incoming ID is honored.
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	req.Header.Set(RequestIDHeader, "client-id-1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if gotID != "client-id-1" {
+		t.Errorf("backend saw %q, want client-id-1", gotID)
+	}
+	if got := rec.Header().Get(RequestIDHeader); got != "client-id-1" {
+		t.Errorf("response %s = %q, want client-id-1", RequestIDHeader, got)
+	}
+
+	// Missing ID is generated.
+	req = httptest.NewRequest("GET", "/v1/models", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	got := rec.Header().Get(RequestIDHeader)
+	if got == "" || got != gotID {
+		t.Errorf("response ID = %q, backend ID = %q; want equal and non-empty", got, gotID)
+	}
+}
+
+func TestReverseProxyRequestIDOnError(t *testing.T) {
+	handler := NewReverseProxy(NewBalancer(), nil)
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	if rec.Header().Get(RequestIDHeader) == "" {
+		t.Error("503 response should carry a request ID")
+	}
+}
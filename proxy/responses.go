@@ -0,0 +1,319 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// responsesPath is the OpenAI Responses API endpoint.
+const responsesPath = "/v1/responses"
+
+// WithResponsesTranslation serves POST /v1/responses by translating it to
+// /v1/chat/completions, for backends (e.g. older vLLM or SGLang builds) that
+// only implement chat completions. Both plain and streaming responses are
+// translated back into Responses API objects and events.
+func WithResponsesTranslation() Option {
+	return func(h *handler) {
+		h.translateResponses = true
+	}
+}
+
+// responsesRequest is the subset of a Responses API request that maps onto
+// chat completions.
+type responsesRequest struct {
+	Model           string          `json:"model"`
+	Input           json.RawMessage `json:"input"`
+	Instructions    string          `json:"instructions,omitempty"`
+	MaxOutputTokens *int            `json:"max_output_tokens,omitempty"`
+	Temperature     *float64        `json:"temperature,omitempty"`
+	TopP            *float64        `json:"top_p,omitempty"`
+	Stream          bool            `json:"stream,omitempty"`
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model         string        `json:"model,omitempty"`
+	Messages      []chatMessage `json:"messages"`
+	MaxTokens     *int          `json:"max_tokens,omitempty"`
+	Temperature   *float64      `json:"temperature,omitempty"`
+	TopP          *float64      `json:"top_p,omitempty"`
+	Stream        bool          `json:"stream,omitempty"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options,omitempty"`
+}
+
+// translateResponsesRequest rewrites a Responses API request in place into
+// a chat completions request.
+func translateResponsesRequest(r *http.Request) error {
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return err
+	}
+	var req responsesRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return fmt.Errorf("invalid responses request: %w", err)
+	}
+	msgs, err := responsesInput(req.Input)
+	if err != nil {
+		return err
+	}
+	if req.Instructions != "" {
+		msgs = append([]chatMessage{{Role: "system", Content: req.Instructions}}, msgs...)
+	}
+
+	chat := chatRequest{
+		Model:       req.Model,
+		Messages:    msgs,
+		MaxTokens:   req.MaxOutputTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stream:      req.Stream,
+	}
+	if req.Stream {
+		chat.StreamOptions = &struct {
+			IncludeUsage bool `json:"include_usage"`
+		}{IncludeUsage: true}
+	}
+	body, err = json.Marshal(chat)
+	if err != nil {
+		return err
+	}
+
+	r.URL.Path = "/v1/chat/completions"
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	r.Header.Set("Content-Type", "application/json")
+	return nil
+}
+
+// responsesInput converts the "input" field, either a string or a list of
+// message items whose content is a string or a list of text parts.
+func responsesInput(raw json.RawMessage) ([]chatMessage, error) {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return []chatMessage{{Role: "user", Content: text}}, nil
+	}
+	var items []struct {
+		Type    string          `json:"type"`
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, fmt.Errorf("unsupported responses input: %w", err)
+	}
+	msgs := make([]chatMessage, 0, len(items))
+	for _, it := range items {
+		if it.Type != "" && it.Type != "message" {
+			return nil, fmt.Errorf("unsupported responses input item type %q", it.Type)
+		}
+		if json.Unmarshal(it.Content, &text) == nil {
+			msgs = append(msgs, chatMessage{Role: it.Role, Content: text})
+			continue
+		}
+		var parts []struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(it.Content, &parts); err != nil {
+			return nil, fmt.Errorf("unsupported responses content: %w", err)
+		}
+		var sb strings.Builder
+		for _, p := range parts {
+			sb.WriteString(p.Text)
+		}
+		msgs = append(msgs, chatMessage{Role: it.Role, Content: sb.String()})
+	}
+	return msgs, nil
+}
+
+// chatCompletion is the subset of a chat completion (or stream chunk) that
+// is translated back into a Responses API object.
+type chatCompletion struct {
+	ID      string `json:"id"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int64 `json:"prompt_tokens"`
+		CompletionTokens int64 `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// responseObject builds a completed Responses API object.
+func responseObject(id, model string, created int64, text string, usage map[string]int64) map[string]any {
+	resp := map[string]any{
+		"id":         "resp_" + id,
+		"object":     "response",
+		"created_at": created,
+		"model":      model,
+		"status":     "completed",
+		"output": []any{map[string]any{
+			"type":   "message",
+			"id":     "msg_" + id,
+			"status": "completed",
+			"role":   "assistant",
+			"content": []any{map[string]any{
+				"type":        "output_text",
+				"text":        text,
+				"annotations": []any{},
+			}},
+		}},
+	}
+	if usage != nil {
+		resp["usage"] = usage
+	}
+	return resp
+}
+
+func responsesUsage(c chatCompletion) map[string]int64 {
+	if c.Usage == nil {
+		return nil
+	}
+	return map[string]int64{
+		"input_tokens":  c.Usage.PromptTokens,
+		"output_tokens": c.Usage.CompletionTokens,
+		"total_tokens":  c.Usage.PromptTokens + c.Usage.CompletionTokens,
+	}
+}
+
+// translateResponsesResponse rewrites a chat completions response into a
+// Responses API response. Error responses and bodies that aren't chat
+// completions are passed through unchanged.
+func translateResponsesResponse(resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	if isEventStream(resp) {
+		pr, pw := io.Pipe()
+		go translateResponsesStream(resp.Body, pw)
+		resp.Body = pr
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	var c chatCompletion
+	if json.Unmarshal(body, &c) != nil {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		return nil
+	}
+	text := ""
+	if len(c.Choices) > 0 {
+		text = c.Choices[0].Message.Content
+	}
+	body, err = json.Marshal(responseObject(c.ID, c.Model, c.Created, text, responsesUsage(c)))
+	if err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+// translateResponsesStream converts chat completion chunks read from src
+// into Responses API stream events written to dst.
+func translateResponsesStream(src io.ReadCloser, dst *io.PipeWriter) {
+	defer src.Close()
+
+	var (
+		id, model string
+		created   int64
+		text      strings.Builder
+		usage     map[string]int64
+		started   bool
+	)
+	emit := func(event string, data map[string]any) error {
+		data["type"] = event
+		b, _ := json.Marshal(data)
+		_, err := fmt.Fprintf(dst, "event: %s\ndata: %s\n\n", event, b)
+		return err
+	}
+	itemFields := func() map[string]any {
+		return map[string]any{"item_id": "msg_" + id, "output_index": 0, "content_index": 0}
+	}
+
+	sc := bufio.NewScanner(src)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		payload, ok := strings.CutPrefix(sc.Text(), "data:")
+		if !ok {
+			continue
+		}
+		payload = strings.TrimSpace(payload)
+		if payload == "[DONE]" {
+			break
+		}
+		var c chatCompletion
+		if json.Unmarshal([]byte(payload), &c) != nil {
+			continue
+		}
+		if !started {
+			started = true
+			id, model, created = c.ID, c.Model, c.Created
+			if created == 0 {
+				created = time.Now().Unix()
+			}
+			inProgress := responseObject(id, model, created, "", nil)
+			inProgress["status"] = "in_progress"
+			inProgress["output"] = []any{}
+			if emit("response.created", map[string]any{"response": inProgress}) != nil {
+				return
+			}
+		}
+		if u := responsesUsage(c); u != nil {
+			usage = u
+		}
+		for _, ch := range c.Choices {
+			if ch.Delta.Content == "" {
+				continue
+			}
+			text.WriteString(ch.Delta.Content)
+			ev := itemFields()
+			ev["delta"] = ch.Delta.Content
+			if emit("response.output_text.delta", ev) != nil {
+				return
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		dst.CloseWithError(err)
+		return
+	}
+	if started {
+		done := itemFields()
+		done["text"] = text.String()
+		emit("response.output_text.done", done)
+		emit("response.completed", map[string]any{
+			"response": responseObject(id, model, created, text.String(), usage),
+		})
+	}
+	dst.Close()
+}
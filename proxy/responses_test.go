@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+func TestTranslateResponsesRequest(t *testing.T) {
+	body := `{"model":"m","instructions":"be brief","max_output_tokens":5,
+		"input":[{"role":"user","content":[{"type":"input_text","text":"hi"}]}]}`
+	r := httptest.NewRequest("POST", responsesPath, strings.NewReader(body))
+	if err := translateResponsesRequest(r); err != nil {
+		t.Fatal(err)
+	}
+	if r.URL.Path != "/v1/chat/completions" {
+		t.Errorf("path = %q", r.URL.Path)
+	}
+	var got chatRequest
+	json.NewDecoder(r.Body).Decode(&got)
+	want := []chatMessage{{Role: "system", Content: "be brief"}, {Role: "user", Content: "hi"}}
+	if got.Model != "m" || fmt.Sprint(got.Messages) != fmt.Sprint(want) || got.MaxTokens == nil || *got.MaxTokens != 5 {
+		t.Errorf("got %+v", got)
+	}
+
+	r = httptest.NewRequest("POST", responsesPath, strings.NewReader(`{"input":[{"type":"function_call"}]}`))
+	if err := translateResponsesRequest(r); err == nil {
+		t.Error("expected error for unsupported input item")
+	}
+}
+
+func responsesProxy(t *testing.T, h http.HandlerFunc) (http.Handler, *string) {
+	t.Helper()
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		h(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	be := backend.NewBackend(&vast.Instance{ID: 1}, "", nil, "")
+	be.SetBaseURL(srv.URL)
+	be.SetHealthy(true)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	return NewReverseProxy(bal, nil, WithResponsesTranslation()), &gotPath
+}
+
+func TestReverseProxyResponsesTranslation(t *testing.T) {
+	handler, gotPath := responsesProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"abc","model":"m","choices":[{"message":{"content":"hello"}}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`)
+	})
+
+	req := httptest.NewRequest("POST", responsesPath, strings.NewReader(`{"model":"m","input":"hi"}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if *gotPath != "/v1/chat/completions" {
+		t.Errorf("backend path = %q", *gotPath)
+	}
+	var got struct {
+		ID     string `json:"id"`
+		Object string `json:"object"`
+		Output []struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"output"`
+		Usage map[string]int `json:"usage"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	if got.ID != "resp_abc" || got.Object != "response" || got.Output[0].Content[0].Text != "hello" || got.Usage["output_tokens"] != 1 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestReverseProxyResponsesTranslationStream(t *testing.T) {
+	handler, _ := responsesProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, s := range []string{"hel", "lo"} {
+			fmt.Fprintf(w, "data: {\"id\":\"abc\",\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", s)
+		}
+		fmt.Fprint(w, "data: {\"id\":\"abc\",\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":2}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+
+	req := httptest.NewRequest("POST", responsesPath, strings.NewReader(`{"input":"hi","stream":true}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	body, _ := io.ReadAll(rec.Body)
+	var events []string
+	for line := range strings.Lines(string(body)) {
+		if ev, ok := strings.CutPrefix(strings.TrimSpace(line), "event: "); ok {
+			events = append(events, ev)
+		}
+	}
+	want := "[response.created response.output_text.delta response.output_text.delta response.output_text.done response.completed]"
+	if fmt.Sprint(events) != want {
+		t.Errorf("events = %v, want %s", events, want)
+	}
+	if !strings.Contains(string(body), `"text":"hello"`) {
+		t.Errorf("final text missing from %s", body)
+	}
+}
+
+func TestUsageCounterResponsesEvents(t *testing.T) {
+	c := &usageCounter{header: http.Header{"Content-Type": {"text/event-stream"}}}
+	c.Write([]byte("event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"a\"}\n\n"))
+	if _, completion, _ := c.result(); completion != 1 {
+		t.Errorf("completion = %d, want 1 from delta events", completion)
+	}
+	c.Write([]byte("event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"usage\":{\"input_tokens\":4,\"output_tokens\":9}}}\n\n"))
+	if prompt, completion, _ := c.result(); prompt != 4 || completion != 9 {
+		t.Errorf("got prompt=%d completion=%d, want 4, 9", prompt, completion)
+	}
+}
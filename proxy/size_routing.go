@@ -0,0 +1,32 @@
+package proxy
+
+import "github.com/shutej/vastproxy/backend"
+
+// SetSizeRouting sends long prompts (see LongPrompt) to the backends with
+// the most VRAM and keeps other requests off them where a smaller backend
+// is available, so a mixed fleet saves its big instances for big prompts.
+func (b *Balancer) SetSizeRouting(on bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sizeRouting = on
+}
+
+// bySize returns the backends with the most VRAM for long prompts, and the
+// rest for other requests. Backends whose VRAM is unknown count as small.
+// If every backend is the same size, all are returned.
+func bySize(backends []*backend.Backend, long bool) []*backend.Backend {
+	var largest float64
+	for _, be := range backends {
+		largest = max(largest, be.Instance.VRAM())
+	}
+	var out []*backend.Backend
+	for _, be := range backends {
+		if (be.Instance.VRAM() == largest) == long {
+			out = append(out, be)
+		}
+	}
+	if len(out) == 0 {
+		return backends
+	}
+	return out
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func sizedBackend(id int, gpu string, n int) *backend.Backend {
+	be := makeBackend(id, true)
+	be.Instance.GPUName = gpu
+	be.Instance.NumGPUs = n
+	return be
+}
+
+func TestSizeRouting(t *testing.T) {
+	bal := NewBalancer()
+	bal.SetSizeRouting(true)
+	bal.SetBackends([]*backend.Backend{
+		sizedBackend(1, "RTX 4090", 1),
+		sizedBackend(2, "H100 SXM", 8),
+		sizedBackend(3, "Mystery GPU", 1),
+	})
+
+	for range 4 {
+		be, err := bal.Pick(LongPrompt())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if be.Instance.ID != 2 {
+			t.Errorf("long prompt routed to backend %d, want 2 (most VRAM)", be.Instance.ID)
+		}
+	}
+
+	seen := map[int]bool{}
+	for range 4 {
+		be, _ := bal.Pick()
+		seen[be.Instance.ID] = true
+	}
+	if seen[2] || !seen[1] || !seen[3] {
+		t.Errorf("short picks = %v, want backends 1 and 3 only", seen)
+	}
+}
+
+func TestSizeRoutingUniformFleet(t *testing.T) {
+	bal := NewBalancer()
+	bal.SetSizeRouting(true)
+	bal.SetBackends([]*backend.Backend{sizedBackend(1, "RTX 4090", 2), sizedBackend(2, "RTX 3090", 2)})
+
+	for _, opts := range [][]PickOption{nil, {LongPrompt()}} {
+		seen := map[int]bool{}
+		for range 2 {
+			be, _ := bal.Pick(opts...)
+			seen[be.Instance.ID] = true
+		}
+		if !seen[1] || !seen[2] {
+			t.Errorf("picks = %v (long=%v), want both backends in a same-size fleet", seen, opts != nil)
+		}
+	}
+}
+
+func TestSizeRoutingDisabled(t *testing.T) {
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{sizedBackend(1, "RTX 4090", 1), sizedBackend(2, "H100 SXM", 8)})
+
+	seen := map[int]bool{}
+	for range 2 {
+		be, _ := bal.Pick(LongPrompt())
+		seen[be.Instance.ID] = true
+	}
+	if !seen[1] || !seen[2] {
+		t.Errorf("picks = %v, want both backends with size routing off", seen)
+	}
+}
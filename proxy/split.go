@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// TrafficSplit divides traffic between groups of backends by instance
+// label, e.g. 90% to "stable" and 10% to "canary" for a gradual rollout.
+// Backends in no listed group get no traffic while a split is set.
+type TrafficSplit map[string]int // label -> percent of traffic
+
+// ParseTrafficSplit parses a split such as "stable=90,canary=10".
+func ParseTrafficSplit(s string) (TrafficSplit, error) {
+	out := make(TrafficSplit)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		label, raw, ok := strings.Cut(entry, "=")
+		label = strings.TrimSpace(label)
+		pct, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(raw, "%")))
+		if !ok || label == "" || err != nil {
+			return nil, fmt.Errorf("invalid entry %q, want label=percent", entry)
+		}
+		out[label] = pct
+	}
+	return out, out.validate()
+}
+
+// validate checks that the percentages are in range and add up to 100. An
+// empty split is valid and disables splitting.
+func (s TrafficSplit) validate() error {
+	total := 0
+	for label, pct := range s {
+		if pct < 0 || pct > 100 {
+			return fmt.Errorf("percent for %q must be between 0 and 100, got %d", label, pct)
+		}
+		total += pct
+	}
+	if len(s) > 0 && total != 100 {
+		return fmt.Errorf("percentages must add up to 100, got %d", total)
+	}
+	return nil
+}
+
+func (s TrafficSplit) String() string {
+	labels := make([]string, 0, len(s))
+	for label := range s {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for i, label := range labels {
+		labels[i] = fmt.Sprintf("%s=%d", label, s[label])
+	}
+	return strings.Join(labels, ",")
+}
+
+// SetTrafficSplit replaces the traffic split; an empty one routes to all
+// backends again. Sticky requests stay on their pinned backend regardless.
+func (b *Balancer) SetTrafficSplit(s TrafficSplit) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	split := make(TrafficSplit, len(s))
+	for label, pct := range s {
+		split[label] = pct
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.split = split
+	log.Printf("balancer: traffic split=%q", split.String())
+	return nil
+}
+
+// TrafficSplit returns a copy of the current traffic split.
+func (b *Balancer) TrafficSplit() TrafficSplit {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	out := make(TrafficSplit, len(b.split))
+	for label, pct := range b.split {
+		out[label] = pct
+	}
+	return out
+}
+
+// splitGroup draws a group according to the traffic split and returns its
+// backends. A group with no usable (non-ejected) backend is skipped and
+// its share spread over the others; if no group is usable, all backends
+// are returned. Must be called with mu held.
+func (b *Balancer) splitGroup(backends []*backend.Backend) []*backend.Backend {
+	if len(b.split) == 0 {
+		return backends
+	}
+	groups := make(map[string][]*backend.Backend)
+	usable := make(map[string]bool)
+	for _, be := range backends {
+		label := be.Instance.BaseLabel()
+		if _, ok := b.split[label]; ok {
+			groups[label] = append(groups[label], be)
+			usable[label] = usable[label] || !be.Ejected()
+		}
+	}
+	var labels []string
+	total := 0
+	for label := range usable {
+		if usable[label] && b.split[label] > 0 {
+			labels = append(labels, label)
+			total += b.split[label]
+		}
+	}
+	if total == 0 {
+		return backends
+	}
+	sort.Strings(labels)
+	r := rand.IntN(total)
+	for _, label := range labels {
+		if r -= b.split[label]; r < 0 {
+			return groups[label]
+		}
+	}
+	return backends // unreachable
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestParseTrafficSplit(t *testing.T) {
+	got, err := ParseTrafficSplit("stable=90, canary=10%")
+	if err != nil || !reflect.DeepEqual(got, TrafficSplit{"stable": 90, "canary": 10}) {
+		t.Errorf("ParseTrafficSplit() = %v, %v", got, err)
+	}
+	if got.String() != "canary=10,stable=90" {
+		t.Errorf("String() = %q", got.String())
+	}
+	for _, bad := range []string{"stable", "stable=x", "=100", "stable=90,canary=20", "stable=101,canary=-1"} {
+		if _, err := ParseTrafficSplit(bad); err == nil {
+			t.Errorf("ParseTrafficSplit(%q) succeeded", bad)
+		}
+	}
+}
+
+// labeled returns a healthy backend with the given ID and label.
+func labeled(id int, label string) *backend.Backend {
+	be := makeBackend(id, true)
+	be.Instance.Label = label
+	return be
+}
+
+func TestPickHonorsTrafficSplit(t *testing.T) {
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{labeled(1, "stable"), labeled(2, "stable:w=2"), labeled(3, "canary"), labeled(4, "other")})
+	if err := bal.SetTrafficSplit(TrafficSplit{"stable": 80, "canary": 20}); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]int{}
+	for range 2000 {
+		be, err := bal.Pick()
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[be.Instance.BaseLabel()]++
+	}
+	if seen["other"] != 0 {
+		t.Errorf("unlisted label picked %d times", seen["other"])
+	}
+	if seen["canary"] < 300 || seen["canary"] > 500 {
+		t.Errorf("canary picked %d of 2000 times, want about 400", seen["canary"])
+	}
+}
+
+func TestTrafficSplitSkipsUnusableGroup(t *testing.T) {
+	canary := labeled(2, "canary")
+	canary.Eject(time.Now().Add(time.Hour))
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{labeled(1, "stable"), canary, labeled(3, "other")})
+	bal.SetTrafficSplit(TrafficSplit{"stable": 50, "canary": 50})
+
+	for range 20 {
+		if be, _ := bal.Pick(); be.Instance.ID != 1 {
+			t.Fatalf("picked %d, want only the stable backend", be.Instance.ID)
+		}
+	}
+
+	// With no listed group available, everything is fair game again.
+	bal.SetTrafficSplit(TrafficSplit{"missing": 100})
+	seen := map[int]bool{}
+	for range 20 {
+		be, _ := bal.Pick()
+		seen[be.Instance.ID] = true
+	}
+	if !seen[1] || !seen[3] {
+		t.Errorf("picked %v, want all backends", seen)
+	}
+}
+
+func TestAdminTrafficSplit(t *testing.T) {
+	bal := NewBalancer()
+	srv := httptest.NewServer((&Admin{Balancer: bal}).Handler())
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/split", "application/json", strings.NewReader(`{"stable":90,"canary":10}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !reflect.DeepEqual(bal.TrafficSplit(), TrafficSplit{"stable": 90, "canary": 10}) {
+		t.Errorf("POST /split: status %d, split %v", resp.StatusCode, bal.TrafficSplit())
+	}
+
+	resp, err = http.Post(srv.URL+"/split", "application/json", strings.NewReader(`{"stable":90}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("split not adding up to 100: status = %d, want 400", resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/split")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got TrafficSplit
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil || got["canary"] != 10 {
+		t.Errorf("GET /split = %v, %v", got, err)
+	}
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ssePing is the SSE comment sent to keep a quiet stream alive; clients
+// ignore comment lines.
+const ssePing = ": ping\n\n"
+
+// WithSSEKeepAlive sends an SSE comment to the client whenever a stream has
+// been silent for interval, e.g. while the backend prefills a long prompt
+// before the first token, so intermediate proxies and client libraries
+// with idle timeouts don't drop the connection.
+func WithSSEKeepAlive(interval time.Duration) Option {
+	return func(h *handler) {
+		h.sseKeepAlive = interval
+	}
+}
+
+// keepAliveWriter wraps the client's ResponseWriter and, once an SSE
+// response has started, writes ssePing after every interval without
+// output. Pings only go between events. Writes are serialized, so stop
+// must be called before the handler returns.
+type keepAliveWriter struct {
+	http.ResponseWriter
+	interval time.Duration
+
+	mu      sync.Mutex
+	timer   *time.Timer // nil until an SSE response starts
+	tail    [2]byte     // last two bytes written, to find event boundaries
+	written int64
+	stopped bool
+}
+
+func newKeepAliveWriter(w http.ResponseWriter, interval time.Duration) *keepAliveWriter {
+	return &keepAliveWriter{ResponseWriter: w, interval: interval}
+}
+
+func (w *keepAliveWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.ResponseWriter.WriteHeader(code)
+	mt, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if code == http.StatusOK && mt == "text/event-stream" && !w.stopped && w.timer == nil {
+		w.timer = time.AfterFunc(w.interval, w.ping)
+	}
+}
+
+func (w *keepAliveWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err := w.ResponseWriter.Write(p)
+	w.record(p[:n])
+	if w.timer != nil {
+		w.timer.Reset(w.interval)
+	}
+	return n, err
+}
+
+// Flush implements http.Flusher for streaming (SSE) support.
+func (w *keepAliveWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flush()
+}
+
+// flush must be called with mu held.
+func (w *keepAliveWriter) flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// record notes the tail of what was written. Must be called with mu held.
+func (w *keepAliveWriter) record(p []byte) {
+	for _, c := range p {
+		w.tail[0], w.tail[1] = w.tail[1], c
+	}
+	w.written += int64(len(p))
+}
+
+// atBoundary reports whether the output so far ends between events. Must
+// be called with mu held.
+func (w *keepAliveWriter) atBoundary() bool {
+	return w.written == 0 || w.tail == [2]byte{'\n', '\n'}
+}
+
+func (w *keepAliveWriter) ping() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
+	if w.atBoundary() {
+		if _, err := w.ResponseWriter.Write([]byte(ssePing)); err != nil {
+			return // client gone
+		}
+		w.record([]byte(ssePing))
+		w.flush()
+	}
+	w.timer.Reset(w.interval)
+}
+
+// stop ends the pings, waiting for one in progress.
+func (w *keepAliveWriter) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// slowSSEServer streams an event stream that stays silent for prefill
+// before the first event and pauses for gap mid-event.
+func slowSSEServer(t *testing.T, prefill, gap time.Duration) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		flusher.Flush()
+		time.Sleep(prefill)
+		fmt.Fprint(w, "data: one")
+		flusher.Flush()
+		time.Sleep(gap)
+		fmt.Fprint(w, "\n\ndata: [DONE]\n\n")
+	}))
+}
+
+func TestSSEKeepAlivePingsBeforeFirstToken(t *testing.T) {
+	srv := slowSSEServer(t, 200*time.Millisecond, 0)
+	defer srv.Close()
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithSSEKeepAlive(30*time.Millisecond))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"stream":true}`)))
+	body := rec.Body.String()
+	if !strings.HasPrefix(body, ssePing) || !strings.HasSuffix(body, "data: one\n\ndata: [DONE]\n\n") {
+		t.Errorf("body = %q, want pings then the events", body)
+	}
+}
+
+func TestSSEKeepAliveOnlyBetweenEvents(t *testing.T) {
+	srv := slowSSEServer(t, 0, 200*time.Millisecond)
+	defer srv.Close()
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithSSEKeepAlive(30*time.Millisecond))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"stream":true}`)))
+	if body := rec.Body.String(); body != "data: one\n\ndata: [DONE]\n\n" {
+		t.Errorf("body = %q, want no ping inside an event", body)
+	}
+}
+
+func TestSSEKeepAliveIgnoresOtherResponses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprint(w, `{}`)
+	}))
+	defer srv.Close()
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithSSEKeepAlive(10*time.Millisecond))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`)))
+	if body := rec.Body.String(); body != `{}` {
+		t.Errorf("body = %q", body)
+	}
+}
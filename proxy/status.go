@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/shutej/vastproxy/vast"
+)
+
+// Status is a read-only snapshot of the fleet as the TUI shows it, for
+// scripts and dashboards.
+type Status struct {
+	Backends       int              `json:"backends"`
+	Healthy        int              `json:"healthy"`
+	ActiveRequests int64            `json:"active_requests"`
+	Paused         bool             `json:"paused"`
+	StickyPercent  float64          `json:"sticky_percent"`
+	StickyMisses   int              `json:"sticky_misses"`
+	Instances      []InstanceStatus `json:"instances"`
+}
+
+// InstanceStatus is one instance in a Status snapshot.
+type InstanceStatus struct {
+	ID             int           `json:"id"`
+	Name           string        `json:"name"`
+	State          string        `json:"state"`
+	StateSince     time.Time     `json:"state_since"`
+	GPUName        string        `json:"gpu_name"`
+	NumGPUs        int           `json:"num_gpus"`
+	Model          string        `json:"model,omitempty"`
+	Models         []string      `json:"models,omitempty"` // every model served, incl. LoRA variants
+	Engine         string        `json:"engine"`
+	ContextLength  int64         `json:"context_length,omitempty"`
+	Label          string        `json:"label,omitempty"`
+	DirectSSH      bool          `json:"direct_ssh"`
+	RTTMillis      float64       `json:"rtt_ms,omitempty"` // latest health check round trip
+	ActiveRequests int64         `json:"active_requests"`
+	ActiveStreams  int64         `json:"active_streams"`    // only counted while streams are limited
+	Ejected        bool          `json:"ejected,omitempty"` // skipped for its error rate
+	GPUs           []GPUStatus   `json:"gpus,omitempty"`
+	Load           *EngineStatus `json:"load,omitempty"`
+	StickyHits     int           `json:"sticky_hits"`
+	StickyMisses   int           `json:"sticky_misses"`
+}
+
+// GPUStatus is the utilization (percent) and temperature (°C) of one GPU.
+type GPUStatus struct {
+	Utilization float64 `json:"utilization"`
+	Temperature float64 `json:"temperature"`
+}
+
+// EngineStatus is the scheduler load reported by an instance's engine.
+type EngineStatus struct {
+	Running      int       `json:"running"`
+	Waiting      int       `json:"waiting"`
+	CacheHitRate float64   `json:"cache_hit_rate"`
+	KVCacheUsage float64   `json:"kv_cache_usage,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// FleetStatus builds a Status from the watcher's instances and the
+// balancer's backends. sticky may be nil.
+func FleetStatus(instances []vast.Instance, bal *Balancer, sticky *StickyStats) Status {
+	st := Status{
+		Backends:       bal.TotalCount(),
+		Healthy:        bal.HealthyCount(),
+		ActiveRequests: bal.ActiveRequests(),
+		Paused:         bal.Paused(),
+		Instances:      make([]InstanceStatus, 0, len(instances)),
+	}
+	var breakdown map[int]StickyBackendStats
+	if sticky != nil {
+		st.StickyPercent = sticky.Percent()
+		st.StickyMisses = sticky.Misses()
+		breakdown = sticky.Breakdown()
+	}
+	for _, inst := range instances {
+		is := InstanceStatus{
+			ID:           inst.ID,
+			Name:         inst.DisplayName(),
+			State:        inst.State.String(),
+			StateSince:   inst.StateChangedAt,
+			GPUName:      inst.GPUName,
+			NumGPUs:      inst.NumGPUs,
+			Model:        inst.ModelName,
+			Engine:       inst.Engine.String(),
+			Label:        inst.Label,
+			StickyHits:   breakdown[inst.ID].Hits,
+			StickyMisses: breakdown[inst.ID].Misses,
+		}
+		// Until the instance has been reached over SSH, fall back to the
+		// averages reported by the vast.ai API, as the TUI does.
+		if inst.GPUUtil != nil && inst.GPUTemp != nil {
+			is.GPUs = []GPUStatus{{Utilization: *inst.GPUUtil, Temperature: *inst.GPUTemp}}
+		}
+		if be := bal.Backend(inst.ID); be != nil {
+			is.ActiveRequests = be.ActiveRequests()
+			is.ActiveStreams = be.ActiveStreams()
+			is.Ejected = be.Ejected()
+			is.Models = be.Models()
+			is.ContextLength = be.ContextLength()
+			is.RTTMillis = float64(be.RTT()) / float64(time.Millisecond)
+			if u := be.LastGPUUpdate(); u != nil {
+				is.DirectSSH = u.IsDirect
+				is.GPUs = is.GPUs[:0]
+				for _, g := range u.GPUs {
+					is.GPUs = append(is.GPUs, GPUStatus{Utilization: g.Utilization, Temperature: g.Temperature})
+				}
+			}
+			if e := be.EngineStats(); e != nil {
+				is.Load = &EngineStatus{
+					Running:      e.Running,
+					Waiting:      e.Waiting,
+					CacheHitRate: e.CacheHitRate,
+					KVCacheUsage: e.KVCacheUsage,
+					UpdatedAt:    e.UpdatedAt,
+				}
+			}
+		}
+		st.Instances = append(st.Instances, is)
+	}
+	return st
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+func TestFleetStatus(t *testing.T) {
+	util, temp := 40.0, 60.0
+	instances := []vast.Instance{
+		{ID: 1, GPUName: "RTX 4090", NumGPUs: 2, State: vast.StateHealthy, ModelName: "llama"},
+		{ID: 2, GPUName: "A100", NumGPUs: 1, State: vast.StateConnecting, GPUUtil: &util, GPUTemp: &temp},
+	}
+	b1 := makeBackend(1, true)
+	b1.Acquire()
+	b1.SetLastGPUUpdate(&backend.GPUUpdate{
+		InstanceID: 1,
+		GPUs:       []backend.GPUMetric{{Utilization: 90, Temperature: 70}, {Utilization: 80, Temperature: 65}},
+		IsDirect:   true,
+	})
+	b1.SetEngineStats(&backend.EngineStats{Running: 3, Waiting: 1})
+	b1.SetRTT(42 * time.Millisecond)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{b1, makeBackend(2, false)})
+	sticky := NewStickyStats(time.Minute)
+	sticky.RecordPin(1, true)
+	sticky.Record(false)
+
+	st := FleetStatus(instances, bal, sticky)
+	if st.Backends != 2 || st.Healthy != 1 || st.StickyPercent != 50 {
+		t.Errorf("status = %+v", st)
+	}
+	if len(st.Instances) != 2 {
+		t.Fatalf("instances = %+v, want 2", st.Instances)
+	}
+	i1, i2 := st.Instances[0], st.Instances[1]
+	if i1.State != "HEALTHY" || i1.Model != "llama" || i1.ActiveRequests != 1 || !i1.DirectSSH || i1.StickyHits != 1 {
+		t.Errorf("instance 1 = %+v", i1)
+	}
+	if i1.RTTMillis != 42 {
+		t.Errorf("instance 1 rtt_ms = %v, want 42", i1.RTTMillis)
+	}
+	if len(i1.GPUs) != 2 || i1.GPUs[0].Utilization != 90 || i1.GPUs[1].Temperature != 65 {
+		t.Errorf("instance 1 GPUs = %+v, want SSH metrics", i1.GPUs)
+	}
+	if i1.Load == nil || i1.Load.Running != 3 || i1.Load.Waiting != 1 {
+		t.Errorf("instance 1 load = %+v", i1.Load)
+	}
+	// Without SSH metrics, the vast.ai API averages are reported.
+	if len(i2.GPUs) != 1 || i2.GPUs[0].Utilization != 40 || i2.Load != nil {
+		t.Errorf("instance 2 = %+v", i2)
+	}
+}
+
+func TestAdminStatus(t *testing.T) {
+	w := vast.NewWatcher(nil, time.Hour)
+	w.InjectInstance(&vast.Instance{ID: 7, State: vast.StateHealthy})
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{makeBackend(7, true)})
+
+	srv := httptest.NewServer((&Admin{Balancer: bal, Watcher: w}).Handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got Status
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Healthy != 1 || len(got.Instances) != 1 || got.Instances[0].ID != 7 {
+		t.Errorf("status = %+v", got)
+	}
+
+	rec := httptest.NewRecorder()
+	(&Admin{Balancer: bal}).Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/status", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status without watcher = %d, want 404", rec.Code)
+	}
+}
@@ -5,30 +5,68 @@ import (
 	"time"
 )
 
+// stickyBuckets is the number of time buckets the sliding window is split
+// into; for the default 5-minute window each bucket covers one second.
+const stickyBuckets = 300
+
 // StickyStats tracks the percentage of requests that present the
-// X-VastProxy-Instance header over a sliding time window.
+// X-VastProxy-Instance header over a sliding time window. Requests are
+// counted in a fixed ring of time buckets, so memory use doesn't grow with
+// the request rate.
 type StickyStats struct {
-	mu     sync.Mutex
-	window time.Duration
-	events []reqEvent
+	mu      sync.Mutex
+	width   time.Duration // time covered by one bucket
+	buckets [stickyBuckets]stickyBucket
+}
+
+// stickyBucket counts the requests in one slice of the window.
+type stickyBucket struct {
+	slot    int64 // time / width of the requests counted here
+	total   int
+	sticky  int
+	targets map[int]StickyBackendStats // pinned instance ID (0 if unparseable) → stats
 }
 
-type reqEvent struct {
-	at     time.Time
-	sticky bool
+// StickyBackendStats breaks down the sticky requests pinned to one instance.
+type StickyBackendStats struct {
+	Hits   int // served by the pinned instance
+	Misses int // rerouted because the instance was unknown or unhealthy
 }
 
 // NewStickyStats creates a StickyStats with the given sliding window duration.
 func NewStickyStats(window time.Duration) *StickyStats {
-	return &StickyStats{window: window}
+	return &StickyStats{width: max(window/stickyBuckets, 1)}
 }
 
 // Record records a request, noting whether it had the sticky header.
 func (s *StickyStats) Record(sticky bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.events = append(s.events, reqEvent{at: time.Now(), sticky: sticky})
-	s.pruneOlderThan(time.Now().Add(-s.window))
+	b := s.bucket(time.Now())
+	b.total++
+	if sticky {
+		b.sticky++
+	}
+}
+
+// RecordPin records a sticky request pinned to target (0 if the header
+// wasn't a valid instance ID), noting whether that instance served it.
+func (s *StickyStats) RecordPin(target int, hit bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.bucket(time.Now())
+	b.total++
+	b.sticky++
+	if b.targets == nil {
+		b.targets = make(map[int]StickyBackendStats)
+	}
+	st := b.targets[target]
+	if hit {
+		st.Hits++
+	} else {
+		st.Misses++
+	}
+	b.targets[target] = st
 }
 
 // Percent returns the percentage of requests with the sticky header
@@ -36,27 +74,72 @@ func (s *StickyStats) Record(sticky bool) {
 func (s *StickyStats) Percent() float64 {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.pruneOlderThan(time.Now().Add(-s.window))
 
-	if len(s.events) == 0 {
+	total, sticky := 0, 0
+	s.eachLive(func(b *stickyBucket) {
+		total += b.total
+		sticky += b.sticky
+	})
+	if total == 0 {
 		return -1
 	}
+	return float64(sticky) / float64(total) * 100
+}
+
+// Misses returns the number of sticky requests over the sliding window
+// whose pinned instance was unknown or unhealthy.
+func (s *StickyStats) Misses() int {
 	n := 0
-	for _, e := range s.events {
-		if e.sticky {
-			n++
-		}
+	for _, st := range s.Breakdown() {
+		n += st.Misses
 	}
-	return float64(n) / float64(len(s.events)) * 100
+	return n
+}
+
+// Breakdown returns per-instance sticky stats over the sliding window,
+// keyed by pinned instance ID. Misses with an unparseable pin are under 0.
+func (s *StickyStats) Breakdown() map[int]StickyBackendStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[int]StickyBackendStats)
+	s.eachLive(func(b *stickyBucket) {
+		for id, st := range b.targets {
+			sum := out[id]
+			sum.Hits += st.Hits
+			sum.Misses += st.Misses
+			out[id] = sum
+		}
+	})
+	return out
+}
+
+// ForInstance returns the sticky hits and misses for one instance over the
+// sliding window.
+func (s *StickyStats) ForInstance(id int) (hits, misses int) {
+	st := s.Breakdown()[id]
+	return st.Hits, st.Misses
 }
 
-// pruneOlderThan removes events before cutoff. Must be called with mu held.
-func (s *StickyStats) pruneOlderThan(cutoff time.Time) {
-	i := 0
-	for i < len(s.events) && s.events[i].at.Before(cutoff) {
-		i++
+// bucket returns the bucket for time t, clearing it if it last counted an
+// older slot. Must be called with mu held.
+func (s *StickyStats) bucket(t time.Time) *stickyBucket {
+	slot := t.UnixNano() / int64(s.width)
+	b := &s.buckets[slot%stickyBuckets]
+	if b.slot != slot {
+		clear(b.targets)
+		*b = stickyBucket{slot: slot, targets: b.targets}
 	}
-	if i > 0 {
-		s.events = s.events[i:]
+	return b
+}
+
+// eachLive calls fn for every bucket inside the sliding window. Must be
+// called with mu held.
+func (s *StickyStats) eachLive(fn func(*stickyBucket)) {
+	now := time.Now().UnixNano() / int64(s.width)
+	for i := range s.buckets {
+		if b := &s.buckets[i]; b.total > 0 && now-b.slot < stickyBuckets {
+			fn(b)
+		}
 	}
 }
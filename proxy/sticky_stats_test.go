@@ -64,3 +64,69 @@ func TestStickyStatsWindowExpiry(t *testing.T) {
 		t.Errorf("Percent() after new request = %v, want 0", got)
 	}
 }
+
+func TestStickyStatsBreakdown(t *testing.T) {
+	s := NewStickyStats(5 * time.Minute)
+	s.RecordPin(1, true)
+	s.RecordPin(1, true)
+	s.RecordPin(1, false)
+	s.RecordPin(2, true)
+	s.RecordPin(0, false) // unparseable pin
+	s.Record(false)
+
+	if got := s.Misses(); got != 2 {
+		t.Errorf("Misses() = %d, want 2", got)
+	}
+	got := s.Breakdown()
+	want := map[int]StickyBackendStats{1: {Hits: 2, Misses: 1}, 2: {Hits: 1}, 0: {Misses: 1}}
+	if len(got) != len(want) {
+		t.Fatalf("Breakdown() = %v, want %v", got, want)
+	}
+	for id, w := range want {
+		if got[id] != w {
+			t.Errorf("Breakdown()[%d] = %+v, want %+v", id, got[id], w)
+		}
+	}
+	if hits, misses := s.ForInstance(1); hits != 2 || misses != 1 {
+		t.Errorf("ForInstance(1) = %d, %d, want 2, 1", hits, misses)
+	}
+	if hits, misses := s.ForInstance(3); hits != 0 || misses != 0 {
+		t.Errorf("ForInstance(3) = %d, %d, want 0, 0", hits, misses)
+	}
+	if got := s.Percent(); got < 83 || got > 84 {
+		t.Errorf("Percent() = %v, want ~83.3", got)
+	}
+}
+
+func TestStickyStatsBreakdownExpiry(t *testing.T) {
+	s := NewStickyStats(100 * time.Millisecond)
+	s.RecordPin(1, false)
+	time.Sleep(150 * time.Millisecond)
+
+	if got := s.Misses(); got != 0 {
+		t.Errorf("Misses() after expiry = %d, want 0", got)
+	}
+	s.RecordPin(2, true)
+	if got := s.Breakdown(); len(got) != 1 || got[2].Hits != 1 {
+		t.Errorf("Breakdown() = %v, want only instance 2", got)
+	}
+}
+
+func TestStickyStatsBoundedBuckets(t *testing.T) {
+	s := NewStickyStats(5 * time.Minute)
+	for i := range 10000 {
+		s.Record(i%2 == 0)
+	}
+	if got := s.Percent(); got != 50 {
+		t.Errorf("Percent() = %v, want 50", got)
+	}
+	live := 0
+	for _, b := range s.buckets {
+		if b.total > 0 {
+			live++
+		}
+	}
+	if live > 2 {
+		t.Errorf("%d buckets in use for a burst, want at most 2", live)
+	}
+}
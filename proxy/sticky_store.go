@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// stickyStoreMaxAge is how long an instance ID stays valid in the store
+// without serving a request, so instances destroyed while the proxy was
+// down don't linger in the file forever.
+const stickyStoreMaxAge = 24 * time.Hour
+
+// stickyStoreRefresh limits how often a known ID's last-seen time is
+// written back to disk.
+const stickyStoreRefresh = time.Minute
+
+// StickyStore persists the set of instance IDs that clients may be pinned
+// to, so that after a proxy restart sticky requests wait for their instance
+// to reconnect instead of being scattered across the fleet (which would
+// re-pin every session and throw away its KV cache).
+type StickyStore struct {
+	path string
+
+	mu  sync.Mutex
+	ids map[int]time.Time // instance ID → last time it served a request
+}
+
+// NewStickyStore loads the store at path. A missing file yields an empty
+// store; entries older than stickyStoreMaxAge are dropped.
+func NewStickyStore(path string) (*StickyStore, error) {
+	s := &StickyStore{path: path, ids: make(map[int]time.Time)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved map[int]time.Time
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	cutoff := time.Now().Add(-stickyStoreMaxAge)
+	for id, at := range saved {
+		if at.After(cutoff) {
+			s.ids[id] = at
+		}
+	}
+	return s, nil
+}
+
+// Known reports whether id is a valid pin target.
+func (s *StickyStore) Known(id int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.ids[id]
+	return ok
+}
+
+// Remember records that id served a request and saves the store if the ID
+// is new or its saved last-seen time is stale.
+func (s *StickyStore) Remember(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if at, ok := s.ids[id]; ok && now.Sub(at) < stickyStoreRefresh {
+		return
+	}
+	s.ids[id] = now
+	s.save()
+}
+
+// Forget removes id, e.g. once its instance is gone for good.
+func (s *StickyStore) Forget(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ids[id]; !ok {
+		return
+	}
+	delete(s.ids, id)
+	s.save()
+}
+
+// save atomically writes the store to disk. Must be called with mu held.
+func (s *StickyStore) save() {
+	data, err := json.Marshal(s.ids)
+	if err != nil {
+		log.Printf("sticky store: marshal: %v", err)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".sticky-*")
+	if err != nil {
+		log.Printf("sticky store: save %s: %v", s.path, err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("sticky store: save %s: %v", s.path, err)
+	}
+}
+
+// WithStickyStore remembers which instances have served requests in store.
+// A sticky request pinned to a remembered instance that isn't healthy yet
+// (e.g. still reconnecting after a restart) waits up to wait for it before
+// falling back to another backend.
+func WithStickyStore(store *StickyStore, wait time.Duration) Option {
+	return func(h *handler) {
+		h.stickyStore = store
+		h.stickyWait = wait
+	}
+}
+
+// stickyPollInterval is how often a waiting sticky request re-checks its
+// pinned backend.
+const stickyPollInterval = 100 * time.Millisecond
+
+// waitForPin waits up to h.stickyWait for the backend with the given ID to
+// become healthy, returning nil if it doesn't or ctx is done first.
+func (h *handler) waitForPin(ctx context.Context, id int) *backend.Backend {
+	timer := time.NewTimer(h.stickyWait)
+	defer timer.Stop()
+	ticker := time.NewTicker(stickyPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+			return nil
+		case <-ticker.C:
+			if be, err := h.balancer.PickByID(id); err == nil {
+				return be
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestStickyStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sticky.json")
+	s, err := NewStickyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Remember(1)
+	s.Remember(2)
+	s.Forget(2)
+
+	s, err = NewStickyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Known(1) {
+		t.Error("instance 1 should survive a reload")
+	}
+	if s.Known(2) {
+		t.Error("forgotten instance 2 should not survive a reload")
+	}
+}
+
+func TestStickyStoreDropsExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sticky.json")
+	old := time.Now().Add(-stickyStoreMaxAge - time.Hour).Format(time.RFC3339)
+	recent := time.Now().Format(time.RFC3339)
+	data := `{"1":"` + old + `","2":"` + recent + `"}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStickyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Known(1) || !s.Known(2) {
+		t.Errorf("Known(1)=%v Known(2)=%v, want false true", s.Known(1), s.Known(2))
+	}
+}
+
+func TestStickyStoreBadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sticky.json")
+	os.WriteFile(path, []byte("not json"), 0644)
+	if _, err := NewStickyStore(path); err == nil {
+		t.Error("expected error for malformed store")
+	}
+}
+
+func TestReverseProxyStickyWaitsForKnownInstance(t *testing.T) {
+	backendSrv := fakeBackendServer(t)
+	defer backendSrv.Close()
+
+	store, _ := NewStickyStore(filepath.Join(t.TempDir(), "sticky.json"))
+	store.Remember(1)
+
+	// After a restart, instance 1 is still connecting while 2 is up.
+	pinned := makeBackend(1, false)
+	pinned.SetBaseURL(backendSrv.URL)
+	other := makeBackend(2, true)
+	other.SetBaseURL(backendSrv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{pinned, other})
+	handler := NewReverseProxy(bal, nil, WithStickyStore(store, 5*time.Second))
+
+	time.AfterFunc(200*time.Millisecond, func() { pinned.SetHealthy(true) })
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	req.Header.Set(StickyHeader, "1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get(StickyHeader); got != "1" {
+		t.Errorf("response %s = %q, want 1", StickyHeader, got)
+	}
+
+	// Unknown pins fall back immediately.
+	req = httptest.NewRequest("GET", "/v1/models", nil)
+	req.Header.Set(StickyHeader, "3")
+	rec = httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(rec, req)
+	if time.Since(start) > time.Second {
+		t.Errorf("unknown pin waited %v", time.Since(start))
+	}
+	served, _ := strconv.Atoi(rec.Header().Get(StickyHeader))
+	if !store.Known(served) {
+		t.Errorf("instance %d served a request and should be remembered", served)
+	}
+}
+
+func TestReverseProxyStickyWaitTimesOut(t *testing.T) {
+	backendSrv := fakeBackendServer(t)
+	defer backendSrv.Close()
+
+	store, _ := NewStickyStore(filepath.Join(t.TempDir(), "sticky.json"))
+	store.Remember(1)
+	other := makeBackend(2, true)
+	other.SetBaseURL(backendSrv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{other})
+	handler := NewReverseProxy(bal, nil, WithStickyStore(store, 150*time.Millisecond))
+
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	req.Header.Set(StickyHeader, "1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get(StickyHeader); got != "2" {
+		t.Errorf("response %s = %q, want fallback to 2", StickyHeader, got)
+	}
+}
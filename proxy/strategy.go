@@ -0,0 +1,204 @@
+package proxy
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// Strategy selects how the balancer chooses among healthy backends.
+type Strategy int
+
+const (
+	StrategyRoundRobin Strategy = iota // rotate through backends (default)
+	StrategyQueueDepth                 // backend with the shortest inference queue
+	StrategyPowerOfTwo                 // less busy of two random backends
+	StrategyLatency                    // random, weighted inversely to latency
+)
+
+// ParseStrategy parses "round-robin", "queue-depth", "p2c" or "latency".
+func ParseStrategy(s string) (Strategy, error) {
+	switch strings.ToLower(s) {
+	case "", "round-robin", "roundrobin":
+		return StrategyRoundRobin, nil
+	case "queue-depth", "queue":
+		return StrategyQueueDepth, nil
+	case "p2c", "power-of-two":
+		return StrategyPowerOfTwo, nil
+	case "latency", "ewma":
+		return StrategyLatency, nil
+	default:
+		return 0, fmt.Errorf("unknown balancing strategy %q", s)
+	}
+}
+
+func (s Strategy) String() string {
+	switch s {
+	case StrategyQueueDepth:
+		return "queue-depth"
+	case StrategyPowerOfTwo:
+		return "p2c"
+	case StrategyLatency:
+		return "latency"
+	default:
+		return "round-robin"
+	}
+}
+
+// SetStrategy sets how backends are chosen.
+func (b *Balancer) SetStrategy(s Strategy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.strategy = s
+}
+
+// choose picks one of the healthy candidates according to the strategy and
+// pick options, advancing counter. It returns the pick and the counter
+// value used. Must be called with mu held.
+func (b *Balancer) choose(healthy []*backend.Backend, counter *atomic.Uint64, opts []PickOption) (*backend.Backend, uint64) {
+	var hints pickHints
+	for _, opt := range opts {
+		opt(&hints)
+	}
+	idx := counter.Add(1) - 1
+	healthy = b.splitGroup(healthy)
+	if hints.promptTokens > 0 {
+		healthy = withContextFor(healthy, hints.promptTokens)
+	}
+	if b.sizeRouting {
+		healthy = bySize(healthy, hints.longPrompt)
+	}
+	if hints.longPrompt && b.kvCacheLimit > 0 {
+		healthy = withKVHeadroom(healthy, b.kvCacheLimit)
+	}
+	healthy = notEjected(healthy)
+	healthy = b.notBusy(healthy)
+	switch b.strategy {
+	case StrategyQueueDepth:
+		healthy = shortestQueues(healthy)
+	case StrategyPowerOfTwo:
+		return powerOfTwo(healthy), idx
+	case StrategyLatency:
+		if be := byLatency(healthy); be != nil {
+			return be, idx
+		}
+	case StrategyRoundRobin:
+		healthy = weighted(healthy)
+	}
+	return healthy[idx%uint64(len(healthy))], idx
+}
+
+// powerOfTwo samples two distinct backends at random and returns the one
+// with fewer in-flight requests. Unlike shortestQueues it looks at only
+// two backends, yet keeps the busiest one nearly as idle as a full scan.
+func powerOfTwo(backends []*backend.Backend) *backend.Backend {
+	n := len(backends)
+	if n == 1 {
+		return backends[0]
+	}
+	i := rand.IntN(n)
+	j := rand.IntN(n - 1)
+	if j >= i {
+		j++
+	}
+	a, b := backends[i], backends[j]
+	if b.ActiveRequests() < a.ActiveRequests() {
+		return b
+	}
+	return a
+}
+
+// maxWeight bounds a backend's round-robin weight, and so the size of the
+// rotation weighted builds.
+const maxWeight = 64
+
+// weighted returns the rotation for weighted round-robin: each backend
+// appears as many times as its weight, interleaved so that heavy backends'
+// turns are spread out rather than back to back. Backends all of weight 1
+// are returned as is.
+func weighted(backends []*backend.Backend) []*backend.Backend {
+	heaviest := 1
+	for _, be := range backends {
+		heaviest = max(heaviest, min(be.Weight(), maxWeight))
+	}
+	if heaviest == 1 {
+		return backends
+	}
+	var out []*backend.Backend
+	for round := range heaviest {
+		for _, be := range backends {
+			if min(be.Weight(), maxWeight) > round {
+				out = append(out, be)
+			}
+		}
+	}
+	return out
+}
+
+// queueDepth returns the number of requests queued or running on be: the
+// larger of the engine's own count (which includes traffic from other
+// clients but is only scraped periodically) and the proxy's live in-flight
+// count.
+func queueDepth(be *backend.Backend) int64 {
+	depth := be.ActiveRequests()
+	if s := be.EngineStats(); s != nil {
+		depth = max(depth, int64(s.Running+s.Waiting))
+	}
+	return depth
+}
+
+// shortestQueues returns the backends tied for the shortest queue, so the
+// round-robin counter spreads load among equally idle backends.
+func shortestQueues(backends []*backend.Backend) []*backend.Backend {
+	var best []*backend.Backend
+	bestDepth := int64(-1)
+	for _, be := range backends {
+		d := queueDepth(be)
+		switch {
+		case bestDepth < 0 || d < bestDepth:
+			best, bestDepth = []*backend.Backend{be}, d
+		case d == bestDepth:
+			best = append(best, be)
+		}
+	}
+	return best
+}
+
+// byLatency picks a backend at random, weighted by the inverse of its
+// latency average, so traffic drains away from backends that slow down
+// without starving them of the requests that show they've recovered.
+// Backends without a latency yet are weighted like the fastest one, to
+// try them out. It returns nil if no backend has a latency yet.
+func byLatency(backends []*backend.Backend) *backend.Backend {
+	var fastest time.Duration
+	for _, be := range backends {
+		if l := be.Latency(); l > 0 && (fastest == 0 || l < fastest) {
+			fastest = l
+		}
+	}
+	if fastest == 0 {
+		return nil
+	}
+	weights := make([]float64, len(backends))
+	var total float64
+	for i, be := range backends {
+		l := be.Latency()
+		if l <= 0 {
+			l = fastest
+		}
+		weights[i] = 1 / l.Seconds()
+		total += weights[i]
+	}
+	r := rand.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return backends[i]
+		}
+		r -= w
+	}
+	return backends[len(backends)-1]
+}
@@ -0,0 +1,213 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestParseStrategy(t *testing.T) {
+	for in, want := range map[string]Strategy{
+		"":             StrategyRoundRobin,
+		"round-robin":  StrategyRoundRobin,
+		"queue-depth":  StrategyQueueDepth,
+		"Queue":        StrategyQueueDepth,
+		"p2c":          StrategyPowerOfTwo,
+		"Power-Of-Two": StrategyPowerOfTwo,
+		"latency":      StrategyLatency,
+		"EWMA":         StrategyLatency,
+	} {
+		got, err := ParseStrategy(in)
+		if err != nil || got != want {
+			t.Errorf("ParseStrategy(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseStrategy("random"); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+}
+
+func TestPickQueueDepthPrefersShortestQueue(t *testing.T) {
+	b1 := makeBackend(1, true)
+	b2 := makeBackend(2, true)
+	b3 := makeBackend(3, true)
+	b1.SetEngineStats(&backend.EngineStats{Running: 4, Waiting: 2})
+	b2.SetEngineStats(&backend.EngineStats{Running: 1})
+	b3.SetEngineStats(&backend.EngineStats{Running: 3})
+
+	bal := NewBalancer()
+	bal.SetStrategy(StrategyQueueDepth)
+	bal.SetBackends([]*backend.Backend{b1, b2, b3})
+
+	for range 5 {
+		be, err := bal.Pick()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if be.Instance.ID != 2 {
+			t.Errorf("picked %d, want 2 (shortest queue)", be.Instance.ID)
+		}
+	}
+}
+
+func TestPickQueueDepthUsesInFlightRequests(t *testing.T) {
+	// No engine stats: the proxy's own in-flight counts decide, and
+	// backends tied for the shortest queue are rotated.
+	b1 := makeBackend(1, true)
+	b2 := makeBackend(2, true)
+	b3 := makeBackend(3, true)
+	b1.Acquire()
+	b1.Acquire()
+
+	bal := NewBalancer()
+	bal.SetStrategy(StrategyQueueDepth)
+	bal.SetBackends([]*backend.Backend{b1, b2, b3})
+
+	seen := map[int]int{}
+	for range 4 {
+		be, _ := bal.Pick()
+		seen[be.Instance.ID]++
+	}
+	if seen[1] != 0 || seen[2] != 2 || seen[3] != 2 {
+		t.Errorf("picks = %v, want 2 and 3 twice each", seen)
+	}
+
+	// Stale engine stats don't hide live load seen by the proxy.
+	b2.SetEngineStats(&backend.EngineStats{})
+	for range 3 {
+		b2.Acquire()
+	}
+	if be, _ := bal.Pick(); be.Instance.ID != 3 {
+		t.Errorf("picked %d, want 3", be.Instance.ID)
+	}
+}
+
+func TestPickPoolQueueDepth(t *testing.T) {
+	b1 := makeBackend(1, true)
+	b1.Instance.ModelName = "m"
+	b2 := makeBackend(2, true)
+	b2.Instance.ModelName = "m"
+	b1.SetEngineStats(&backend.EngineStats{Waiting: 10})
+
+	bal := NewBalancer()
+	bal.SetPoolMode(PoolByModel)
+	bal.SetStrategy(StrategyQueueDepth)
+	bal.SetBackends([]*backend.Backend{b1, b2})
+
+	if be, _ := bal.PickPool("m"); be.Instance.ID != 2 {
+		t.Errorf("picked %d, want 2", be.Instance.ID)
+	}
+}
+
+func TestPickPowerOfTwoAvoidsBusiestBackend(t *testing.T) {
+	b1 := makeBackend(1, true)
+	b2 := makeBackend(2, true)
+	b3 := makeBackend(3, true)
+	for range 5 {
+		b1.Acquire()
+	}
+	b2.Acquire()
+
+	bal := NewBalancer()
+	bal.SetStrategy(StrategyPowerOfTwo)
+	bal.SetBackends([]*backend.Backend{b1, b2, b3})
+
+	seen := map[int]int{}
+	for range 300 {
+		be, err := bal.Pick()
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[be.Instance.ID]++
+	}
+	// The busiest backend loses every comparison; the idlest wins both of
+	// its pairings and so is picked about twice as often as the other.
+	if seen[1] != 0 {
+		t.Errorf("picked the busiest backend %d times", seen[1])
+	}
+	if seen[3] <= seen[2] {
+		t.Errorf("picks = %v, want 3 more often than 2", seen)
+	}
+}
+
+func TestPickPowerOfTwoSingleBackend(t *testing.T) {
+	bal := NewBalancer()
+	bal.SetStrategy(StrategyPowerOfTwo)
+	bal.SetBackends([]*backend.Backend{makeBackend(1, true)})
+	if be, err := bal.Pick(); err != nil || be.Instance.ID != 1 {
+		t.Errorf("Pick() = %v, %v", be, err)
+	}
+}
+
+func TestPickLatencyWeightsFasterBackends(t *testing.T) {
+	fast := makeBackend(1, true)
+	slow := makeBackend(2, true)
+	untried := makeBackend(3, true)
+	fast.ObserveLatency(100 * time.Millisecond)
+	slow.ObserveLatency(time.Second)
+
+	bal := NewBalancer()
+	bal.SetStrategy(StrategyLatency)
+	bal.SetBackends([]*backend.Backend{fast, slow, untried})
+
+	seen := map[int]int{}
+	for range 2100 {
+		be, _ := bal.Pick()
+		seen[be.Instance.ID]++
+	}
+	// Weights 10:1:10, the untried backend counting as the fastest.
+	if seen[2] == 0 || seen[2] > 250 || seen[1] < 800 || seen[3] < 800 {
+		t.Errorf("picks = %v, want about 1000:100:1000", seen)
+	}
+}
+
+func TestPickLatencyRoundRobinWithoutSamples(t *testing.T) {
+	bal := NewBalancer()
+	bal.SetStrategy(StrategyLatency)
+	bal.SetBackends([]*backend.Backend{makeBackend(1, true), makeBackend(2, true)})
+	a, _ := bal.Pick()
+	b, _ := bal.Pick()
+	if a.Instance.ID == b.Instance.ID {
+		t.Errorf("picked %d twice, want rotation before any latency is known", a.Instance.ID)
+	}
+}
+
+func TestHandlerObservesBackendLatency(t *testing.T) {
+	srv := fakeBackendServer(t)
+	defer srv.Close()
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`)))
+	if be.Latency() <= 0 {
+		t.Error("backend latency not recorded after a successful request")
+	}
+}
+
+func TestPickRoundRobinWeighted(t *testing.T) {
+	big := makeBackend(1, true)
+	big.SetWeight(3)
+	small := makeBackend(2, true)
+	labeled := makeBackend(3, true)
+	labeled.Instance.Label = "proxied:w=2"
+
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{big, small, labeled})
+
+	var order []int
+	for range 12 {
+		be, _ := bal.Pick()
+		order = append(order, be.Instance.ID)
+	}
+	want := []int{1, 2, 3, 1, 3, 1, 1, 2, 3, 1, 3, 1}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("picks = %v, want %v", order, want)
+	}
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+)
+
+// streamErrorBody wraps an SSE response body. If reading it fails before
+// EOF — the backend connection died mid-stream, or the request was cut
+// short by a timeout — it ends the stream with an OpenAI-style error event
+// and [DONE] instead of failing the copy, which would truncate the
+// response silently. Clients can thus tell truncation from completion.
+type streamErrorBody struct {
+	io.ReadCloser
+	onError func(error)
+
+	tail    [2]byte // last two bytes read, to find event boundaries
+	read    int64
+	pending []byte // the terminal event, once the backend failed
+	failed  bool
+}
+
+func newStreamErrorBody(rc io.ReadCloser, onError func(error)) *streamErrorBody {
+	return &streamErrorBody{ReadCloser: rc, onError: onError}
+}
+
+func (b *streamErrorBody) Read(p []byte) (int, error) {
+	if b.failed {
+		if len(b.pending) == 0 {
+			return 0, io.EOF
+		}
+		n := copy(p, b.pending)
+		b.pending = b.pending[n:]
+		return n, nil
+	}
+	n, err := b.ReadCloser.Read(p)
+	for _, c := range p[:n] {
+		b.tail[0], b.tail[1] = b.tail[1], c
+	}
+	b.read += int64(n)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	b.failed = true
+	b.onError(err)
+	b.pending = streamErrorEvent(err, b.read == 0 || b.tail == [2]byte{'\n', '\n'})
+	if n > 0 {
+		return n, nil
+	}
+	return b.Read(p)
+}
+
+// streamErrorEvent returns the events ending a stream that failed with
+// err, first terminating the event in progress unless atBoundary.
+func streamErrorEvent(err error, atBoundary bool) []byte {
+	message := "backend stream interrupted"
+	if isTimeout(err) {
+		message = "upstream request timed out"
+	}
+	prefix := ""
+	if !atBoundary {
+		prefix = "\n\n"
+	}
+	return fmt.Appendf(nil, "%sdata: {\"error\":{\"message\":%q,\"type\":\"server_error\",\"code\":\"stream_interrupted\"}}\n\ndata: [DONE]\n\n",
+		prefix, message)
+}
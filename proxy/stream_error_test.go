@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+const streamInterrupted = `data: {"error":{"message":"backend stream interrupted","type":"server_error","code":"stream_interrupted"}}` + "\n\ndata: [DONE]\n\n"
+
+func TestStreamErrorBody(t *testing.T) {
+	for _, tt := range []struct {
+		name, sent string
+		err        error
+		want       string
+	}{
+		{"at boundary", "data: one\n\n", io.ErrUnexpectedEOF, "data: one\n\n" + streamInterrupted},
+		{"mid-event", "data: o", io.ErrUnexpectedEOF, "data: o\n\n" + streamInterrupted},
+		{"before any event", "", io.ErrUnexpectedEOF, streamInterrupted},
+		{"timeout", "", context.DeadlineExceeded, strings.Replace(streamInterrupted, "backend stream interrupted", "upstream request timed out", 1)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var failed error
+			r := io.MultiReader(strings.NewReader(tt.sent), iotest.ErrReader(tt.err))
+			body := newStreamErrorBody(io.NopCloser(r), func(err error) { failed = err })
+			got, err := io.ReadAll(body)
+			if err != nil || string(got) != tt.want {
+				t.Errorf("ReadAll() = %q, %v; want %q", got, err, tt.want)
+			}
+			if failed != tt.err {
+				t.Errorf("onError got %v, want %v", failed, tt.err)
+			}
+		})
+	}
+}
+
+func TestHandlerEndsBrokenStreamWithError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: one\n\n")
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler) // drop the connection mid-stream
+	}))
+	defer srv.Close()
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"stream":true}`)))
+	if body := rec.Body.String(); body != "data: one\n\n"+streamInterrupted {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestHandlerLeavesCompleteStreamAlone(t *testing.T) {
+	srv := sseBackendServer(t)
+	defer srv.Close()
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"stream":true}`)))
+	if body := rec.Body.String(); strings.Contains(body, "error") || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("body = %q", body)
+	}
+}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// WithStreamIdleTimeout aborts an SSE response if the backend sends no bytes
+// for d, closing the upstream connection so the backend slot is freed
+// instead of being held by a wedged engine.
+func WithStreamIdleTimeout(d time.Duration) Option {
+	return func(h *handler) {
+		h.streamIdleTimeout = d
+	}
+}
+
+// isEventStream reports whether resp is a server-sent events stream.
+func isEventStream(resp *http.Response) bool {
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mt == "text/event-stream"
+}
+
+// idleTimeoutBody wraps a response body and calls onIdle if no data is read
+// for timeout. onIdle is expected to cancel the upstream request, which
+// unblocks any pending Read with an error.
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func newIdleTimeoutBody(rc io.ReadCloser, timeout time.Duration, onIdle func()) *idleTimeoutBody {
+	return &idleTimeoutBody{
+		ReadCloser: rc,
+		timeout:    timeout,
+		timer:      time.AfterFunc(timeout, onIdle),
+	}
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"sync/atomic"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// ErrStreamsFull is returned when every candidate backend is at its limit
+// of concurrent streaming requests (see Balancer.SetMaxStreams).
+var ErrStreamsFull = errors.New("every backend is at its streaming request limit")
+
+// Streaming marks the request as streaming, so it only goes to backends
+// below their limit of concurrent streams (see Balancer.SetMaxStreams).
+// The pick reserves a stream on the backend it returns; the caller must
+// give it back with ReleaseStream.
+func Streaming() PickOption {
+	return func(h *pickHints) {
+		h.streaming = true
+	}
+}
+
+// SetMaxStreams limits each backend to n concurrent streaming requests. A
+// single instance can serve many quick calls at once but only so many
+// simultaneous generations before time to first token collapses, so
+// streams are capped separately. Once every backend is at its limit,
+// further streams are rejected. 0 disables the limit.
+func (b *Balancer) SetMaxStreams(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.maxStreams = n
+}
+
+// limitsStreams reports whether a stream limit is set, so streaming
+// requests must be told apart.
+func (b *Balancer) limitsStreams() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.maxStreams > 0
+}
+
+// streamingPick reports whether opts include Streaming.
+func streamingPick(opts []PickOption) bool {
+	var hints pickHints
+	for _, opt := range opts {
+		opt(&hints)
+	}
+	return hints.streaming
+}
+
+// TryAcquireStream reserves a stream on be unless it is at its limit,
+// reporting whether it did. The caller must give a reserved stream back
+// with ReleaseStream.
+func (b *Balancer) TryAcquireStream(be *backend.Backend) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return be.TryAcquireStream(b.maxStreams)
+}
+
+// chooseWithStream chooses among backends as choose does. For a streaming
+// request it only considers backends below their stream limit and
+// reserves a stream on the one chosen, choosing again among the rest if a
+// concurrent request took its last stream first; unlike the other filters
+// it doesn't fall back to all backends. Must be called with mu held.
+func (b *Balancer) chooseWithStream(backends []*backend.Backend, counter *atomic.Uint64, opts []PickOption) (*backend.Backend, uint64, error) {
+	if !streamingPick(opts) {
+		pick, idx := b.choose(backends, counter, opts)
+		return pick, idx, nil
+	}
+	var room []*backend.Backend
+	for _, be := range backends {
+		if b.maxStreams == 0 || be.ActiveStreams() < b.maxStreams {
+			room = append(room, be)
+		}
+	}
+	for len(room) > 0 {
+		pick, idx := b.choose(room, counter, opts)
+		if pick.TryAcquireStream(b.maxStreams) {
+			return pick, idx, nil
+		}
+		room = slices.DeleteFunc(room, func(be *backend.Backend) bool { return be == pick })
+	}
+	return nil, 0, ErrStreamsFull
+}
+
+// writeStreamsFull writes the 503 response sent when every backend is at
+// its streaming request limit.
+func writeStreamsFull(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "1")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(`{"error":{"message":"every backend is at its limit of concurrent streams","type":"server_error","code":"streams_at_capacity"}}`))
+}
@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestPickHonorsMaxStreams(t *testing.T) {
+	b1, b2 := makeBackend(1, true), makeBackend(2, true)
+	bal := NewBalancer()
+	bal.SetMaxStreams(1)
+	bal.SetBackends([]*backend.Backend{b1, b2})
+
+	b1.AcquireStream()
+	for range 4 {
+		if be, err := bal.Pick(Streaming()); err != nil || be != b2 {
+			t.Fatalf("Pick(Streaming()) = %v, %v, want backend 2", be, err)
+		}
+		if b2.ActiveStreams() != 1 {
+			t.Fatalf("Pick(Streaming()) reserved %d streams, want 1", b2.ActiveStreams())
+		}
+		b2.ReleaseStream()
+	}
+	b2.AcquireStream()
+	if _, err := bal.Pick(Streaming()); !errors.Is(err, ErrStreamsFull) {
+		t.Errorf("Pick(Streaming()) with all full = %v, want ErrStreamsFull", err)
+	}
+	if _, err := bal.Pick(); err != nil {
+		t.Errorf("non-streaming Pick() = %v, want no limit", err)
+	}
+	if bal.TryAcquireStream(b1) {
+		t.Error("TryAcquireStream() = true for a full backend")
+	}
+
+	bal.SetMaxStreams(0)
+	if _, err := bal.Pick(Streaming()); err != nil {
+		t.Errorf("Pick(Streaming()) without a limit = %v", err)
+	}
+}
+
+func TestPickStreamingNeverOvershoots(t *testing.T) {
+	be := makeBackend(1, true)
+	bal := NewBalancer()
+	bal.SetMaxStreams(5)
+	bal.SetBackends([]*backend.Backend{be})
+
+	var picked atomic.Int64
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := bal.Pick(Streaming()); err == nil {
+				picked.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if picked.Load() != 5 || be.ActiveStreams() != 5 {
+		t.Errorf("%d streaming picks succeeded (%d active), want 5", picked.Load(), be.ActiveStreams())
+	}
+}
+
+func TestHandlerRejectsStreamsOverLimit(t *testing.T) {
+	srv := sseBackendServer(t)
+	defer srv.Close()
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetMaxStreams(1)
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil)
+
+	stream := func(sticky bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"stream":true}`))
+		if sticky {
+			req.Header.Set(StickyHeader, "1")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := stream(false); rec.Code != http.StatusOK || be.ActiveStreams() != 0 {
+		t.Fatalf("status = %d, streams = %d after the stream", rec.Code, be.ActiveStreams())
+	}
+
+	be.AcquireStream() // another stream in flight
+	for _, sticky := range []bool{false, true} {
+		if rec := stream(sticky); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "streams_at_capacity") {
+			t.Errorf("sticky=%v: status = %d, body = %s; want 503", sticky, rec.Code, rec.Body.String())
+		}
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("non-streaming request: status = %d, want 200", rec.Code)
+	}
+}
+
+func TestHandlerSkipsStreamDetectionWithoutLimit(t *testing.T) {
+	srv := sseBackendServer(t)
+	defer srv.Close()
+	be := makeBackend(1, true)
+	be.SetBaseURL(srv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil)
+
+	be.AcquireStream()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"stream":true}`)))
+	if rec.Code != http.StatusOK || be.ActiveStreams() != 1 {
+		t.Errorf("status = %d, streams = %d; want 200 with the stream uncounted", rec.Code, be.ActiveStreams())
+	}
+}
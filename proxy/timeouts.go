@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RouteTimeouts sets upstream deadlines by request path. The longest
+// matching prefix in Routes wins; paths with no match use Default.
+// A zero duration means no deadline.
+type RouteTimeouts struct {
+	Default time.Duration
+	Routes  map[string]time.Duration
+}
+
+// WithRouteTimeouts applies per-route upstream timeouts. A request that
+// exceeds its deadline is answered with 504 Gateway Timeout.
+func WithRouteTimeouts(t RouteTimeouts) Option {
+	return func(h *handler) {
+		h.timeouts = &t
+	}
+}
+
+// For returns the timeout for path.
+func (t *RouteTimeouts) For(path string) time.Duration {
+	best, d := -1, t.Default
+	for prefix, timeout := range t.Routes {
+		if strings.HasPrefix(path, prefix) && len(prefix) > best {
+			best, d = len(prefix), timeout
+		}
+	}
+	return d
+}
+
+// ParseRouteTimeouts parses a comma-separated list of path=duration pairs,
+// e.g. "/v1/models=10s,/v1/chat/completions=30m".
+func ParseRouteTimeouts(s string) (map[string]time.Duration, error) {
+	routes := make(map[string]time.Duration)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		path, dur, ok := strings.Cut(pair, "=")
+		if !ok || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid route timeout %q (want /path=duration)", pair)
+		}
+		d, err := time.ParseDuration(dur)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", path, err)
+		}
+		routes[path] = d
+	}
+	return routes, nil
+}
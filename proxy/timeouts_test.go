@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestParseRouteTimeouts(t *testing.T) {
+	routes, err := ParseRouteTimeouts("/v1/models=10s, /v1/chat/completions=30m")
+	if err != nil {
+		t.Fatalf("ParseRouteTimeouts() error: %v", err)
+	}
+	if routes["/v1/models"] != 10*time.Second || routes["/v1/chat/completions"] != 30*time.Minute {
+		t.Errorf("routes = %v", routes)
+	}
+
+	if routes, err := ParseRouteTimeouts(""); err != nil || len(routes) != 0 {
+		t.Errorf("empty: routes = %v, err = %v", routes, err)
+	}
+	for _, bad := range []string{"v1/models=10s", "/v1/models", "/v1/models=soon"} {
+		if _, err := ParseRouteTimeouts(bad); err == nil {
+			t.Errorf("ParseRouteTimeouts(%q) expected error", bad)
+		}
+	}
+}
+
+func TestRouteTimeoutsFor(t *testing.T) {
+	rt := RouteTimeouts{
+		Default: time.Minute,
+		Routes: map[string]time.Duration{
+			"/v1":                  time.Hour,
+			"/v1/chat/completions": 30 * time.Minute,
+		},
+	}
+	tests := []struct {
+		path string
+		want time.Duration
+	}{
+		{"/v1/chat/completions", 30 * time.Minute},
+		{"/v1/models", time.Hour},
+		{"/health", time.Minute},
+	}
+	for _, tt := range tests {
+		if got := rt.For(tt.path); got != tt.want {
+			t.Errorf("For(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestReverseProxyRouteTimeout(t *testing.T) {
+	var hits atomic.Int32
+	be, srv := delayedBackend(t, 1, 500*time.Millisecond, &hits)
+	defer srv.Close()
+
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	handler := NewReverseProxy(bal, nil, WithRouteTimeouts(RouteTimeouts{
+		Routes: map[string]time.Duration{"/v1/models": 20 * time.Millisecond},
+	}))
+
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want 504", rec.Code)
+	}
+	if !be.IsHealthy() {
+		t.Error("a timeout should not mark the backend unhealthy")
+	}
+
+	// Routes without a timeout are unaffected.
+	req = httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("{}"))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+}
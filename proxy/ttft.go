@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// TTFTStats is the time-to-first-token summary for one backend: the time
+// from sending a streaming request upstream to the first SSE data chunk.
+type TTFTStats struct {
+	Count int64   `json:"count"`
+	Avg   float64 `json:"avg_seconds"`
+	Last  float64 `json:"last_seconds"`
+}
+
+// TTFTTracker aggregates time to first token per backend. Safe for
+// concurrent use.
+type TTFTTracker struct {
+	mu        sync.Mutex
+	byBackend map[int]*ttftTotals
+}
+
+type ttftTotals struct {
+	count int64
+	sum   time.Duration
+	last  time.Duration
+}
+
+// NewTTFTTracker creates an empty TTFT tracker.
+func NewTTFTTracker() *TTFTTracker {
+	return &TTFTTracker{byBackend: make(map[int]*ttftTotals)}
+}
+
+// WithTTFT measures time to first token of every streaming response into t.
+func WithTTFT(t *TTFTTracker) Option {
+	return func(h *handler) {
+		h.ttft = t
+	}
+}
+
+// Record adds one streaming request's time to first token.
+func (t *TTFTTracker) Record(backendID int, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tot := t.byBackend[backendID]
+	if tot == nil {
+		tot = &ttftTotals{}
+		t.byBackend[backendID] = tot
+	}
+	tot.count++
+	tot.sum += d
+	tot.last = d
+}
+
+// ByBackend returns a snapshot of TTFT stats per backend instance ID.
+func (t *TTFTTracker) ByBackend() map[int]TTFTStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[int]TTFTStats, len(t.byBackend))
+	for id, tot := range t.byBackend {
+		out[id] = TTFTStats{
+			Count: tot.count,
+			Avg:   (tot.sum / time.Duration(tot.count)).Seconds(),
+			Last:  tot.last.Seconds(),
+		}
+	}
+	return out
+}
+
+// WritePrometheus writes per-backend TTFT totals in the Prometheus text
+// exposition format as the vastproxy_ttft_seconds summary.
+func (t *TTFTTracker) WritePrometheus(w io.Writer) {
+	const name = "vastproxy_ttft_seconds"
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s Time from upstream request to the first SSE data chunk, by backend.\n", name)
+	fmt.Fprintf(w, "# TYPE %s summary\n", name)
+	for _, id := range slices.Sorted(maps.Keys(t.byBackend)) {
+		tot := t.byBackend[id]
+		fmt.Fprintf(w, "%s_sum{backend=\"%d\"} %g\n", name, id, tot.sum.Seconds())
+		fmt.Fprintf(w, "%s_count{backend=\"%d\"} %d\n", name, id, tot.count)
+	}
+}
+
+// firstDataBody wraps an SSE response body and calls onFirst the first time
+// a read contains a "data:" field, i.e. when the first token arrives.
+type firstDataBody struct {
+	io.ReadCloser
+	onFirst func()
+	seen    bool
+}
+
+func (b *firstDataBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.seen && bytes.Contains(p[:n], []byte("data:")) {
+		b.seen = true
+		b.onFirst()
+	}
+	return n, err
+}
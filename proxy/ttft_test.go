@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+func TestTTFTTracker(t *testing.T) {
+	tr := NewTTFTTracker()
+	tr.Record(1, 100*time.Millisecond)
+	tr.Record(1, 300*time.Millisecond)
+
+	got := tr.ByBackend()[1]
+	if got.Count != 2 || got.Avg != 0.2 || got.Last != 0.3 {
+		t.Errorf("stats = %+v, want count 2 avg 0.2 last 0.3", got)
+	}
+
+	var b strings.Builder
+	tr.WritePrometheus(&b)
+	if !strings.Contains(b.String(), `vastproxy_ttft_seconds_count{backend="1"} 2`) {
+		t.Errorf("metrics = %s", b.String())
+	}
+}
+
+func TestReverseProxyMeasuresTTFT(t *testing.T) {
+	backendSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond) // prefill
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer backendSrv.Close()
+
+	be := makeBackend(1, true)
+	be.SetBaseURL(backendSrv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	tr := NewTTFTTracker()
+	handler := NewReverseProxy(bal, nil, WithTTFT(tr))
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"stream":true}`))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	got, ok := tr.ByBackend()[1]
+	if !ok || got.Count != 1 {
+		t.Fatalf("stats = %+v, want one measurement", tr.ByBackend())
+	}
+	if got.Avg < 0.05 {
+		t.Errorf("TTFT = %vs, want at least the 50ms prefill", got.Avg)
+	}
+}
+
+func TestReverseProxyTTFTSkipsNonStreaming(t *testing.T) {
+	backendSrv := fakeBackendServer(t)
+	defer backendSrv.Close()
+
+	be := makeBackend(1, true)
+	be.SetBaseURL(backendSrv.URL)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	tr := NewTTFTTracker()
+	handler := NewReverseProxy(bal, nil, WithTTFT(tr))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/models", nil))
+	if got := tr.ByBackend(); len(got) != 0 {
+		t.Errorf("stats = %+v, want none for a JSON response", got)
+	}
+}
+
+func TestAdminTTFT(t *testing.T) {
+	tr := NewTTFTTracker()
+	tr.Record(2, time.Second)
+	srv := httptest.NewServer((&Admin{TTFT: tr}).Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/ttft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got map[int]TTFTStats
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got[2].Count != 1 || got[2].Avg != 1 {
+		t.Errorf("got %+v", got)
+	}
+}
@@ -0,0 +1,307 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// Usage is aggregated token usage.
+type Usage struct {
+	Requests         int64 `json:"requests"`
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+}
+
+func (u *Usage) add(prompt, completion int64) {
+	u.Requests++
+	u.PromptTokens += prompt
+	u.CompletionTokens += completion
+}
+
+// UsageTracker aggregates token usage per client API key and per backend.
+// Safe for concurrent use.
+type UsageTracker struct {
+	mu        sync.Mutex
+	byKey     map[string]*Usage
+	byBackend map[int]*Usage
+	byRow     map[usageRowKey]*UsageRow
+	quotas    map[string][]Quota
+	byPeriod  map[string]map[QuotaPeriod]*periodUsage
+}
+
+// NewUsageTracker creates an empty usage tracker.
+func NewUsageTracker() *UsageTracker {
+	return &UsageTracker{
+		byKey:     make(map[string]*Usage),
+		byBackend: make(map[int]*Usage),
+		byRow:     make(map[usageRowKey]*UsageRow),
+		byPeriod:  make(map[string]map[QuotaPeriod]*periodUsage),
+	}
+}
+
+// WithUsage counts prompt and completion tokens for every request into u.
+func WithUsage(u *UsageTracker) Option {
+	return func(h *handler) {
+		h.usage = u
+	}
+}
+
+// Record adds one request's token counts and wall time. model may be empty
+// if the request didn't name one.
+func (t *UsageTracker) Record(key string, backendID int, model string, prompt, completion int64, wall time.Duration) {
+	t.recordAt(key, backendID, model, prompt, completion, wall, time.Now())
+}
+
+func (t *UsageTracker) recordAt(key string, backendID int, model string, prompt, completion int64, wall time.Duration, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	row, totals := t.totals(key, backendID, model, now)
+	for _, u := range totals {
+		u.add(prompt, completion)
+	}
+	row.WallSeconds += wall.Seconds()
+}
+
+// adjustPrompt adds delta prompt tokens to usage already recorded, without
+// counting a request.
+func (t *UsageTracker) adjustPrompt(key string, backendID int, model string, delta int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, totals := t.totals(key, backendID, model, time.Now())
+	for _, u := range totals {
+		u.PromptTokens += delta
+	}
+}
+
+// totals returns the usage row for key, backend and model, and every
+// aggregate a request by them counts toward, creating any that are
+// missing. Must be called with mu held.
+func (t *UsageTracker) totals(key string, backendID int, model string, now time.Time) (*UsageRow, []*Usage) {
+	rk := usageRowKey{key, backendID, model}
+	if t.byRow[rk] == nil {
+		t.byRow[rk] = &UsageRow{Key: key, BackendID: backendID, Model: model}
+	}
+	if t.byKey[key] == nil {
+		t.byKey[key] = &Usage{}
+	}
+	if t.byBackend[backendID] == nil {
+		t.byBackend[backendID] = &Usage{}
+	}
+	totals := []*Usage{&t.byRow[rk].Usage, t.byKey[key], t.byBackend[backendID]}
+	for _, q := range t.quotasFor(key) {
+		totals = append(totals, &t.periodUsageAt(key, q.Period, now).Usage)
+	}
+	return t.byRow[rk], totals
+}
+
+// ByKey returns a snapshot of usage per API key fingerprint.
+func (t *UsageTracker) ByKey() map[string]Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]Usage, len(t.byKey))
+	for k, u := range t.byKey {
+		out[k] = *u
+	}
+	return out
+}
+
+// ByBackend returns a snapshot of usage per backend instance ID.
+func (t *UsageTracker) ByBackend() map[int]Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[int]Usage, len(t.byBackend))
+	for id, u := range t.byBackend {
+		out[id] = *u
+	}
+	return out
+}
+
+// estimateTokens approximates a token count from text length using the
+// ~4 characters per token rule of thumb for BPE tokenizers.
+func estimateTokens(chars int) int64 {
+	return int64((chars + 3) / 4)
+}
+
+// correctPromptTokens replaces a recorded prompt estimate with the count
+// from be's tokenizer, for a request that got no usage block back. The
+// estimate stands for engines without /tokenize. It makes a round trip to
+// the backend, so call it off the request path.
+func (t *UsageTracker) correctPromptTokens(be *backend.Backend, body []byte, key string, backendID int, model string, estimate int64) {
+	if n, err := be.Tokenize(context.Background(), body); err == nil && n != estimate {
+		t.adjustPrompt(key, backendID, model, n-estimate)
+	}
+}
+
+// estimatePromptTokens estimates the prompt size of an OpenAI-style JSON
+// request by summing the text under "messages", "prompt" and "input".
+func estimatePromptTokens(body []byte) int64 {
+	var req map[string]any
+	if json.Unmarshal(body, &req) != nil {
+		return 0
+	}
+	chars := 0
+	for _, k := range []string{"messages", "prompt", "input"} {
+		chars += textLen(req[k])
+	}
+	return estimateTokens(chars)
+}
+
+// nonTextKeys are the object keys in a prompt whose values the model
+// doesn't read as text: message roles, content part types, and images,
+// audio and files, which are mostly base64 data.
+var nonTextKeys = map[string]bool{
+	"role": true, "type": true, "image_url": true, "input_audio": true, "file": true,
+}
+
+// textLen sums the lengths of the strings in v, skipping nonTextKeys.
+func textLen(v any) int {
+	switch t := v.(type) {
+	case string:
+		return len(t)
+	case []any:
+		n := 0
+		for _, c := range t {
+			n += textLen(c)
+		}
+		return n
+	case map[string]any:
+		n := 0
+		for k, c := range t {
+			if !nonTextKeys[k] {
+				n += textLen(c)
+			}
+		}
+		return n
+	}
+	return 0
+}
+
+// usageLimit bounds how much of a non-streaming response is buffered to
+// find its usage block.
+const usageLimit = 1 << 20
+
+// usageCounter observes a response body as it is written to the client and
+// extracts token usage. SSE streams are parsed line by line: a chunk with a
+// "usage" object is authoritative, otherwise each content-bearing chunk
+// counts as one completion token. Other bodies are parsed as JSON at the end.
+type usageCounter struct {
+	header  http.Header // response headers, inspected on the first write
+	started bool
+	sse     bool
+	buf     bytes.Buffer
+	seen    bool // a usage object was reported
+
+	promptTokens     int64
+	completionTokens int64
+	chunkTokens      int64 // content chunks seen in a stream
+}
+
+func (c *usageCounter) Write(p []byte) (int, error) {
+	if !c.started {
+		c.started = true
+		mt, _, _ := mime.ParseMediaType(c.header.Get("Content-Type"))
+		c.sse = mt == "text/event-stream"
+	}
+	if !c.sse {
+		if room := usageLimit - c.buf.Len(); room > 0 {
+			c.buf.Write(p[:min(len(p), room)])
+		}
+		return len(p), nil
+	}
+	c.buf.Write(p)
+	for {
+		line, err := c.buf.ReadBytes('\n')
+		if err != nil {
+			// Incomplete line: keep it for the next write.
+			c.buf.Reset()
+			c.buf.Write(line)
+			break
+		}
+		c.sseLine(line)
+	}
+	return len(p), nil
+}
+
+// tokenUsage is a usage object in either chat completions or Responses API
+// naming.
+type tokenUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	InputTokens      int64 `json:"input_tokens"`
+	OutputTokens     int64 `json:"output_tokens"`
+}
+
+// usageChunk matches chat/text completion chunks as well as Responses API
+// objects and stream events.
+type usageChunk struct {
+	Usage   *tokenUsage `json:"usage"`
+	Choices []struct {
+		Text  string `json:"text"`
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Type     string `json:"type"`
+	Response *struct {
+		Usage *tokenUsage `json:"usage"`
+	} `json:"response"`
+}
+
+func (c *usageCounter) sseLine(line []byte) {
+	payload, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok {
+		return
+	}
+	payload = bytes.TrimSpace(payload)
+	if len(payload) == 0 || payload[0] != '{' {
+		return
+	}
+	var chunk usageChunk
+	if json.Unmarshal(payload, &chunk) != nil {
+		return
+	}
+	c.apply(chunk)
+	if chunk.Type == "response.output_text.delta" {
+		c.chunkTokens++
+	}
+	for _, ch := range chunk.Choices {
+		if ch.Delta.Content != "" || ch.Text != "" {
+			c.chunkTokens++
+		}
+	}
+}
+
+func (c *usageCounter) apply(chunk usageChunk) {
+	u := chunk.Usage
+	if chunk.Response != nil && chunk.Response.Usage != nil {
+		u = chunk.Response.Usage
+	}
+	if u != nil {
+		c.seen = true
+		c.promptTokens = u.PromptTokens + u.InputTokens
+		c.completionTokens = u.CompletionTokens + u.OutputTokens
+	}
+}
+
+// result returns prompt and completion token counts. ok is false if no
+// usage was reported; prompt is then 0, for the caller to count, and
+// completion is the stream chunk count.
+func (c *usageCounter) result() (prompt, completion int64, ok bool) {
+	if !c.sse {
+		var chunk usageChunk
+		if json.Unmarshal(c.buf.Bytes(), &chunk) == nil {
+			c.apply(chunk)
+		}
+	}
+	if c.seen {
+		return c.promptTokens, c.completionTokens, true
+	}
+	return 0, c.chunkTokens, false
+}
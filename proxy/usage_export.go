@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// usageRowKey identifies one line of the usage accounting breakdown.
+type usageRowKey struct {
+	key       string
+	backendID int
+	model     string
+}
+
+// UsageRow is the usage accounted to one API key on one backend and model,
+// for charging costs back to teams.
+type UsageRow struct {
+	Key       string `json:"key"`
+	BackendID int    `json:"backend"`
+	Model     string `json:"model"`
+	Usage
+	WallSeconds float64 `json:"wall_seconds"` // total request duration
+}
+
+// Rows returns a snapshot of usage per API key, backend and model, sorted
+// in that order.
+func (t *UsageTracker) Rows() []UsageRow {
+	t.mu.Lock()
+	rows := make([]UsageRow, 0, len(t.byRow))
+	for _, r := range t.byRow {
+		rows = append(rows, *r)
+	}
+	t.mu.Unlock()
+	slices.SortFunc(rows, func(a, b UsageRow) int {
+		return cmp.Or(
+			cmp.Compare(a.Key, b.Key),
+			cmp.Compare(a.BackendID, b.BackendID),
+			cmp.Compare(a.Model, b.Model),
+		)
+	})
+	return rows
+}
+
+var usageCSVHeader = []string{"key", "backend", "model", "requests", "prompt_tokens", "completion_tokens", "wall_seconds"}
+
+// WriteCSV writes the usage breakdown as CSV with a header row.
+func (t *UsageTracker) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(usageCSVHeader)
+	for _, r := range t.Rows() {
+		cw.Write([]string{
+			r.Key,
+			strconv.Itoa(r.BackendID),
+			r.Model,
+			strconv.FormatInt(r.Requests, 10),
+			strconv.FormatInt(r.PromptTokens, 10),
+			strconv.FormatInt(r.CompletionTokens, 10),
+			strconv.FormatFloat(r.WallSeconds, 'f', 3, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the usage breakdown as a JSON array.
+func (t *UsageTracker) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(t.Rows())
+}
+
+// Export atomically writes the usage breakdown to path, as CSV if the path
+// ends in .csv and JSON otherwise.
+func (t *UsageTracker) Export(path string) error {
+	write := t.WriteJSON
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		write = t.WriteCSV
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".usage-*")
+	if err != nil {
+		return err
+	}
+	err = write(tmp)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// RunExport exports the usage breakdown to path every interval until ctx
+// is cancelled.
+func (t *UsageTracker) RunExport(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.Export(path); err != nil {
+				log.Printf("usage export: %v", err)
+			}
+		}
+	}
+}
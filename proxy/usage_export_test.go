@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUsageTrackerRows(t *testing.T) {
+	u := NewUsageTracker()
+	u.Record("key-b", 1, "llama", 10, 20, time.Second)
+	u.Record("key-a", 2, "qwen", 5, 5, 500*time.Millisecond)
+	u.Record("key-b", 1, "llama", 30, 40, 2*time.Second)
+
+	rows := u.Rows()
+	if len(rows) != 2 {
+		t.Fatalf("Rows() = %+v, want 2 rows", rows)
+	}
+	if rows[0].Key != "key-a" || rows[1].Key != "key-b" {
+		t.Errorf("rows not sorted by key: %+v", rows)
+	}
+	want := UsageRow{Key: "key-b", BackendID: 1, Model: "llama",
+		Usage: Usage{Requests: 2, PromptTokens: 40, CompletionTokens: 60}, WallSeconds: 3}
+	if rows[1] != want {
+		t.Errorf("rows[1] = %+v, want %+v", rows[1], want)
+	}
+}
+
+func TestUsageTrackerExport(t *testing.T) {
+	u := NewUsageTracker()
+	u.Record("key-a", 2, "qwen", 5, 7, 1500*time.Millisecond)
+	dir := t.TempDir()
+
+	csvPath := filepath.Join(dir, "usage.csv")
+	if err := u.Export(csvPath); err != nil {
+		t.Fatalf("Export(csv) error: %v", err)
+	}
+	data, _ := os.ReadFile(csvPath)
+	want := "key,backend,model,requests,prompt_tokens,completion_tokens,wall_seconds\nkey-a,2,qwen,1,5,7,1.500\n"
+	if string(data) != want {
+		t.Errorf("CSV = %q, want %q", data, want)
+	}
+
+	jsonPath := filepath.Join(dir, "usage.json")
+	if err := u.Export(jsonPath); err != nil {
+		t.Fatalf("Export(json) error: %v", err)
+	}
+	data, _ = os.ReadFile(jsonPath)
+	var rows []UsageRow
+	if err := json.Unmarshal(data, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].PromptTokens != 5 || rows[0].WallSeconds != 1.5 {
+		t.Errorf("JSON rows = %+v", rows)
+	}
+}
+
+func TestAdminUsageExport(t *testing.T) {
+	u := NewUsageTracker()
+	u.Record("key-a", 2, "qwen", 5, 7, time.Second)
+	srv := httptest.NewServer((&Admin{Usage: u}).Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/usage/export?format=csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/csv" || !strings.Contains(string(body), "key-a,2,qwen,1,5,7") {
+		t.Errorf("CSV export = %s %q", resp.Header.Get("Content-Type"), body)
+	}
+
+	resp, err = http.Get(srv.URL + "/usage/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var rows []UsageRow
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Model != "qwen" {
+		t.Errorf("JSON export = %+v", rows)
+	}
+}
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+func TestClientKeyID(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if got := clientKeyID(r); got != anonymousKey {
+		t.Errorf("no auth: got %q, want %q", got, anonymousKey)
+	}
+	r.Header.Set("Authorization", "Bearer sk-secret")
+	id := clientKeyID(r)
+	if !strings.HasPrefix(id, "key-") || strings.Contains(id, "secret") {
+		t.Errorf("got %q, want an opaque key- fingerprint", id)
+	}
+	r2 := httptest.NewRequest("GET", "/", nil)
+	r2.Header.Set("Authorization", "Bearer sk-other")
+	if clientKeyID(r2) == id {
+		t.Error("different keys produced the same fingerprint")
+	}
+}
+
+func TestEstimatePromptTokens(t *testing.T) {
+	body := `{"model":"m","messages":[{"role":"user","content":"12345678"}]}`
+	// "12345678" (8) = 8 chars → 2 tokens; roles aren't prompt text.
+	if got := estimatePromptTokens([]byte(body)); got != 2 {
+		t.Errorf("got %d, want 2", got)
+	}
+	vision := `{"messages":[{"role":"user","content":[{"type":"text","text":"1234"},` +
+		`{"type":"image_url","image_url":{"url":"data:image/png;base64,` + strings.Repeat("A", 4000) + `"}}]}]}`
+	if got := estimatePromptTokens([]byte(vision)); got != 1 {
+		t.Errorf("vision request: got %d, want 1 (image data isn't text)", got)
+	}
+	if got := estimatePromptTokens([]byte("not json")); got != 0 {
+		t.Errorf("got %d for non-JSON, want 0", got)
+	}
+}
+
+func TestUsageCounterSSE(t *testing.T) {
+	c := &usageCounter{header: http.Header{"Content-Type": {"text/event-stream"}}}
+	// Split a chunk across writes to exercise line buffering.
+	c.Write([]byte(`data: {"choices":[{"delta":{"content":"he"}}]}` + "\n\ndata: {\"choices\":[{\"del"))
+	c.Write([]byte(`ta":{"content":"llo"}}]}` + "\n\ndata: [DONE]\n\n"))
+	prompt, completion, ok := c.result()
+	if ok || prompt != 0 || completion != 2 {
+		t.Errorf("got prompt=%d completion=%d ok=%v, want 0, 2, false", prompt, completion, ok)
+	}
+
+	c = &usageCounter{header: http.Header{"Content-Type": {"text/event-stream"}}}
+	c.Write([]byte(`data: {"choices":[{"delta":{"content":"hi"}}]}` + "\n\n"))
+	c.Write([]byte(`data: {"choices":[],"usage":{"prompt_tokens":11,"completion_tokens":5}}` + "\n\n"))
+	prompt, completion, ok = c.result()
+	if !ok || prompt != 11 || completion != 5 {
+		t.Errorf("reported usage: got prompt=%d completion=%d, want 11, 5", prompt, completion)
+	}
+}
+
+func TestUsageCounterSSECompletions(t *testing.T) {
+	// Legacy /v1/completions chunks carry choices[].text instead of a delta.
+	c := &usageCounter{header: http.Header{"Content-Type": {"text/event-stream; charset=utf-8"}}}
+	c.Write([]byte("data: {\"choices\":[{\"text\":\"a\"}]}\n\ndata: {\"choices\":[{\"text\":\"b\"}]}\n\n"))
+	if _, completion, _ := c.result(); completion != 2 {
+		t.Errorf("completion = %d, want 2", completion)
+	}
+}
+
+func TestReverseProxyUsage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":20}}`)
+	}))
+	defer srv.Close()
+
+	be := backend.NewBackend(&vast.Instance{ID: 3}, "", nil, "")
+	be.SetBaseURL(srv.URL)
+	be.SetHealthy(true)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	usage := NewUsageTracker()
+	handler := NewReverseProxy(bal, nil, WithUsage(usage))
+
+	for range 2 {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"messages":[]}`))
+		req.Header.Set("Authorization", "Bearer sk-test")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	want := Usage{Requests: 2, PromptTokens: 20, CompletionTokens: 40}
+	if got := usage.ByBackend()[3]; got != want {
+		t.Errorf("ByBackend()[3] = %+v, want %+v", got, want)
+	}
+	byKey := usage.ByKey()
+	if len(byKey) != 1 {
+		t.Fatalf("ByKey() has %d keys, want 1", len(byKey))
+	}
+	for _, got := range byKey {
+		if got != want {
+			t.Errorf("ByKey() = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestReverseProxyUsageTokenizesWithoutUsageBlock(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/tokenize" {
+			<-release
+			fmt.Fprint(w, `{"count":17}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	be := backend.NewBackend(&vast.Instance{ID: 3}, "", nil, "")
+	be.SetBaseURL(srv.URL)
+	be.SetHealthy(true)
+	bal := NewBalancer()
+	bal.SetBackends([]*backend.Backend{be})
+	usage := NewUsageTracker()
+	handler := NewReverseProxy(bal, nil, WithUsage(usage))
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// The response doesn't wait for /tokenize: the estimate is recorded
+	// first and corrected once the tokenizer answers.
+	want := Usage{Requests: 1, PromptTokens: 1, CompletionTokens: 1}
+	if got := usage.ByBackend()[3]; got != want {
+		t.Errorf("before /tokenize: ByBackend()[3] = %+v, want %+v", got, want)
+	}
+	close(release)
+	want.PromptTokens = 17
+	deadline := time.Now().Add(2 * time.Second)
+	for usage.ByBackend()[3] != want && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := usage.ByBackend()[3]; got != want {
+		t.Errorf("ByBackend()[3] = %+v, want %+v", got, want)
+	}
+	if got := usage.ByKey()[anonymousKey]; got != want {
+		t.Errorf("ByKey() = %+v, want %+v", got, want)
+	}
+}
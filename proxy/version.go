@@ -0,0 +1,34 @@
+package proxy
+
+// BuildInfo identifies the running build, for GET /version and bug reports.
+type BuildInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+	Date    string `json:"date,omitempty"`
+	Dirty   bool   `json:"dirty,omitempty"` // built from a modified work tree
+}
+
+// String formats the build as e.g. "v1.2.3 (abc1234, 2026-01-02T15:04:05Z)".
+func (b BuildInfo) String() string {
+	s := b.Version
+	var extra string
+	if b.Commit != "" {
+		extra = b.Commit
+		if len(extra) > 7 {
+			extra = extra[:7]
+		}
+		if b.Dirty {
+			extra += "-dirty"
+		}
+	}
+	if b.Date != "" {
+		if extra != "" {
+			extra += ", "
+		}
+		extra += b.Date
+	}
+	if extra != "" {
+		s += " (" + extra + ")"
+	}
+	return s
+}
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBuildInfoString(t *testing.T) {
+	tests := []struct {
+		b    BuildInfo
+		want string
+	}{
+		{BuildInfo{Version: "dev"}, "dev"},
+		{BuildInfo{Version: "v1.2.3", Commit: "0123456789abcdef"}, "v1.2.3 (0123456)"},
+		{BuildInfo{Version: "v1.2.3", Commit: "0123456789abcdef", Dirty: true, Date: "2026-01-02T15:04:05Z"},
+			"v1.2.3 (0123456-dirty, 2026-01-02T15:04:05Z)"},
+		{BuildInfo{Version: "dev", Date: "2026-01-02"}, "dev (2026-01-02)"},
+	}
+	for _, tt := range tests {
+		if got := tt.b.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestAdminVersion(t *testing.T) {
+	build := BuildInfo{Version: "v1.2.3", Commit: "abc"}
+	rec := httptest.NewRecorder()
+	(&Admin{Build: &build}).Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/version", nil))
+	var got BuildInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("bad JSON %q: %v", rec.Body.String(), err)
+	}
+	if got != build {
+		t.Errorf("version = %+v, want %+v", got, build)
+	}
+
+	rec = httptest.NewRecorder()
+	(&Admin{}).Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/version", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status without build info = %d, want 404", rec.Code)
+	}
+}
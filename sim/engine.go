@@ -0,0 +1,205 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// reply is the canned completion every simulated engine streams back.
+const reply = "This is a simulated response from vastproxy's dry-run mode. " +
+	"No GPU was rented to produce it: the tokens are canned and streamed " +
+	"at a steady pace so the proxy, balancer and TUI behave as they would " +
+	"against a real inference server."
+
+// tokenDelay is the pause between streamed words.
+const tokenDelay = 30 * time.Millisecond
+
+// engine is a fake SGLang server: it serves /v1/models, canned chat and
+// text completions, /get_server_info and /abort_request, and tracks load
+// so GPU metrics can follow it.
+type engine struct {
+	model      string
+	contextLen int64
+
+	running atomic.Int64 // in-flight completions
+	served  atomic.Int64 // completions finished
+	down    atomic.Bool  // answer everything with 503, as a crashed server would
+	aborts  atomic.Int64 // bumped by /abort_request; in-flight streams stop
+}
+
+func (e *engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if e.down.Load() {
+		http.Error(w, "simulated outage", http.StatusServiceUnavailable)
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/models":
+		writeJSON(w, map[string]any{
+			"object": "list",
+			"data": []map[string]any{
+				{"id": e.model, "object": "model", "owned_by": "sim", "max_model_len": e.contextLen},
+			},
+		})
+	case "/get_server_info":
+		writeJSON(w, map[string]any{
+			"context_length": e.contextLen,
+			"internal_states": []map[string]any{{
+				"num_running_reqs": e.running.Load(),
+				"num_waiting_reqs": 0,
+				"cache_hit_rate":   0.42,
+			}},
+		})
+	case "/abort_request":
+		e.aborts.Add(1)
+		w.WriteHeader(http.StatusOK)
+	case "/v1/chat/completions":
+		e.complete(w, r, true)
+	case "/v1/completions":
+		e.complete(w, r, false)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// complete answers a completion request with the canned reply, streamed
+// word by word as server-sent events when the request asks for it.
+func (e *engine) complete(w http.ResponseWriter, r *http.Request, chat bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Stream    bool `json:"stream"`
+		MaxTokens int  `json:"max_tokens"`
+	}
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	json.Unmarshal(raw, &req)
+
+	e.running.Add(1)
+	defer e.running.Add(-1)
+
+	words := strings.SplitAfter(reply, " ")
+	if req.MaxTokens > 0 && req.MaxTokens < len(words) {
+		words = words[:req.MaxTokens]
+	}
+	usage := map[string]int{
+		"prompt_tokens":     len(raw)/4 + 1,
+		"completion_tokens": len(words),
+		"total_tokens":      len(raw)/4 + 1 + len(words),
+	}
+	id := fmt.Sprintf("sim-%d", rand.Int64())
+	created := time.Now().Unix()
+	object, chunkObject := "text_completion", "text_completion"
+	if chat {
+		object, chunkObject = "chat.completion", "chat.completion.chunk"
+	}
+	choice := func(text string, delta bool, finish any) map[string]any {
+		c := map[string]any{"index": 0, "finish_reason": finish}
+		switch {
+		case !chat:
+			c["text"] = text
+		case delta:
+			c["delta"] = map[string]string{"content": text}
+		default:
+			c["message"] = map[string]string{"role": "assistant", "content": text}
+		}
+		return c
+	}
+
+	// Time to first token.
+	aborts := e.aborts.Load()
+	if !sleep(r, time.Duration(150+rand.IntN(250))*time.Millisecond) {
+		return
+	}
+
+	if !req.Stream {
+		for range words {
+			if !sleep(r, tokenDelay/3) {
+				return
+			}
+		}
+		e.served.Add(1)
+		writeJSON(w, map[string]any{
+			"id": id, "object": object, "created": created, "model": e.model,
+			"choices": []any{choice(strings.Join(words, ""), false, "stop")},
+			"usage":   usage,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	send := func(v any) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	for i, word := range words {
+		if i > 0 && !sleep(r, tokenDelay) {
+			return
+		}
+		if e.aborts.Load() != aborts {
+			send(map[string]any{
+				"id": id, "object": chunkObject, "created": created, "model": e.model,
+				"choices": []any{choice("", true, "abort")},
+			})
+			break
+		}
+		send(map[string]any{
+			"id": id, "object": chunkObject, "created": created, "model": e.model,
+			"choices": []any{choice(word, true, nil)},
+		})
+	}
+	send(map[string]any{
+		"id": id, "object": chunkObject, "created": created, "model": e.model,
+		"choices": []any{choice("", true, "stop")},
+		"usage":   usage,
+	})
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+	e.served.Add(1)
+}
+
+// gpuMetrics renders nvidia-smi CSV (utilization, temperature) for gpus
+// GPUs, busier and hotter the more requests are in flight.
+func (e *engine) gpuMetrics(gpus int) string {
+	load := float64(e.running.Load())
+	var b strings.Builder
+	for range gpus {
+		util := min(100, 2+28*load+rand.Float64()*6)
+		temp := 36 + util*0.42 + rand.Float64()*3
+		fmt.Fprintf(&b, "%.0f, %.0f\n", util, temp)
+	}
+	return b.String()
+}
+
+// sleep waits for d, reporting false if the client went away first.
+func sleep(r *http.Request, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-r.Context().Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,236 @@
+// Package sim simulates a vast.ai fleet in-process for dry runs: a fake
+// instance list, fake SGLang servers answering with canned completions,
+// and fake SSH tunnels reporting synthetic GPU metrics. It lets the proxy
+// and TUI be demoed and developed without renting any GPUs.
+package sim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+// offers are the machines simulated instances are rented on, in turn.
+var offers = []struct {
+	gpu   string
+	num   int
+	ramMB float64
+	dph   float64
+	model string
+}{
+	{"RTX 4090", 1, 24564, 0.38, "meta-llama/Llama-3.1-8B-Instruct"},
+	{"RTX 4090", 2, 24564, 0.74, "Qwen/Qwen2.5-14B-Instruct"},
+	{"A100 SXM4", 1, 81920, 1.12, "meta-llama/Llama-3.1-8B-Instruct"},
+	{"RTX A6000", 1, 49140, 0.47, "Qwen/Qwen2.5-14B-Instruct"},
+	{"H100 SXM", 2, 81559, 4.58, "meta-llama/Llama-3.3-70B-Instruct"},
+}
+
+// firstID and firstSSHPort number simulated instances like real ones.
+const (
+	firstID      = 9000001
+	firstSSHPort = 41001
+)
+
+// Fleet is a simulated vast.ai account. It implements vast.Provider (and
+// can destroy instances), and its Tunnel method is a backend.TunnelFactory
+// connecting to the simulated servers.
+type Fleet struct {
+	mu    sync.Mutex
+	nodes map[int]*node // by instance ID
+}
+
+// node is one simulated instance and its server.
+type node struct {
+	inst    vast.Instance
+	engine  *engine
+	addr    string
+	server  *http.Server
+	started time.Time
+}
+
+var _ vast.Provider = (*Fleet)(nil)
+
+// NewFleet starts n simulated instances, each with its own server on a
+// loopback port. Call Close to stop them.
+func NewFleet(n int) (*Fleet, error) {
+	f := &Fleet{nodes: make(map[int]*node)}
+	for i := range n {
+		if err := f.start(i); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// start launches the i'th simulated instance.
+func (f *Fleet) start(i int) error {
+	offer := offers[i%len(offers)]
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("sim: %w", err)
+	}
+	env, _ := json.Marshal(map[string]string{
+		"SGLANG_ARGS": fmt.Sprintf("--model-path %s --port 8000", offer.model),
+	})
+	now := time.Now()
+	n := &node{
+		inst: vast.Instance{
+			ID:           firstID + i,
+			ActualStatus: "running",
+			PublicIPAddr: "127.0.0.1",
+			SSHHost:      "sim.vast.ai",
+			SSHPort:      firstSSHPort + i,
+			GPUName:      offer.gpu,
+			NumGPUs:      offer.num,
+			GPURAM:       offer.ramMB,
+			ExtraEnv:     env,
+			StartDate:    float64(now.Add(-time.Duration(i) * 17 * time.Minute).Unix()),
+			DphBase:      offer.dph * 0.9,
+			DphTotal:     offer.dph,
+		},
+		engine:  &engine{model: offer.model, contextLen: 32768},
+		addr:    ln.Addr().String(),
+		started: now,
+	}
+	n.server = &http.Server{Handler: n.engine}
+	go n.server.Serve(ln)
+
+	f.mu.Lock()
+	f.nodes[n.inst.ID] = n
+	f.mu.Unlock()
+	return nil
+}
+
+// Close stops every simulated server.
+func (f *Fleet) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, n := range f.nodes {
+		n.server.Close()
+	}
+}
+
+// ListInstances returns the simulated instances, ordered by ID.
+func (f *Fleet) ListInstances(ctx context.Context) ([]vast.Instance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]vast.Instance, 0, len(f.nodes))
+	for _, n := range f.nodes {
+		out = append(out, n.inst)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+// DestroyInstance stops a simulated instance's server and drops it from
+// the list.
+func (f *Fleet) DestroyInstance(ctx context.Context, instanceID int) error {
+	f.mu.Lock()
+	n, ok := f.nodes[instanceID]
+	delete(f.nodes, instanceID)
+	f.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("sim: no instance %d", instanceID)
+	}
+	log.Printf("sim: destroyed instance %d", instanceID)
+	return n.server.Close()
+}
+
+// Tunnel returns a tunnel to the simulated instance with the given SSH
+// port. It has the signature of a backend.TunnelFactory.
+func (f *Fleet) Tunnel(publicIP string, directSSHPort int, sshHost string, sshPort int, keyPath string, remotePort int) (backend.Tunnel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, n := range f.nodes {
+		if n.inst.SSHPort == sshPort {
+			return &tunnel{node: n}, nil
+		}
+	}
+	return nil, fmt.Errorf("sim: no instance with ssh port %d", sshPort)
+}
+
+// Logs returns canned container logs for an instance. It has the
+// signature of a tui.LogsFunc.
+func (f *Fleet) Logs(id int) ([]string, error) {
+	f.mu.Lock()
+	n, ok := f.nodes[id]
+	f.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("sim: no instance %d", id)
+	}
+	ts := n.started.Format("2006-01-02 15:04:05")
+	return []string{
+		fmt.Sprintf("[%s] [sim] launching sglang for %s", ts, n.engine.model),
+		fmt.Sprintf("[%s] [sim] %d x %s, %.0f GB VRAM each", ts, n.inst.NumGPUs, n.inst.GPUName, n.inst.GPURAM/1024),
+		fmt.Sprintf("[%s] [sim] server listening on port 8000", ts),
+		fmt.Sprintf("[%s] [sim] %d requests served, %d running",
+			time.Now().Format("2006-01-02 15:04:05"), n.engine.served.Load(), n.engine.running.Load()),
+	}, nil
+}
+
+// Chaos takes a random instance's server down for outage every interval
+// until ctx is canceled, so unhealthy backends, failover and recovery can
+// be demoed too. Call in a goroutine.
+func (f *Fleet) Chaos(ctx context.Context, interval, outage time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		f.mu.Lock()
+		var victim *node
+		i := 0
+		for _, n := range f.nodes {
+			if rand.IntN(i+1) == 0 {
+				victim = n
+			}
+			i++
+		}
+		f.mu.Unlock()
+		if victim == nil {
+			continue
+		}
+		log.Printf("sim: taking instance %d down for %v", victim.inst.ID, outage)
+		victim.engine.down.Store(true)
+		time.AfterFunc(outage, func() {
+			log.Printf("sim: instance %d is back", victim.inst.ID)
+			victim.engine.down.Store(false)
+		})
+	}
+}
+
+// tunnel connects straight to a simulated server and answers nvidia-smi
+// with synthetic metrics.
+type tunnel struct {
+	node *node
+}
+
+func (t *tunnel) LocalAddr() string { return t.node.addr }
+func (t *tunnel) IsDirect() bool    { return true }
+func (t *tunnel) Close()            {}
+
+// RunCommand answers nvidia-smi queries; other commands print nothing.
+func (t *tunnel) RunCommand(cmd string) (string, error) {
+	if t.node.engine.down.Load() {
+		return "", fmt.Errorf("sim: instance %d is down", t.node.inst.ID)
+	}
+	if strings.HasPrefix(cmd, "nvidia-smi") {
+		return t.node.engine.gpuMetrics(t.node.inst.NumGPUs), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,133 @@
+package sim
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+func newFleet(t *testing.T, n int) *Fleet {
+	t.Helper()
+	f, err := NewFleet(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(f.Close)
+	return f
+}
+
+func TestFleetInstances(t *testing.T) {
+	f := newFleet(t, 3)
+	insts, err := f.ListInstances(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(insts) != 3 {
+		t.Fatalf("got %d instances, want 3", len(insts))
+	}
+	for _, inst := range insts {
+		if inst.ActualStatus != "running" || inst.ResolveEngineType() != vast.EngineSGLang || inst.DphTotal <= 0 {
+			t.Errorf("instance = %+v", inst)
+		}
+	}
+
+	if err := f.DestroyInstance(context.Background(), insts[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	insts, _ = f.ListInstances(context.Background())
+	if len(insts) != 2 {
+		t.Errorf("got %d instances after destroy, want 2", len(insts))
+	}
+	if err := f.DestroyInstance(context.Background(), 1); err == nil {
+		t.Error("expected error destroying unknown instance")
+	}
+}
+
+func TestFleetBackend(t *testing.T) {
+	f := newFleet(t, 2)
+	insts, _ := f.ListInstances(context.Background())
+	inst := insts[1]
+	inst.Engine = inst.ResolveEngineType()
+
+	be := backend.NewBackend(&inst, "", nil, "")
+	be.SetTunnelFactory(f.Tunnel)
+	if !be.EnsureSSH() {
+		t.Fatal("EnsureSSH() = false")
+	}
+	if err := be.CheckHealth(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	name, err := be.FetchModel(context.Background())
+	if err != nil || name != offers[1].model {
+		t.Errorf("FetchModel() = %q, %v", name, err)
+	}
+	m, err := be.FetchGPUMetrics()
+	if err != nil || len(m.GPUs) != inst.NumGPUs {
+		t.Errorf("FetchGPUMetrics() = %+v, %v", m, err)
+	}
+}
+
+func TestEngineStreamsCompletion(t *testing.T) {
+	f := newFleet(t, 1)
+	tun, err := f.Tunnel("", 0, "", firstSSHPort, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `{"model":"m","stream":true,"max_tokens":3,"messages":[{"role":"user","content":"hi"}]}`
+	resp, err := http.Post("http://"+tun.LocalAddr()+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	var done bool
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("bad chunk %q: %v", data, err)
+		}
+		text.WriteString(chunk.Choices[0].Delta.Content)
+	}
+	if !done || text.String() != "This is a " {
+		t.Errorf("streamed %q, done = %v", text.String(), done)
+	}
+}
+
+func TestEngineDown(t *testing.T) {
+	f := newFleet(t, 1)
+	tun, _ := f.Tunnel("", 0, "", firstSSHPort, "", 0)
+	f.nodes[firstID].engine.down.Store(true)
+	resp, err := http.Get("http://" + tun.LocalAddr() + "/v1/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", resp.StatusCode)
+	}
+	if _, err := tun.RunCommand("nvidia-smi"); err == nil {
+		t.Error("expected nvidia-smi to fail while down")
+	}
+}
@@ -0,0 +1,59 @@
+package tui
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// stickyHeader pins a request to one instance; it mirrors
+// proxy.StickyHeader, which this package doesn't import.
+const stickyHeader = "X-VastProxy-Instance"
+
+// ProxyURL returns the base URL clients reach the proxy listening on
+// listenAddr at. Wildcard and empty hosts become localhost.
+func ProxyURL(listenAddr string, https bool) string {
+	scheme := "http"
+	if https {
+		scheme = "https"
+	}
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return scheme + "://" + listenAddr
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
+// CurlSnippet returns a ready-to-paste curl command sending a chat
+// completion for model to the proxy at baseURL, pinned to instance id.
+func CurlSnippet(baseURL string, id int, model string) string {
+	body, _ := json.Marshal(map[string]any{
+		"model":    model,
+		"messages": []map[string]string{{"role": "user", "content": "Hello!"}},
+	})
+	return fmt.Sprintf("curl %s/v1/chat/completions -H 'Content-Type: application/json' -H '%s: %d' -d %s",
+		baseURL, stickyHeader, id, shellQuote(string(body)))
+}
+
+// shellQuote single-quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// copyToClipboard asks the terminal to copy s to the system clipboard
+// with an OSC 52 escape sequence. Terminals without OSC 52 support ignore
+// it, which is why the snippet is also shown in the footer.
+func copyToClipboard(s string) tea.Cmd {
+	return func() tea.Msg {
+		fmt.Fprint(os.Stdout, "\x1b]52;c;"+base64.StdEncoding.EncodeToString([]byte(s))+"\a")
+		return nil
+	}
+}
@@ -22,11 +22,25 @@ type InstanceRemovedMsg struct {
 	InstanceID int
 }
 
+// WatcherErrorMsg reports that the vast.ai API is unreachable. A zero
+// message (nil Err) means it is reachable again.
+type WatcherErrorMsg struct {
+	Err   error
+	Since time.Time
+}
+
 // GPUMetricsMsg delivers GPU metrics from a backend's health loop.
 type GPUMetricsMsg struct {
 	backend.GPUUpdate
 }
 
+// LogsMsg delivers fetched container logs for the detail view.
+type LogsMsg struct {
+	InstanceID int
+	Lines      []string
+	Err        error
+}
+
 // TickMsg is sent periodically to refresh durations in the view.
 type TickMsg time.Time
 
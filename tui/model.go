@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"fmt"
 	"log"
 	"slices"
 	"strings"
@@ -12,9 +13,13 @@ import (
 	"github.com/shutej/vastproxy/vast"
 )
 
-// StickyPercenter returns the sticky-request percentage for display.
+// StickyPercenter returns the sticky-request percentage, the number of
+// misses (pins to unknown or unhealthy instances) and a per-instance
+// breakdown for display.
 type StickyPercenter interface {
 	Percent() float64
+	Misses() int
+	ForInstance(id int) (hits, misses int)
 }
 
 // AbortChecker reports whether any backend supports server-side abort.
@@ -22,41 +27,94 @@ type AbortChecker interface {
 	HasAbortSupport() bool
 }
 
+// Pauser pauses and resumes accepting new requests.
+type Pauser interface {
+	Paused() bool
+	SetPaused(paused bool)
+}
+
+// OutageReporter reports when the current outage (no healthy backends for
+// too long) began, if there is one.
+type OutageReporter interface {
+	Outage() (since time.Time, ok bool)
+}
+
+// LogsFunc fetches the last lines of an instance's container logs.
+type LogsFunc func(instanceID int) ([]string, error)
+
 // Model is the bubbletea model for the proxy TUI.
 type Model struct {
 	instances      map[int]*InstanceView
 	order          []int // instance IDs in discovery order
 	listenAddr     string
+	proxyURL       string // base URL for curl snippets
+	curlSnippet    string // last copied curl snippet, shown until the next key
+	version        string // build shown in the header
 	err            error
 	eventCh        <-chan vast.InstanceEvent
 	gpuCh          <-chan backend.GPUUpdate
-	startWatcher   func() // called once from Init to start the watcher
-	abortFn        func() // called to abort all backend inference
-	destroyFn      func() // called to destroy all vast.ai instances
+	startWatcher   func()       // called once from Init to start the watcher
+	abortFn        func()       // called to abort all backend inference
+	abortOneFn     func(id int) // called to abort inference on a single backend
+	destroyFn      func()       // called to destroy all vast.ai instances
 	stickyStats    StickyPercenter
 	abortChecker   AbortChecker
+	pauser         Pauser
+	destroyOneFn   func(id int) // called to destroy a single vast.ai instance
+	cleanupFn      func()       // called to destroy all UNHEALTHY instances
 	started        bool
 	width          int    // terminal width
 	height         int    // terminal height
 	scroll         int    // vertical scroll offset (in lines)
 	confirmAbort   bool   // true when abort confirmation dialog is showing
 	abortStatus    string // transient status message after abort
+	abortTarget    int    // instance awaiting abort confirmation; 0 = none
 	confirmDestroy bool   // true when destroy confirmation dialog is showing
 	destroyStatus  string // transient status message after destroy
+	destroyTarget  int    // instance awaiting destroy confirmation; 0 = none
+	confirmCleanup int    // UNHEALTHY instances awaiting destroy confirmation; 0 = no dialog
+	logsFn         LogsFunc
+	requestsFn     RequestsFunc
+	outage         OutageReporter
+	requests       bool          // true when the recent-requests pane is showing
+	reqList        []RequestView // snapshot shown in the pane, newest first
+	reqSelected    int           // index into reqList of the highlighted request
+	reqDetail      bool          // true when the selected request's details are showing
+	selected       int           // index into order of the highlighted card
+	detail         bool          // true when the selected instance's detail view is showing
+	detailLogs     []string      // log lines for the detail view
+	detailErr      error         // error fetching logs for the detail view
+	detailLoading  bool
+	watcherErr     error        // latest poll error while vast.ai is unreachable
+	watcherSince   time.Time    // when polls started failing
+	lastTick       time.Time    // when spend was last accumulated
+	help           bool         // true when the help overlay is showing
+	table          bool         // true for the compact table instead of cards
+	searching      bool         // true while the search prompt has focus
+	search         string       // filter on ID, model, GPU or label; "" shows all
+	config         []ConfigItem // settings listed in the help overlay
+	spent          float64      // $ spent by every instance seen, removed ones included
 }
 
 // NewModel creates the TUI model.
-func NewModel(eventCh <-chan vast.InstanceEvent, gpuCh <-chan backend.GPUUpdate, listenAddr string, startWatcher func(), abortFn func(), destroyFn func(), stickyStats StickyPercenter, abortChecker AbortChecker) Model {
+func NewModel(eventCh <-chan vast.InstanceEvent, gpuCh <-chan backend.GPUUpdate, listenAddr, version string, startWatcher func(), abortFn func(), abortOneFn func(id int), destroyFn func(), destroyOneFn func(id int), cleanupFn func(), stickyStats StickyPercenter, abortChecker AbortChecker, pauser Pauser, logsFn LogsFunc) Model {
 	return Model{
 		instances:    make(map[int]*InstanceView),
 		eventCh:      eventCh,
 		gpuCh:        gpuCh,
 		listenAddr:   listenAddr,
+		proxyURL:     ProxyURL(listenAddr, false),
+		version:      version,
 		startWatcher: startWatcher,
 		abortFn:      abortFn,
+		abortOneFn:   abortOneFn,
 		destroyFn:    destroyFn,
+		destroyOneFn: destroyOneFn,
+		cleanupFn:    cleanupFn,
 		stickyStats:  stickyStats,
 		abortChecker: abortChecker,
+		pauser:       pauser,
+		logsFn:       logsFn,
 	}
 }
 
@@ -83,7 +141,11 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.clampScroll()
 		return m, nil
 
+	case tea.MouseMsg:
+		return m.handleMouse(msg)
+
 	case tea.KeyMsg:
+		m.curlSnippet = ""
 		// When confirmation dialog is showing, only handle y/n/esc.
 		if m.confirmAbort {
 			switch msg.String() {
@@ -101,6 +163,23 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			return m, nil
 		}
+		if m.abortTarget != 0 {
+			switch msg.String() {
+			case "y", "Y":
+				id := m.abortTarget
+				m.abortTarget = 0
+				m.abortStatus = fmt.Sprintf("Aborting instance %d...", id)
+				if m.abortOneFn != nil {
+					go m.abortOneFn(id)
+				}
+				log.Printf("tui: user confirmed abort on instance %d", id)
+				return m, clearAbortStatusAfter(3 * time.Second)
+			case "n", "N", "esc":
+				m.abortTarget = 0
+				return m, nil
+			}
+			return m, nil
+		}
 		if m.confirmDestroy {
 			switch msg.String() {
 			case "y", "Y":
@@ -118,17 +197,198 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 
+		if m.destroyTarget != 0 {
+			switch msg.String() {
+			case "y", "Y":
+				id := m.destroyTarget
+				m.destroyTarget = 0
+				m.destroyStatus = fmt.Sprintf("Destroying instance %d...", id)
+				if m.destroyOneFn != nil {
+					go m.destroyOneFn(id)
+				}
+				log.Printf("tui: user confirmed destroy of instance %d", id)
+				return m, clearDestroyStatusAfter(3 * time.Second)
+			case "n", "N", "esc":
+				m.destroyTarget = 0
+				return m, nil
+			}
+			return m, nil
+		}
+
+		if m.confirmCleanup != 0 {
+			switch msg.String() {
+			case "y", "Y":
+				m.destroyStatus = fmt.Sprintf("Destroying %d unhealthy instances...", m.confirmCleanup)
+				m.confirmCleanup = 0
+				if m.cleanupFn != nil {
+					go m.cleanupFn()
+				}
+				log.Printf("tui: user confirmed destroy of unhealthy instances")
+				return m, clearDestroyStatusAfter(3 * time.Second)
+			case "n", "N", "esc":
+				m.confirmCleanup = 0
+				return m, nil
+			}
+			return m, nil
+		}
+
+		if m.searching {
+			switch msg.Type {
+			case tea.KeyCtrlC:
+				return m, tea.Quit
+			case tea.KeyEnter:
+				m.searching = false
+			case tea.KeyEsc:
+				m.searching = false
+				m.search = ""
+			case tea.KeyBackspace:
+				if r := []rune(m.search); len(r) > 0 {
+					m.search = string(r[:len(r)-1])
+				}
+			case tea.KeySpace:
+				m.search += " "
+			case tea.KeyRunes:
+				m.search += string(msg.Runes)
+			}
+			m.selectVisible()
+			m.clampScroll()
+			return m, nil
+		}
+
+		if m.help {
+			switch msg.String() {
+			case "q", "ctrl+c":
+				return m, tea.Quit
+			case "?", "esc":
+				m.help = false
+				m.scroll = 0
+			}
+			return m, nil
+		}
+
+		if m.requests {
+			switch msg.String() {
+			case "q", "ctrl+c":
+				return m, tea.Quit
+			case "esc", "R":
+				m.scroll = 0
+				if m.reqDetail && msg.String() == "esc" {
+					m.reqDetail = false
+					m.followRequest()
+				} else {
+					m.requests, m.reqDetail = false, false
+				}
+			case "enter":
+				m.reqDetail = len(m.reqList) > 0
+				m.scroll = 0
+			case "up", "k":
+				if !m.reqDetail && m.reqSelected > 0 {
+					m.reqSelected--
+					m.followRequest()
+				}
+			case "down", "j":
+				if !m.reqDetail && m.reqSelected < len(m.reqList)-1 {
+					m.reqSelected++
+					m.followRequest()
+				}
+			case "?":
+				m.help = true
+				m.scroll = 0
+			}
+			return m, nil
+		}
+
+		if m.detail {
+			switch msg.String() {
+			case "q", "ctrl+c":
+				return m, tea.Quit
+			case "esc", "enter":
+				m.detail = false
+				return m, nil
+			case "r":
+				return m.openDetail()
+			case "c":
+				return m.copyCurl()
+			case "?":
+				m.help = true
+				m.scroll = 0
+				return m, nil
+			case "x":
+				m.destroyTarget = m.selectedID()
+				return m, nil
+			case "A":
+				if m.canAbort() {
+					m.abortTarget = m.selectedID()
+				}
+				return m, nil
+			}
+			return m, nil
+		}
+
 		switch msg.String() {
 		case "q", "ctrl+c":
 			return m, tea.Quit
+		case "left", "h":
+			m.step(-1)
+			return m, nil
+		case "right", "l":
+			m.step(1)
+			return m, nil
+		case "enter":
+			if m.selectedID() != 0 {
+				return m.openDetail()
+			}
+			return m, nil
+		case "c":
+			return m.copyCurl()
+		case "R":
+			if m.requestsFn != nil {
+				m.requests = true
+				m.reqSelected = 0
+				m.scroll = 0
+				m.refreshRequests()
+			}
+			return m, nil
+		case "/":
+			m.searching = true
+			return m, nil
+		case "esc":
+			m.search = ""
+			m.clampScroll()
+			return m, nil
 		case "a":
 			if m.canAbort() {
 				m.confirmAbort = true
 			}
 			return m, nil
+		case "A":
+			if m.canAbort() {
+				m.abortTarget = m.selectedID()
+			}
+			return m, nil
 		case "d":
 			m.confirmDestroy = true
 			return m, nil
+		case "x":
+			m.destroyTarget = m.selectedID()
+			return m, nil
+		case "u":
+			m.confirmCleanup = m.countState(vast.StateUnhealthy)
+			return m, nil
+		case "?":
+			m.help = true
+			m.scroll = 0
+			return m, nil
+		case "t":
+			m.table = !m.table
+			m.clampScroll()
+			return m, nil
+		case "p":
+			if m.pauser != nil {
+				m.pauser.SetPaused(!m.pauser.Paused())
+				log.Printf("tui: user set paused=%v", m.pauser.Paused())
+			}
+			return m, nil
 		case "up", "k":
 			m.scroll--
 			m.clampScroll()
@@ -142,12 +402,14 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case InstanceAddedMsg:
 		log.Printf("tui: InstanceAddedMsg id=%d name=%s", msg.Instance.ID, msg.Instance.DisplayName())
 		iv := &InstanceView{
-			ID:         msg.Instance.ID,
-			GPUName:    msg.Instance.GPUName,
-			NumGPUs:    msg.Instance.NumGPUs,
-			State:      msg.Instance.State,
-			StateSince: msg.Instance.StateChangedAt,
-			ModelName:  msg.Instance.ModelName,
+			ID:          msg.Instance.ID,
+			GPUName:     msg.Instance.GPUName,
+			NumGPUs:     msg.Instance.NumGPUs,
+			State:       msg.Instance.State,
+			StateSince:  msg.Instance.StateChangedAt,
+			ModelName:   msg.Instance.ModelName,
+			Label:       msg.Instance.Label,
+			CostPerHour: msg.Instance.HourlyCost(),
 		}
 		if msg.Instance.GPUUtil != nil {
 			iv.GPUUtil = *msg.Instance.GPUUtil
@@ -168,6 +430,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if msg.Instance.ModelName != "" {
 				iv.ModelName = msg.Instance.ModelName
 			}
+			iv.Label = msg.Instance.Label
+			iv.CostPerHour = msg.Instance.HourlyCost()
 			// Only use API-reported GPU metrics if we don't have SSH metrics yet.
 			// SSH nvidia-smi data is fresher and per-backend; the vast.ai API
 			// reports stale/aggregate values that overwrite correct readings.
@@ -189,6 +453,11 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, waitForEvent(m.eventCh)
 
+	case WatcherErrorMsg:
+		m.watcherErr = msg.Err
+		m.watcherSince = msg.Since
+		return m, waitForEvent(m.eventCh)
+
 	case GPUMetricsMsg:
 		if iv, ok := m.instances[msg.InstanceID]; ok {
 			iv.PerGPU = msg.GPUs
@@ -204,9 +473,20 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			iv.HasSSHMetrics = true
 			iv.SSHDirect = msg.IsDirect
+			iv.Engine = msg.Engine
+			iv.Active = msg.Active
+			iv.RTT = msg.RTT
 		}
 		return m, waitForGPU(m.gpuCh)
 
+	case LogsMsg:
+		if m.detail && m.selectedID() == msg.InstanceID {
+			m.detailLogs = msg.Lines
+			m.detailErr = msg.Err
+			m.detailLoading = false
+		}
+		return m, nil
+
 	case AbortClearedMsg:
 		m.abortStatus = ""
 		return m, nil
@@ -216,14 +496,22 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case TickMsg:
+		m.accumulateSpend(time.Time(msg))
+
 		// Purge instances that have been in REMOVING state for 30s+.
 		now := time.Now()
 		for id, iv := range m.instances {
 			if iv.State == vast.StateRemoving && now.Sub(iv.StateSince) >= 30*time.Second {
 				delete(m.instances, id)
 				m.order = slices.DeleteFunc(m.order, func(x int) bool { return x == id })
+				if m.selected >= len(m.order) {
+					m.selected = max(len(m.order)-1, 0)
+				}
 			}
 		}
+		if m.requests && !m.reqDetail {
+			m.refreshRequests()
+		}
 		return m, tickCmd()
 	}
 
@@ -232,69 +520,274 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 // View renders the TUI.
 func (m Model) View() string {
-	// --- Footer (pinned to bottom) ---
+	footer := m.footer()
+	return m.applyScroll(m.body(), strings.Count(footer, "\n")+1) + "\n" + footer
+}
+
+// footer renders the status lines and key help pinned to the bottom.
+func (m Model) footer() string {
 	var footer strings.Builder
+	if since, ok := m.outageSince(); ok {
+		footer.WriteString("  " + alertStyle.Render(fmt.Sprintf(" OUTAGE: no healthy backends for %s ",
+			formatDuration(time.Since(since)))) + "\n")
+	}
 	if m.err != nil {
 		footer.WriteString("  ERROR: " + m.err.Error() + "\n")
 	}
+	if m.watcherErr != nil {
+		footer.WriteString("  " + stateUnhealthy.Render(RenderWatcherError(m.watcherErr, m.watcherSince)) + "\n")
+	}
+	if m.pauser != nil && m.pauser.Paused() {
+		footer.WriteString("  " + stateUnhealthy.Render("PAUSED: new requests get 503 (p to resume)") + "\n")
+	}
+	if m.curlSnippet != "" {
+		footer.WriteString("  " + stateHealthy.Render("Copied to clipboard:") + "\n")
+		footer.WriteString(lipgloss.NewStyle().Width(max(m.width-2, 20)).PaddingLeft(2).Render(m.curlSnippet) + "\n")
+	}
 	if m.abortStatus != "" {
 		footer.WriteString("  " + stateRemoving.Render(m.abortStatus) + "\n")
 	}
 	if m.destroyStatus != "" {
 		footer.WriteString("  " + stateRemoving.Render(m.destroyStatus) + "\n")
 	}
-	if m.confirmAbort {
+	if m.destroyTarget != 0 {
+		footer.WriteString("  " + stateUnhealthy.Render(fmt.Sprintf("DESTROY instance #%d? This is irreversible! (y/n)", m.destroyTarget)))
+	} else if m.abortTarget != 0 {
+		footer.WriteString("  " + stateUnhealthy.Render(fmt.Sprintf("Abort inference on instance #%d? (y/n)", m.abortTarget)))
+	} else if m.confirmCleanup != 0 {
+		footer.WriteString("  " + stateUnhealthy.Render(fmt.Sprintf("DESTROY %d unhealthy instances? This is irreversible! (y/n)", m.confirmCleanup)))
+	} else if m.help {
+		footer.WriteString("  Press ? or esc to close help | q to quit")
+	} else if m.reqDetail {
+		footer.WriteString("  esc back to requests | R close | ? help | q quit")
+	} else if m.requests {
+		footer.WriteString("  ↑/↓ select | enter details | esc close | ? help | q quit")
+	} else if m.detail {
+		footer.WriteString("  Press r to reload logs | esc to go back | ? help | q to quit")
+	} else if m.confirmAbort {
 		footer.WriteString("  " + stateUnhealthy.Render("Abort all backend inference? (y/n)"))
 	} else if m.confirmDestroy {
 		footer.WriteString("  " + stateUnhealthy.Render("DESTROY all vast.ai instances? This is irreversible! (y/n)"))
-	} else if m.canAbort() {
-		footer.WriteString("  Press a to abort all | d to destroy all | q to quit")
+	} else if m.searching {
+		footer.WriteString("  /" + m.search + "█  " + stateDim.Render("enter to keep | esc to clear"))
 	} else {
-		footer.WriteString("  Press d to destroy all | q to quit")
+		if m.search != "" {
+			footer.WriteString(fmt.Sprintf("  Filter %q: %d of %d | esc clear\n", m.search, len(m.visible()), len(m.instances)))
+		}
+		footer.WriteString("  ←/→ select | enter details | t table/cards | p pause | ? help | q quit")
 	}
-	footerStr := footer.String()
-	footerLines := strings.Count(footerStr, "\n") + 1
+	return footer.String()
+}
+
+// gridTop is the body line the card grid starts on, below the header and
+// a blank line.
+const gridTop = 2
 
-	// --- Body (scrollable) ---
+// body renders the scrollable part of the view: the header, then the card
+// grid or the selected instance's detail view.
+func (m Model) body() string {
 	var body strings.Builder
 
 	// Count healthy/total from our instance views.
 	total := len(m.instances)
-	healthy := 0
-	for _, iv := range m.instances {
-		if iv.State == vast.StateHealthy {
-			healthy++
-		}
-	}
+	healthy := m.countState(vast.StateHealthy)
 
-	stickyPct := float64(-1)
+	stickyPct, stickyMisses := float64(-1), 0
 	if m.stickyStats != nil {
 		stickyPct = m.stickyStats.Percent()
+		stickyMisses = m.stickyStats.Misses()
 	}
-	body.WriteString(RenderHeader(m.listenAddr, total, healthy, stickyPct))
+	body.WriteString(RenderHeader(m.version, m.listenAddr, total, healthy, stickyPct, stickyMisses, m.costPerHour(), m.spent))
 	body.WriteString("\n\n")
 
-	// Collect rendered cards.
-	var cards []string
-	for _, id := range m.order {
-		iv, ok := m.instances[id]
-		if !ok {
-			continue
+	if m.help {
+		body.WriteString(RenderHelp(m.canAbort(), m.listenAddr, m.config))
+		return body.String()
+	}
+
+	if m.reqDetail {
+		body.WriteString(RenderRequestDetail(&m.reqList[m.reqSelected]))
+		return body.String()
+	}
+	if m.requests {
+		body.WriteString(RenderRequests(m.reqList, m.reqSelected))
+		return body.String()
+	}
+
+	if iv, ok := m.instances[m.selectedID()]; m.detail && ok {
+		detail := *iv
+		if m.stickyStats != nil {
+			detail.StickyHits, detail.StickyMisses = m.stickyStats.ForInstance(iv.ID)
 		}
-		cards = append(cards, RenderInstance(iv))
+		body.WriteString(RenderDetail(&detail, m.detailLogs, m.detailErr, m.detailLoading))
+		return body.String()
 	}
 
-	if len(cards) == 0 {
+	cards, _ := m.cards()
+	switch {
+	case len(cards) == 0 && m.search != "":
+		body.WriteString(fmt.Sprintf("  No instances match %q.\n", m.search))
+	case len(cards) == 0:
 		body.WriteString("  Watching for vast.ai instances...\n")
-	} else {
+	case m.table:
+		body.WriteString(RenderTableHeader())
+		for _, i := range m.visible() {
+			body.WriteString("\n" + RenderTableRow(m.instances[m.order[i]], i == m.selected))
+		}
+	default:
 		body.WriteString(m.renderGrid(cards))
 	}
 
-	// Apply scroll to body, reserving space for the footer.
-	bodyContent := body.String()
-	scrolled := m.applyScroll(bodyContent, footerLines)
+	return body.String()
+}
+
+// cards renders the visible instance cards, marking the selected one, along
+// with each card's index into order.
+func (m Model) cards() ([]string, []int) {
+	var cards []string
+	idx := m.visible()
+	for _, i := range idx {
+		card := RenderInstance(m.instances[m.order[i]])
+		if i == m.selected {
+			card = "▶ " + strings.TrimPrefix(card, "  ")
+		}
+		cards = append(cards, card)
+	}
+	return cards, idx
+}
+
+// visible returns the indexes into order of the instances matching the
+// search, in order.
+func (m *Model) visible() []int {
+	var idx []int
+	for i, id := range m.order {
+		if iv, ok := m.instances[id]; ok && iv.Matches(m.search) {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// step moves the selection delta visible instances along, stopping at
+// either end.
+func (m *Model) step(delta int) {
+	idx := m.visible()
+	pos := slices.Index(idx, m.selected)
+	if pos < 0 {
+		m.selectVisible()
+		return
+	}
+	if pos+delta >= 0 && pos+delta < len(idx) {
+		m.selected = idx[pos+delta]
+	}
+}
+
+// selectVisible moves the selection to the first visible instance if the
+// search hides the selected one.
+func (m *Model) selectVisible() {
+	idx := m.visible()
+	if len(idx) > 0 && !slices.Contains(idx, m.selected) {
+		m.selected = idx[0]
+	}
+}
+
+// SetProxyURL sets the proxy URL used in curl snippets; it defaults to
+// plain HTTP on the listen address.
+func (m *Model) SetProxyURL(url string) {
+	m.proxyURL = url
+}
+
+// copyCurl copies a curl command pinned to the selected instance to the
+// clipboard and shows it in the footer.
+func (m Model) copyCurl() (tea.Model, tea.Cmd) {
+	iv, ok := m.instances[m.selectedID()]
+	if !ok {
+		return m, nil
+	}
+	m.curlSnippet = CurlSnippet(m.proxyURL, iv.ID, iv.ModelName)
+	log.Printf("tui: curl snippet for instance %d: %s", iv.ID, m.curlSnippet)
+	return m, copyToClipboard(m.curlSnippet)
+}
+
+// SetOutage sets the source of the outage banner.
+func (m *Model) SetOutage(o OutageReporter) {
+	m.outage = o
+}
+
+// outageSince reports when the current outage began, if there is one.
+func (m Model) outageSince() (time.Time, bool) {
+	if m.outage == nil {
+		return time.Time{}, false
+	}
+	return m.outage.Outage()
+}
+
+// SetConfig sets the configuration listed in the help overlay.
+func (m *Model) SetConfig(items []ConfigItem) {
+	m.config = items
+}
+
+// countState returns the number of instances in state.
+func (m *Model) countState(state vast.InstanceState) int {
+	n := 0
+	for _, iv := range m.instances {
+		if iv.State == state {
+			n++
+		}
+	}
+	return n
+}
 
-	return scrolled + "\n" + footerStr
+// accumulateSpend adds what each instance cost since the last tick to its
+// and the fleet's spend. Removed instances no longer cost anything.
+func (m *Model) accumulateSpend(now time.Time) {
+	if !m.lastTick.IsZero() {
+		hours := now.Sub(m.lastTick).Hours()
+		for _, iv := range m.instances {
+			if iv.State != vast.StateRemoving {
+				iv.Spent += iv.CostPerHour * hours
+				m.spent += iv.CostPerHour * hours
+			}
+		}
+	}
+	m.lastTick = now
+}
+
+// costPerHour returns what the fleet currently costs per hour.
+func (m *Model) costPerHour() float64 {
+	var total float64
+	for _, iv := range m.instances {
+		if iv.State != vast.StateRemoving {
+			total += iv.CostPerHour
+		}
+	}
+	return total
+}
+
+// selectedID returns the instance ID of the selected card, or 0 if there
+// is none or the search hides it.
+func (m *Model) selectedID() int {
+	if m.selected < 0 || m.selected >= len(m.order) {
+		return 0
+	}
+	id := m.order[m.selected]
+	if iv, ok := m.instances[id]; ok && !iv.Matches(m.search) {
+		return 0
+	}
+	return id
+}
+
+// openDetail shows the selected instance's detail view and fetches its logs.
+func (m Model) openDetail() (tea.Model, tea.Cmd) {
+	m.detail = true
+	m.detailLogs = nil
+	m.detailErr = nil
+	if m.logsFn == nil {
+		m.detailLoading = false
+		return m, nil
+	}
+	m.detailLoading = true
+	return m, fetchLogs(m.logsFn, m.selectedID())
 }
 
 func (m *Model) hasID(id int) bool {
@@ -312,6 +805,35 @@ func (m Model) renderGrid(cards []string) string {
 		return ""
 	}
 
+	rects := m.layoutGrid(cards)
+	var rows []string
+	var row []string
+	for i, card := range cards {
+		if i > 0 && rects[i].y != rects[i-1].y {
+			rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, row...))
+			row = nil
+		}
+		if len(row) > 0 {
+			row = append(row, strings.Repeat(" ", gridGap))
+		}
+		row = append(row, card)
+	}
+	rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, row...))
+
+	return strings.Join(rows, "\n\n")
+}
+
+// gridGap is the number of columns between cards in a row.
+const gridGap = 2
+
+// cardRect is where a card sits, in cells from the grid's top-left corner.
+type cardRect struct {
+	x, y, w, h int
+}
+
+// layoutGrid places cards as renderGrid draws them: left-to-right, wrapping
+// when a row is full, with a blank line between rows.
+func (m Model) layoutGrid(cards []string) []cardRect {
 	termWidth := m.width
 	if termWidth <= 0 {
 		termWidth = 80
@@ -320,35 +842,22 @@ func (m Model) renderGrid(cards []string) string {
 	// Leave 1 column for the scrollbar.
 	usable := termWidth - 1
 
-	var rows []string
-	var row []string
-	rowWidth := 0
-	gap := 2 // gap between cards in a row
-
-	for _, card := range cards {
-		cardW := lipgloss.Width(card)
-		needed := cardW
-		if len(row) > 0 {
-			needed += gap
-		}
+	rects := make([]cardRect, len(cards))
+	x, y, rowH := 0, 0, 0
+	for i, card := range cards {
+		w, h := lipgloss.Width(card), lipgloss.Height(card)
 		// Wrap to new row if this card doesn't fit (unless row is empty).
-		if len(row) > 0 && rowWidth+needed > usable {
-			rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, row...))
-			row = nil
-			rowWidth = 0
+		if x > 0 && x+gridGap+w > usable {
+			x, y, rowH = 0, y+rowH+1, 0
 		}
-		if len(row) > 0 {
-			row = append(row, strings.Repeat(" ", gap))
-			rowWidth += gap
+		if x > 0 {
+			x += gridGap
 		}
-		row = append(row, card)
-		rowWidth += cardW
-	}
-	if len(row) > 0 {
-		rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, row...))
+		rects[i] = cardRect{x: x, y: y, w: w, h: h}
+		x += w
+		rowH = max(rowH, h)
 	}
-
-	return strings.Join(rows, "\n\n")
+	return rects
 }
 
 // applyScroll slices visible lines from content and appends a scrollbar.
@@ -397,13 +906,69 @@ func (m Model) applyScroll(content string, reservedLines int) string {
 	return strings.Join(result, "\n")
 }
 
-// clampScroll ensures scroll offset is within valid bounds.
+// clampScroll keeps the scroll offset within the rendered content.
 func (m *Model) clampScroll() {
-	if m.scroll < 0 {
-		m.scroll = 0
+	m.scroll = m.scrollOffset()
+}
+
+// viewHeight returns the number of body lines shown above the footer, or 0
+// before the window size is known.
+func (m Model) viewHeight() int {
+	footerLines := strings.Count(m.footer(), "\n") + 1
+	return max(m.height-footerLines-1, 0) // -1 for the newline between body and footer
+}
+
+// scrollOffset returns the first body line shown, clamped as applyScroll
+// clamps it.
+func (m Model) scrollOffset() int {
+	viewH := m.viewHeight()
+	total := strings.Count(m.body(), "\n") + 1
+	if viewH == 0 || total <= viewH {
+		return 0
+	}
+	return min(max(m.scroll, 0), total-viewH)
+}
+
+// mouseScrollLines is how far one wheel notch scrolls.
+const mouseScrollLines = 3
+
+// handleMouse scrolls on the wheel and selects the card that was clicked.
+func (m Model) handleMouse(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case msg.Button == tea.MouseButtonWheelUp:
+		m.scroll -= mouseScrollLines
+		m.clampScroll()
+	case msg.Button == tea.MouseButtonWheelDown:
+		m.scroll += mouseScrollLines
+		m.clampScroll()
+	case msg.Button == tea.MouseButtonLeft && msg.Action == tea.MouseActionPress && !m.detail && !m.help && !m.requests:
+		if i, ok := m.cardAt(msg.X, msg.Y); ok {
+			m.selected = i
+		}
 	}
-	// We can't know the exact max here (content isn't rendered yet),
-	// but applyScroll will clamp it further. Just prevent negatives.
+	return m, nil
+}
+
+// cardAt returns the index into order of the card at screen cell (x, y).
+func (m Model) cardAt(x, y int) (int, bool) {
+	if viewH := m.viewHeight(); viewH > 0 && y >= viewH {
+		return 0, false // in the footer
+	}
+	cards, idx := m.cards()
+	line := y + m.scrollOffset() - gridTop
+	if m.table {
+		// One row per instance, below the column titles.
+		if line >= 1 && line <= len(idx) {
+			return idx[line-1], true
+		}
+		return 0, false
+	}
+	for i, r := range m.layoutGrid(cards) {
+		if x >= r.x && x < r.x+r.w && line >= r.y && line < r.y+r.h {
+			return idx[i], true
+		}
+	}
+	return 0, false
 }
 
 // waitForEvent returns a command that waits for the next watcher event.
@@ -413,11 +978,17 @@ func waitForEvent(ch <-chan vast.InstanceEvent) tea.Cmd {
 		if !ok {
 			return nil
 		}
+		switch evt.Type {
+		case "unreachable":
+			return WatcherErrorMsg{Err: evt.Err, Since: evt.Since}
+		case "reachable":
+			return WatcherErrorMsg{}
+		}
 		log.Printf("tui: received event type=%s instance=%d", evt.Type, evt.Instance.ID)
 		switch evt.Type {
 		case "added":
 			return InstanceAddedMsg{Instance: evt.Instance}
-		case "updated":
+		case "updated", "moved", "restarted", "draining":
 			return InstanceUpdatedMsg{Instance: evt.Instance}
 		case "removed":
 			return InstanceRemovedMsg{InstanceID: evt.Instance.ID}
@@ -437,6 +1008,14 @@ func waitForGPU(ch <-chan backend.GPUUpdate) tea.Cmd {
 	}
 }
 
+// fetchLogs returns a command that fetches an instance's logs.
+func fetchLogs(fn LogsFunc, id int) tea.Cmd {
+	return func() tea.Msg {
+		lines, err := fn(id)
+		return LogsMsg{InstanceID: id, Lines: lines, Err: err}
+	}
+}
+
 func tickCmd() tea.Cmd {
 	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
 		return TickMsg(t)
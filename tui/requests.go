@@ -0,0 +1,149 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RequestView is one proxied request in the recent-requests pane.
+type RequestView struct {
+	Time           time.Time
+	RequestID      string
+	ClientAddr     string
+	Method         string
+	Path           string
+	Model          string
+	BackendID      int // 0 if no backend was picked
+	Status         int
+	UpstreamStatus int // 0 if the backend never responded
+	Bytes          int64
+	Duration       time.Duration
+	TTFT           time.Duration // 0 if not streamed
+}
+
+// RequestsFunc returns the most recent proxied requests, newest first.
+type RequestsFunc func() []RequestView
+
+// requestColumns are the recent-requests pane's columns.
+var requestColumns = []column{
+	{"TIME", 10}, {"ROUTE", 30}, {"MODEL", 24}, {"BACKEND", 9},
+	{"STATUS", 6}, {"DURATION", 9}, {"TTFT", 8},
+}
+
+// RenderRequests renders the recent-requests pane, one row per request,
+// marking the selected one.
+func RenderRequests(reqs []RequestView, selected int) string {
+	if len(reqs) == 0 {
+		return "  No requests yet.\n"
+	}
+	var b strings.Builder
+	b.WriteString(renderColumnTitles(requestColumns))
+	for i, rv := range reqs {
+		t := rv.Time.Format("15:04:05")
+		if i == selected {
+			t = "▶ " + rv.Time.Format("15:04:05")
+		}
+		b.WriteString("\n" + tableLine(requestColumns, []string{
+			t, rv.Method + " " + rv.Path, orDash(rv.Model), backendLabel(rv.BackendID),
+			renderStatus(rv.Status), formatLatency(rv.Duration), formatLatency(rv.TTFT),
+		}))
+	}
+	return b.String()
+}
+
+// RenderRequestDetail renders everything recorded about one request.
+func RenderRequestDetail(rv *RequestView) string {
+	upstream := "-"
+	if rv.UpstreamStatus != 0 {
+		upstream = renderStatus(rv.UpstreamStatus)
+	}
+	rows := []struct{ name, value string }{
+		{"Time", rv.Time.Format("2006-01-02 15:04:05.000")},
+		{"Request ID", rv.RequestID},
+		{"Client", orDash(rv.ClientAddr)},
+		{"Route", rv.Method + " " + rv.Path},
+		{"Model", orDash(rv.Model)},
+		{"Backend", backendLabel(rv.BackendID)},
+		{"Status", renderStatus(rv.Status)},
+		{"Upstream", upstream},
+		{"Bytes", fmt.Sprint(rv.Bytes)},
+		{"Duration", formatLatency(rv.Duration)},
+		{"TTFT", formatLatency(rv.TTFT)},
+	}
+	var b strings.Builder
+	b.WriteString("  " + headerStyle.Render("Request") + "\n")
+	for _, row := range rows {
+		fmt.Fprintf(&b, "  %-12s %s\n", row.name, row.value)
+	}
+	return b.String()
+}
+
+// renderStatus colors an HTTP status code by class.
+func renderStatus(code int) string {
+	s := fmt.Sprint(code)
+	switch {
+	case code >= 500:
+		return stateUnhealthy.Render(s)
+	case code >= 400:
+		return stateConnecting.Render(s)
+	default:
+		return stateHealthy.Render(s)
+	}
+}
+
+// formatLatency rounds d to the millisecond; 0 means unknown.
+func formatLatency(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+func backendLabel(id int) string {
+	if id == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("#%d", id)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// SetRequests sets the source of the recent-requests pane; without one
+// the pane is unavailable.
+func (m *Model) SetRequests(fn RequestsFunc) {
+	m.requestsFn = fn
+}
+
+// refreshRequests takes a new snapshot of the recent requests, keeping
+// the same request selected as new ones arrive.
+func (m *Model) refreshRequests() {
+	prev := ""
+	if m.reqSelected < len(m.reqList) {
+		prev = m.reqList[m.reqSelected].RequestID
+	}
+	m.reqList = m.requestsFn()
+	if i := slices.IndexFunc(m.reqList, func(rv RequestView) bool { return rv.RequestID == prev }); i >= 0 {
+		m.reqSelected = i
+	}
+	m.reqSelected = min(m.reqSelected, max(len(m.reqList)-1, 0))
+	m.followRequest()
+}
+
+// followRequest scrolls the selected request's row into view.
+func (m *Model) followRequest() {
+	line := gridTop + 1 + m.reqSelected // below the column titles
+	if line < m.scroll+gridTop+1 {
+		m.scroll = line - gridTop - 1
+	}
+	if viewH := m.viewHeight(); viewH > 0 && line >= m.scroll+viewH {
+		m.scroll = line - viewH + 1
+	}
+	m.clampScroll()
+}
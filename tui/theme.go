@@ -0,0 +1,98 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// palette holds the TUI's colors by name. Each has a dark- and a
+// light-background variant; lipgloss picks one from the terminal's
+// background unless a theme forces it.
+var palette = map[string]lipgloss.AdaptiveColor{
+	"header":     {Dark: "39", Light: "25"},
+	"healthy":    {Dark: "46", Light: "28"},
+	"unhealthy":  {Dark: "196", Light: "160"},
+	"connecting": {Dark: "226", Light: "136"},
+	"removing":   {Dark: "208", Light: "166"},
+	"dim":        {Dark: "244", Light: "242"},
+	"bar-empty":  {Dark: "240", Light: "250"},
+}
+
+var (
+	headerStyle, alertStyle lipgloss.Style
+
+	stateHealthy, stateUnhealthy, stateConnecting, stateRemoving, stateDim lipgloss.Style
+
+	gpuBarFull, gpuBarWarn, gpuBarHot, gpuBarEmpty lipgloss.Style
+)
+
+func init() {
+	applyPalette()
+}
+
+// SetTheme configures the TUI's colors. theme is "auto" (or empty) to
+// follow the terminal's background, or "dark" or "light" to force one.
+// colors overrides individual colors as comma-separated name=color pairs,
+// e.g. "healthy=#00af00,dim=245"; names are those of the palette (header,
+// healthy, unhealthy, connecting, removing, dim, bar-empty). Colors are
+// dropped entirely when NO_COLOR is set.
+func SetTheme(theme, colors string) error {
+	switch strings.ToLower(theme) {
+	case "", "auto":
+	case "dark":
+		lipgloss.SetHasDarkBackground(true)
+	case "light":
+		lipgloss.SetHasDarkBackground(false)
+	default:
+		return fmt.Errorf("unknown theme %q (want auto, dark or light)", theme)
+	}
+	for _, pair := range strings.Split(colors, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, color, ok := strings.Cut(pair, "=")
+		if _, known := palette[name]; !ok || !known || color == "" {
+			return fmt.Errorf("invalid color %q (want name=color)", pair)
+		}
+		palette[name] = lipgloss.AdaptiveColor{Dark: color, Light: color}
+	}
+	applyPalette()
+	return nil
+}
+
+// applyPalette rebuilds the styles from the palette.
+func applyPalette() {
+	fg := func(name string) lipgloss.Style {
+		return lipgloss.NewStyle().Foreground(palette[name])
+	}
+	headerStyle = fg("header").Bold(true)
+	alertStyle = fg("unhealthy").Bold(true).Reverse(true)
+
+	stateHealthy = fg("healthy")
+	stateUnhealthy = fg("unhealthy")
+	stateConnecting = fg("connecting")
+	stateRemoving = fg("removing")
+	stateDim = fg("dim")
+
+	gpuBarFull = fg("healthy")
+	gpuBarWarn = fg("connecting")
+	gpuBarHot = fg("unhealthy")
+	gpuBarEmpty = fg("bar-empty")
+}
+
+// renderDot renders the dot next to an instance's model: green when
+// healthy, red otherwise, or filled and hollow without color.
+func renderDot(healthy bool) string {
+	switch {
+	case healthy:
+		return stateHealthy.Bold(true).Render("●")
+	case os.Getenv("NO_COLOR") != "":
+		return "○"
+	default:
+		return stateUnhealthy.Bold(true).Render("●")
+	}
+}
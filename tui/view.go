@@ -2,6 +2,7 @@ package tui
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -10,38 +11,36 @@ import (
 	"github.com/shutej/vastproxy/vast"
 )
 
-var (
-	headerStyle = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(lipgloss.Color("39"))
-
-	healthyDot   = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("46")).Render("●")
-	unhealthyDot = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("196")).Render("●")
-
-	stateHealthy    = lipgloss.NewStyle().Foreground(lipgloss.Color("46"))
-	stateUnhealthy  = lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
-	stateConnecting = lipgloss.NewStyle().Foreground(lipgloss.Color("226"))
-	stateRemoving   = lipgloss.NewStyle().Foreground(lipgloss.Color("208"))
-	stateDim        = lipgloss.NewStyle().Foreground(lipgloss.Color("244"))
-
-	gpuBarFull  = lipgloss.NewStyle().Foreground(lipgloss.Color("46"))
-	gpuBarWarn  = lipgloss.NewStyle().Foreground(lipgloss.Color("226"))
-	gpuBarHot   = lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
-	gpuBarEmpty = lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
-)
-
-// RenderHeader renders the proxy status header line.
+// RenderHeader renders the proxy status header line, prefixed with the
+// build version when known.
 // stickyPct is the percentage of requests with the sticky header over the last
 // 5 minutes; a negative value means no requests have been recorded yet.
-func RenderHeader(listenAddr string, totalBackends, healthyBackends int, stickyPct float64) string {
+// stickyMisses counts sticky requests whose pinned instance couldn't serve them.
+func RenderHeader(version, listenAddr string, totalBackends, healthyBackends int, stickyPct float64, stickyMisses int, costPerHour, spent float64) string {
 	base := fmt.Sprintf("Listening on %s | %d backends (%d healthy)",
 		listenAddr, totalBackends, healthyBackends)
+	if version != "" {
+		base = "vastproxy " + version + " | " + base
+	}
 	if stickyPct >= 0 {
 		base += fmt.Sprintf(" | %.0f%% sticky", stickyPct)
+		if stickyMisses > 0 {
+			base += fmt.Sprintf(" (%d missed)", stickyMisses)
+		}
+	}
+	if costPerHour > 0 || spent > 0 {
+		base += fmt.Sprintf(" | $%.2f/hr ($%.2f spent)", costPerHour, spent)
 	}
 	return headerStyle.Render(base)
 }
 
+// RenderWatcherError describes a failing vast.ai API, e.g.
+// "vast.ai unreachable since 12:03: <err> (showing stale data)".
+func RenderWatcherError(err error, since time.Time) string {
+	return fmt.Sprintf("vast.ai unreachable since %s: %v (showing stale data)",
+		since.Format("15:04"), err)
+}
+
 // InstanceView holds the display state for a single instance.
 type InstanceView struct {
 	ID            int
@@ -50,11 +49,31 @@ type InstanceView struct {
 	State         vast.InstanceState
 	StateSince    time.Time
 	ModelName     string
-	GPUUtil       float64             // average utilization (used for API fallback display)
-	GPUTemp       float64             // average temperature (used for API fallback display)
-	PerGPU        []backend.GPUMetric // per-GPU metrics from SSH nvidia-smi
-	HasSSHMetrics bool                // true once we've received GPU data via SSH; prevents API overwrite
-	SSHDirect     bool                // true if SSH tunnel is direct (not proxied)
+	Label         string
+	GPUUtil       float64              // average utilization (used for API fallback display)
+	GPUTemp       float64              // average temperature (used for API fallback display)
+	PerGPU        []backend.GPUMetric  // per-GPU metrics from SSH nvidia-smi
+	HasSSHMetrics bool                 // true once we've received GPU data via SSH; prevents API overwrite
+	SSHDirect     bool                 // true if SSH tunnel is direct (not proxied)
+	Engine        *backend.EngineStats // scheduler load from the engine; nil if unavailable
+	Active        int64                // requests in flight through the proxy, as of the last GPU update
+	RTT           time.Duration        // latest health check round trip; 0 if unknown
+	CostPerHour   float64              // $/hour from the vast.ai API; 0 if unknown
+	Spent         float64              // $ spent since discovery, accumulated at CostPerHour
+	StickyHits    int                  // sticky requests served here (detail view only)
+	StickyMisses  int                  // sticky requests pinned here but rerouted (detail view only)
+}
+
+// Matches reports whether query is a case-insensitive substring of the
+// instance's ID, model name, GPU type or label. An empty query matches.
+func (iv *InstanceView) Matches(query string) bool {
+	q := strings.ToLower(query)
+	for _, s := range []string{strconv.Itoa(iv.ID), iv.ModelName, iv.GPUName, iv.Label} {
+		if strings.Contains(strings.ToLower(s), q) {
+			return true
+		}
+	}
+	return false
 }
 
 // RenderInstance renders a multi-line view for a single instance.
@@ -65,18 +84,21 @@ func RenderInstance(iv *InstanceView) string {
 	duration := formatDuration(time.Since(iv.StateSince))
 	stateStr := renderState(iv.State)
 	sshIcon := renderSSHIcon(iv.SSHDirect, iv.HasSSHMetrics)
+	if iv.RTT > 0 {
+		sshIcon += " " + stateDim.Render(iv.RTT.Round(time.Millisecond).String())
+	}
 	lines = append(lines, fmt.Sprintf("  #%d %sx%d  %s %s %s",
 		iv.ID, iv.GPUName, iv.NumGPUs, stateStr, sshIcon, stateDim.Render(duration)))
 
 	// Line 2: dot + model name
-	dot := unhealthyDot
-	if iv.State == vast.StateHealthy {
-		dot = healthyDot
-	}
+	dot := renderDot(iv.State == vast.StateHealthy)
 	model := iv.ModelName
 	if model == "" {
 		model = "(discovering...)"
 	}
+	if iv.HasSSHMetrics {
+		model += stateDim.Render(fmt.Sprintf("  %d in flight", iv.Active))
+	}
 	lines = append(lines, fmt.Sprintf("    %s %s", dot, model))
 
 	// GPU bars: one per GPU if we have per-GPU data, otherwise a single aggregate bar.
@@ -92,9 +114,159 @@ func RenderInstance(iv *InstanceView) string {
 			renderGPUStats(iv.GPUUtil, iv.GPUTemp)))
 	}
 
+	if iv.CostPerHour > 0 {
+		lines = append(lines, "    "+stateDim.Render(fmt.Sprintf("$%.3f/hr, $%.2f spent", iv.CostPerHour, iv.Spent)))
+	}
+
+	if e := iv.Engine; e != nil {
+		load := fmt.Sprintf("load %d running, %d waiting, %.0f%% cache hits",
+			e.Running, e.Waiting, e.CacheHitRate*100)
+		if e.KVCacheUsage > 0 {
+			load += fmt.Sprintf(", KV %.0f%%", e.KVCacheUsage*100)
+		}
+		lines = append(lines, "    "+stateDim.Render(load))
+	}
+
 	return strings.Join(lines, "\n")
 }
 
+// ConfigItem is one setting shown in the help overlay.
+type ConfigItem struct {
+	Name  string
+	Value string
+}
+
+// helpKeys lists the key bindings shown in the help overlay; abort-only
+// bindings are marked.
+var helpKeys = []struct {
+	keys, action string
+	abort        bool
+}{
+	{"←/→ h/l", "select an instance (or click its card)", false},
+	{"↑/↓ j/k", "scroll (or use the mouse wheel)", false},
+	{"t", "switch between cards and a compact table", false},
+	{"c", "copy a curl command pinned to the selected instance", false},
+	{"R", "browse recent requests (↑/↓ select, enter details)", false},
+	{"/", "search by ID, model, GPU or label (esc clears)", false},
+	{"enter", "show the selected instance's details and logs", false},
+	{"r", "reload logs (details view)", false},
+	{"esc", "back to the fleet (details view)", false},
+	{"A", "abort inference on the selected instance", true},
+	{"a", "abort inference on every instance", true},
+	{"x", "destroy the selected instance", false},
+	{"u", "destroy all UNHEALTHY instances", false},
+	{"d", "destroy all instances", false},
+	{"p", "pause or resume accepting requests", false},
+	{"?", "show or hide this help", false},
+	{"q", "quit", false},
+}
+
+// RenderHelp renders the help overlay: key bindings, then configuration.
+func RenderHelp(canAbort bool, listenAddr string, config []ConfigItem) string {
+	var b strings.Builder
+	b.WriteString("  " + headerStyle.Render("Keys") + "\n")
+	for _, k := range helpKeys {
+		if k.abort && !canAbort {
+			continue
+		}
+		fmt.Fprintf(&b, "  %-9s %s\n", k.keys, k.action)
+	}
+	b.WriteString("\n  " + headerStyle.Render("Configuration") + "\n")
+	items := append([]ConfigItem{{"listen", listenAddr}}, config...)
+	for _, c := range items {
+		value := c.Value
+		if value == "" {
+			value = stateDim.Render("(none)")
+		}
+		fmt.Fprintf(&b, "  %-9s %s\n", c.Name, value)
+	}
+	return b.String()
+}
+
+// column is a table column's title and width.
+type column struct {
+	title string
+	width int
+}
+
+// tableColumns are the compact table's columns.
+var tableColumns = []column{
+	{"ID", 11}, {"GPU", 14}, {"STATE", 11}, {"MODEL", 28},
+	{"UTIL", 5}, {"TEMP", 5}, {"REQS", 5}, {"$/HR", 7},
+}
+
+// RenderTableHeader renders the column titles of the compact table.
+func RenderTableHeader() string {
+	return renderColumnTitles(tableColumns)
+}
+
+// renderColumnTitles renders a table's header row.
+func renderColumnTitles(cols []column) string {
+	cells := make([]string, len(cols))
+	for i, c := range cols {
+		cells[i] = c.title
+	}
+	return headerStyle.Render(tableLine(cols, cells))
+}
+
+// RenderTableRow renders one instance as a row of the compact table, for
+// fleets too large for cards. selected marks the highlighted instance.
+func RenderTableRow(iv *InstanceView, selected bool) string {
+	id := fmt.Sprintf("#%d", iv.ID)
+	if selected {
+		id = "▶ " + id
+	}
+	reqs, cost := "-", "-"
+	if iv.HasSSHMetrics {
+		reqs = fmt.Sprint(iv.Active)
+	}
+	if iv.CostPerHour > 0 {
+		cost = fmt.Sprintf("$%.3f", iv.CostPerHour)
+	}
+	return tableLine(tableColumns, []string{
+		id, fmt.Sprintf("%sx%d", iv.GPUName, iv.NumGPUs), renderState(iv.State), iv.ModelName,
+		fmt.Sprintf("%.0f%%", iv.GPUUtil), fmt.Sprintf("%.0f°", iv.GPUTemp), reqs, cost,
+	})
+}
+
+// tableLine pads or truncates cells to the columns' widths.
+func tableLine(cols []column, cells []string) string {
+	var b strings.Builder
+	b.WriteString("  ")
+	for i, cell := range cells {
+		w := cols[i].width
+		if lipgloss.Width(cell) > w {
+			cell = string([]rune(cell)[:w-1]) + "…" // only plain cells are that long
+		}
+		b.WriteString(cell + strings.Repeat(" ", w-lipgloss.Width(cell)+1))
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// RenderDetail renders the detail view for one instance: its card followed
+// by the tail of its container logs.
+func RenderDetail(iv *InstanceView, logs []string, err error, loading bool) string {
+	var b strings.Builder
+	b.WriteString(RenderInstance(iv))
+	b.WriteString("\n\n  " + stateDim.Render(fmt.Sprintf("Sticky (5m): %d served, %d missed",
+		iv.StickyHits, iv.StickyMisses)))
+	b.WriteString("\n\n  " + headerStyle.Render("Container logs") + "\n")
+	switch {
+	case loading:
+		b.WriteString("  " + stateDim.Render("fetching logs...") + "\n")
+	case err != nil:
+		b.WriteString("  " + stateUnhealthy.Render("logs unavailable: "+err.Error()) + "\n")
+	case logs == nil:
+		b.WriteString("  " + stateDim.Render("logs unavailable (requires the vast.ai API)") + "\n")
+	case len(logs) == 0:
+		b.WriteString("  " + stateDim.Render("(no output)") + "\n")
+	}
+	for _, line := range logs {
+		b.WriteString("  " + line + "\n")
+	}
+	return b.String()
+}
+
 func renderState(s vast.InstanceState) string {
 	switch s {
 	case vast.StateHealthy:
@@ -105,6 +277,8 @@ func renderState(s vast.InstanceState) string {
 		return stateConnecting.Render("CONNECTING")
 	case vast.StateRemoving:
 		return stateRemoving.Render("REMOVING")
+	case vast.StateDraining:
+		return stateRemoving.Render("DRAINING")
 	case vast.StateDiscovered:
 		return stateConnecting.Render("DISCOVERED")
 	default:
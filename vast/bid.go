@@ -0,0 +1,65 @@
+package vast
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+)
+
+// bidChanger is the part of Client the BidPolicy uses.
+type bidChanger interface {
+	ChangeBid(ctx context.Context, instanceID int, price float64) error
+}
+
+// BidPolicy raises the bids of interruptible instances before they are
+// outbid. When the machine's minimum bid comes within Margin of an
+// instance's bid (or passes it), the bid is raised to the minimum bid plus
+// Margin, but never above MaxPrice. Register Check with Watcher.OnPoll.
+type BidPolicy struct {
+	client   bidChanger
+	MaxPrice float64 // $/hour cap for any bid
+	Margin   float64 // fraction above the minimum bid to keep, e.g. 0.05
+}
+
+// NewBidPolicy creates a bid policy capped at maxPrice $/hour.
+func NewBidPolicy(client *Client, maxPrice, margin float64) *BidPolicy {
+	return &BidPolicy{client: client, MaxPrice: maxPrice, Margin: margin}
+}
+
+// Check bumps the bids of instances at risk of being outbid. Outbid
+// instances are bumped too, so they can resume if the cap allows.
+func (p *BidPolicy) Check(ctx context.Context, instances []Instance) {
+	for i := range instances {
+		inst := &instances[i]
+		if !inst.IsBid || inst.MinBid <= 0 {
+			continue
+		}
+		target := p.target(inst.MinBid)
+		if inst.DphBase >= inst.MinBid*(1+p.Margin) || target <= inst.DphBase {
+			continue // safe, or capped at or below the current bid
+		}
+		if target < inst.MinBid {
+			log.Printf("bid policy: instance %d min bid $%.3f/h exceeds cap $%.3f/h, not bidding",
+				inst.ID, inst.MinBid, p.MaxPrice)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := p.client.ChangeBid(ctx, inst.ID, target)
+		cancel()
+		if err != nil {
+			log.Printf("bid policy: instance %d: change bid to $%.3f/h: %v", inst.ID, target, err)
+			continue
+		}
+		log.Printf("bid policy: instance %d bid $%.3f/h → $%.3f/h (min bid $%.3f/h)",
+			inst.ID, inst.DphBase, target, inst.MinBid)
+	}
+}
+
+// target returns the bid to place for a machine with the given minimum
+// bid, rounded up to a tenth of a cent and capped at MaxPrice.
+func (p *BidPolicy) target(minBid float64) float64 {
+	bid := math.Ceil(minBid*(1+p.Margin)*1000) / 1000
+	return math.Min(bid, p.MaxPrice)
+}
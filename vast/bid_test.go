@@ -0,0 +1,60 @@
+package vast
+
+import (
+	"context"
+	"testing"
+)
+
+type fakeBidChanger struct {
+	bids map[int]float64
+}
+
+func (f *fakeBidChanger) ChangeBid(ctx context.Context, id int, price float64) error {
+	f.bids[id] = price
+	return nil
+}
+
+func TestBidPolicyCheck(t *testing.T) {
+	f := &fakeBidChanger{bids: map[int]float64{}}
+	p := &BidPolicy{client: f, MaxPrice: 0.50, Margin: 0.10}
+
+	p.Check(context.Background(), []Instance{
+		{ID: 1, IsBid: true, DphBase: 0.30, MinBid: 0.20},                         // safe
+		{ID: 2, IsBid: true, DphBase: 0.30, MinBid: 0.29},                         // within margin
+		{ID: 3, IsBid: true, DphBase: 0.30, MinBid: 0.48, ActualStatus: "outbid"}, // outbid, capped
+		{ID: 4, IsBid: true, DphBase: 0.30, MinBid: 0.60},                         // above cap
+		{ID: 5, IsBid: false, DphBase: 0.30, MinBid: 0.40},                        // on-demand
+	})
+
+	if _, ok := f.bids[1]; ok {
+		t.Error("instance 1 bid changed despite margin")
+	}
+	if got := f.bids[2]; got != 0.319 {
+		t.Errorf("instance 2 bid = %v, want 0.319", got)
+	}
+	if got := f.bids[3]; got != 0.50 {
+		t.Errorf("instance 3 bid = %v, want cap 0.50", got)
+	}
+	if _, ok := f.bids[4]; ok {
+		t.Error("instance 4 bid above cap")
+	}
+	if _, ok := f.bids[5]; ok {
+		t.Error("on-demand instance 5 bid changed")
+	}
+}
+
+func TestInstanceOutbid(t *testing.T) {
+	for _, tc := range []struct {
+		inst Instance
+		want bool
+	}{
+		{Instance{IsBid: true, ActualStatus: "outbid"}, true},
+		{Instance{IsBid: true, ActualStatus: "inactive"}, true},
+		{Instance{IsBid: true, ActualStatus: "running"}, false},
+		{Instance{IsBid: false, ActualStatus: "inactive"}, false},
+	} {
+		if got := tc.inst.Outbid(); got != tc.want {
+			t.Errorf("Outbid(%+v) = %v, want %v", tc.inst, got, tc.want)
+		}
+	}
+}
@@ -14,9 +14,10 @@ const defaultAPIBase = "https://console.vast.ai/api/v0"
 
 // Client is a vast.ai API client.
 type Client struct {
-	apiKey     string
-	baseURL    string
-	httpClient *http.Client
+	apiKey          string
+	baseURL         string
+	httpClient      *http.Client
+	logPollInterval time.Duration // delay between InstanceLogs polls
 }
 
 // NewClient creates a new vast.ai API client.
@@ -27,6 +28,7 @@ func NewClient(apiKey string) *Client {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		logPollInterval: time.Second,
 	}
 }
 
@@ -63,7 +65,25 @@ func (c *Client) SetBaseURL(url string) {
 
 // SetLabel sets the label on an instance via PUT /api/v0/instances/{id}/.
 func (c *Client) SetLabel(ctx context.Context, instanceID int, label string) error {
-	body, _ := json.Marshal(map[string]string{"label": label})
+	return c.updateInstance(ctx, instanceID, map[string]string{"label": label}, "set label")
+}
+
+// StartInstance starts a stopped instance via PUT /api/v0/instances/{id}/.
+// The instance may not be rentable again if its machine was taken meanwhile.
+func (c *Client) StartInstance(ctx context.Context, instanceID int) error {
+	return c.updateInstance(ctx, instanceID, map[string]string{"state": "running"}, "start instance")
+}
+
+// StopInstance stops an instance via PUT /api/v0/instances/{id}/. A stopped
+// instance keeps its disk (and storage charges) but stops GPU billing.
+func (c *Client) StopInstance(ctx context.Context, instanceID int) error {
+	return c.updateInstance(ctx, instanceID, map[string]string{"state": "stopped"}, "stop instance")
+}
+
+// updateInstance sends fields to PUT /api/v0/instances/{id}/. op names the
+// operation in errors.
+func (c *Client) updateInstance(ctx context.Context, instanceID int, fields map[string]string, op string) error {
+	body, _ := json.Marshal(fields)
 	url := fmt.Sprintf("%s/instances/%d/", c.baseURL, instanceID)
 	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewReader(body))
 	if err != nil {
@@ -80,7 +100,7 @@ func (c *Client) SetLabel(ctx context.Context, instanceID int, label string) err
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
-		return fmt.Errorf("set label returned HTTP %d: %s", resp.StatusCode, body)
+		return fmt.Errorf("%s returned HTTP %d: %s", op, resp.StatusCode, body)
 	}
 	return nil
 }
@@ -107,3 +127,209 @@ func (c *Client) DestroyInstance(ctx context.Context, instanceID int) error {
 	}
 	return nil
 }
+
+// Offer is a rentable machine returned by SearchOffers.
+type Offer struct {
+	ID       int     `json:"id"`
+	GPUName  string  `json:"gpu_name"`
+	NumGPUs  int     `json:"num_gpus"`
+	DphTotal float64 `json:"dph_total"` // total price in $/hour
+}
+
+// SearchOffers queries rentable offers via POST /api/v0/bundles/. query is
+// a vast.ai search filter object, e.g.
+//
+//	{"gpu_name": {"eq": "RTX 4090"}, "rentable": {"eq": true}, "order": [["dph_total", "asc"]]}
+//
+// Offers are returned in the order the API sorted them.
+func (c *Client) SearchOffers(ctx context.Context, query json.RawMessage) ([]Offer, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/bundles/", bytes.NewReader(query))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("search offers returned HTTP %d: %s", resp.StatusCode, body)
+	}
+
+	var result struct {
+		Offers []Offer `json:"offers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return result.Offers, nil
+}
+
+// CreateInstanceRequest describes the instance to create on an offer.
+// Either TemplateHashID or Image must be set.
+type CreateInstanceRequest struct {
+	TemplateHashID string            `json:"template_hash_id,omitempty"`
+	Image          string            `json:"image,omitempty"`
+	Disk           float64           `json:"disk,omitempty"` // GB
+	Label          string            `json:"label,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	Onstart        string            `json:"onstart,omitempty"`
+	RunType        string            `json:"runtype,omitempty"`
+}
+
+// CreateInstance rents offerID via PUT /api/v0/asks/{id}/ and returns the
+// new instance ID.
+func (c *Client) CreateInstance(ctx context.Context, offerID int, spec CreateInstanceRequest) (int, error) {
+	body, _ := json.Marshal(struct {
+		ClientID string `json:"client_id"`
+		CreateInstanceRequest
+	}{ClientID: "me", CreateInstanceRequest: spec})
+	url := fmt.Sprintf("%s/asks/%d/", c.baseURL, offerID)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, fmt.Errorf("create instance returned HTTP %d: %s", resp.StatusCode, body)
+	}
+
+	var result struct {
+		Success     bool `json:"success"`
+		NewContract int  `json:"new_contract"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("decode response: %w", err)
+	}
+	if !result.Success || result.NewContract == 0 {
+		return 0, fmt.Errorf("create instance on offer %d was not accepted", offerID)
+	}
+	return result.NewContract, nil
+}
+
+// logPollAttempts bounds how often InstanceLogs polls for the log file.
+const logPollAttempts = 10
+
+// InstanceLogs returns the last tail lines of an instance's container logs.
+// vast.ai uploads the logs asynchronously: PUT
+// /api/v0/instances/request_logs/{id}/ returns a URL that is polled until
+// the upload is available.
+func (c *Client) InstanceLogs(ctx context.Context, instanceID, tail int) (string, error) {
+	body, _ := json.Marshal(map[string]string{"tail": fmt.Sprint(tail)})
+	url := fmt.Sprintf("%s/instances/request_logs/%d/", c.baseURL, instanceID)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("request logs returned HTTP %d: %s", resp.StatusCode, body)
+	}
+	var result struct {
+		ResultURL string `json:"result_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+	if result.ResultURL == "" {
+		return "", fmt.Errorf("request logs returned no result URL")
+	}
+
+	for attempt := range logPollAttempts {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(c.logPollInterval):
+			}
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", result.ResultURL, nil)
+		if err != nil {
+			return "", fmt.Errorf("create request: %w", err)
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("fetch logs: %w", err)
+		}
+		logs, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return string(logs), err
+		}
+		// Not uploaded yet (S3 answers 403/404 until then).
+	}
+	return "", fmt.Errorf("logs for instance %d not available after %d attempts", instanceID, logPollAttempts)
+}
+
+// ChangeBid sets the hourly bid price of an interruptible instance via PUT
+// /api/v0/instances/bid_price/{id}/.
+func (c *Client) ChangeBid(ctx context.Context, instanceID int, price float64) error {
+	body, _ := json.Marshal(map[string]any{"client_id": "me", "price": price})
+	url := fmt.Sprintf("%s/instances/bid_price/%d/", c.baseURL, instanceID)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("change bid returned HTTP %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// AttachSSHKey authorizes an SSH public key (an authorized_keys line) on an
+// instance via POST /api/v0/instances/{id}/ssh/.
+func (c *Client) AttachSSHKey(ctx context.Context, instanceID int, publicKey string) error {
+	body, _ := json.Marshal(map[string]string{"ssh_key": publicKey})
+	url := fmt.Sprintf("%s/instances/%d/ssh/", c.baseURL, instanceID)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("attach ssh key returned HTTP %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestListInstances(t *testing.T) {
@@ -194,9 +196,213 @@ func TestSetLabelNetworkError(t *testing.T) {
 	}
 }
 
+func TestStartStopInstance(t *testing.T) {
+	var gotMethod, gotPath string
+	var gotBody map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath = r.Method, r.URL.Path
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient("test-key", srv.URL)
+	if err := c.StopInstance(context.Background(), 42); err != nil {
+		t.Fatalf("StopInstance() error: %v", err)
+	}
+	if gotMethod != "PUT" || gotPath != "/instances/42/" || gotBody["state"] != "stopped" {
+		t.Errorf("stop: %s %s %v", gotMethod, gotPath, gotBody)
+	}
+	if err := c.StartInstance(context.Background(), 42); err != nil {
+		t.Fatalf("StartInstance() error: %v", err)
+	}
+	if gotBody["state"] != "running" {
+		t.Errorf("start: state = %q, want running", gotBody["state"])
+	}
+}
+
+func TestStartInstanceHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"no machine"}`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient("key", srv.URL)
+	err := c.StartInstance(context.Background(), 1)
+	if err == nil || !strings.Contains(err.Error(), "start instance returned HTTP 400") {
+		t.Fatalf("err = %v, want start instance HTTP 400 error", err)
+	}
+}
+
+func TestSearchOffers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/bundles/" {
+			t.Errorf("got %s %s, want POST /bundles/", r.Method, r.URL.Path)
+		}
+		var q map[string]any
+		json.NewDecoder(r.Body).Decode(&q)
+		if _, ok := q["gpu_name"]; !ok {
+			t.Errorf("query not forwarded: %v", q)
+		}
+		w.Write([]byte(`{"offers":[{"id":7,"gpu_name":"RTX 4090","num_gpus":1,"dph_total":0.4}]}`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient("test-key", srv.URL)
+	offers, err := c.SearchOffers(context.Background(), json.RawMessage(`{"gpu_name":{"eq":"RTX 4090"}}`))
+	if err != nil {
+		t.Fatalf("SearchOffers() error: %v", err)
+	}
+	if len(offers) != 1 || offers[0].ID != 7 || offers[0].DphTotal != 0.4 {
+		t.Errorf("offers = %+v", offers)
+	}
+}
+
+func TestCreateInstance(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.URL.Path != "/asks/7/" {
+			t.Errorf("got %s %s, want PUT /asks/7/", r.Method, r.URL.Path)
+		}
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["client_id"] != "me" || body["template_hash_id"] != "abc" {
+			t.Errorf("body = %v", body)
+		}
+		w.Write([]byte(`{"success":true,"new_contract":1234}`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient("test-key", srv.URL)
+	id, err := c.CreateInstance(context.Background(), 7, CreateInstanceRequest{TemplateHashID: "abc"})
+	if err != nil {
+		t.Fatalf("CreateInstance() error: %v", err)
+	}
+	if id != 1234 {
+		t.Errorf("id = %d, want 1234", id)
+	}
+}
+
+func TestCreateInstanceRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":false,"error":"no_such_ask"}`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient("test-key", srv.URL)
+	if _, err := c.CreateInstance(context.Background(), 7, CreateInstanceRequest{Image: "vllm"}); err == nil {
+		t.Fatal("expected error for rejected create")
+	}
+}
+
+func TestInstanceLogs(t *testing.T) {
+	polls := 0
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/instances/request_logs/42/":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if r.Method != "PUT" || body["tail"] != "100" {
+				t.Errorf("got %s %v", r.Method, body)
+			}
+			json.NewEncoder(w).Encode(map[string]any{"success": true, "result_url": srv.URL + "/logs/42.txt"})
+		case "/logs/42.txt":
+			polls++
+			if polls < 3 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte("loading model\nready\n"))
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestClient("test-key", srv.URL)
+	logs, err := c.InstanceLogs(context.Background(), 42, 100)
+	if err != nil {
+		t.Fatalf("InstanceLogs() error: %v", err)
+	}
+	if logs != "loading model\nready\n" || polls != 3 {
+		t.Errorf("logs = %q after %d polls", logs, polls)
+	}
+}
+
+func TestInstanceLogsNeverReady(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/instances/request_logs/1/" {
+			json.NewEncoder(w).Encode(map[string]any{"result_url": srv.URL + "/missing"})
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	c := newTestClient("key", srv.URL)
+	if _, err := c.InstanceLogs(context.Background(), 1, 10); err == nil {
+		t.Fatal("expected error when logs never become available")
+	}
+}
+
+func TestChangeBid(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.URL.Path != "/instances/bid_price/42/" {
+			t.Errorf("got %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient("test-key", srv.URL)
+	if err := c.ChangeBid(context.Background(), 42, 0.35); err != nil {
+		t.Fatalf("ChangeBid() error: %v", err)
+	}
+	if body["price"] != 0.35 || body["client_id"] != "me" {
+		t.Errorf("body = %v", body)
+	}
+}
+
+func TestAttachSSHKey(t *testing.T) {
+	var body map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/instances/42/ssh/" {
+			t.Errorf("got %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient("test-key", srv.URL)
+	if err := c.AttachSSHKey(context.Background(), 42, "ssh-ed25519 AAAA vastproxy"); err != nil {
+		t.Fatalf("AttachSSHKey() error: %v", err)
+	}
+	if body["ssh_key"] != "ssh-ed25519 AAAA vastproxy" {
+		t.Errorf("body = %v", body)
+	}
+}
+
+func TestAttachSSHKeyError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad key", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	c := newTestClient("test-key", srv.URL)
+	if err := c.AttachSSHKey(context.Background(), 42, "junk"); err == nil {
+		t.Fatal("expected error for HTTP 400")
+	}
+}
+
 // newTestClient creates a Client pointing at a test server instead of the real API.
 func newTestClient(apiKey, baseURL string) *Client {
 	c := NewClient(apiKey)
 	c.baseURL = baseURL
+	c.logPollInterval = time.Millisecond
 	return c
 }
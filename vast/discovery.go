@@ -0,0 +1,118 @@
+package vast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Discovery is the interface the backend manager uses to learn about
+// instances. Implementations emit "added", "updated" and "removed" events
+// (and optionally "moved", "restarted", "draining", "unreachable" and
+// "reachable") to subscribers
+// and accept lifecycle state updates from the backends.
+type Discovery interface {
+	// Subscribe returns a channel receiving every instance event.
+	Subscribe() <-chan InstanceEvent
+	// Unsubscribe stops delivery to a subscribed channel and closes it.
+	Unsubscribe(ch <-chan InstanceEvent)
+	// Start runs discovery until ctx is canceled, then closes all
+	// subscriber channels. Call in a goroutine.
+	Start(ctx context.Context)
+	// HasInstance reports whether an instance is still known.
+	HasInstance(id int) bool
+	// SetInstanceState records a backend-driven lifecycle transition.
+	SetInstanceState(id int, state InstanceState)
+}
+
+// Provider lists the instances a Watcher should track. *Client implements
+// it against the vast.ai API; FileProvider reads a local JSON file.
+type Provider interface {
+	ListInstances(ctx context.Context) ([]Instance, error)
+}
+
+// instanceDestroyer is implemented by providers that can destroy instances.
+type instanceDestroyer interface {
+	DestroyInstance(ctx context.Context, instanceID int) error
+}
+
+// Verify implementations at compile time.
+var (
+	_ Discovery = (*Watcher)(nil)
+	_ Provider  = (*Client)(nil)
+	_ Provider  = (*FileProvider)(nil)
+)
+
+// FileProvider lists instances from a JSON file on disk. The file uses the
+// same shape as the vast.ai API response ({"instances": [...]}) or a bare
+// array of instances. It is re-read only when its modification time or size
+// changes, so it can be edited while the proxy is running.
+type FileProvider struct {
+	path string
+
+	mu        sync.Mutex
+	modTime   time.Time
+	size      int64
+	instances []Instance
+}
+
+// NewFileProvider creates a provider backed by the JSON file at path.
+func NewFileProvider(path string) *FileProvider {
+	return &FileProvider{path: path}
+}
+
+// ListInstances returns the instances in the file, re-reading it if it has
+// changed since the last call.
+func (p *FileProvider) ListInstances(ctx context.Context) ([]Instance, error) {
+	fi, err := os.Stat(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("stat %s: %w", p.path, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.instances == nil || !fi.ModTime().Equal(p.modTime) || fi.Size() != p.size {
+		data, err := os.ReadFile(p.path)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", p.path, err)
+		}
+		instances, err := parseInstancesFile(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", p.path, err)
+		}
+		p.instances = instances
+		p.modTime = fi.ModTime()
+		p.size = fi.Size()
+	}
+
+	// Return a fresh copy — the watcher keeps pointers into the slice.
+	out := make([]Instance, len(p.instances))
+	copy(out, p.instances)
+	return out, nil
+}
+
+// parseInstancesFile accepts either {"instances": [...]} or [...]. Instances
+// without an explicit actual_status are treated as running.
+func parseInstancesFile(data []byte) ([]Instance, error) {
+	var instances []Instance
+	if err := json.Unmarshal(data, &instances); err != nil {
+		var resp InstancesResponse
+		if err2 := json.Unmarshal(data, &resp); err2 != nil {
+			return nil, err2
+		}
+		instances = resp.Instances
+	}
+	if instances == nil {
+		instances = []Instance{}
+	}
+	for i := range instances {
+		if instances[i].ActualStatus == "" {
+			instances[i].ActualStatus = "running"
+		}
+	}
+	return instances, nil
+}
@@ -0,0 +1,124 @@
+package vast
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeInstancesFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileProviderWrappedFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances.json")
+	writeInstancesFile(t, path, `{"instances":[{"id":1,"actual_status":"running","ssh_host":"h","ssh_port":22}]}`)
+
+	p := NewFileProvider(path)
+	instances, err := p.ListInstances(context.Background())
+	if err != nil {
+		t.Fatalf("ListInstances() error: %v", err)
+	}
+	if len(instances) != 1 || instances[0].ID != 1 || instances[0].SSHHost != "h" {
+		t.Errorf("instances = %+v", instances)
+	}
+}
+
+func TestFileProviderBareArrayDefaultsRunning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances.json")
+	writeInstancesFile(t, path, `[{"id":7},{"id":8,"actual_status":"exited"}]`)
+
+	p := NewFileProvider(path)
+	instances, err := p.ListInstances(context.Background())
+	if err != nil {
+		t.Fatalf("ListInstances() error: %v", err)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("got %d instances, want 2", len(instances))
+	}
+	if instances[0].ActualStatus != "running" {
+		t.Errorf("status = %q, want running (default)", instances[0].ActualStatus)
+	}
+	if instances[1].ActualStatus != "exited" {
+		t.Errorf("status = %q, want exited", instances[1].ActualStatus)
+	}
+}
+
+func TestFileProviderRereadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances.json")
+	writeInstancesFile(t, path, `[{"id":1}]`)
+
+	p := NewFileProvider(path)
+	if instances, _ := p.ListInstances(context.Background()); len(instances) != 1 {
+		t.Fatalf("got %d instances, want 1", len(instances))
+	}
+
+	writeInstancesFile(t, path, `[{"id":1},{"id":2}]`)
+	// Bump mtime explicitly in case the filesystem has coarse timestamps.
+	later := time.Now().Add(time.Second)
+	os.Chtimes(path, later, later)
+
+	instances, err := p.ListInstances(context.Background())
+	if err != nil {
+		t.Fatalf("ListInstances() error: %v", err)
+	}
+	if len(instances) != 2 {
+		t.Errorf("got %d instances after change, want 2", len(instances))
+	}
+}
+
+func TestFileProviderMissingFile(t *testing.T) {
+	p := NewFileProvider(filepath.Join(t.TempDir(), "missing.json"))
+	if _, err := p.ListInstances(context.Background()); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+}
+
+func TestFileProviderBadJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances.json")
+	writeInstancesFile(t, path, `not json`)
+
+	p := NewFileProvider(path)
+	if _, err := p.ListInstances(context.Background()); err == nil {
+		t.Fatal("expected error for bad JSON")
+	}
+}
+
+func TestWatcherWithFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances.json")
+	writeInstancesFile(t, path, `[{"id":5,"public_ipaddr":"10.0.0.5"}]`)
+
+	var d Discovery = NewWatcher(NewFileProvider(path), time.Hour)
+	ch := d.Subscribe()
+	d.(*Watcher).poll(context.Background())
+
+	select {
+	case evt := <-ch:
+		if evt.Type != "added" || evt.Instance.ID != 5 {
+			t.Errorf("got %s/%d, want added/5", evt.Type, evt.Instance.ID)
+		}
+	default:
+		t.Fatal("expected added event")
+	}
+	if !d.HasInstance(5) {
+		t.Error("HasInstance(5) = false")
+	}
+}
+
+func TestWatcherDestroyAllUnsupportedProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances.json")
+	writeInstancesFile(t, path, `[{"id":5}]`)
+
+	w := NewWatcher(NewFileProvider(path), time.Hour)
+	w.poll(context.Background())
+	// Should log and return without panicking.
+	w.DestroyAll(context.Background())
+	if !w.HasInstance(5) {
+		t.Error("instance should still be tracked")
+	}
+}
@@ -0,0 +1,151 @@
+package vast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LoggedEvent is one line of the event log.
+type LoggedEvent struct {
+	Time          time.Time `json:"time"`
+	Kind          string    `json:"kind"`  // "instance", "state" or "action"
+	Event         string    `json:"event"` // event type, new state or action
+	InstanceID    int       `json:"instance_id,omitempty"`
+	Name          string    `json:"name,omitempty"`
+	State         string    `json:"state,omitempty"`
+	PreviousState string    `json:"previous_state,omitempty"`
+	Detail        string    `json:"detail,omitempty"`
+}
+
+// EventLog appends every instance event, state transition and scaling
+// action to a file as JSON lines, an audit trail of the fleet that
+// survives restarts. Once the file would grow past maxBytes it is rotated
+// to path.1, path.2 and so on, keeping the newest keep files. Safe for
+// concurrent use.
+type EventLog struct {
+	path     string
+	maxBytes int64 // 0 = never rotate
+	keep     int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// OpenEventLog opens path for appending, creating it if needed.
+func OpenEventLog(path string, maxBytes int64, keep int) (*EventLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &EventLog{path: path, maxBytes: maxBytes, keep: keep, f: f, size: st.Size()}, nil
+}
+
+// Close closes the log file.
+func (l *EventLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// Write appends e, stamping it with the current time if it has none.
+// Errors are logged, not returned, so auditing never blocks the fleet.
+func (l *EventLog) Write(e LoggedEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("event log: marshal: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxBytes > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxBytes {
+		if err := l.rotate(); err != nil {
+			log.Printf("event log: rotate %s: %v", l.path, err)
+		}
+	}
+	n, err := l.f.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		log.Printf("event log: write %s: %v", l.path, err)
+	}
+}
+
+// rotate shifts path.N to path.N+1, dropping the oldest, moves the current
+// file to path.1 and starts a new one. Must be called with mu held.
+func (l *EventLog) rotate() error {
+	l.f.Close()
+	for i := l.keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	if l.keep > 0 {
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	l.f, l.size = f, 0
+	return nil
+}
+
+// Run logs every event received on events until ctx is canceled or the
+// channel is closed. Call in a goroutine.
+func (l *EventLog) Run(ctx context.Context, events <-chan InstanceEvent) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-events:
+			if !ok {
+				return
+			}
+			e := LoggedEvent{Kind: "instance", Event: evt.Type}
+			if evt.Instance != nil {
+				e.InstanceID = evt.Instance.ID
+				e.Name = evt.Instance.DisplayName()
+				e.State = evt.Instance.State.String()
+			}
+			if evt.Err != nil {
+				e.Detail = evt.Err.Error()
+			}
+			l.Write(e)
+		}
+	}
+}
+
+// StateChanged logs a state transition. Use it as a Watcher.OnStateChange
+// hook.
+func (l *EventLog) StateChanged(inst Instance, from InstanceState) {
+	l.Write(LoggedEvent{
+		Time:          inst.StateChangedAt,
+		Kind:          "state",
+		Event:         inst.State.String(),
+		InstanceID:    inst.ID,
+		Name:          inst.DisplayName(),
+		State:         inst.State.String(),
+		PreviousState: from.String(),
+	})
+}
+
+// Action logs a scaling action. Use it as a Watcher.OnAction or
+// Watchdog.OnAction hook.
+func (l *EventLog) Action(action string, id int, detail string) {
+	l.Write(LoggedEvent{Kind: "action", Event: action, InstanceID: id, Detail: detail})
+}
@@ -0,0 +1,101 @@
+package vast
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readEventLog returns the events in a JSONL file.
+func readEventLog(t *testing.T, path string) []LoggedEvent {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out []LoggedEvent
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e LoggedEvent
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("bad line %q: %v", sc.Text(), err)
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func TestEventLogRecordsEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	l, err := OpenEventLog(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan InstanceEvent, 2)
+	events <- InstanceEvent{Type: "added", Instance: &Instance{ID: 1, GPUName: "A100", NumGPUs: 1}}
+	events <- InstanceEvent{Type: "unreachable", Err: errors.New("api down")}
+	close(events)
+	l.Run(context.Background(), events)
+	l.StateChanged(Instance{ID: 1, GPUName: "A100", NumGPUs: 1, State: StateHealthy}, StateConnecting)
+	l.Action("destroy", 1, "manual")
+	l.Close()
+
+	// Reopening appends.
+	l, _ = OpenEventLog(path, 0, 0)
+	l.Action("create", 2, "offer 9")
+	l.Close()
+
+	got := readEventLog(t, path)
+	if len(got) != 5 {
+		t.Fatalf("got %d events, want 5: %+v", len(got), got)
+	}
+	if e := got[0]; e.Kind != "instance" || e.Event != "added" || e.InstanceID != 1 || e.Name != "#1 A100x1" || e.Time.IsZero() {
+		t.Errorf("added = %+v", e)
+	}
+	if e := got[1]; e.Event != "unreachable" || e.Detail != "api down" || e.InstanceID != 0 {
+		t.Errorf("unreachable = %+v", e)
+	}
+	if e := got[2]; e.Kind != "state" || e.State != "HEALTHY" || e.PreviousState != "CONNECTING" {
+		t.Errorf("state = %+v", e)
+	}
+	if e := got[4]; e.Kind != "action" || e.Event != "create" || e.InstanceID != 2 || e.Detail != "offer 9" {
+		t.Errorf("action = %+v", e)
+	}
+}
+
+func TestEventLogRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	l, err := OpenEventLog(path, 200, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for i := range 10 {
+		l.Write(LoggedEvent{Time: time.Unix(int64(i), 0), Kind: "action", Event: "create", InstanceID: i + 1})
+	}
+
+	current := readEventLog(t, path)
+	older := readEventLog(t, path+".1")
+	if len(current) == 0 || len(older) == 0 {
+		t.Fatalf("current = %d, .1 = %d events", len(current), len(older))
+	}
+	if st, _ := os.Stat(path); st.Size() > 200 {
+		t.Errorf("current file is %d bytes, want at most 200", st.Size())
+	}
+	if last := current[len(current)-1]; last.InstanceID != 10 {
+		t.Errorf("newest event = %+v", last)
+	}
+	if older[len(older)-1].InstanceID != current[0].InstanceID-1 {
+		t.Errorf(".1 ends with %d, current starts with %d", older[len(older)-1].InstanceID, current[0].InstanceID)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("kept more than 2 rotated files: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package vast
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// OutageAlarm raises an alarm when the fleet has had no healthy backends
+// for longer than a grace period: the outage users most need paged on. It
+// is armed once any backend has been healthy, so a fleet that is still
+// booting doesn't count as down.
+type OutageAlarm struct {
+	fleet   Fleet
+	after   time.Duration
+	onRaise []func(since time.Time)
+	onClear []func(since time.Time)
+
+	mu     sync.Mutex
+	armed  bool      // a backend has been healthy
+	since  time.Time // when the healthy count hit zero; zero while healthy
+	raised bool
+}
+
+// NewOutageAlarm creates an alarm raised after the fleet has had no
+// healthy backends for after.
+func NewOutageAlarm(fleet Fleet, after time.Duration) *OutageAlarm {
+	return &OutageAlarm{fleet: fleet, after: after}
+}
+
+// OnRaise registers fn to be called with the start of the outage when the
+// alarm is raised. Call before Run.
+func (a *OutageAlarm) OnRaise(fn func(since time.Time)) {
+	a.onRaise = append(a.onRaise, fn)
+}
+
+// OnClear registers fn to be called with the start of the outage when a
+// backend is healthy again after the alarm was raised. Call before Run.
+func (a *OutageAlarm) OnClear(fn func(since time.Time)) {
+	a.onClear = append(a.onClear, fn)
+}
+
+// Run checks the fleet every interval until ctx is canceled.
+func (a *OutageAlarm) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			a.check(now)
+		}
+	}
+}
+
+// check updates the outage state from the healthy count at now, calling
+// the hooks when the alarm is raised or cleared.
+func (a *OutageAlarm) check(now time.Time) {
+	healthy := a.fleet.HealthyCount() > 0
+
+	a.mu.Lock()
+	var hooks []func(time.Time)
+	since := a.since
+	switch {
+	case healthy:
+		if a.raised {
+			hooks = a.onClear
+		}
+		a.armed, a.since, a.raised = true, time.Time{}, false
+	case !a.armed:
+	case a.since.IsZero():
+		a.since = now
+	case !a.raised && now.Sub(a.since) >= a.after:
+		a.raised = true
+		hooks = a.onRaise
+	}
+	a.mu.Unlock()
+
+	if hooks != nil {
+		if healthy {
+			log.Printf("outage: healthy backends are back after %v", now.Sub(since).Round(time.Second))
+		} else {
+			log.Printf("outage: no healthy backends since %s", since.Format(time.RFC3339))
+		}
+	}
+	for _, fn := range hooks {
+		fn(since)
+	}
+}
+
+// Outage reports when the current outage began, if the alarm is raised.
+func (a *OutageAlarm) Outage() (since time.Time, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.since, a.raised
+}
@@ -0,0 +1,52 @@
+package vast
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutageAlarm(t *testing.T) {
+	fleet := &fakeFleet{healthy: map[int]bool{}}
+	a := NewOutageAlarm(fleet, time.Minute)
+	var raised, cleared []time.Time
+	a.OnRaise(func(since time.Time) { raised = append(raised, since) })
+	a.OnClear(func(since time.Time) { cleared = append(cleared, since) })
+
+	t0 := time.Now()
+	// A fleet that has never been healthy is booting, not down.
+	a.check(t0)
+	a.check(t0.Add(time.Hour))
+	if len(raised) != 0 {
+		t.Fatal("alarm raised before any backend was healthy")
+	}
+
+	fleet.healthy = map[int]bool{1: true}
+	a.check(t0.Add(time.Hour))
+	fleet.healthy = map[int]bool{}
+	down := t0.Add(2 * time.Hour)
+	a.check(down)
+	a.check(down.Add(59 * time.Second))
+	if _, ok := a.Outage(); ok || len(raised) != 0 {
+		t.Fatal("alarm raised before the grace period")
+	}
+	a.check(down.Add(time.Minute))
+	a.check(down.Add(2 * time.Minute)) // raised once
+	if since, ok := a.Outage(); !ok || !since.Equal(down) || len(raised) != 1 || !raised[0].Equal(down) {
+		t.Fatalf("Outage() = %v, %v; raised = %v", since, ok, raised)
+	}
+
+	fleet.healthy = map[int]bool{1: true, 2: true}
+	a.check(down.Add(3 * time.Minute))
+	if _, ok := a.Outage(); ok || len(cleared) != 1 || !cleared[0].Equal(down) {
+		t.Errorf("after recovery: cleared = %v", cleared)
+	}
+
+	// A blip shorter than the grace period doesn't raise it.
+	fleet.healthy = map[int]bool{}
+	a.check(down.Add(4 * time.Minute))
+	fleet.healthy = map[int]bool{1: true}
+	a.check(down.Add(4*time.Minute + 30*time.Second))
+	if len(raised) != 1 || len(cleared) != 1 {
+		t.Errorf("blip: raised = %v, cleared = %v", raised, cleared)
+	}
+}
@@ -0,0 +1,318 @@
+package vast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// ProvisionSpec describes the instances to rent when the fleet needs more
+// capacity: an offer search query and the instance to create on the chosen
+// offer.
+type ProvisionSpec struct {
+	Offers   json.RawMessage       `json:"offers"`   // SearchOffers query
+	Instance CreateInstanceRequest `json:"instance"` // CreateInstance spec
+}
+
+// LoadProvisionSpec reads a ProvisionSpec from a JSON file.
+func LoadProvisionSpec(path string) (ProvisionSpec, error) {
+	var spec ProvisionSpec
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return spec, err
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return spec, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(spec.Offers) == 0 {
+		return spec, fmt.Errorf("%s: missing offers query", path)
+	}
+	if spec.Instance.TemplateHashID == "" && spec.Instance.Image == "" {
+		return spec, fmt.Errorf("%s: instance needs template_hash_id or image", path)
+	}
+	return spec, nil
+}
+
+// Fleet reports backend health to the Watchdog.
+type Fleet interface {
+	HealthyCount() int
+	IsHealthy(id int) bool
+	TotalCount() int        // backends in the fleet, healthy or not
+	HasBackend(id int) bool // whether the instance is in the fleet
+}
+
+// instanceProvisioner is the part of Client the Watchdog uses.
+type instanceProvisioner interface {
+	SearchOffers(ctx context.Context, query json.RawMessage) ([]Offer, error)
+	CreateInstance(ctx context.Context, offerID int, spec CreateInstanceRequest) (int, error)
+	DestroyInstance(ctx context.Context, instanceID int) error
+}
+
+// Watchdog keeps at least a minimum number of healthy backends by renting
+// replacement instances from a ProvisionSpec whenever the healthy count
+// drops below the floor. Instances it created count toward the floor while
+// they boot, so slow starts don't trigger a provisioning storm; those still
+// not healthy after BootTimeout are destroyed, since they keep billing.
+type Watchdog struct {
+	client     instanceProvisioner
+	spec       ProvisionSpec
+	minHealthy int
+	fleet      Fleet
+
+	// BootTimeout is how long a newly created instance may take to
+	// become healthy before it is destroyed.
+	BootTimeout time.Duration
+
+	// MaxInstances caps the fleet the watchdog rents into, counting
+	// unhealthy and booting instances, so rentals that never come up
+	// can't make it rent without bound. 0 means no cap.
+	MaxInstances int
+
+	actionHooks []ActionFunc
+
+	provisionMu sync.Mutex // serializes renting, so MaxInstances holds
+
+	mu       sync.Mutex
+	pending  map[int]time.Time // instance ID → creation time
+	bootSum  time.Duration     // total boot time of instances that came up
+	bootSeen int               // number of instances in bootSum
+}
+
+// defaultBootEstimate is the assumed boot time before any provisioned
+// instance has been seen to come up.
+const defaultBootEstimate = 5 * time.Minute
+
+// NewWatchdog creates a watchdog that keeps minHealthy backends healthy.
+func NewWatchdog(client *Client, spec ProvisionSpec, minHealthy int, fleet Fleet) *Watchdog {
+	return &Watchdog{
+		client:      client,
+		spec:        spec,
+		minHealthy:  minHealthy,
+		fleet:       fleet,
+		BootTimeout: 20 * time.Minute,
+		pending:     make(map[int]time.Time),
+	}
+}
+
+// OnAction registers fn to be called after each instance the Watchdog
+// creates or destroys. Call before Run.
+func (w *Watchdog) OnAction(fn ActionFunc) {
+	w.actionHooks = append(w.actionHooks, fn)
+}
+
+// Run checks the fleet every interval until ctx is canceled.
+func (w *Watchdog) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check(ctx)
+		}
+	}
+}
+
+// check destroys instances that failed to boot and provisions instances
+// to cover any shortfall below the floor.
+func (w *Watchdog) check(ctx context.Context) {
+	for _, id := range w.expired() {
+		w.destroy(ctx, id)
+	}
+	deficit := w.minHealthy - w.fleet.HealthyCount() - w.pendingCount()
+	if deficit <= 0 {
+		return
+	}
+	log.Printf("watchdog: %d healthy backends below floor of %d, provisioning %d",
+		w.fleet.HealthyCount(), w.minHealthy, deficit)
+	w.Provision(ctx, deficit)
+}
+
+// pendingCount returns the number of created instances still booting,
+// forgetting those that became healthy. Those past BootTimeout count until
+// check destroys them.
+func (w *Watchdog) pendingCount() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for id, created := range w.pending {
+		if w.fleet.IsHealthy(id) {
+			w.bootSum += time.Since(created)
+			w.bootSeen++
+			delete(w.pending, id)
+		}
+	}
+	return len(w.pending)
+}
+
+// expired forgets and returns the created instances that didn't become
+// healthy within BootTimeout.
+func (w *Watchdog) expired() []int {
+	w.pendingCount()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var ids []int
+	for id, created := range w.pending {
+		if time.Since(created) > w.BootTimeout {
+			ids = append(ids, id)
+			delete(w.pending, id)
+		}
+	}
+	return ids
+}
+
+// destroy destroys an instance that failed to boot. If that fails, the
+// instance keeps counting toward MaxInstances while it is in the fleet.
+func (w *Watchdog) destroy(ctx context.Context, id int) {
+	log.Printf("watchdog: instance %d not healthy after %v, destroying", id, w.BootTimeout)
+	if err := w.client.DestroyInstance(ctx, id); err != nil {
+		log.Printf("watchdog: destroy instance %d failed: %v", id, err)
+		return
+	}
+	for _, fn := range w.actionHooks {
+		fn("destroy", id, fmt.Sprintf("not healthy after %v", w.BootTimeout))
+	}
+}
+
+// fleetSize returns the number of instances in the fleet, healthy or not,
+// plus those created but not in it yet. The instance gone, already
+// destroyed but perhaps still listed, isn't counted.
+func (w *Watchdog) fleetSize(gone int) int {
+	n := w.fleet.TotalCount()
+	if gone != 0 && w.fleet.HasBackend(gone) {
+		n--
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for id := range w.pending {
+		if !w.fleet.HasBackend(id) {
+			n++
+		}
+	}
+	return n
+}
+
+// TimeToCapacity estimates how long until the first instance still being
+// provisioned becomes healthy, from the average boot time observed so far.
+// It reports false if nothing is being provisioned.
+func (w *Watchdog) TimeToCapacity() (time.Duration, bool) {
+	if w.pendingCount() == 0 {
+		return 0, false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	boot := defaultBootEstimate
+	if w.bootSeen > 0 {
+		boot = w.bootSum / time.Duration(w.bootSeen)
+	}
+	var oldest time.Time
+	for _, created := range w.pending {
+		if oldest.IsZero() || created.Before(oldest) {
+			oldest = created
+		}
+	}
+	return max(boot-time.Since(oldest), 0), true
+}
+
+// defaultOfferQuery is used when the spec has no offer query: the cheapest
+// rentable offers first.
+const defaultOfferQuery = `{"rentable": {"eq": true}, "order": [["dph_total", "asc"]]}`
+
+// Provision rents n instances from the spec, trying offers in the order
+// the search returned them. It returns the IDs of the created instances.
+func (w *Watchdog) Provision(ctx context.Context, n int) []int {
+	return w.provision(ctx, n, w.spec.Offers, w.spec.Instance, 0)
+}
+
+// Replace rents one instance equivalent to inst, which was destroyed: an
+// offer with the same GPU model and count (unless the spec's query says
+// otherwise), created from inst's template when it has one and from the
+// spec otherwise. Like Provision, it rents nothing once the fleet is at
+// MaxInstances, so a loop of destroying and replacing rentals that never
+// come up can't grow the fleet. It returns the new instance ID, or 0 on
+// failure.
+func (w *Watchdog) Replace(ctx context.Context, inst Instance) int {
+	query := make(map[string]any)
+	raw := w.spec.Offers
+	if len(raw) == 0 {
+		raw = json.RawMessage(defaultOfferQuery)
+	}
+	if err := json.Unmarshal(raw, &query); err != nil {
+		log.Printf("watchdog: bad offer query: %v", err)
+		return 0
+	}
+	if _, ok := query["gpu_name"]; !ok && inst.GPUName != "" {
+		query["gpu_name"] = map[string]any{"eq": inst.GPUName}
+	}
+	if _, ok := query["num_gpus"]; !ok && inst.NumGPUs > 0 {
+		query["num_gpus"] = map[string]any{"eq": inst.NumGPUs}
+	}
+	offers, _ := json.Marshal(query)
+
+	create := w.spec.Instance
+	if inst.TemplateHashID != "" {
+		create.TemplateHashID = inst.TemplateHashID
+	}
+	if create.TemplateHashID == "" && create.Image == "" {
+		log.Printf("watchdog: cannot replace instance %d: no template and no spec", inst.ID)
+		return 0
+	}
+
+	log.Printf("watchdog: replacing destroyed instance %d (%s x%d)", inst.ID, inst.GPUName, inst.NumGPUs)
+	if ids := w.provision(ctx, 1, offers, create, inst.ID); len(ids) > 0 {
+		return ids[0]
+	}
+	return 0
+}
+
+// provision rents up to n instances; gone is an instance just destroyed,
+// which no longer counts toward MaxInstances (0 if none).
+func (w *Watchdog) provision(ctx context.Context, n int, query json.RawMessage, create CreateInstanceRequest, gone int) []int {
+	w.provisionMu.Lock()
+	defer w.provisionMu.Unlock()
+	if w.MaxInstances > 0 {
+		room := w.MaxInstances - w.fleetSize(gone)
+		if room <= 0 {
+			log.Printf("watchdog: fleet at its cap of %d instances, not renting", w.MaxInstances)
+			return nil
+		}
+		n = min(n, room)
+	}
+
+	offers, err := w.client.SearchOffers(ctx, query)
+	if err != nil {
+		log.Printf("watchdog: search offers: %v", err)
+		return nil
+	}
+
+	var created []int
+	for _, offer := range offers {
+		if len(created) == n {
+			break
+		}
+		id, err := w.client.CreateInstance(ctx, offer.ID, create)
+		if err != nil {
+			log.Printf("watchdog: offer %d (%s x%d, $%.3f/h): %v",
+				offer.ID, offer.GPUName, offer.NumGPUs, offer.DphTotal, err)
+			continue
+		}
+		log.Printf("watchdog: created instance %d on offer %d (%s x%d, $%.3f/h)",
+			id, offer.ID, offer.GPUName, offer.NumGPUs, offer.DphTotal)
+		created = append(created, id)
+		for _, fn := range w.actionHooks {
+			fn("create", id, fmt.Sprintf("offer %d (%s x%d, $%.3f/h)", offer.ID, offer.GPUName, offer.NumGPUs, offer.DphTotal))
+		}
+
+		w.mu.Lock()
+		w.pending[id] = time.Now()
+		w.mu.Unlock()
+	}
+	if len(created) < n {
+		log.Printf("watchdog: provisioned %d of %d instances (%d offers)", len(created), n, len(offers))
+	}
+	return created
+}
@@ -0,0 +1,269 @@
+package vast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeProvisioner struct {
+	mu        sync.Mutex
+	queries   []map[string]any
+	specs     []CreateInstanceRequest
+	offers    []Offer
+	fail      map[int]bool // offer IDs whose create fails
+	created   []int        // offer IDs rented
+	destroyed []int        // instance IDs destroyed
+	nextID    int
+}
+
+func (f *fakeProvisioner) SearchOffers(ctx context.Context, query json.RawMessage) ([]Offer, error) {
+	var q map[string]any
+	json.Unmarshal(query, &q)
+	f.mu.Lock()
+	f.queries = append(f.queries, q)
+	f.mu.Unlock()
+	return f.offers, nil
+}
+
+func (f *fakeProvisioner) CreateInstance(ctx context.Context, offerID int, spec CreateInstanceRequest) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail[offerID] {
+		return 0, errors.New("offer gone")
+	}
+	f.created = append(f.created, offerID)
+	f.specs = append(f.specs, spec)
+	f.nextID++
+	return 100 + f.nextID, nil
+}
+
+func (f *fakeProvisioner) DestroyInstance(ctx context.Context, instanceID int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.destroyed = append(f.destroyed, instanceID)
+	return nil
+}
+
+type fakeFleet struct {
+	mu      sync.Mutex
+	healthy map[int]bool
+	down    map[int]bool // unhealthy instances in the fleet
+}
+
+func (f *fakeFleet) HealthyCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.healthy)
+}
+
+func (f *fakeFleet) IsHealthy(id int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.healthy[id]
+}
+
+func (f *fakeFleet) TotalCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.healthy) + len(f.down)
+}
+
+func (f *fakeFleet) HasBackend(id int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.healthy[id] || f.down[id]
+}
+
+func newTestWatchdog(p *fakeProvisioner, fleet *fakeFleet, min int) *Watchdog {
+	return &Watchdog{
+		client:      p,
+		minHealthy:  min,
+		fleet:       fleet,
+		BootTimeout: time.Hour,
+		pending:     make(map[int]time.Time),
+	}
+}
+
+func TestWatchdogProvisionsDeficit(t *testing.T) {
+	p := &fakeProvisioner{
+		offers: []Offer{{ID: 1}, {ID: 2}, {ID: 3}},
+		fail:   map[int]bool{1: true},
+	}
+	fleet := &fakeFleet{healthy: map[int]bool{5: true}}
+	w := newTestWatchdog(p, fleet, 3)
+
+	w.check(context.Background())
+	if len(p.created) != 2 || p.created[0] != 2 || p.created[1] != 3 {
+		t.Fatalf("created offers %v, want [2 3] (skipping failed offer 1)", p.created)
+	}
+
+	// Booting instances count toward the floor: no new rentals.
+	w.check(context.Background())
+	if len(p.created) != 2 {
+		t.Errorf("created %v while instances were booting", p.created)
+	}
+}
+
+func TestWatchdogPendingExpires(t *testing.T) {
+	p := &fakeProvisioner{offers: []Offer{{ID: 1}, {ID: 2}}}
+	fleet := &fakeFleet{healthy: map[int]bool{}}
+	w := newTestWatchdog(p, fleet, 1)
+
+	w.check(context.Background())
+	if len(p.created) != 1 {
+		t.Fatalf("created %v, want one instance", p.created)
+	}
+
+	// The instance never came up: after the boot timeout, destroy and
+	// replace it.
+	w.BootTimeout = 0
+	w.check(context.Background())
+	if len(p.created) != 2 {
+		t.Errorf("created %v, want a replacement after boot timeout", p.created)
+	}
+	if len(p.destroyed) != 1 || p.destroyed[0] != 101 {
+		t.Errorf("destroyed %v, want the instance that never booted", p.destroyed)
+	}
+}
+
+func TestWatchdogMaxInstances(t *testing.T) {
+	p := &fakeProvisioner{offers: []Offer{{ID: 1}, {ID: 2}, {ID: 3}}}
+	fleet := &fakeFleet{healthy: map[int]bool{5: true}, down: map[int]bool{6: true}}
+	w := newTestWatchdog(p, fleet, 4)
+	w.MaxInstances = 3
+
+	w.check(context.Background())
+	if len(p.created) != 1 {
+		t.Fatalf("created %v, want one instance up to the cap", p.created)
+	}
+
+	// It joins the fleet but never comes up. Until the destroyed instance
+	// leaves the fleet, it still counts toward the cap.
+	fleet.down[101] = true
+	w.BootTimeout = 0
+	for range 3 {
+		w.check(context.Background())
+	}
+	if len(p.created) != 1 || len(p.destroyed) != 1 {
+		t.Errorf("created %v, destroyed %v; want no rentals beyond the cap", p.created, p.destroyed)
+	}
+
+	delete(fleet.down, 101)
+	w.check(context.Background())
+	if len(p.created) != 2 {
+		t.Errorf("created %v, want a rental once the fleet has room", p.created)
+	}
+}
+
+func TestWatchdogHealthyInstanceLeavesPending(t *testing.T) {
+	p := &fakeProvisioner{offers: []Offer{{ID: 1}}}
+	fleet := &fakeFleet{healthy: map[int]bool{}}
+	w := newTestWatchdog(p, fleet, 1)
+
+	w.check(context.Background())
+	fleet.healthy[101] = true
+	if n := w.pendingCount(); n != 0 {
+		t.Errorf("pendingCount() = %d, want 0 once healthy", n)
+	}
+}
+
+func TestWatchdogReplace(t *testing.T) {
+	p := &fakeProvisioner{offers: []Offer{{ID: 1}}}
+	w := newTestWatchdog(p, &fakeFleet{healthy: map[int]bool{}}, 0)
+	w.spec.Instance = CreateInstanceRequest{Image: "vllm/vllm-openai", Disk: 80}
+
+	id := w.Replace(context.Background(), Instance{ID: 9, GPUName: "RTX 4090", NumGPUs: 2, TemplateHashID: "tmpl"})
+	if id == 0 {
+		t.Fatal("Replace() failed")
+	}
+	q := p.queries[0]
+	if q["gpu_name"].(map[string]any)["eq"] != "RTX 4090" || q["num_gpus"].(map[string]any)["eq"] != 2.0 {
+		t.Errorf("query = %v, want same GPU model and count", q)
+	}
+	if q["rentable"] == nil {
+		t.Errorf("query = %v, want default rentable filter", q)
+	}
+	if got := p.specs[0]; got.TemplateHashID != "tmpl" || got.Disk != 80 {
+		t.Errorf("create spec = %+v, want instance template with spec disk", got)
+	}
+	if w.pendingCount() != 1 {
+		t.Error("replacement should count as pending capacity")
+	}
+}
+
+func TestWatchdogReplaceHonorsMaxInstances(t *testing.T) {
+	p := &fakeProvisioner{offers: []Offer{{ID: 1}}}
+	fleet := &fakeFleet{healthy: map[int]bool{1: true}, down: map[int]bool{9: true}}
+	w := newTestWatchdog(p, fleet, 0)
+	w.MaxInstances = 2
+	inst := Instance{ID: 9, TemplateHashID: "tmpl"}
+
+	// Instance 9 was just destroyed but is still listed: it doesn't count.
+	if id := w.Replace(context.Background(), inst); id == 0 {
+		t.Fatal("Replace() failed with room in the fleet")
+	}
+	// With the replacement booting, the fleet is full: replacing another
+	// destroyed instance rents nothing.
+	if id := w.Replace(context.Background(), Instance{ID: 7, TemplateHashID: "tmpl"}); id != 0 {
+		t.Errorf("Replace() = %d, want 0 at the cap", id)
+	}
+	if len(p.created) != 1 {
+		t.Errorf("created %v, want one replacement", p.created)
+	}
+}
+
+func TestWatchdogReplaceWithoutTemplate(t *testing.T) {
+	p := &fakeProvisioner{offers: []Offer{{ID: 1}}}
+	w := newTestWatchdog(p, &fakeFleet{healthy: map[int]bool{}}, 0)
+	if id := w.Replace(context.Background(), Instance{ID: 9}); id != 0 {
+		t.Errorf("Replace() = %d, want 0 with no template or spec", id)
+	}
+	if len(p.created) != 0 {
+		t.Errorf("created %v", p.created)
+	}
+}
+
+func TestLoadProvisionSpec(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.json")
+	os.WriteFile(good, []byte(`{"offers":{"rentable":{"eq":true}},"instance":{"template_hash_id":"abc","disk":40}}`), 0o644)
+	spec, err := LoadProvisionSpec(good)
+	if err != nil {
+		t.Fatalf("LoadProvisionSpec() error: %v", err)
+	}
+	if spec.Instance.TemplateHashID != "abc" || spec.Instance.Disk != 40 {
+		t.Errorf("spec = %+v", spec)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte(`{"offers":{}}`), 0o644)
+	if _, err := LoadProvisionSpec(bad); err == nil {
+		t.Error("expected error for spec without template or image")
+	}
+}
+
+func TestWatchdogTimeToCapacity(t *testing.T) {
+	fleet := &fakeFleet{healthy: map[int]bool{}}
+	w := newTestWatchdog(&fakeProvisioner{}, fleet, 1)
+	if _, ok := w.TimeToCapacity(); ok {
+		t.Error("TimeToCapacity() reported an estimate with nothing provisioning")
+	}
+
+	// One instance took 2 minutes to boot.
+	w.pending[1] = time.Now().Add(-2 * time.Minute)
+	fleet.healthy[1] = true
+	w.pendingCount()
+
+	w.pending[2] = time.Now().Add(-30 * time.Second)
+	w.pending[3] = time.Now()
+	eta, ok := w.TimeToCapacity()
+	if !ok || eta < 89*time.Second || eta > 91*time.Second {
+		t.Errorf("TimeToCapacity() = %v, %v; want ~90s from the oldest pending instance", eta, ok)
+	}
+}
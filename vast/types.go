@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -17,6 +18,7 @@ const (
 	StateHealthy
 	StateUnhealthy
 	StateRemoving
+	StateDraining // preempted: no new requests, removed after a grace period
 )
 
 func (s InstanceState) String() string {
@@ -31,6 +33,8 @@ func (s InstanceState) String() string {
 		return "UNHEALTHY"
 	case StateRemoving:
 		return "REMOVING"
+	case StateDraining:
+		return "DRAINING"
 	default:
 		return "UNKNOWN"
 	}
@@ -46,6 +50,7 @@ type Instance struct {
 	Ports           map[string][]PortMapping `json:"ports"`
 	GPUName         string                   `json:"gpu_name"`
 	NumGPUs         int                      `json:"num_gpus"`
+	GPURAM          float64                  `json:"gpu_ram"` // VRAM per GPU in MB
 	GPUUtil         *float64                 `json:"gpu_util"`
 	GPUTemp         *float64                 `json:"gpu_temp"`
 	Label           string                   `json:"label"`
@@ -54,6 +59,12 @@ type Instance struct {
 	Onstart         string                   `json:"onstart"`
 	DirectPortStart *int                     `json:"direct_port_start"`
 	JupyterToken    string                   `json:"jupyter_token"`
+	StartDate       float64                  `json:"start_date"` // Unix time the container (last) started
+	IntendedStatus  string                   `json:"intended_status"`
+	IsBid           bool                     `json:"is_bid"`    // interruptible (spot) rental
+	DphBase         float64                  `json:"dph_base"`  // base $/hour; the bid price for interruptible rentals
+	MinBid          float64                  `json:"min_bid"`   // current minimum bid for the machine
+	DphTotal        float64                  `json:"dph_total"` // total $/hour, storage and bandwidth included
 
 	// Computed fields (not from JSON).
 	State          InstanceState `json:"-"`
@@ -153,11 +164,36 @@ func (inst *Instance) ResolveContainerPort() int {
 	return 8000
 }
 
+// SameEndpoints reports whether inst and other are reached at the same SSH
+// and HTTP addresses. Container ports must already be resolved.
+func (inst *Instance) SameEndpoints(other *Instance) bool {
+	return inst.SSHHost == other.SSHHost && inst.SSHPort == other.SSHPort &&
+		inst.PublicIPAddr == other.PublicIPAddr &&
+		inst.ResolveDirectSSHPort() == other.ResolveDirectSSHPort() &&
+		inst.ContainerPort == other.ContainerPort &&
+		inst.ResolveDirectHTTPPort() == other.ResolveDirectHTTPPort()
+}
+
+// Restarted reports whether other, a later listing of inst, shows the
+// container restarted since: a new start time or jupyter_token. Fields
+// missing from either listing are ignored.
+func (inst *Instance) Restarted(other *Instance) bool {
+	changed := func(a, b string) bool { return a != "" && b != "" && a != b }
+	return changed(inst.JupyterToken, other.JupyterToken) ||
+		inst.StartDate != 0 && other.StartDate != 0 && inst.StartDate != other.StartDate
+}
+
 // ResolveDirectSSHPort resolves the direct SSH host port (22/tcp mapping).
 func (inst *Instance) ResolveDirectSSHPort() int {
 	return inst.resolvePort("22/tcp")
 }
 
+// ResolveDirectHTTPPort resolves the public host port mapped to the
+// engine's container port, or 0 if the port isn't exposed.
+func (inst *Instance) ResolveDirectHTTPPort() int {
+	return inst.resolvePort(strconv.Itoa(inst.ContainerPort) + "/tcp")
+}
+
 func (inst *Instance) resolvePort(key string) int {
 	mappings, ok := inst.Ports[key]
 	if !ok || len(mappings) == 0 {
@@ -198,6 +234,61 @@ func (inst *Instance) ParseExtraEnv() map[string]string {
 	return env
 }
 
+// LabelWeight splits a routing weight off a label: "proxied:w=3" is label
+// "proxied" with weight 3, and "w=2" weight 2 with no label. A label
+// without a positive weight is returned whole with weight 0.
+func LabelWeight(label string) (base string, weight int) {
+	i := strings.LastIndex(label, "w=")
+	if i < 0 || (i > 0 && label[i-1] != ':') {
+		return label, 0
+	}
+	w, err := strconv.Atoi(label[i+2:])
+	if err != nil || w <= 0 {
+		return label, 0
+	}
+	return strings.TrimSuffix(label[:i], ":"), w
+}
+
+// WithLabelWeight appends weight to label as LabelWeight parses it; a
+// weight of 0 leaves the label alone.
+func WithLabelWeight(label string, weight int) string {
+	switch {
+	case weight <= 0:
+		return label
+	case label == "":
+		return fmt.Sprintf("w=%d", weight)
+	default:
+		return fmt.Sprintf("%s:w=%d", label, weight)
+	}
+}
+
+// BaseLabel returns the instance label without any routing weight.
+func (inst *Instance) BaseLabel() string {
+	base, _ := LabelWeight(inst.Label)
+	return base
+}
+
+// Outbid reports whether an interruptible instance has lost its machine to
+// a higher bid. vast.ai reports such instances as "outbid" or "inactive".
+func (inst *Instance) Outbid() bool {
+	return inst.IsBid && (inst.ActualStatus == "outbid" || inst.ActualStatus == "inactive")
+}
+
+// Preempted reports whether an interruptible instance has stopped running
+// without being asked to, e.g. because it was outbid.
+func (inst *Instance) Preempted() bool {
+	return inst.IsBid && inst.ActualStatus != "running" && inst.IntendedStatus != "stopped"
+}
+
+// HourlyCost returns what the instance costs per hour: the total price if
+// the listing has it, else the base price.
+func (inst *Instance) HourlyCost() float64 {
+	if inst.DphTotal > 0 {
+		return inst.DphTotal
+	}
+	return inst.DphBase
+}
+
 // DisplayName returns a human-readable name for the instance.
 func (inst *Instance) DisplayName() string {
 	name := fmt.Sprintf("#%d %sx%d", inst.ID, inst.GPUName, inst.NumGPUs)
@@ -208,7 +299,13 @@ func (inst *Instance) DisplayName() string {
 }
 
 // InstanceEvent is emitted by the Watcher when instance state changes.
+// "moved" replaces a tracked instance whose IP or ports changed, and
+// "restarted" one whose container restarted (new start time or token); its
+// backend must be rebuilt either way. "unreachable" and "reachable" events report the provider's availability
+// and carry no Instance.
 type InstanceEvent struct {
-	Type     string
+	Type     string // "added", "updated", "moved", "restarted", "draining", "removed", "unreachable" or "reachable"
 	Instance *Instance
+	Err      error     // latest poll error, for "unreachable"
+	Since    time.Time // when polls started failing, for "unreachable"
 }
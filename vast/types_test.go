@@ -83,6 +83,94 @@ func TestResolveDirectSSHPort(t *testing.T) {
 	}
 }
 
+func TestResolveDirectHTTPPort(t *testing.T) {
+	inst := Instance{
+		ContainerPort: 18000,
+		Ports:         map[string][]PortMapping{"18000/tcp": {{HostPort: "41234"}}, "22/tcp": {{HostPort: "22222"}}},
+	}
+	if got := inst.ResolveDirectHTTPPort(); got != 41234 {
+		t.Errorf("ResolveDirectHTTPPort() = %d, want 41234", got)
+	}
+
+	inst.ContainerPort = 8000
+	if got := inst.ResolveDirectHTTPPort(); got != 0 {
+		t.Errorf("ResolveDirectHTTPPort() = %d, want 0 for an unexposed port", got)
+	}
+}
+
+func TestSameEndpoints(t *testing.T) {
+	base := func() *Instance {
+		return &Instance{PublicIPAddr: "1.2.3.4", SSHHost: "ssh1.vast.ai", SSHPort: 2222, ContainerPort: 8000,
+			Ports: map[string][]PortMapping{"22/tcp": {{HostPort: "22222"}}, "8000/tcp": {{HostPort: "41234"}}}}
+	}
+	if !base().SameEndpoints(base()) {
+		t.Error("identical instances should have the same endpoints")
+	}
+	changes := map[string]func(*Instance){
+		"public IP":   func(i *Instance) { i.PublicIPAddr = "5.6.7.8" },
+		"ssh host":    func(i *Instance) { i.SSHHost = "ssh2.vast.ai" },
+		"ssh port":    func(i *Instance) { i.SSHPort = 3333 },
+		"direct ssh":  func(i *Instance) { i.Ports["22/tcp"] = []PortMapping{{HostPort: "22223"}} },
+		"direct http": func(i *Instance) { i.Ports["8000/tcp"] = []PortMapping{{HostPort: "41235"}} },
+		"container":   func(i *Instance) { i.ContainerPort = 9000 },
+	}
+	for name, change := range changes {
+		other := base()
+		change(other)
+		if base().SameEndpoints(other) {
+			t.Errorf("%s change not detected", name)
+		}
+	}
+}
+
+func TestRestarted(t *testing.T) {
+	tests := []struct {
+		name       string
+		old, new   Instance
+		wantChange bool
+	}{
+		{"unchanged", Instance{JupyterToken: "a", StartDate: 100}, Instance{JupyterToken: "a", StartDate: 100}, false},
+		{"new token", Instance{JupyterToken: "a", StartDate: 100}, Instance{JupyterToken: "b", StartDate: 100}, true},
+		{"new start date", Instance{JupyterToken: "a", StartDate: 100}, Instance{JupyterToken: "a", StartDate: 200}, true},
+		{"token missing", Instance{JupyterToken: "a"}, Instance{}, false},
+		{"start date missing", Instance{StartDate: 100}, Instance{}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.old.Restarted(&tt.new); got != tt.wantChange {
+			t.Errorf("%s: Restarted() = %v, want %v", tt.name, got, tt.wantChange)
+		}
+	}
+}
+
+func TestHourlyCost(t *testing.T) {
+	if got := (&Instance{DphBase: 0.3, DphTotal: 0.35}).HourlyCost(); got != 0.35 {
+		t.Errorf("HourlyCost() = %v, want dph_total 0.35", got)
+	}
+	if got := (&Instance{DphBase: 0.3}).HourlyCost(); got != 0.3 {
+		t.Errorf("HourlyCost() = %v, want dph_base 0.3 without dph_total", got)
+	}
+}
+
+func TestVRAM(t *testing.T) {
+	tests := []struct {
+		inst Instance
+		want float64
+	}{
+		{Instance{GPUName: "RTX 4090", NumGPUs: 2, GPURAM: 24564}, 2 * 24564.0 / 1024},
+		{Instance{GPUName: "H100 SXM", NumGPUs: 8}, 640},
+		{Instance{GPUName: "A100 SXM4 80GB", NumGPUs: 1}, 80},
+		{Instance{GPUName: "A100 PCIE", NumGPUs: 1}, 40},
+		{Instance{GPUName: "RTX A4000", NumGPUs: 1}, 16},
+		{Instance{GPUName: "L40S", NumGPUs: 1}, 48},
+		{Instance{GPUName: "Mystery GPU", NumGPUs: 4}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.inst.VRAM(); got != tt.want {
+			t.Errorf("%s x%d: VRAM() = %v, want %v", tt.inst.GPUName, tt.inst.NumGPUs, got, tt.want)
+		}
+	}
+}
+
 func TestParseExtraEnv(t *testing.T) {
 	tests := []struct {
 		name string
@@ -263,3 +351,33 @@ func TestEngineTypeSupportsAbort(t *testing.T) {
 		}
 	}
 }
+
+func TestLabelWeight(t *testing.T) {
+	tests := []struct {
+		label  string
+		base   string
+		weight int
+	}{
+		{"proxied:w=3", "proxied", 3},
+		{"w=2", "", 2},
+		{"proxied", "proxied", 0},
+		{"", "", 0},
+		{"proxied:w=0", "proxied:w=0", 0},
+		{"proxied:w=x", "proxied:w=x", 0},
+		{"neww=4", "neww=4", 0},
+	}
+	for _, tt := range tests {
+		base, weight := LabelWeight(tt.label)
+		if base != tt.base || weight != tt.weight {
+			t.Errorf("LabelWeight(%q) = %q, %d; want %q, %d", tt.label, base, weight, tt.base, tt.weight)
+		}
+		if tt.weight > 0 {
+			if got := WithLabelWeight(base, weight); got != tt.label {
+				t.Errorf("WithLabelWeight(%q, %d) = %q, want %q", base, weight, got, tt.label)
+			}
+		}
+	}
+	if got := WithLabelWeight("proxied", 0); got != "proxied" {
+		t.Errorf("WithLabelWeight(proxied, 0) = %q", got)
+	}
+}
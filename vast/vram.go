@@ -0,0 +1,48 @@
+package vast
+
+import "strings"
+
+// gpuVRAM is the VRAM in GB of common GPUs, by a substring of vast.ai's
+// gpu_name, for listings that don't report gpu_ram. More specific names
+// come first.
+var gpuVRAM = []struct {
+	name string
+	gb   float64
+}{
+	{"H200", 141},
+	{"H100", 80},
+	{"A100 SXM4 80", 80},
+	{"A100 PCIE 80", 80},
+	{"A100X", 80},
+	{"A100", 40},
+	{"L40", 48},
+	{"A6000", 48},
+	{"6000Ada", 48},
+	{"A4000", 16},
+	{"A40", 48},
+	{"RTX 5090", 32},
+	{"V100", 16},
+	{"RTX 4090", 24},
+	{"RTX 3090", 24},
+	{"A5000", 24},
+	{"A10", 24},
+	{"L4", 24},
+	{"T4", 16},
+}
+
+// VRAM returns the instance's total GPU memory in GB: gpu_ram if the
+// listing has it, else an estimate from the GPU name. It returns 0 if
+// neither is known.
+func (inst *Instance) VRAM() float64 {
+	n := max(inst.NumGPUs, 1)
+	if inst.GPURAM > 0 {
+		return float64(n) * inst.GPURAM / 1024
+	}
+	name := strings.ToUpper(inst.GPUName)
+	for _, g := range gpuVRAM {
+		if strings.Contains(name, strings.ToUpper(g.name)) {
+			return float64(n) * g.gb
+		}
+	}
+	return 0
+}
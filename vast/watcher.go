@@ -2,37 +2,123 @@ package vast
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"slices"
 	"sync"
 	"time"
 )
 
-// Watcher polls the vast.ai API and tracks instance lifecycle.
+// Watcher polls a Provider (normally the vast.ai API) and tracks instance
+// lifecycle.
 type Watcher struct {
-	client       *Client
+	provider     Provider
 	pollInterval time.Duration
 	instances    map[int]*Instance
 	subscribers  []chan InstanceEvent
+	stopped      bool // Start has returned and subscriber channels are closed
+	pollHooks    []func(context.Context, []Instance)
+	stateHooks   []func(inst Instance, from InstanceState)
+	actionHooks  []ActionFunc
 	mu           sync.RWMutex
+
+	// Consecutive ListInstances failures and when the streak began; only
+	// touched by the polling goroutine.
+	failures     int
+	failingSince time.Time
 }
 
-// NewWatcher creates a new instance watcher.
-func NewWatcher(client *Client, pollInterval time.Duration) *Watcher {
+// maxPollBackoff caps the delay between polls while the provider is failing.
+const maxPollBackoff = 5 * time.Minute
+
+// fastPollInterval is used instead of the configured interval while any
+// instance is changing state, so new and departing instances are picked up
+// quickly without polling the API that often once the fleet is stable.
+const fastPollInterval = 2 * time.Second
+
+// NewWatcher creates a new instance watcher. provider is usually a *Client;
+// any Provider (e.g. a FileProvider) can be used instead.
+func NewWatcher(provider Provider, pollInterval time.Duration) *Watcher {
 	return &Watcher{
-		client:       client,
+		provider:     provider,
 		pollInterval: pollInterval,
 		instances:    make(map[int]*Instance),
 	}
 }
 
 // Subscribe returns a new channel that receives a copy of every instance event.
-// Each subscriber gets its own independent channel. Call before Start.
+// Each subscriber gets its own independent channel, which is closed by
+// Unsubscribe or when Start returns. Subscribers added after Start only see
+// subsequent events.
 func (w *Watcher) Subscribe() <-chan InstanceEvent {
 	ch := make(chan InstanceEvent, 64)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		close(ch)
+		return ch
+	}
 	w.subscribers = append(w.subscribers, ch)
 	return ch
 }
 
+// Unsubscribe stops delivery to a channel returned by Subscribe and closes
+// it. Unknown or already unsubscribed channels are ignored.
+func (w *Watcher) Unsubscribe(ch <-chan InstanceEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, sub := range w.subscribers {
+		if sub == ch {
+			close(sub)
+			w.subscribers = slices.Delete(w.subscribers, i, i+1)
+			return
+		}
+	}
+}
+
+// closeSubscribers closes every subscriber channel once polling stops.
+func (w *Watcher) closeSubscribers() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, ch := range w.subscribers {
+		close(ch)
+	}
+	w.subscribers = nil
+	w.stopped = true
+}
+
+// OnPoll registers fn to be called with every instance list the provider
+// returns, including instances that aren't running. fn runs synchronously in
+// the polling goroutine and should return quickly. Call before Start.
+func (w *Watcher) OnPoll(fn func(context.Context, []Instance)) {
+	w.pollHooks = append(w.pollHooks, fn)
+}
+
+// OnStateChange registers fn to be called with a copy of the instance
+// whenever SetInstanceState changes its state; from is the previous state.
+// fn runs synchronously in the caller of SetInstanceState (usually a health
+// loop) and should return quickly. Call before Start.
+func (w *Watcher) OnStateChange(fn func(inst Instance, from InstanceState)) {
+	w.stateHooks = append(w.stateHooks, fn)
+}
+
+// ActionFunc is called for each scaling action taken on the fleet: action
+// is "create" or "destroy", id the instance and detail a human-readable
+// reason.
+type ActionFunc func(action string, id int, detail string)
+
+// OnAction registers fn to be called after each instance the Watcher
+// destroys. Call before Start.
+func (w *Watcher) OnAction(fn ActionFunc) {
+	w.actionHooks = append(w.actionHooks, fn)
+}
+
+func (w *Watcher) action(action string, id int, detail string) {
+	for _, fn := range w.actionHooks {
+		fn(action, id, detail)
+	}
+}
+
 // Instances returns a snapshot of all tracked instances.
 func (w *Watcher) Instances() map[int]*Instance {
 	w.mu.RLock()
@@ -44,6 +130,18 @@ func (w *Watcher) Instances() map[int]*Instance {
 	return cp
 }
 
+// List returns copies of all tracked instances, sorted by ID.
+func (w *Watcher) List() []Instance {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	out := make([]Instance, 0, len(w.instances))
+	for _, inst := range w.instances {
+		out = append(out, *inst)
+	}
+	slices.SortFunc(out, func(a, b Instance) int { return a.ID - b.ID })
+	return out
+}
+
 // HasInstance checks whether an instance ID is still known.
 func (w *Watcher) HasInstance(id int) bool {
 	w.mu.RLock()
@@ -52,33 +150,83 @@ func (w *Watcher) HasInstance(id int) bool {
 	return ok && inst.State != StateRemoving
 }
 
-// Start begins polling in the foreground. Call in a goroutine.
+// Start begins polling in the foreground. Call in a goroutine. Polls are
+// faster while instances are changing state and back off exponentially, up
+// to maxPollBackoff, while the provider keeps failing.
 func (w *Watcher) Start(ctx context.Context) {
-	ticker := time.NewTicker(w.pollInterval)
-	defer ticker.Stop()
+	defer w.closeSubscribers()
 
 	// Immediate first poll.
 	w.poll(ctx)
 
+	timer := time.NewTimer(w.nextPollDelay())
+	defer timer.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-timer.C:
 			w.poll(ctx)
+			timer.Reset(w.nextPollDelay())
 		}
 	}
 }
 
+// nextPollDelay returns the poll interval, doubled for each consecutive
+// failure beyond the first and capped at maxPollBackoff. While the provider
+// is healthy and any instance is in transition, it is fastPollInterval.
+func (w *Watcher) nextPollDelay() time.Duration {
+	if w.failures == 0 && w.inTransition() {
+		return min(fastPollInterval, w.pollInterval)
+	}
+	d := w.pollInterval
+	for i := 1; i < w.failures && d < maxPollBackoff; i++ {
+		d *= 2
+	}
+	return min(d, max(maxPollBackoff, w.pollInterval))
+}
+
+// inTransition reports whether any instance is DISCOVERED, CONNECTING or
+// REMOVING.
+func (w *Watcher) inTransition() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	for _, inst := range w.instances {
+		switch inst.State {
+		case StateDiscovered, StateConnecting, StateRemoving:
+			return true
+		}
+	}
+	return false
+}
+
 func (w *Watcher) poll(ctx context.Context) {
-	instances, err := w.client.ListInstances(ctx)
+	instances, err := w.provider.ListInstances(ctx)
 	if err != nil {
-		log.Printf("vast watcher: poll error: %v", err)
+		if w.failures == 0 {
+			w.failingSince = time.Now()
+		}
+		w.failures++
+		log.Printf("vast watcher: poll error (%d in a row): %v", w.failures, err)
+		w.mu.Lock()
+		w.emit(InstanceEvent{Type: "unreachable", Err: err, Since: w.failingSince})
+		w.mu.Unlock()
 		return
 	}
+	if w.failures > 0 {
+		log.Printf("vast watcher: provider reachable again after %d failed polls", w.failures)
+		w.failures = 0
+		w.mu.Lock()
+		w.emit(InstanceEvent{Type: "reachable"})
+		w.mu.Unlock()
+	}
 
 	log.Printf("vast watcher: poll returned %d instances", len(instances))
 
+	for _, fn := range w.pollHooks {
+		fn(ctx, instances)
+	}
+
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
@@ -87,16 +235,28 @@ func (w *Watcher) poll(ctx context.Context) {
 	for i := range instances {
 		inst := &instances[i]
 		if inst.ActualStatus != "running" {
+			if existing, ok := w.instances[inst.ID]; ok && inst.Preempted() && w.drain(existing, inst) {
+				seen[inst.ID] = true
+				continue
+			}
 			log.Printf("vast watcher: instance %d status=%q (skipping)", inst.ID, inst.ActualStatus)
 			continue
 		}
 		seen[inst.ID] = true
 
 		existing, ok := w.instances[inst.ID]
+		if ok && existing.State == StateDraining {
+			// Resumed after preemption (e.g. the bid was raised): replace
+			// the drained backend with a fresh one.
+			log.Printf("vast watcher: instance %d resumed after preemption", inst.ID)
+			existing.State = StateRemoving
+			existing.StateChangedAt = time.Now()
+			w.emit(InstanceEvent{Type: "removed", Instance: existing})
+		}
+		inst.ContainerPort = inst.ResolveContainerPort()
+		inst.DirectSSHPort = inst.ResolveDirectSSHPort()
 		if !ok || existing.State == StateRemoving {
 			// New instance, or instance returning after removal (e.g. recycling).
-			inst.ContainerPort = inst.ResolveContainerPort()
-			inst.DirectSSHPort = inst.ResolveDirectSSHPort()
 			inst.Engine = inst.ResolveEngineType()
 			inst.State = StateDiscovered
 			inst.StateChangedAt = time.Now()
@@ -104,12 +264,32 @@ func (w *Watcher) poll(ctx context.Context) {
 				inst.ID, inst.PublicIPAddr, inst.ContainerPort, inst.DirectSSHPort, inst.SSHHost, inst.SSHPort, inst.Engine)
 			w.instances[inst.ID] = inst
 			w.emit(InstanceEvent{Type: "added", Instance: inst})
+		} else if moved, restarted := !existing.SameEndpoints(inst), existing.Restarted(inst); moved || restarted {
+			// New ports or IP, or a restarted container (the served model
+			// and credentials may have changed): replace the instance so
+			// its backend is rebuilt. Backends read the old Instance
+			// concurrently, so it isn't modified.
+			inst.Engine = inst.ResolveEngineType()
+			inst.State = StateDiscovered
+			inst.StateChangedAt = time.Now()
+			evtType := "restarted"
+			if moved {
+				evtType = "moved"
+				inst.ModelName = existing.ModelName
+			}
+			log.Printf("vast watcher: instance %d %s: publicIP=%s containerPort=%d directSSH=%d ssh=%s:%d",
+				inst.ID, evtType, inst.PublicIPAddr, inst.ContainerPort, inst.DirectSSHPort, inst.SSHHost, inst.SSHPort)
+			w.instances[inst.ID] = inst
+			w.emit(InstanceEvent{Type: evtType, Instance: inst})
 		} else {
 			// Update mutable fields (GPU metrics, status, label).
 			existing.GPUUtil = inst.GPUUtil
 			existing.GPUTemp = inst.GPUTemp
 			existing.ActualStatus = inst.ActualStatus
 			existing.Label = inst.Label
+			existing.DphBase = inst.DphBase
+			existing.DphTotal = inst.DphTotal
+			existing.MinBid = inst.MinBid
 			w.emit(InstanceEvent{Type: "updated", Instance: existing})
 		}
 	}
@@ -132,6 +312,33 @@ func (w *Watcher) poll(ctx context.Context) {
 	}
 }
 
+// drainGrace is how long a preempted instance stays DRAINING, so in-flight
+// requests can finish, before it is removed.
+const drainGrace = 2 * time.Minute
+
+// drain handles a preempted instance, which is still listed but no longer
+// running. The first time, it is marked DRAINING and a "draining" event is
+// emitted so its backend stops taking new requests. It reports whether the
+// instance should stay tracked; once drainGrace has passed it is removed.
+// Must be called with mu held.
+func (w *Watcher) drain(existing, inst *Instance) bool {
+	switch existing.State {
+	case StateRemoving:
+		return false
+	case StateDraining:
+		return time.Since(existing.StateChangedAt) < drainGrace
+	}
+	log.Printf("vast watcher: instance %d preempted (status=%q, bid $%.3f/h, min bid $%.3f/h), draining",
+		inst.ID, inst.ActualStatus, inst.DphBase, inst.MinBid)
+	existing.ActualStatus = inst.ActualStatus
+	existing.MinBid = inst.MinBid
+	existing.State = StateDraining
+	existing.StateChangedAt = time.Now()
+	w.emit(InstanceEvent{Type: "draining", Instance: existing})
+	return true
+}
+
+// emit sends evt to every subscriber. Must be called with mu held.
 func (w *Watcher) emit(evt InstanceEvent) {
 	for _, ch := range w.subscribers {
 		select {
@@ -150,7 +357,14 @@ func (w *Watcher) InjectInstance(inst *Instance) {
 }
 
 // DestroyAll destroys all tracked instances via the vast.ai API.
+// It is a no-op for providers that cannot destroy instances.
 func (w *Watcher) DestroyAll(ctx context.Context) {
+	destroyer, ok := w.provider.(instanceDestroyer)
+	if !ok {
+		log.Printf("vast watcher: provider does not support destroy")
+		return
+	}
+
 	w.mu.RLock()
 	ids := make([]int, 0, len(w.instances))
 	for id, inst := range w.instances {
@@ -161,10 +375,105 @@ func (w *Watcher) DestroyAll(ctx context.Context) {
 	w.mu.RUnlock()
 
 	for _, id := range ids {
-		if err := w.client.DestroyInstance(ctx, id); err != nil {
+		if err := destroyer.DestroyInstance(ctx, id); err != nil {
 			log.Printf("vast watcher: destroy instance %d failed: %v", id, err)
 		} else {
 			log.Printf("vast watcher: destroyed instance %d", id)
+			w.action("destroy", id, "destroy all")
+		}
+	}
+}
+
+// DestroyUnhealthy destroys every instance currently UNHEALTHY via the
+// vast.ai API, e.g. rentals from a batch that never came up. It is a no-op
+// for providers that cannot destroy instances.
+func (w *Watcher) DestroyUnhealthy(ctx context.Context) {
+	destroyer, ok := w.provider.(instanceDestroyer)
+	if !ok {
+		log.Printf("vast watcher: provider does not support destroy")
+		return
+	}
+	for _, inst := range w.UnhealthyFor(0) {
+		if err := destroyer.DestroyInstance(ctx, inst.ID); err != nil {
+			log.Printf("vast watcher: destroy instance %d failed: %v", inst.ID, err)
+		} else {
+			log.Printf("vast watcher: destroyed unhealthy instance %d", inst.ID)
+			w.action("destroy", inst.ID, "destroy unhealthy")
+		}
+	}
+}
+
+// Destroy destroys one tracked instance via the vast.ai API.
+func (w *Watcher) Destroy(ctx context.Context, id int) error {
+	destroyer, ok := w.provider.(instanceDestroyer)
+	if !ok {
+		return fmt.Errorf("provider does not support destroy")
+	}
+	w.mu.RLock()
+	_, tracked := w.instances[id]
+	w.mu.RUnlock()
+	if !tracked {
+		return fmt.Errorf("instance %d is not tracked", id)
+	}
+	if err := destroyer.DestroyInstance(ctx, id); err != nil {
+		return err
+	}
+	log.Printf("vast watcher: destroyed instance %d", id)
+	w.action("destroy", id, "manual")
+	return nil
+}
+
+// UnhealthyFor returns copies of the instances that have been UNHEALTHY
+// for longer than maxAge.
+func (w *Watcher) UnhealthyFor(maxAge time.Duration) []Instance {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	var out []Instance
+	for _, inst := range w.instances {
+		if inst.State == StateUnhealthy && time.Since(inst.StateChangedAt) > maxAge {
+			out = append(out, *inst)
+		}
+	}
+	return out
+}
+
+// ReapUnhealthy destroys instances that stay UNHEALTHY for longer than
+// maxAge, so dead rentals stop accruing charges. It checks every interval
+// until ctx is canceled and destroys each instance at most once; the
+// instance is removed as usual once the provider stops listing it.
+// onDestroy, if non-nil, is called with each destroyed instance (e.g. to
+// rent a replacement). It is a no-op for providers that cannot destroy
+// instances.
+func (w *Watcher) ReapUnhealthy(ctx context.Context, maxAge, interval time.Duration, onDestroy func(Instance)) {
+	destroyer, ok := w.provider.(instanceDestroyer)
+	if !ok {
+		log.Printf("vast watcher: provider does not support destroy, not reaping unhealthy instances")
+		return
+	}
+
+	destroyed := make(map[int]bool)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, inst := range w.UnhealthyFor(maxAge) {
+			if destroyed[inst.ID] {
+				continue
+			}
+			log.Printf("vast watcher: instance %d unhealthy for over %v, destroying", inst.ID, maxAge)
+			if err := destroyer.DestroyInstance(ctx, inst.ID); err != nil {
+				log.Printf("vast watcher: destroy instance %d failed: %v", inst.ID, err)
+				continue
+			}
+			destroyed[inst.ID] = true
+			w.action("destroy", inst.ID, fmt.Sprintf("unhealthy for over %v", maxAge))
+			if onDestroy != nil {
+				onDestroy(inst)
+			}
 		}
 	}
 }
@@ -172,9 +481,20 @@ func (w *Watcher) DestroyAll(ctx context.Context) {
 // SetInstanceState updates an instance's state (called from backend manager).
 func (w *Watcher) SetInstanceState(id int, state InstanceState) {
 	w.mu.Lock()
-	defer w.mu.Unlock()
-	if inst, ok := w.instances[id]; ok {
-		inst.State = state
-		inst.StateChangedAt = time.Now()
+	inst, ok := w.instances[id]
+	if !ok || inst.State == StateDraining && state != StateRemoving {
+		w.mu.Unlock()
+		return // health checks don't override a drain
+	}
+	from := inst.State
+	inst.State = state
+	inst.StateChangedAt = time.Now()
+	cp := *inst
+	w.mu.Unlock()
+
+	if from != state {
+		for _, fn := range w.stateHooks {
+			fn(cp, from)
+		}
 	}
 }
@@ -3,8 +3,10 @@ package vast
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"sync"
 	"testing"
 	"time"
@@ -238,12 +240,65 @@ func TestWatcherPollError(t *testing.T) {
 	// Poll should handle error gracefully without crashing.
 	w.poll(context.Background())
 
-	// No events should be emitted.
+	// Only an "unreachable" event should be emitted.
 	select {
 	case evt := <-ch:
-		t.Errorf("unexpected event on poll error: %s/%d", evt.Type, evt.Instance.ID)
+		if evt.Type != "unreachable" || evt.Err == nil || evt.Since.IsZero() {
+			t.Errorf("event = %+v, want unreachable with error and start time", evt)
+		}
 	default:
-		// Good.
+		t.Fatal("expected unreachable event on poll error")
+	}
+	select {
+	case evt := <-ch:
+		t.Errorf("unexpected event on poll error: %+v", evt)
+	default:
+	}
+}
+
+// flakyProvider fails while failing is set.
+type flakyProvider struct {
+	failing bool
+}
+
+func (p *flakyProvider) ListInstances(ctx context.Context) ([]Instance, error) {
+	if p.failing {
+		return nil, errors.New("network down")
+	}
+	return nil, nil
+}
+
+func TestWatcherPollErrorBackoff(t *testing.T) {
+	p := &flakyProvider{failing: true}
+	w := NewWatcher(p, 10*time.Second)
+	ch := w.Subscribe()
+
+	if got := w.nextPollDelay(); got != 10*time.Second {
+		t.Errorf("delay before failures = %v, want 10s", got)
+	}
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second,
+		160 * time.Second, maxPollBackoff, maxPollBackoff}
+	for i, d := range want {
+		w.poll(context.Background())
+		if got := w.nextPollDelay(); got != d {
+			t.Errorf("delay after %d failures = %v, want %v", i+1, got, d)
+		}
+	}
+
+	first := (<-ch).Since
+	for range len(want) - 1 {
+		if evt := <-ch; evt.Since != first {
+			t.Errorf("Since = %v, want streak start %v", evt.Since, first)
+		}
+	}
+
+	p.failing = false
+	w.poll(context.Background())
+	if evt := <-ch; evt.Type != "reachable" {
+		t.Errorf("event = %s, want reachable", evt.Type)
+	}
+	if got := w.nextPollDelay(); got != 10*time.Second {
+		t.Errorf("delay after recovery = %v, want 10s", got)
 	}
 }
 
@@ -261,6 +316,21 @@ func TestInjectInstance(t *testing.T) {
 	}
 }
 
+func TestWatcherList(t *testing.T) {
+	w := NewWatcher(nil, time.Hour)
+	w.InjectInstance(&Instance{ID: 9})
+	w.InjectInstance(&Instance{ID: 3})
+	list := w.List()
+	if len(list) != 2 || list[0].ID != 3 || list[1].ID != 9 {
+		t.Fatalf("List() = %+v, want instances 3 and 9", list)
+	}
+	// The list holds copies.
+	list[0].State = StateRemoving
+	if w.Instances()[3].State == StateRemoving {
+		t.Error("List() returned shared instances")
+	}
+}
+
 func TestSetInstanceStateNonExistent(t *testing.T) {
 	w := NewWatcher(nil, time.Hour)
 	// Setting state on non-existent instance should not panic.
@@ -514,3 +584,326 @@ func TestWatcherConcurrentAccess(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+// destroyingProvider lists fixed instances and records destroys.
+type destroyingProvider struct {
+	instances []Instance
+	mu        sync.Mutex
+	destroyed []int
+}
+
+func (p *destroyingProvider) ListInstances(ctx context.Context) ([]Instance, error) {
+	return p.instances, nil
+}
+
+func (p *destroyingProvider) DestroyInstance(ctx context.Context, id int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.destroyed = append(p.destroyed, id)
+	return nil
+}
+
+func TestWatcherReapUnhealthy(t *testing.T) {
+	p := &destroyingProvider{instances: []Instance{
+		{ID: 1, ActualStatus: "running"},
+		{ID: 2, ActualStatus: "running"},
+		{ID: 3, ActualStatus: "running"},
+	}}
+	w := NewWatcher(p, time.Hour)
+	w.poll(context.Background())
+	w.SetInstanceState(1, StateUnhealthy)
+	w.SetInstanceState(2, StateHealthy)
+	w.SetInstanceState(3, StateUnhealthy)
+	// Instance 3 only just became unhealthy.
+	w.instances[1].StateChangedAt = time.Now().Add(-time.Hour)
+
+	if insts := w.UnhealthyFor(30 * time.Minute); len(insts) != 1 || insts[0].ID != 1 {
+		t.Fatalf("UnhealthyFor() = %v, want instance 1", insts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	var replaced []int
+	go func() {
+		w.ReapUnhealthy(ctx, 30*time.Minute, 10*time.Millisecond, func(inst Instance) {
+			replaced = append(replaced, inst.ID)
+		})
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.destroyed) != 1 || p.destroyed[0] != 1 {
+		t.Errorf("destroyed = %v, want [1] exactly once", p.destroyed)
+	}
+	if len(replaced) != 1 || replaced[0] != 1 {
+		t.Errorf("onDestroy called for %v, want [1]", replaced)
+	}
+}
+
+func TestWatcherOnPollSeesOutbidInstances(t *testing.T) {
+	p := &destroyingProvider{instances: []Instance{
+		{ID: 1, ActualStatus: "running", IsBid: true},
+	}}
+	w := NewWatcher(p, time.Hour)
+	ch := w.Subscribe()
+	var seen []Instance
+	w.OnPoll(func(ctx context.Context, instances []Instance) {
+		seen = instances
+	})
+
+	w.poll(context.Background())
+	<-ch // added
+
+	p.instances = []Instance{{ID: 1, ActualStatus: "outbid", IsBid: true, MinBid: 0.4}}
+	w.poll(context.Background())
+
+	if len(seen) != 1 || !seen[0].Outbid() {
+		t.Errorf("OnPoll saw %+v, want the outbid instance", seen)
+	}
+	select {
+	case evt := <-ch:
+		if evt.Type != "draining" || evt.Instance.ID != 1 {
+			t.Errorf("event = %s %d, want draining 1", evt.Type, evt.Instance.ID)
+		}
+	default:
+		t.Fatal("expected draining event for outbid instance")
+	}
+}
+
+func TestWatcherDrainsPreemptedInstance(t *testing.T) {
+	p := &destroyingProvider{instances: []Instance{
+		{ID: 1, ActualStatus: "running", IsBid: true},
+	}}
+	w := NewWatcher(p, time.Hour)
+	ch := w.Subscribe()
+	w.poll(context.Background())
+	<-ch // added
+
+	p.instances = []Instance{{ID: 1, ActualStatus: "exited", IntendedStatus: "running", IsBid: true}}
+	w.poll(context.Background())
+	if evt := <-ch; evt.Type != "draining" {
+		t.Fatalf("event = %s, want draining", evt.Type)
+	}
+
+	// Health checks don't override the drain.
+	w.SetInstanceState(1, StateHealthy)
+	if got := w.instances[1].State; got != StateDraining {
+		t.Errorf("state = %v, want DRAINING", got)
+	}
+
+	// Still draining within the grace period: no further events.
+	w.poll(context.Background())
+	select {
+	case evt := <-ch:
+		t.Fatalf("unexpected %s event during drain", evt.Type)
+	default:
+	}
+
+	// Removed once the grace period has passed.
+	w.instances[1].StateChangedAt = time.Now().Add(-drainGrace - time.Second)
+	w.poll(context.Background())
+	if evt := <-ch; evt.Type != "removed" {
+		t.Errorf("event = %s, want removed", evt.Type)
+	}
+}
+
+func TestWatcherAdaptivePollInterval(t *testing.T) {
+	p := &destroyingProvider{instances: []Instance{{ID: 1, ActualStatus: "running"}}}
+	w := NewWatcher(p, 30*time.Second)
+
+	if got := w.nextPollDelay(); got != 30*time.Second {
+		t.Errorf("delay with no instances = %v, want 30s", got)
+	}
+
+	w.poll(context.Background())
+	if got := w.nextPollDelay(); got != fastPollInterval {
+		t.Errorf("delay with DISCOVERED instance = %v, want %v", got, fastPollInterval)
+	}
+	w.SetInstanceState(1, StateConnecting)
+	if got := w.nextPollDelay(); got != fastPollInterval {
+		t.Errorf("delay with CONNECTING instance = %v, want %v", got, fastPollInterval)
+	}
+	w.SetInstanceState(1, StateHealthy)
+	if got := w.nextPollDelay(); got != 30*time.Second {
+		t.Errorf("delay with stable fleet = %v, want 30s", got)
+	}
+
+	p.instances = nil
+	w.poll(context.Background())
+	if got := w.nextPollDelay(); got != fastPollInterval {
+		t.Errorf("delay with REMOVING instance = %v, want %v", got, fastPollInterval)
+	}
+
+	// A configured interval shorter than the fast interval is kept.
+	w.pollInterval = time.Second
+	if got := w.nextPollDelay(); got != time.Second {
+		t.Errorf("delay = %v, want 1s", got)
+	}
+}
+
+func TestWatcherUnsubscribe(t *testing.T) {
+	p := &destroyingProvider{instances: []Instance{{ID: 1, ActualStatus: "running"}}}
+	w := NewWatcher(p, time.Hour)
+	kept := w.Subscribe()
+	dropped := w.Subscribe()
+
+	w.Unsubscribe(dropped)
+	w.Unsubscribe(dropped) // no-op
+	if _, ok := <-dropped; ok {
+		t.Error("unsubscribed channel should be closed")
+	}
+
+	w.poll(context.Background())
+	if evt := <-kept; evt.Type != "added" {
+		t.Errorf("event = %s, want added", evt.Type)
+	}
+	if len(w.subscribers) != 1 {
+		t.Errorf("subscribers = %d, want 1", len(w.subscribers))
+	}
+}
+
+func TestWatcherStartClosesSubscribers(t *testing.T) {
+	w := NewWatcher(&destroyingProvider{}, time.Hour)
+	ch := w.Subscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Start(ctx)
+		close(done)
+	}()
+	cancel()
+	<-done
+
+	for range ch {
+	}
+	if _, ok := <-w.Subscribe(); ok {
+		t.Error("subscribing after shutdown should return a closed channel")
+	}
+}
+
+func TestWatcherDestroy(t *testing.T) {
+	p := &destroyingProvider{instances: []Instance{
+		{ID: 1, ActualStatus: "running"},
+		{ID: 2, ActualStatus: "running"},
+	}}
+	w := NewWatcher(p, time.Hour)
+	w.poll(context.Background())
+
+	if err := w.Destroy(context.Background(), 2); err != nil {
+		t.Fatalf("Destroy(2) error: %v", err)
+	}
+	if err := w.Destroy(context.Background(), 99); err == nil {
+		t.Error("Destroy(99) should fail for an untracked instance")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.destroyed) != 1 || p.destroyed[0] != 2 {
+		t.Errorf("destroyed = %v, want [2]", p.destroyed)
+	}
+}
+
+func TestWatcherDestroyUnhealthy(t *testing.T) {
+	p := &destroyingProvider{instances: []Instance{
+		{ID: 1, ActualStatus: "running"},
+		{ID: 2, ActualStatus: "running"},
+		{ID: 3, ActualStatus: "running"},
+	}}
+	w := NewWatcher(p, time.Hour)
+	w.poll(context.Background())
+	w.SetInstanceState(1, StateUnhealthy)
+	w.SetInstanceState(2, StateHealthy)
+	w.SetInstanceState(3, StateUnhealthy)
+
+	w.DestroyUnhealthy(context.Background())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	slices.Sort(p.destroyed)
+	if !slices.Equal(p.destroyed, []int{1, 3}) {
+		t.Errorf("destroyed = %v, want [1 3]", p.destroyed)
+	}
+}
+
+func TestWatcherPollEmitsMoved(t *testing.T) {
+	hostPort := "12345"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(InstancesResponse{Instances: []Instance{
+			{ID: 1, ActualStatus: "running", PublicIPAddr: "1.2.3.4", SSHHost: "ssh1.vast.ai", SSHPort: 2222,
+				Ports: map[string][]PortMapping{"22/tcp": {{HostPort: hostPort}}}},
+		}})
+	}))
+	defer srv.Close()
+
+	w := NewWatcher(newTestClient("key", srv.URL), time.Hour)
+	ch := w.Subscribe()
+	ctx := context.Background()
+
+	w.poll(ctx)
+	if evt := <-ch; evt.Type != "added" {
+		t.Fatalf("first poll: got %s, want added", evt.Type)
+	}
+	w.SetInstanceState(1, StateHealthy)
+
+	w.poll(ctx)
+	if evt := <-ch; evt.Type != "updated" {
+		t.Fatalf("unchanged poll: got %s, want updated", evt.Type)
+	}
+
+	// Container restarted with a new direct SSH port.
+	hostPort = "23456"
+	w.poll(ctx)
+	evt := <-ch
+	if evt.Type != "moved" || evt.Instance.DirectSSHPort != 23456 {
+		t.Fatalf("got %s directSSH=%d, want moved 23456", evt.Type, evt.Instance.DirectSSHPort)
+	}
+	if evt.Instance.State != StateDiscovered {
+		t.Errorf("moved instance state = %s, want DISCOVERED", evt.Instance.State)
+	}
+	if got := w.List()[0]; got.DirectSSHPort != 23456 {
+		t.Errorf("tracked directSSH = %d, want 23456", got.DirectSSHPort)
+	}
+}
+
+func TestWatcherPollEmitsRestarted(t *testing.T) {
+	token := "tok1"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(InstancesResponse{Instances: []Instance{
+			{ID: 1, ActualStatus: "running", PublicIPAddr: "1.2.3.4", JupyterToken: token, StartDate: 1000},
+		}})
+	}))
+	defer srv.Close()
+
+	w := NewWatcher(newTestClient("key", srv.URL), time.Hour)
+	ch := w.Subscribe()
+	ctx := context.Background()
+
+	w.poll(ctx)
+	<-ch // added
+
+	token = "tok2"
+	w.poll(ctx)
+	evt := <-ch
+	if evt.Type != "restarted" || evt.Instance.JupyterToken != "tok2" {
+		t.Fatalf("got %s token=%q, want restarted tok2", evt.Type, evt.Instance.JupyterToken)
+	}
+}
+
+func TestWatcherOnAction(t *testing.T) {
+	w := NewWatcher(&destroyingProvider{}, time.Second)
+	w.instances[1] = &Instance{ID: 1}
+	var got []string
+	w.OnAction(func(action string, id int, detail string) {
+		got = append(got, action+" "+detail)
+	})
+	if err := w.Destroy(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != "destroy manual" {
+		t.Errorf("actions = %v", got)
+	}
+}
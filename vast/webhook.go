@@ -0,0 +1,190 @@
+package vast
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WebhookFormat selects the payload a Webhook posts.
+type WebhookFormat int
+
+const (
+	// WebhookJSON posts a WebhookEvent as JSON.
+	WebhookJSON WebhookFormat = iota
+	// WebhookSlack posts a Slack-compatible {"text": ...} message.
+	WebhookSlack
+)
+
+// ParseWebhookFormat parses "json" or "slack" (case-insensitive).
+func ParseWebhookFormat(s string) (WebhookFormat, error) {
+	switch strings.ToLower(s) {
+	case "", "json":
+		return WebhookJSON, nil
+	case "slack":
+		return WebhookSlack, nil
+	default:
+		return 0, fmt.Errorf("unknown webhook format %q", s)
+	}
+}
+
+// WebhookEvent describes one fleet change posted to a webhook. Instance
+// events are "added", "removed", "healthy" and "unhealthy"; fleet-wide
+// "outage" and "recovered" events (see OutageAlarm) carry no instance but
+// the time the outage began.
+type WebhookEvent struct {
+	Event         string    `json:"event"`
+	InstanceID    int       `json:"instance_id,omitempty"`
+	Name          string    `json:"name,omitempty"`
+	State         string    `json:"state,omitempty"`
+	PreviousState string    `json:"previous_state,omitempty"`
+	OutageSince   time.Time `json:"outage_since,omitzero"`
+	Time          time.Time `json:"time"`
+}
+
+// webhookQueue bounds the events waiting to be posted; more are dropped so
+// a slow webhook never stalls health checks.
+const webhookQueue = 64
+
+// Webhook posts fleet changes to a URL: instances being added or removed,
+// backends turning unhealthy or recovering, and fleet-wide outages, so
+// problems surface in chat rather than only in the TUI. Posts happen in
+// Run's goroutine.
+type Webhook struct {
+	url    string
+	format WebhookFormat
+	client *http.Client
+	queue  chan WebhookEvent
+}
+
+// NewWebhook creates a webhook posting to url in format.
+func NewWebhook(url string, format WebhookFormat) *Webhook {
+	return &Webhook{
+		url:    url,
+		format: format,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan WebhookEvent, webhookQueue),
+	}
+}
+
+// StateChanged queues a notification when an instance turns unhealthy or
+// recovers from being unhealthy. Use it as a Watcher.OnStateChange hook.
+func (wh *Webhook) StateChanged(inst Instance, from InstanceState) {
+	var event string
+	switch {
+	case inst.State == StateUnhealthy:
+		event = "unhealthy"
+	case inst.State == StateHealthy && from == StateUnhealthy:
+		event = "healthy"
+	default:
+		return
+	}
+	wh.enqueue(WebhookEvent{
+		Event:         event,
+		InstanceID:    inst.ID,
+		Name:          inst.DisplayName(),
+		State:         inst.State.String(),
+		PreviousState: from.String(),
+		Time:          inst.StateChangedAt,
+	})
+}
+
+// Outage queues an "outage" notification for an outage that began at
+// since. Use it as an OutageAlarm.OnRaise hook.
+func (wh *Webhook) Outage(since time.Time) {
+	wh.enqueue(WebhookEvent{Event: "outage", OutageSince: since, Time: time.Now()})
+}
+
+// Recovered queues a "recovered" notification for the end of an outage
+// that began at since. Use it as an OutageAlarm.OnClear hook.
+func (wh *Webhook) Recovered(since time.Time) {
+	wh.enqueue(WebhookEvent{Event: "recovered", OutageSince: since, Time: time.Now()})
+}
+
+func (wh *Webhook) enqueue(e WebhookEvent) {
+	select {
+	case wh.queue <- e:
+	default:
+		log.Printf("webhook: queue full, dropping %s event", e.Event)
+	}
+}
+
+// Run posts "added" and "removed" events from events, and the events
+// queued by StateChanged, Outage and Recovered, until ctx is canceled.
+// Call in a goroutine.
+func (wh *Webhook) Run(ctx context.Context, events <-chan InstanceEvent) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if evt.Type == "added" || evt.Type == "removed" {
+				wh.post(ctx, WebhookEvent{
+					Event:      evt.Type,
+					InstanceID: evt.Instance.ID,
+					Name:       evt.Instance.DisplayName(),
+					State:      evt.Instance.State.String(),
+					Time:       time.Now(),
+				})
+			}
+		case e := <-wh.queue:
+			wh.post(ctx, e)
+		}
+	}
+}
+
+// post sends one event, logging failures.
+func (wh *Webhook) post(ctx context.Context, e WebhookEvent) {
+	var payload any = e
+	if wh.format == WebhookSlack {
+		payload = map[string]string{"text": e.text()}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("webhook: marshal: %v", err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.url, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("webhook: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		log.Printf("webhook: post %s event: %v", e.Event, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("webhook: post %s event: status %d", e.Event, resp.StatusCode)
+	}
+}
+
+// text renders e as a one-line chat message.
+func (e WebhookEvent) text() string {
+	switch e.Event {
+	case "added":
+		return fmt.Sprintf("vastproxy: instance %s added", e.Name)
+	case "removed":
+		return fmt.Sprintf("vastproxy: instance %s removed", e.Name)
+	case "unhealthy":
+		return fmt.Sprintf("vastproxy: instance %s is UNHEALTHY (was %s)", e.Name, e.PreviousState)
+	case "outage":
+		return fmt.Sprintf("vastproxy: OUTAGE, no healthy backends since %s", e.OutageSince.Format(time.RFC3339))
+	case "recovered":
+		return fmt.Sprintf("vastproxy: outage over, healthy backends are back after %s",
+			e.Time.Sub(e.OutageSince).Round(time.Second))
+	default:
+		return fmt.Sprintf("vastproxy: instance %s is %s again", e.Name, e.State)
+	}
+}
@@ -0,0 +1,118 @@
+package vast
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWebhookFormat(t *testing.T) {
+	for in, want := range map[string]WebhookFormat{"": WebhookJSON, "json": WebhookJSON, "Slack": WebhookSlack} {
+		if got, err := ParseWebhookFormat(in); err != nil || got != want {
+			t.Errorf("ParseWebhookFormat(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseWebhookFormat("teams"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestWatcherOnStateChange(t *testing.T) {
+	w := NewWatcher(nil, time.Second)
+	w.instances[1] = &Instance{ID: 1, State: StateConnecting}
+	var got []string
+	w.OnStateChange(func(inst Instance, from InstanceState) {
+		got = append(got, from.String()+"→"+inst.State.String())
+	})
+	w.SetInstanceState(1, StateHealthy)
+	w.SetInstanceState(1, StateHealthy) // unchanged
+	w.SetInstanceState(1, StateUnhealthy)
+	w.SetInstanceState(2, StateHealthy) // unknown
+	want := "CONNECTING→HEALTHY,HEALTHY→UNHEALTHY"
+	if strings.Join(got, ",") != want {
+		t.Errorf("transitions = %v, want %s", got, want)
+	}
+}
+
+// webhookServer records the bodies posted to it.
+func webhookServer(t *testing.T) (*httptest.Server, <-chan []byte) {
+	t.Helper()
+	bodies := make(chan []byte, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body json.RawMessage
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies <- body
+	}))
+	t.Cleanup(srv.Close)
+	return srv, bodies
+}
+
+func TestWebhookPostsEvents(t *testing.T) {
+	srv, bodies := webhookServer(t)
+	wh := NewWebhook(srv.URL, WebhookJSON)
+	events := make(chan InstanceEvent, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wh.Run(ctx, events)
+
+	inst := Instance{ID: 7, GPUName: "RTX 4090", NumGPUs: 1}
+	events <- InstanceEvent{Type: "updated", Instance: &inst} // not notified
+	events <- InstanceEvent{Type: "added", Instance: &inst}
+	var e WebhookEvent
+	json.Unmarshal(<-bodies, &e)
+	if e.Event != "added" || e.InstanceID != 7 || e.Name != "#7 RTX 4090x1" {
+		t.Errorf("added event = %+v", e)
+	}
+
+	inst.State = StateHealthy
+	wh.StateChanged(inst, StateConnecting) // not notified
+	inst.State = StateUnhealthy
+	wh.StateChanged(inst, StateHealthy)
+	json.Unmarshal(<-bodies, &e)
+	if e.Event != "unhealthy" || e.State != "UNHEALTHY" || e.PreviousState != "HEALTHY" {
+		t.Errorf("unhealthy event = %+v", e)
+	}
+}
+
+func TestWebhookSlackFormat(t *testing.T) {
+	srv, bodies := webhookServer(t)
+	wh := NewWebhook(srv.URL, WebhookSlack)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wh.Run(ctx, nil)
+
+	wh.StateChanged(Instance{ID: 7, GPUName: "A100", NumGPUs: 2, State: StateHealthy}, StateUnhealthy)
+	var msg struct {
+		Text string `json:"text"`
+	}
+	json.Unmarshal(<-bodies, &msg)
+	if msg.Text != "vastproxy: instance #7 A100x2 is HEALTHY again" {
+		t.Errorf("text = %q", msg.Text)
+	}
+}
+
+func TestWebhookOutageEvents(t *testing.T) {
+	srv, bodies := webhookServer(t)
+	wh := NewWebhook(srv.URL, WebhookJSON)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wh.Run(ctx, nil)
+
+	since := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	wh.Outage(since)
+	body := <-bodies
+	var e WebhookEvent
+	json.Unmarshal(body, &e)
+	if e.Event != "outage" || !e.OutageSince.Equal(since) || strings.Contains(string(body), "instance_id") {
+		t.Errorf("outage event = %s", body)
+	}
+	wh.Recovered(since)
+	json.Unmarshal(<-bodies, &e)
+	if e.Event != "recovered" {
+		t.Errorf("recovered event = %+v", e)
+	}
+}
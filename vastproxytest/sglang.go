@@ -0,0 +1,136 @@
+package vastproxytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/vast"
+)
+
+// Reply is the completion a fake SGLang server returns.
+const Reply = "Hello from the fake SGLang server."
+
+// SGLang is a fake SGLang inference server. It lists one model, answers
+// chat and text completions with Reply (streamed word by word as
+// server-sent events when asked), reports its load at /get_server_info
+// and counts /abort_request calls.
+type SGLang struct {
+	*httptest.Server
+	Model string
+
+	requests atomic.Int64
+	aborts   atomic.Int64
+	running  atomic.Int64
+}
+
+// NewSGLang starts a fake server serving model. It is closed when the test
+// ends.
+func NewSGLang(tb testing.TB, model string) *SGLang {
+	tb.Helper()
+	s := &SGLang{Model: model}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// Requests returns the number of completion requests served.
+func (s *SGLang) Requests() int { return int(s.requests.Load()) }
+
+// Aborts returns the number of /abort_request calls.
+func (s *SGLang) Aborts() int { return int(s.aborts.Load()) }
+
+// SetRunning sets the running request count /get_server_info reports.
+func (s *SGLang) SetRunning(n int) { s.running.Store(int64(n)) }
+
+// Tunnel returns a mock tunnel to the server.
+func (s *SGLang) Tunnel() *Tunnel {
+	return &Tunnel{Addr: s.Listener.Addr().String(), Output: GPUOutput, Direct: true}
+}
+
+func (s *SGLang) serve(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v1/models":
+		writeJSON(w, map[string]any{
+			"object": "list",
+			"data":   []map[string]any{{"id": s.Model, "object": "model", "max_model_len": 4096}},
+		})
+	case "/get_server_info":
+		writeJSON(w, map[string]any{
+			"internal_states": []map[string]any{{"num_running_reqs": s.running.Load(), "num_waiting_reqs": 0}},
+		})
+	case "/abort_request":
+		s.aborts.Add(1)
+		writeJSON(w, map[string]bool{"success": true})
+	case "/v1/chat/completions":
+		s.complete(w, r, true)
+	case "/v1/completions":
+		s.complete(w, r, false)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// complete answers a completion request with Reply.
+func (s *SGLang) complete(w http.ResponseWriter, r *http.Request, chat bool) {
+	s.requests.Add(1)
+	var req struct {
+		Stream bool `json:"stream"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	words := strings.SplitAfter(Reply, " ")
+	usage := map[string]int{"prompt_tokens": 1, "completion_tokens": len(words), "total_tokens": 1 + len(words)}
+	choice := func(text string, delta bool) map[string]any {
+		switch {
+		case !chat:
+			return map[string]any{"index": 0, "text": text}
+		case delta:
+			return map[string]any{"index": 0, "delta": map[string]string{"content": text}}
+		default:
+			return map[string]any{"index": 0, "message": map[string]string{"role": "assistant", "content": text}, "finish_reason": "stop"}
+		}
+	}
+
+	if !req.Stream {
+		writeJSON(w, map[string]any{
+			"id":      "fake",
+			"model":   s.Model,
+			"choices": []any{choice(Reply, false)},
+			"usage":   usage,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+	send := func(v any) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	for _, word := range words {
+		send(map[string]any{"id": "fake", "model": s.Model, "choices": []any{choice(word, true)}})
+	}
+	send(map[string]any{"id": "fake", "model": s.Model, "choices": []any{}, "usage": usage})
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// NewBackend returns a healthy SGLang backend for instance id, already
+// connected to s.
+func NewBackend(id int, s *SGLang) *backend.Backend {
+	inst := &vast.Instance{ID: id, ModelName: s.Model, Engine: vast.EngineSGLang}
+	be := backend.NewBackend(inst, "", nil, "")
+	be.SetBaseURL(s.URL)
+	be.SetHealthy(true)
+	return be
+}
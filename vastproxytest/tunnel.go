@@ -0,0 +1,40 @@
+package vastproxytest
+
+import (
+	"sync/atomic"
+
+	"github.com/shutej/vastproxy/backend"
+)
+
+// Tunnel is a mock backend.Tunnel. LocalAddr returns Addr, typically a
+// fake server's listener address, and RunCommand returns Output and Err.
+type Tunnel struct {
+	Addr   string
+	Output string // e.g. nvidia-smi CSV; see GPUOutput
+	Err    error
+	Direct bool // report a direct SSH connection
+
+	closed atomic.Bool
+}
+
+var _ backend.Tunnel = (*Tunnel)(nil)
+
+func (t *Tunnel) LocalAddr() string                     { return t.Addr }
+func (t *Tunnel) RunCommand(cmd string) (string, error) { return t.Output, t.Err }
+func (t *Tunnel) Close()                                { t.closed.Store(true) }
+func (t *Tunnel) IsDirect() bool                        { return t.Direct }
+
+// Closed reports whether Close has been called.
+func (t *Tunnel) Closed() bool { return t.closed.Load() }
+
+// TunnelFactory returns a backend.TunnelFactory that always returns t and
+// err, for Backend.SetTunnelFactory.
+func TunnelFactory(t backend.Tunnel, err error) backend.TunnelFactory {
+	return func(publicIP string, directSSHPort int, sshHost string, sshPort int, keyPath string, remotePort int) (backend.Tunnel, error) {
+		return t, err
+	}
+}
+
+// GPUOutput is nvidia-smi CSV output for two GPUs at 50% and 75%
+// utilization, 60°C and 70°C.
+const GPUOutput = "50, 60\n75, 70\n"
@@ -0,0 +1,138 @@
+// Package vastproxytest provides fakes for testing code built on the
+// vastproxy packages: a fake vast.ai API server, a mock SSH tunnel and a
+// fake SGLang inference server. They run in-process and need no network
+// beyond loopback.
+package vastproxytest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shutej/vastproxy/vast"
+)
+
+// VastServer is a fake vast.ai API. It serves the instance list, applies
+// label updates and destroys instances, recording every call, so a
+// vast.Client pointed at it (see Client) behaves as against the real API.
+type VastServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	instances []vast.Instance
+	labels    []string // label values set, in order
+	destroyed []int    // destroyed instance IDs, in order
+}
+
+// NewVastServer starts a fake API listing instances. It is closed when the
+// test ends.
+func NewVastServer(tb testing.TB, instances ...vast.Instance) *VastServer {
+	tb.Helper()
+	s := &VastServer{instances: instances}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// Client returns a vast.Client using the fake API.
+func (s *VastServer) Client() *vast.Client {
+	c := vast.NewClient("test-key")
+	c.SetBaseURL(s.URL)
+	return c
+}
+
+// SetInstances replaces the instance list.
+func (s *VastServer) SetInstances(instances ...vast.Instance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.instances = instances
+}
+
+// Instances returns the current instance list.
+func (s *VastServer) Instances() []vast.Instance {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]vast.Instance(nil), s.instances...)
+}
+
+// Labels returns the labels set through the API, in order.
+func (s *VastServer) Labels() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.labels...)
+}
+
+// Destroyed returns the IDs of the instances destroyed through the API, in
+// order.
+func (s *VastServer) Destroyed() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.destroyed...)
+}
+
+func (s *VastServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path == "/instances/" && r.Method == http.MethodGet {
+		writeJSON(w, vast.InstancesResponse{Instances: s.instances})
+		return
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, "/instances/")
+	id, err := strconv.Atoi(strings.TrimSuffix(rest, "/"))
+	if !ok || err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	i := s.index(id)
+	if i < 0 {
+		http.Error(w, `{"success": false, "error": "no_such_instance"}`, http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var fields map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+			http.Error(w, `{"success": false}`, http.StatusBadRequest)
+			return
+		}
+		if label, ok := fields["label"]; ok {
+			s.instances[i].Label = label
+			s.labels = append(s.labels, label)
+		}
+		switch fields["state"] {
+		case "running":
+			s.instances[i].ActualStatus = "running"
+		case "stopped":
+			s.instances[i].ActualStatus = "exited"
+		}
+	case http.MethodDelete:
+		s.instances = append(s.instances[:i], s.instances[i+1:]...)
+		s.destroyed = append(s.destroyed, id)
+	default:
+		http.Error(w, `{"success": false}`, http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, map[string]bool{"success": true})
+}
+
+// index returns the position of instance id, or -1. Must be called with mu
+// held.
+func (s *VastServer) index(id int) int {
+	for i, inst := range s.instances {
+		if inst.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,100 @@
+package vastproxytest_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shutej/vastproxy/backend"
+	"github.com/shutej/vastproxy/proxy"
+	"github.com/shutej/vastproxy/vast"
+	"github.com/shutej/vastproxy/vastproxytest"
+)
+
+func TestVastServer(t *testing.T) {
+	srv := vastproxytest.NewVastServer(t, vast.Instance{ID: 1}, vast.Instance{ID: 2})
+	c := srv.Client()
+	ctx := context.Background()
+
+	insts, err := c.ListInstances(ctx)
+	if err != nil || len(insts) != 2 {
+		t.Fatalf("ListInstances() = %+v, %v", insts, err)
+	}
+	if err := c.SetLabel(ctx, 1, "proxied"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DestroyInstance(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DestroyInstance(ctx, 3); err == nil {
+		t.Error("expected error destroying unknown instance")
+	}
+	if got := srv.Labels(); !reflect.DeepEqual(got, []string{"proxied"}) {
+		t.Errorf("Labels() = %v", got)
+	}
+	if got := srv.Destroyed(); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("Destroyed() = %v", got)
+	}
+	if got := srv.Instances(); len(got) != 1 || got[0].Label != "proxied" {
+		t.Errorf("Instances() = %+v", got)
+	}
+}
+
+func TestSGLangBackendOverTunnel(t *testing.T) {
+	srv := vastproxytest.NewSGLang(t, "test-model")
+	be := backend.NewBackend(&vast.Instance{ID: 1, Engine: vast.EngineSGLang}, "", nil, "")
+	be.SetTunnelFactory(vastproxytest.TunnelFactory(srv.Tunnel(), nil))
+	if !be.EnsureSSH() {
+		t.Fatal("EnsureSSH() = false")
+	}
+	if err := be.CheckHealth(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if name, err := be.FetchModel(context.Background()); err != nil || name != "test-model" {
+		t.Errorf("FetchModel() = %q, %v", name, err)
+	}
+	if m, err := be.FetchGPUMetrics(); err != nil || len(m.GPUs) != 2 {
+		t.Errorf("FetchGPUMetrics() = %+v, %v", m, err)
+	}
+	if err := be.AbortAll(context.Background()); err != nil || srv.Aborts() != 1 {
+		t.Errorf("AbortAll() = %v with %d aborts", err, srv.Aborts())
+	}
+}
+
+func TestTunnelFactoryError(t *testing.T) {
+	be := backend.NewBackend(&vast.Instance{ID: 1}, "", nil, "")
+	be.SetTunnelFactory(vastproxytest.TunnelFactory(nil, errors.New("refused")))
+	if be.EnsureSSH() {
+		t.Error("EnsureSSH() = true, want false")
+	}
+}
+
+func TestSGLangThroughProxy(t *testing.T) {
+	srv := vastproxytest.NewSGLang(t, "test-model")
+	bal := proxy.NewBalancer()
+	bal.SetBackends([]*backend.Backend{vastproxytest.NewBackend(1, srv)})
+	handler := proxy.NewReverseProxy(bal, nil)
+
+	for _, stream := range []bool{false, true} {
+		body := `{"model":"test-model","messages":[]}`
+		if stream {
+			body = `{"model":"test-model","stream":true,"messages":[]}`
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+		out, _ := io.ReadAll(rec.Body)
+		if rec.Code != 200 || !strings.Contains(string(out), "SGLang") {
+			t.Errorf("stream=%v: status %d, body %s", stream, rec.Code, out)
+		}
+		if stream && !strings.HasSuffix(string(out), "data: [DONE]\n\n") {
+			t.Errorf("stream not terminated: %s", out)
+		}
+	}
+	if srv.Requests() != 2 {
+		t.Errorf("Requests() = %d, want 2", srv.Requests())
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"runtime/debug"
+
+	"github.com/shutej/vastproxy/proxy"
+)
+
+// Build metadata, set at link time:
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%FT%TZ)"
+//
+// Anything left unset is filled in from the module and VCS information the
+// Go toolchain embeds, so `go install ...@v1.2.3` builds still identify
+// themselves.
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// buildInfo returns this binary's version, commit and build date.
+func buildInfo() proxy.BuildInfo {
+	bi := proxy.BuildInfo{Version: version, Commit: commit, Date: date}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if bi.Version == "" && info.Main.Version != "(devel)" {
+			bi.Version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && bi.Commit == "":
+				bi.Commit = s.Value
+			case s.Key == "vcs.time" && bi.Date == "":
+				bi.Date = s.Value
+			case s.Key == "vcs.modified" && s.Value == "true":
+				bi.Dirty = true
+			}
+		}
+	}
+	if bi.Version == "" {
+		bi.Version = "dev"
+	}
+	return bi
+}